@@ -0,0 +1,281 @@
+package main
+
+import (
+	"78concepts.com/domicile/internal/database"
+	"78concepts.com/domicile/internal/export"
+	"78concepts.com/domicile/internal/importer"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"78concepts.com/domicile/internal/service"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: admin <command> [options]
+
+Commands:
+  create-user -username NAME [-scope read|control|admin]   create a user, the password is read from stdin
+  set-password -username NAME                              change a user's password, read from stdin
+  list-users                                               list users
+  create-api-key -name NAME [-scope read|control|admin]    create an api key and print it
+  list-api-keys                                            list api keys
+  export [-format csv|jsonl|parquet] [-measurement LIST] [-area IDS] [-device IEEE]
+         [-start RFC3339] [-end RFC3339] [-output FILE]      export report history, to stdout by default
+  import -mapping FILE [-format csv|lineprotocol] [-input FILE] [-measurement NAME]
+         [-batch SIZE] [-dry-run]                          import readings of a previous system, from stdin by default
+`
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	command := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	username := command.String("username", "", "username")
+	name := command.String("name", "", "api key name")
+	scope := command.String("scope", model.ScopeAdmin, "scope granted: read, control or admin")
+	format := command.String("format", export.FormatCsv, "export format: csv, jsonl or parquet")
+	measurements := command.String("measurement", "", "comma separated measurements to export, all by default")
+	areas := command.String("area", "", "comma separated area ids to export, all by default")
+	devices := command.String("device", "", "comma separated IEEE addresses of devices to export, all by default")
+	start := command.String("start", "", "start of the exported range as an RFC 3339 date")
+	end := command.String("end", "", "end of the exported range as an RFC 3339 date")
+	output := command.String("output", "", "file to export to, stdout by default")
+	input := command.String("input", "", "file to import, stdin by default")
+	mapping := command.String("mapping", "", "JSON file mapping the columns or tags of the import")
+	batch := command.Int("batch", service.DefaultImportBatchSize, "readings of a measurement loaded at once")
+	dryRun := command.Bool("dry-run", false, "validate the import and count duplicates without loading anything")
+	command.Parse(os.Args[2:])
+
+	ctx := context.Background()
+
+	dbPool := database.NewPGXPool()
+	defer dbPool.Close()
+
+	authService := service.NewAuthService(&repository.PostgresAuthRepository{Postgres: dbPool})
+
+	var err error
+
+	switch os.Args[1] {
+
+	case "create-user":
+		var user *model.User
+		user, err = authService.CreateUser(ctx, *username, readPassword(), *scope)
+		if err == nil {
+			fmt.Printf("Created %s user %s\n", user.Scope, user.Username)
+		}
+
+	case "set-password":
+		err = authService.SetPassword(ctx, *username, readPassword())
+		if err == nil {
+			fmt.Printf("Changed the password of %s\n", *username)
+		}
+
+	case "list-users":
+		var users []model.User
+		users, err = authService.GetUsers(ctx)
+		for _, user := range users {
+			fmt.Printf("%d\t%s\t%s\n", user.Id, user.Username, user.Scope)
+		}
+
+	case "create-api-key":
+		var key string
+		var apiKey *model.ApiKey
+		key, apiKey, err = authService.CreateApiKey(ctx, *name, *scope)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Created %s api key %s, it will not be shown again:\n", apiKey.Scope, apiKey.Name)
+			fmt.Println(key)
+		}
+
+	case "list-api-keys":
+		var keys []model.ApiKey
+		keys, err = authService.GetApiKeys(ctx)
+		for _, key := range keys {
+			fmt.Printf("%d\t%s\t%s\t%s\n", key.Id, key.Name, key.Prefix, key.Scope)
+		}
+
+	case "export":
+		var filter model.ReportFilter
+		filter, err = exportFilter(*measurements, *areas, *devices, *start, *end)
+		if err == nil {
+			// Exports publish and write nothing, so the reports service needs no event bus or ingest queue
+			reportsService := service.NewReportsService(&repository.PostgresReportsRepository{Postgres: dbPool}, nil, nil)
+			err = exportReports(ctx, reportsService, filter, *format, *output)
+		}
+
+	case "import":
+		importService := service.NewImportService(&repository.PostgresReportsRepository{Postgres: dbPool}, &repository.PostgresDevicesRepository{Postgres: dbPool}, &repository.PostgresAreasRepository{Postgres: dbPool})
+		err = importReports(ctx, importService, *mapping, *format, *input, *measurements, service.ImportOptions{BatchSize: *batch, DryRun: *dryRun})
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// readPassword takes the first line of stdin so the password can also be piped in
+func readPassword() string {
+
+	fmt.Fprint(os.Stderr, "Password: ")
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+func exportFilter(measurements string, areas string, devices string, start string, end string) (model.ReportFilter, error) {
+
+	filter := model.ReportFilter{Measurements: splitList(measurements), DeviceIds: splitList(devices)}
+
+	for _, id := range splitList(areas) {
+		areaId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid area id %s", id)
+		}
+		filter.AreaIds = append(filter.AreaIds, areaId)
+	}
+
+	for _, date := range []struct {
+		value string
+		target **time.Time
+	}{{start, &filter.StartDate}, {end, &filter.EndDate}} {
+		if date.value != "" {
+			parsed, err := time.Parse(time.RFC3339, date.value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid date %s, use RFC 3339", date.value)
+			}
+			*date.target = &parsed
+		}
+	}
+
+	return filter, nil
+}
+
+// exportReports writes the reports to the output file, removing it again when the export fails part way
+func exportReports(ctx context.Context, reportsService *service.ReportsService, filter model.ReportFilter, format string, output string) error {
+
+	var w io.Writer = os.Stdout
+
+	if output != "" {
+
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	buffer := bufio.NewWriter(w)
+
+	writer, err := export.NewReportWriter(buffer, format)
+
+	if err == nil {
+		err = reportsService.ExportReports(ctx, filter, writer)
+	}
+
+	if err == nil {
+		err = buffer.Flush()
+	}
+
+	if err != nil && output != "" {
+		os.Remove(output)
+	}
+
+	return err
+}
+
+// Only the first rejected readings are listed, a source in the wrong shape would otherwise bury the progress
+const maxRejectedShown = 100
+
+func importReports(ctx context.Context, importService *service.ImportService, mappingPath string, format string, input string, measurement string, options service.ImportOptions) error {
+
+	if mappingPath == "" {
+		return errors.New("-mapping is required")
+	}
+
+	mapping, err := importer.LoadMapping(mappingPath)
+
+	if err != nil {
+		return err
+	}
+
+	if measurement != "" {
+		mapping.DefaultMeasurement = measurement
+	}
+
+	var r io.Reader = os.Stdin
+
+	if input != "" {
+
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	reader, err := importer.NewReader(bufio.NewReaderSize(r, 1024*1024), format, mapping, service.MeasurementUnits)
+
+	if err != nil {
+		return err
+	}
+
+	rejected := 0
+
+	options.Rejected = func(line int, err error) {
+		if rejected++; rejected <= maxRejectedShown {
+			fmt.Fprintf(os.Stderr, "Skipped line %d: %s\n", line, err)
+		}
+	}
+
+	options.Progress = func(progress model.ImportProgress) {
+		fmt.Fprintf(os.Stderr, "Read %d, imported %d, duplicates %d, invalid %d\n", progress.Read, progress.Imported, progress.Duplicates, progress.Invalid)
+	}
+
+	progress, err := importService.ImportReports(ctx, reader, options)
+
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if options.DryRun {
+		verb = "Dry run, would import"
+	}
+
+	fmt.Printf("%s %d of %d readings, skipped %d duplicates and %d invalid\n", verb, progress.Imported, progress.Read, progress.Duplicates, progress.Invalid)
+
+	return nil
+}
+
+func splitList(value string) []string {
+
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -3,20 +3,19 @@ package main
 import (
 	"78concepts.com/domicile/internal/api"
 	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/config"
 	"78concepts.com/domicile/internal/database"
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/graph"
 	"78concepts.com/domicile/internal/model"
 	"78concepts.com/domicile/internal/repository"
 	"78concepts.com/domicile/internal/service"
+	"78concepts.com/domicile/internal/web"
 	"context"
 	"encoding/json"
-	"fmt"
-	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
 )
 
 func NewServer(
@@ -28,6 +27,23 @@ func NewServer(
 	areasService *service.AreasService,
 	devicesApi *api.DevicesApi,
 	reportsApi *api.ReportsApi,
+	automationsApi *api.AutomationsApi,
+	schedulesApi *api.SchedulesApi,
+	scenesApi *api.ScenesApi,
+	alertsApi *api.AlertsApi,
+	maintenanceApi *api.MaintenanceApi,
+	batteryApi *api.BatteryApi,
+	bridgeApi *api.BridgeApi,
+	networkApi *api.NetworkApi,
+	otaApi *api.OtaApi,
+	auditApi *api.AuditApi,
+	authApi *api.AuthApi,
+	accessApi *api.AccessApi,
+	v1Api *api.V1Api,
+	graphqlApi *api.GraphqlApi,
+	graphsApi *api.GraphsApi,
+	exportApi *api.ExportApi,
+	web *web.Web,
 ) *Server {
 	return &Server{
 		ctx: ctx,
@@ -37,7 +53,24 @@ func NewServer(
 		groupsService: groupsService,
 		areasService: areasService,
 		devicesApi: devicesApi,
-		reportsApi: reportsApi}
+		reportsApi: reportsApi,
+		automationsApi: automationsApi,
+		schedulesApi: schedulesApi,
+		scenesApi: scenesApi,
+		alertsApi: alertsApi,
+		maintenanceApi: maintenanceApi,
+		batteryApi: batteryApi,
+		bridgeApi: bridgeApi,
+		networkApi: networkApi,
+		otaApi: otaApi,
+		auditApi: auditApi,
+		authApi: authApi,
+		accessApi: accessApi,
+		v1Api: v1Api,
+		graphqlApi: graphqlApi,
+		graphsApi: graphsApi,
+		exportApi: exportApi,
+		web: web}
 }
 
 type Server struct {
@@ -49,73 +82,23 @@ type Server struct {
 	areasService *service.AreasService
 	devicesApi *api.DevicesApi
 	reportsApi *api.ReportsApi
-}
-
-func (s *Server) Index(w http.ResponseWriter, r *http.Request){
-
-	log.Println("Endpoint hit: /")
-
-	html :=
-		`<html>
-			<head>
-				<script>
-					function on(groupId){
-						window.location.replace('/groupOn?group=' + groupId);
-					}
-					function off(groupId){
-						window.location.replace('/groupOff?group=' + groupId);
-					}
-				</script>
-			</head>
-			<body>
-				<h1>Welcome to the machine</h1>
-			`
-	fmt.Fprintf(w, html)
-
-	areas, err := s.areasService.GetAreas(s.ctx)
-
-	if err != nil {
-		log.Println("Unable to list areas", err)
-	}
-
-	for _, area := range areas {
-		fmt.Fprintf(w, "<strong>" + area.Name + "</strong><br /><br />")
-		fmt.Fprintf(w, "<a href=\"reports/?area=%s&type=temperature\">Temperature reports</a> [<a href=\"graphs/?area=%s&type=temperature\">Graph</a>]<br />", area.Uuid.Get(), area.Uuid.Get())
-		fmt.Fprintf(w, "<a href=\"reports/?area=%s&type=humidity\">Humidity reports</a> [<a href=\"graphs/?area=%s&type=humidity\">Graph</a>]<br />", area.Uuid.Get(), area.Uuid.Get())
-		fmt.Fprintf(w, "<a href=\"reports/?area=%s&type=pressure\">Pressure reports</a> [<a href=\"graphs/?area=%s&type=pressure\">Graph</a>]<br />", area.Uuid.Get(), area.Uuid.Get())
-		fmt.Fprintf(w, "<a href=\"reports/?area=%s&type=illuminance\">Illuminance reports</a> [<a href=\"graphs/?area=%s&type=illuminance\">Graph</a>]<br />", area.Uuid.Get(), area.Uuid.Get())
-		fmt.Fprintf(w, "<br /><br />")
-	}
-
-	//fmt.Fprintf(w, "<br /><br />")
-	groups, err := s.groupsService.GetGroups(s.ctx)
-
-	fmt.Fprintf(w, "<strong>Groups</strong><br /><br />")
-
-	for _, group := range groups {
-		fmt.Fprintf(w, "%s", group.FriendlyName)
-
-		if len(group.Members) > 0 {
-			fmt.Fprintf(w, " -- <button onClick=\"on(%d)\">Toggle on</button>  -- <button onClick=\"off(%d)\">Toggle off</button><br />", group.Id, group.Id)
-		}
-
-		fmt.Fprintf(w, "<br /><br />")
-
-		if len(group.Members) == 0 {
-			fmt.Fprintf(w, "<em>No devices in group</em><br />")
-		}
-
-		for _, member := range group.Members {
-			log.Println(member)
-			fmt.Fprintf(w, "%s<br />", member.FriendlyName)
-			//TODO Get status
-			// If the something
-		}
-
-		fmt.Fprintf(w, "<br /><br />")
-	}
-
-	fmt.Fprintf(w, "</body></html>")
+	automationsApi *api.AutomationsApi
+	schedulesApi *api.SchedulesApi
+	scenesApi *api.ScenesApi
+	alertsApi *api.AlertsApi
+	maintenanceApi *api.MaintenanceApi
+	batteryApi *api.BatteryApi
+	bridgeApi *api.BridgeApi
+	networkApi *api.NetworkApi
+	otaApi *api.OtaApi
+	auditApi *api.AuditApi
+	authApi *api.AuthApi
+	accessApi *api.AccessApi
+	v1Api *api.V1Api
+	graphqlApi *api.GraphqlApi
+	graphsApi *api.GraphsApi
+	exportApi *api.ExportApi
+	web *web.Web
 }
 
 func (s *Server) ListAllGroups(w http.ResponseWriter, r *http.Request) {
@@ -129,163 +112,132 @@ func (s *Server) ListAllGroups(w http.ResponseWriter, r *http.Request) {
 	groups, err := s.groupsService.GetGroups(s.ctx)
 
 	if err != nil {
-		//middleware.NotFound(w, "group", r.URL.Query().Get("group"))
-		return
-	}
-
-	var response string
-
-	json, _ := json.Marshal(groups)
-	response = string(json)
-
-	fmt.Fprintf(w, string(response))
-
-}
-
-func (s *Server) GraphReports(w http.ResponseWriter, r *http.Request) {
-
-	log.Println("Endpoint hit: /graphs?area=" + r.URL.Query().Get("area") + "&type=" + r.URL.Query().Get("type"))
-
-	//if !middleware.ValidateRequiredQueryParam(w, r, "group") || !middleware.ValidateValidSetQueryParam(w, r, "type", []string{devices.TemperatureReport, devices.HumidityReport, devices.PressureReport, devices.IlluminanceReport}) {
-	//	return
-	//}
-
-	uuid, _ := uuid.FromString(r.URL.Query().Get("area"))
-	area, err := s.areasService.GetArea(s.ctx, uuid)
-
-	loc, err := time.LoadLocation("Australia/Melbourne")
-	now := time.Now().In(loc)
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
-
-	if area == nil || err != nil {
-		//middleware.NotFound(w, "group", r.URL.Query().Get("group"))
+		http.Error(w, "Unable to list groups", http.StatusInternalServerError)
 		return
 	}
 
-	data, _ := s.reportsService.GetTemperatureReports(s.ctx, area.Id, startOfDay.In(time.UTC), now.In(time.UTC))
-
-	var cleanedData []model.TemperatureReport
-	var previousDate time.Time
-	for _, report := range data {
-		if report.Date.Sub(previousDate).Seconds() >= 60 {
-			cleanedData = append(cleanedData, report)
+	visible := make([]model.Group, 0, len(groups))
+	for _, group := range groups {
+		if s.groupsService.CheckGroupAccess(api.CommandContext(s.ctx, r), &group, model.RoleView) == nil {
+			visible = append(visible, group)
 		}
-		previousDate = report.Date
-	}
-
-	var values []string
-	for _, report := range cleanedData {
-		s := fmt.Sprintf("%v", report.Value)
-		values = append(values, s)
 	}
+	groups = visible
 
-	location, err := time.LoadLocation("Australia/Melbourne")
-
-	if err != nil {
-		panic(err)
-	}
-
-	var dates []string
-	for _, report := range cleanedData {
-		dates = append(dates, "'" + report.Date.In(location).Format("Jan 2 15:04:05") + "'")
-	}
-
-
-	script :=
-		`<html>
-			<head>
-				<script src='https://cdn.jsdelivr.net/npm/chart.js@3.2.1/dist/chart.min.js'></script>
-			</head>
-			<body>
-				<div class="chart-container" style="position: relative; max-width:1024px; margin: auto; ">
-					<canvas id="myChart" width="1024" height="768"></canvas>
-				</div>
-				<script>
-					var ctx = document.getElementById('myChart').getContext('2d');
-					var myChart = new Chart(ctx, {
-						type: 'line',
-						data: {
-							labels: [` + strings.Join(dates, ", ") + `],
-							datasets: [{
-								label: '` + area.Name + " - " + r.URL.Query().Get("type") + `',
-							  	tension: 0.4,
-								data: [` + strings.Join(values, ", ") + `],
-								borderColor: 'rgb(75, 192, 255)',
-								borderWidth: 4
-							}]
-						},
-						options: {
-							responsive: false,
-							scales: {
-								y: {
-									suggestedMin: 10,
-									suggestedMax: 32
-								}
-							}
-						}
-					});
-				</script>
-			</body>
-		</html>`
+	data, _ := json.Marshal(groups)
 
-	fmt.Fprintf(w, script);
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
 }
 
-func (s *Server) TurnGroupOn(w http.ResponseWriter, r *http.Request) {
-
-	log.Println("Endpoint hit: /groupOn?group=" + r.URL.Query().Get("group"))
-
-	//if !middleware.ValidateRequiredQueryParam(w, r, "group") || !middleware.ValidateValidSetQueryParam(w, r, "type", []string{devices.TemperatureReport, devices.HumidityReport, devices.PressureReport, devices.IlluminanceReport}) {
-	//	return
-	//}
-
-	id, _ := strconv.ParseUint(r.URL.Query().Get("group"), 10, 64)
-	group, err := s.groupsService.GetGroup(s.ctx, id)
-
-	if group == nil || err != nil {
-		//middleware.NotFound(w, "group", r.URL.Query().Get("group"))
-		return
-	}
-
-	s.groupsService.TurnGroupOn(s.client, group)
-
-	http.Redirect(w, r, "/", 302)
-}
-
-func (s *Server) TurnGroupOff(w http.ResponseWriter, r *http.Request) {
-
-	log.Println("Endpoint hit: /groupOff?group=" + r.URL.Query().Get("group"))
-
-	//if !middleware.ValidateRequiredQueryParam(w, r, "group") || !middleware.ValidateValidSetQueryParam(w, r, "type", []string{devices.TemperatureReport, devices.HumidityReport, devices.PressureReport, devices.IlluminanceReport}) {
-	//	return
-	//}
-
-	id, _ := strconv.ParseUint(r.URL.Query().Get("group"), 10, 64)
-	group, err := s.groupsService.GetGroup(s.ctx, id)
-
-	if group == nil || err != nil {
-		//middleware.NotFound(w, "group", r.URL.Query().Get("group"))
-		return
-	}
-
-	s.groupsService.TurnGroupOff(s.client, group)
-
-	http.Redirect(w, r, "/", 302)
+func (s *Server) HandleRequests() {
+	log.Fatal(serve(config.GetConfig().Http, s.Router()))
 }
 
-
-func (s *Server) HandleRequests() {
+// Router registers every route of the api, each of which must also be described in the OpenAPI document
+func (s *Server) Router() *mux.Router {
 
 	router := mux.NewRouter().StrictSlash(true)
-	router.HandleFunc("/", s.Index)
-	router.HandleFunc("/reports", s.reportsApi.ListReports)
-	router.HandleFunc("/devices/state", s.devicesApi.GetState)
-	router.HandleFunc("/graphs", s.GraphReports)
-	router.HandleFunc("/groups", s.ListAllGroups)
-	router.HandleFunc("/groupOn", s.TurnGroupOn)
-	router.HandleFunc("/groupOff", s.TurnGroupOff)
-
-	log.Fatal(http.ListenAndServe(":8080", router))
+	router.HandleFunc("/login", s.authApi.LoginPage).Methods("GET")
+	router.HandleFunc("/login", s.authApi.Login).Methods("POST")
+	router.HandleFunc("/logout", s.authApi.Logout).Methods("POST")
+	router.HandleFunc("/me", s.authApi.Require(model.ScopeRead, s.authApi.GetMe)).Methods("GET")
+	router.HandleFunc("/me/areas", s.authApi.Require(model.ScopeRead, s.accessApi.GetMyAccess)).Methods("GET")
+	router.HandleFunc("/users", s.authApi.Require(model.ScopeAdmin, s.authApi.ListUsers)).Methods("GET")
+	router.HandleFunc("/users", s.authApi.Require(model.ScopeAdmin, s.authApi.CreateUser)).Methods("POST")
+	router.HandleFunc("/users/{id:[0-9]+}", s.authApi.Require(model.ScopeAdmin, s.authApi.DeleteUser)).Methods("DELETE")
+	router.HandleFunc("/users/{id:[0-9]+}/areas", s.authApi.Require(model.ScopeAdmin, s.accessApi.ListAreaRoles)).Methods("GET")
+	router.HandleFunc("/users/{id:[0-9]+}/areas/{area:[0-9]+}", s.authApi.Require(model.ScopeAdmin, s.accessApi.SetAreaRole)).Methods("PUT")
+	router.HandleFunc("/users/{id:[0-9]+}/areas/{area:[0-9]+}", s.authApi.Require(model.ScopeAdmin, s.accessApi.DeleteAreaRole)).Methods("DELETE")
+	router.HandleFunc("/areas/{area:[0-9]+}/parent", s.authApi.Require(model.ScopeAdmin, s.accessApi.SetAreaParent)).Methods("PUT")
+	router.HandleFunc("/apikeys", s.authApi.Require(model.ScopeAdmin, s.authApi.ListApiKeys)).Methods("GET")
+	router.HandleFunc("/apikeys", s.authApi.Require(model.ScopeAdmin, s.authApi.CreateApiKey)).Methods("POST")
+	router.HandleFunc("/apikeys/{id:[0-9]+}", s.authApi.Require(model.ScopeAdmin, s.authApi.DeleteApiKey)).Methods("DELETE")
+	router.HandleFunc("/", s.authApi.Require(model.ScopeRead, s.web.Dashboard)).Methods("GET")
+	router.HandleFunc("/readings", s.authApi.Require(model.ScopeRead, s.web.Readings)).Methods("GET")
+	router.HandleFunc("/devices", s.authApi.Require(model.ScopeRead, s.web.Devices)).Methods("GET")
+	router.HandleFunc("/devices/{ieee}/state", s.authApi.Require(model.ScopeControl, s.web.SetDeviceState)).Methods("POST")
+	router.HandleFunc("/groups/{id:[0-9]+}/state", s.authApi.Require(model.ScopeControl, s.web.SetGroupState)).Methods("POST")
+	router.HandleFunc("/graphs/{area:[0-9]+}/{measurement:[a-z]+}", s.authApi.Require(model.ScopeRead, s.web.Graph)).Methods("GET")
+	router.HandleFunc("/graphs/{area:[0-9]+}/{measurement:[a-z]+}.svg", s.authApi.Require(model.ScopeRead, s.graphsApi.GetReportGraph)).Methods("GET")
+	router.HandleFunc("/graphs/{area:[0-9]+}/{measurement:[a-z]+}.png", s.authApi.Require(model.ScopeRead, s.graphsApi.GetReportGraph)).Methods("GET")
+	router.HandleFunc("/export/reports", s.authApi.Require(model.ScopeRead, s.exportApi.ExportReports)).Methods("GET")
+	router.HandleFunc("/static/{file}", web.Static).Methods("GET")
+	router.HandleFunc("/reports", s.authApi.Require(model.ScopeRead, s.reportsApi.ListReports))
+	router.HandleFunc("/devices/state", s.authApi.Require(model.ScopeRead, s.devicesApi.GetState))
+	router.HandleFunc("/devices/{ieee}/area", s.authApi.Require(model.ScopeControl, s.devicesApi.SetArea)).Methods("PUT")
+	router.HandleFunc("/graphs", s.authApi.Require(model.ScopeRead, s.web.LegacyGraph))
+	router.HandleFunc("/groups", s.authApi.Require(model.ScopeRead, s.ListAllGroups))
+	router.HandleFunc("/automations", s.authApi.Require(model.ScopeRead, s.automationsApi.ListAutomations)).Methods("GET")
+	router.HandleFunc("/automations", s.authApi.Require(model.ScopeControl, s.automationsApi.CreateAutomation)).Methods("POST")
+	router.HandleFunc("/automations/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.automationsApi.GetAutomation)).Methods("GET")
+	router.HandleFunc("/automations/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.automationsApi.UpdateAutomation)).Methods("PUT")
+	router.HandleFunc("/automations/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.automationsApi.DeleteAutomation)).Methods("DELETE")
+	router.HandleFunc("/automations/{id:[0-9]+}/logs", s.authApi.Require(model.ScopeRead, s.automationsApi.ListAutomationLogs)).Methods("GET")
+	router.HandleFunc("/schedules", s.authApi.Require(model.ScopeRead, s.schedulesApi.ListSchedules)).Methods("GET")
+	router.HandleFunc("/schedules", s.authApi.Require(model.ScopeControl, s.schedulesApi.CreateSchedule)).Methods("POST")
+	router.HandleFunc("/schedules/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.schedulesApi.GetSchedule)).Methods("GET")
+	router.HandleFunc("/schedules/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.schedulesApi.UpdateSchedule)).Methods("PUT")
+	router.HandleFunc("/schedules/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.schedulesApi.DeleteSchedule)).Methods("DELETE")
+	router.HandleFunc("/scenes", s.authApi.Require(model.ScopeRead, s.scenesApi.ListScenes)).Methods("GET")
+	router.HandleFunc("/scenes", s.authApi.Require(model.ScopeControl, s.scenesApi.CaptureScene)).Methods("POST")
+	router.HandleFunc("/scenes/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.scenesApi.GetScene)).Methods("GET")
+	router.HandleFunc("/scenes/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.scenesApi.DeleteScene)).Methods("DELETE")
+	router.HandleFunc("/scenes/{id:[0-9]+}/recall", s.authApi.Require(model.ScopeControl, s.scenesApi.RecallScene)).Methods("POST")
+	router.HandleFunc("/alerts", s.authApi.Require(model.ScopeRead, s.alertsApi.ListAlerts)).Methods("GET")
+	router.HandleFunc("/alerts/rules", s.authApi.Require(model.ScopeRead, s.alertsApi.ListAlertRules)).Methods("GET")
+	router.HandleFunc("/alerts/rules", s.authApi.Require(model.ScopeControl, s.alertsApi.CreateAlertRule)).Methods("POST")
+	router.HandleFunc("/alerts/rules/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.alertsApi.GetAlertRule)).Methods("GET")
+	router.HandleFunc("/alerts/rules/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.alertsApi.UpdateAlertRule)).Methods("PUT")
+	router.HandleFunc("/alerts/rules/{id:[0-9]+}", s.authApi.Require(model.ScopeControl, s.alertsApi.DeleteAlertRule)).Methods("DELETE")
+	router.HandleFunc("/notifiers", s.authApi.Require(model.ScopeRead, s.alertsApi.ListNotifiers)).Methods("GET")
+	router.HandleFunc("/notifiers/{name}/test", s.authApi.Require(model.ScopeControl, s.alertsApi.TestNotifier)).Methods("POST")
+	router.HandleFunc("/maintenance", s.authApi.Require(model.ScopeRead, s.maintenanceApi.GetMaintenance)).Methods("GET")
+	router.HandleFunc("/maintenance/digest", s.authApi.Require(model.ScopeControl, s.maintenanceApi.SendDigest)).Methods("POST")
+	router.HandleFunc("/devices/{ieee}/battery", s.authApi.Require(model.ScopeRead, s.batteryApi.GetBatteryHistory)).Methods("GET")
+	router.HandleFunc("/bridge", s.authApi.Require(model.ScopeRead, s.bridgeApi.GetBridge)).Methods("GET")
+	router.HandleFunc("/audit", s.authApi.Require(model.ScopeAdmin, s.auditApi.ListAuditEntries)).Methods("GET")
+	router.HandleFunc("/ota", s.authApi.Require(model.ScopeRead, s.otaApi.ListFirmware)).Methods("GET")
+	router.HandleFunc("/ota/check", s.authApi.Require(model.ScopeAdmin, s.otaApi.StartCheckAll)).Methods("POST")
+	router.HandleFunc("/ota/check/{id:[0-9]+}", s.authApi.Require(model.ScopeAdmin, s.otaApi.GetCheckJob)).Methods("GET")
+	router.HandleFunc("/devices/{ieee}/ota/check", s.authApi.Require(model.ScopeAdmin, s.otaApi.CheckDevice)).Methods("POST")
+	router.HandleFunc("/devices/{ieee}/ota/update", s.authApi.Require(model.ScopeAdmin, s.otaApi.StartUpdate)).Methods("POST")
+	router.HandleFunc("/devices/{ieee}/firmware", s.authApi.Require(model.ScopeRead, s.otaApi.ListFirmwareHistory)).Methods("GET")
+	router.HandleFunc("/network", s.authApi.Require(model.ScopeRead, s.networkApi.GetNetworkMap)).Methods("GET")
+	router.HandleFunc("/network.svg", s.authApi.Require(model.ScopeRead, s.networkApi.GetNetworkMap)).Methods("GET")
+	router.HandleFunc("/network/snapshots", s.authApi.Require(model.ScopeRead, s.networkApi.ListNetworkMapSnapshots)).Methods("GET")
+	router.HandleFunc("/network/snapshots/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.networkApi.GetNetworkMapSnapshot)).Methods("GET")
+	router.HandleFunc("/network/snapshots/{id:[0-9]+}.svg", s.authApi.Require(model.ScopeRead, s.networkApi.GetNetworkMapSnapshot)).Methods("GET")
+	router.HandleFunc("/bridge/events", s.authApi.Require(model.ScopeRead, s.bridgeApi.ListBridgeEvents)).Methods("GET")
+	router.HandleFunc("/bridge/permit_join", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.PermitJoin)).Methods("POST")
+	router.HandleFunc("/bridge/devices/{id}", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.RemoveDevice)).Methods("DELETE")
+	router.HandleFunc("/bridge/devices/{id}/rename", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.RenameDevice)).Methods("POST")
+	router.HandleFunc("/bridge/devices/{id}/options", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.SetDeviceOptions)).Methods("PUT")
+	router.HandleFunc("/bridge/devices/{id}/configure", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.ConfigureDevice)).Methods("POST")
+	router.HandleFunc("/bridge/groups", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.AddGroup)).Methods("POST")
+	router.HandleFunc("/bridge/groups/{id}", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.RemoveGroup)).Methods("DELETE")
+	router.HandleFunc("/bridge/groups/{id}/members", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.AddGroupMember)).Methods("POST")
+	router.HandleFunc("/bridge/groups/{id}/members/{device}", s.authApi.Require(model.ScopeAdmin, s.bridgeApi.RemoveGroupMember)).Methods("DELETE")
+
+	router.HandleFunc("/graphql", s.authApi.Require(model.ScopeRead, s.graphqlApi.Query)).Methods("POST")
+
+	v1 := router.PathPrefix(api.V1Prefix).Subrouter()
+	v1.NotFoundHandler = http.HandlerFunc(api.V1NotFound)
+	v1.MethodNotAllowedHandler = http.HandlerFunc(api.V1MethodNotAllowed)
+	v1.HandleFunc("/openapi.json", api.OpenApiDocument).Methods("GET")
+	v1.HandleFunc("/devices", s.authApi.Require(model.ScopeRead, s.v1Api.ListDevices)).Methods("GET")
+	v1.HandleFunc("/devices/{ieee}", s.authApi.Require(model.ScopeRead, s.v1Api.GetDevice)).Methods("GET")
+	v1.HandleFunc("/devices/{ieee}/area", s.authApi.Require(model.ScopeControl, s.v1Api.SetDeviceArea)).Methods("PUT")
+	v1.HandleFunc("/devices/{ieee}/commands", s.authApi.Require(model.ScopeControl, s.v1Api.SendDeviceCommand)).Methods("POST")
+	v1.HandleFunc("/groups", s.authApi.Require(model.ScopeRead, s.v1Api.ListGroups)).Methods("GET")
+	v1.HandleFunc("/groups/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.v1Api.GetGroup)).Methods("GET")
+	v1.HandleFunc("/groups/{id:[0-9]+}/commands", s.authApi.Require(model.ScopeControl, s.v1Api.SendGroupCommand)).Methods("POST")
+	v1.HandleFunc("/areas", s.authApi.Require(model.ScopeRead, s.v1Api.ListAreas)).Methods("GET")
+	v1.HandleFunc("/areas/{id:[0-9]+}", s.authApi.Require(model.ScopeRead, s.v1Api.GetArea)).Methods("GET")
+	v1.HandleFunc("/areas/{id:[0-9]+}/reports/{measurement}", s.authApi.Require(model.ScopeRead, s.v1Api.ListAreaReports)).Methods("GET")
+	v1.HandleFunc("/commands", s.authApi.Require(model.ScopeAdmin, s.v1Api.ListCommands)).Methods("GET")
+
+	return router
 }
 
 func main() {
@@ -297,15 +249,52 @@ func main() {
 
 	var client = broker.NewMqttClient(ctx, ctxCancel, "logger")
 
-	reportsService:= service.NewReportsService(&repository.PostgresReportsRepository{Postgres: dbPool})
-	devicesService:= service.NewDevicesService(reportsService, &repository.PostgresDevicesRepository{Postgres: dbPool})
-	groupsService:= service.NewGroupsService(&repository.PostgresGroupsRepository{Postgres: dbPool})
+	eventBus:= events.NewMqttEventBus(client, "api")
+
+	auditService:= service.NewAuditService(&repository.PostgresAuditRepository{Postgres: dbPool})
+	reportsService:= service.NewReportsService(&repository.PostgresReportsRepository{Postgres: dbPool}, eventBus, nil)
+	devicesService:= service.NewDevicesService(reportsService, auditService, &repository.PostgresDevicesRepository{Postgres: dbPool}, eventBus)
+	groupsService:= service.NewGroupsService(auditService, &repository.PostgresGroupsRepository{Postgres: dbPool}, eventBus)
 	areasService:= service.NewAreasService(&repository.PostgresAreasRepository{Postgres: dbPool})
+	accessService:= service.NewAccessService(&repository.PostgresAccessRepository{Postgres: dbPool}, &repository.PostgresAreasRepository{Postgres: dbPool}, &repository.PostgresAuthRepository{Postgres: dbPool})
+	scenesService:= service.NewScenesService(&repository.PostgresScenesRepository{Postgres: dbPool}, devicesService, groupsService)
+	automationsService:= service.NewAutomationsService(&repository.PostgresAutomationsRepository{Postgres: dbPool}, devicesService, groupsService, reportsService, scenesService, accessService, eventBus)
+	schedulesService:= service.NewSchedulesService(&repository.PostgresSchedulesRepository{Postgres: dbPool}, devicesService, groupsService, accessService, eventBus)
+	notificationsService:= service.NewNotificationsService(eventBus)
+	alertsService:= service.NewAlertsService(&repository.PostgresAlertsRepository{Postgres: dbPool}, devicesService, notificationsService, eventBus)
+	maintenanceService:= service.NewMaintenanceService(devicesService, reportsService, notificationsService)
+	batteryService:= service.NewBatteryService(devicesService, reportsService)
+	bridgeService:= service.NewBridgeService(&repository.PostgresBridgeRepository{Postgres: dbPool}, devicesService, auditService, eventBus)
+
+	networkService:= service.NewNetworkService(&repository.PostgresNetworkRepository{Postgres: dbPool}, bridgeService, devicesService, areasService)
+	otaService:= service.NewOtaService(bridgeService, devicesService)
+
+	bridgeService.ManageBridge(client)
+	devicesService.TrackDeviceStates()
 
 	devicesApi := api.NewDevicesApi(ctx, client, devicesService)
 	reportsApi := api.NewReportsApi(ctx, reportsService, areasService)
-
-	server:= NewServer(ctx, client, devicesService, reportsService, groupsService, areasService, devicesApi, reportsApi)
+	automationsApi := api.NewAutomationsApi(ctx, automationsService)
+	schedulesApi := api.NewSchedulesApi(ctx, schedulesService)
+	scenesApi := api.NewScenesApi(ctx, client, scenesService)
+	alertsApi := api.NewAlertsApi(ctx, alertsService, notificationsService)
+	maintenanceApi := api.NewMaintenanceApi(ctx, maintenanceService)
+	batteryApi := api.NewBatteryApi(ctx, batteryService)
+	bridgeApi := api.NewBridgeApi(ctx, bridgeService)
+	networkApi := api.NewNetworkApi(ctx, networkService)
+	otaApi := api.NewOtaApi(ctx, otaService, devicesService)
+	auditApi := api.NewAuditApi(ctx, auditService)
+	authApi := api.NewAuthApi(ctx, service.NewAuthService(&repository.PostgresAuthRepository{Postgres: dbPool}), accessService)
+
+	accessApi := api.NewAccessApi(ctx, accessService, areasService)
+	v1Api := api.NewV1Api(ctx, client, devicesService, groupsService, areasService, reportsService, auditService)
+	graphsApi := api.NewGraphsApi(ctx, service.NewChartsService(reportsService, devicesService, areasService))
+	graphqlApi := api.NewGraphqlApi(ctx, graph.NewGraph(client, devicesService, groupsService, areasService, reportsService))
+	exportApi := api.NewExportApi(ctx, reportsService)
+
+	dashboard := web.NewWeb(ctx, client, devicesService, groupsService, areasService, reportsService)
+
+	server:= NewServer(ctx, client, devicesService, reportsService, groupsService, areasService, devicesApi, reportsApi, automationsApi, schedulesApi, scenesApi, alertsApi, maintenanceApi, batteryApi, bridgeApi, networkApi, otaApi, auditApi, authApi, accessApi, v1Api, graphqlApi, graphsApi, exportApi, dashboard)
 
 	server.HandleRequests()
 }
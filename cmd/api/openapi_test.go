@@ -0,0 +1,144 @@
+package main
+
+import (
+	"78concepts.com/domicile/internal/api"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Route variables with a pattern, e.g. {id:[0-9]+}, are written without it in OpenAPI paths
+var routeVariable = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+type openApiOperation struct {
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+}
+
+type openApiDocument struct {
+	Paths map[string]map[string]openApiOperation `json:"paths"`
+}
+
+// TestOpenApiMatchesRouter checks that every route has an operation in the OpenAPI document and every operation
+// has a route, with the same path parameters
+func TestOpenApiMatchesRouter(t *testing.T) {
+
+	router := (&Server{}).Router()
+	document := fetchOpenApi(t, router)
+
+	routes := map[string]bool{}
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+
+		// Path prefixes of subrouters have no handler of their own
+		if route.GetHandler() == nil {
+			return nil
+		}
+
+		template, err := route.GetPathTemplate()
+
+		if err != nil {
+			return err
+		}
+
+		path := routeVariable.ReplaceAllString(template, "{$1}")
+
+		// Routes without a method serve GET requests from links and forms
+		methods, err := route.GetMethods()
+
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+
+		for _, method := range methods {
+			routes[strings.ToLower(method)+" "+path] = true
+
+			operation, ok := document.Paths[path][strings.ToLower(method)]
+
+			if !ok {
+				t.Errorf("%s %s is routed but not in the OpenAPI document", method, path)
+				continue
+			}
+
+			checkPathParameters(t, method, path, operation)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var missing []string
+
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if !routes[method+" "+path] {
+				missing = append(missing, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	sort.Strings(missing)
+
+	for _, operation := range missing {
+		t.Errorf("%s is in the OpenAPI document but not routed", operation)
+	}
+}
+
+func fetchOpenApi(t *testing.T, router *mux.Router) openApiDocument {
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, api.V1Prefix+"/openapi.json", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("GET %s/openapi.json returned %d", api.V1Prefix, response.Code)
+	}
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("GET %s/openapi.json returned Content-Type %q", api.V1Prefix, contentType)
+	}
+
+	var document openApiDocument
+
+	if err := json.Unmarshal(response.Body.Bytes(), &document); err != nil {
+		t.Fatalf("The OpenAPI document is not valid JSON: %v", err)
+	}
+
+	return document
+}
+
+func checkPathParameters(t *testing.T, method string, path string, operation openApiOperation) {
+
+	expected := map[string]bool{}
+
+	for _, match := range routeVariable.FindAllStringSubmatch(path, -1) {
+		expected[match[1]] = true
+	}
+
+	for _, parameter := range operation.Parameters {
+
+		if parameter.In != "path" {
+			continue
+		}
+
+		if !expected[parameter.Name] {
+			t.Errorf("%s %s documents path parameter %s which is not in the path", method, path, parameter.Name)
+		}
+
+		delete(expected, parameter.Name)
+	}
+
+	for name := range expected {
+		t.Errorf("%s %s does not document path parameter %s", method, path, name)
+	}
+}
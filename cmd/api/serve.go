@@ -0,0 +1,153 @@
+package main
+
+import (
+	"78concepts.com/domicile/internal/api"
+	"78concepts.com/domicile/internal/certs"
+	"78concepts.com/domicile/internal/config"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	defaultAddress = ":8080"
+	defaultCertDirectory = "certs"
+)
+
+// serve runs the api on the configured plain and TLS listeners, returning when either of them fails
+func serve(configuration config.HttpConfiguration, handler http.Handler) error {
+
+	if configuration.Address == "" && configuration.TlsAddress == "" {
+		configuration.Address = defaultAddress
+	}
+
+	if err := api.TrustProxies(configuration.TrustedProxies); err != nil {
+		return err
+	}
+
+	plain := handler
+	errs := make(chan error, 2)
+
+	if configuration.TlsAddress != "" {
+
+		source, caFile, err := certificateSource(configuration)
+
+		if err != nil {
+			return err
+		}
+
+		go reloadOnHangup(source)
+
+		// Phones fetch the CA over plain HTTP to trust it, before they can use HTTPS without warnings
+		if caFile != "" {
+			handler = withCa(handler, caFile)
+		}
+
+		plain = handler
+
+		if configuration.RedirectHttp {
+			plain = redirectToTls(configuration.TlsAddress)
+			if caFile != "" {
+				plain = withCa(plain, caFile)
+			}
+		}
+
+		server := &http.Server{
+			Addr: configuration.TlsAddress,
+			Handler: handler,
+			TLSConfig: &tls.Config{GetCertificate: source.GetCertificate, MinVersion: tls.VersionTLS12},
+		}
+
+		go func() {
+			log.Println("Serving HTTPS on", configuration.TlsAddress)
+			errs <- server.ListenAndServeTLS("", "")
+		}()
+	}
+
+	if configuration.Address != "" {
+		go func() {
+			log.Println("Serving HTTP on", configuration.Address)
+			errs <- http.ListenAndServe(configuration.Address, plain)
+		}()
+	}
+
+	return <-errs
+}
+
+// certificateSource returns the provided certificate, or one issued from the self-signed CA along with the CA's file
+func certificateSource(configuration config.HttpConfiguration) (*certs.Source, string, error) {
+
+	if configuration.CertFile != "" || configuration.KeyFile != "" {
+		source, err := certs.NewFileSource(configuration.CertFile, configuration.KeyFile)
+		return source, "", err
+	}
+
+	directory := configuration.CertDirectory
+
+	if directory == "" {
+		directory = defaultCertDirectory
+	}
+
+	hostnames := configuration.Hostnames
+
+	if len(hostnames) == 0 {
+		hostnames = certs.DefaultHostnames()
+	}
+
+	source, err := certs.NewSelfSignedSource(directory, hostnames)
+
+	return source, filepath.Join(directory, certs.CaCertFile), err
+}
+
+// reloadOnHangup reloads the certificate on SIGHUP, so renewed files are picked up without a restart
+func reloadOnHangup(source *certs.Source) {
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		if err := source.Reload(); err != nil {
+			log.Println("Unable to reload the certificate, keeping the current one:", err)
+			continue
+		}
+		log.Println("Reloaded the certificate")
+	}
+}
+
+func redirectToTls(tlsAddress string) http.Handler {
+
+	_, port, _ := net.SplitHostPort(tlsAddress)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		host := r.Host
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+func withCa(handler http.Handler, caFile string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != "/ca.pem" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		http.ServeFile(w, r, caFile)
+	})
+}
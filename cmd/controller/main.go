@@ -2,32 +2,111 @@ package main
 
 import (
 	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/config"
 	"78concepts.com/domicile/internal/database"
+	"78concepts.com/domicile/internal/events"
 	"78concepts.com/domicile/internal/repository"
 	"78concepts.com/domicile/internal/service"
+	"78concepts.com/domicile/internal/spool"
 	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// Queued readings are given this long to be written when the controller is stopped
+	shutdownTimeout = 30 * time.Second
+	defaultSpoolDirectory = "spool"
+	deviceCacheFile = "devices.json"
 )
 
 func main() {
 
-	// Connect to the MQTT broker
 	ctx, ctxCancel:= context.WithCancel(context.Background())
 
+	// Readings wait here while the database is unavailable
+	spoolDirectory:= config.GetConfig().Ingest.SpoolDirectory
+
+	if spoolDirectory == "" {
+		spoolDirectory = defaultSpoolDirectory
+	}
+
+	reportSpool, err:= spool.Open(spoolDirectory)
+
+	if err != nil {
+		log.Fatalf("Unable to open the report spool: %v\n", err)
+	}
+
+	// Connect to the MQTT broker
 	var mqttClient = broker.NewMqttClient(ctx, ctxCancel, "api")
 
-	// Connect to the database
-	dbPool:= database.NewPGXPool()
+	// The pool connects when first used, so the controller starts while the database is down
+	dbPool, err:= database.NewLazyPGXPool()
+
+	if err != nil {
+		log.Fatalf("Invalid database configuration: %v\n", err)
+	}
 
-	reportsService:= service.NewReportsService(&repository.PostgresReportsRepository{Postgres: dbPool})
-	devicesService:= service.NewDevicesService(reportsService, &repository.PostgresDevicesRepository{Postgres: dbPool})
-	groupsService:= service.NewGroupsService(&repository.PostgresGroupsRepository{Postgres: dbPool})
+	eventBus:= events.NewMqttEventBus(mqttClient, "controller")
 
-	c := make(chan int)
+	auditService:= service.NewAuditService(&repository.PostgresAuditRepository{Postgres: dbPool})
+	ingestService:= service.NewIngestService(&repository.PostgresReportsRepository{Postgres: dbPool}, reportSpool, eventBus, config.GetConfig().Ingest)
+	reportsService:= service.NewReportsService(&repository.PostgresReportsRepository{Postgres: dbPool}, eventBus, ingestService)
+	devicesService:= service.NewDevicesService(reportsService, auditService, &repository.PostgresDevicesRepository{Postgres: dbPool}, eventBus)
+	groupsService:= service.NewGroupsService(auditService, &repository.PostgresGroupsRepository{Postgres: dbPool}, eventBus)
+	accessService:= service.NewAccessService(&repository.PostgresAccessRepository{Postgres: dbPool}, &repository.PostgresAreasRepository{Postgres: dbPool}, &repository.PostgresAuthRepository{Postgres: dbPool})
+	scenesService:= service.NewScenesService(&repository.PostgresScenesRepository{Postgres: dbPool}, devicesService, groupsService)
+	automationsService:= service.NewAutomationsService(&repository.PostgresAutomationsRepository{Postgres: dbPool}, devicesService, groupsService, reportsService, scenesService, accessService, eventBus)
+	schedulesService:= service.NewSchedulesService(&repository.PostgresSchedulesRepository{Postgres: dbPool}, devicesService, groupsService, accessService, eventBus)
+	notificationsService:= service.NewNotificationsService(eventBus)
+	alertsService:= service.NewAlertsService(&repository.PostgresAlertsRepository{Postgres: dbPool}, devicesService, notificationsService, eventBus)
+	maintenanceService:= service.NewMaintenanceService(devicesService, reportsService, notificationsService)
+	bridgeService:= service.NewBridgeService(&repository.PostgresBridgeRepository{Postgres: dbPool}, devicesService, auditService, eventBus)
 
 	defer dbPool.Close()
 
-	devicesService.ManageDevices(mqttClient)
-	groupsService.ManageGroups(mqttClient)
+	// Reports are spooled until the database can be reached, and those left from the last run replayed once it can
+	ingestService.ManageIngest(ctx)
+	notificationsService.ManageNotifications()
+
+	// Devices are subscribed to from the cache until their list can be synced with the database, so their readings
+	// are recorded from the start
+	bridgeService.ManageBridgeEvents(mqttClient)
+	devicesService.ManageDevices(mqttClient, filepath.Join(spoolDirectory, deviceCacheFile))
+
+	// The rest need what is stored, so they start once the database is up
+	go func() {
+
+		if err := database.WaitForPGXPool(ctx, dbPool); err != nil {
+			return
+		}
+
+		groupsService.ManageGroups(mqttClient)
+		automationsService.ManageAutomations(mqttClient)
+		schedulesService.ManageSchedules(mqttClient)
+		alertsService.ManageAlerts(ctx)
+		maintenanceService.ManageDigest(ctx)
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	<- stop
+
+	log.Println("Shutting down, writing queued reports")
+
+	// Nothing more is queued once the broker connection is closed
+	mqttClient.Conn.Disconnect(250)
+	ctxCancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
 
-	<- c
+	if err := ingestService.Close(shutdownCtx); err != nil {
+		log.Println("Unable to write every queued report:", err)
+	}
 }
@@ -1,11 +1,14 @@
 module 78concepts.com/domicile
 
-go 1.15
+go 1.16
 
 require (
 	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/gofrs/uuid v4.0.0+incompatible
 	github.com/gorilla/mux v1.8.0
+	github.com/graph-gophers/graphql-go v1.5.0
+	github.com/jackc/pgconn v1.10.1
 	github.com/jackc/pgtype v1.9.1
 	github.com/jackc/pgx/v4 v4.14.1
+	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
 )
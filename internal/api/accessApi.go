@@ -0,0 +1,159 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func NewAccessApi(ctx context.Context, accessService *service.AccessService, areasService *service.AreasService) *AccessApi {
+	return &AccessApi{ctx: ctx, accessService: accessService, areasService: areasService}
+}
+
+type AccessApi struct {
+	ctx context.Context
+	accessService *service.AccessService
+	areasService *service.AreasService
+}
+
+// GetMyAccess returns the role the caller has in each area, or the role it has everywhere when not limited to some areas
+func (a *AccessApi) GetMyAccess(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, AccessFromRequest(r))
+}
+
+func (a *AccessApi) ListAreaRoles(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /users/" + mux.Vars(r)["id"] + "/areas")
+
+	userId, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	roles, err := a.accessService.GetAreaRoles(a.ctx, userId)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list area roles")
+		return
+	}
+
+	writeJson(w, http.StatusOK, roles)
+}
+
+// SetAreaRole grants a user a role, given as {"role": "control"}, in an area and every area beneath it.
+// Once a user has any area role they can only act in the areas they have been granted.
+func (a *AccessApi) SetAreaRole(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT /users/" + mux.Vars(r)["id"] + "/areas/" + mux.Vars(r)["area"])
+
+	userId, areaId, ok := userArea(w, r)
+
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid role: "+err.Error())
+		return
+	}
+
+	role, err := a.accessService.SetAreaRole(a.ctx, userId, areaId, request.Role)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unable to set role: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, role)
+}
+
+func (a *AccessApi) DeleteAreaRole(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /users/" + mux.Vars(r)["id"] + "/areas/" + mux.Vars(r)["area"])
+
+	userId, areaId, ok := userArea(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := a.accessService.DeleteAreaRole(a.ctx, userId, areaId); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetAreaParent nests an area beneath another, given as {"parentId": 2}, or makes it top level with {"parentId": null}
+func (a *AccessApi) SetAreaParent(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT /areas/" + mux.Vars(r)["area"] + "/parent")
+
+	id, err := strconv.ParseUint(mux.Vars(r)["area"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid area id")
+		return
+	}
+
+	area, err := a.areasService.GetAreaById(a.ctx, id)
+
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Area not found")
+		return
+	}
+
+	var request struct {
+		ParentId *uint64 `json:"parentId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid parent: "+err.Error())
+		return
+	}
+
+	updated, err := a.areasService.SetAreaParent(a.ctx, area, request.ParentId)
+
+	if errors.Is(err, service.ErrAreaNotFound) || errors.Is(err, service.ErrAreaCycle) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to set parent")
+		return
+	}
+
+	writeJson(w, http.StatusOK, updated)
+}
+
+func userArea(w http.ResponseWriter, r *http.Request) (uint64, uint64, bool) {
+
+	userId, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return 0, 0, false
+	}
+
+	areaId, err := strconv.ParseUint(mux.Vars(r)["area"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid area id")
+		return 0, 0, false
+	}
+
+	return userId, areaId, true
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/notify"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+func NewAlertsApi(ctx context.Context, alertsService *service.AlertsService, notificationsService *service.NotificationsService) *AlertsApi {
+	return &AlertsApi{ctx: ctx, alertsService: alertsService, notificationsService: notificationsService}
+}
+
+type AlertsApi struct {
+	ctx context.Context
+	alertsService *service.AlertsService
+	notificationsService *service.NotificationsService
+}
+
+func (a *AlertsApi) ListAlertRules(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /alerts/rules")
+
+	rules, err := a.alertsService.GetAlertRules(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list alert rules")
+		return
+	}
+
+	writeJson(w, http.StatusOK, rules)
+}
+
+func (a *AlertsApi) GetAlertRule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /alerts/rules/" + mux.Vars(r)["id"])
+
+	rule := a.findAlertRule(w, r)
+
+	if rule == nil {
+		return
+	}
+
+	writeJson(w, http.StatusOK, rule)
+}
+
+func (a *AlertsApi) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /alerts/rules")
+
+	var rule model.AlertRule
+
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid alert rule: "+err.Error())
+		return
+	}
+
+	created, err := a.alertsService.CreateAlertRule(a.ctx, rule)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid alert rule: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusCreated, created)
+}
+
+func (a *AlertsApi) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT /alerts/rules/" + mux.Vars(r)["id"])
+
+	existing := a.findAlertRule(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	var rule model.AlertRule
+
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid alert rule: "+err.Error())
+		return
+	}
+
+	rule.Id = existing.Id
+
+	updated, err := a.alertsService.UpdateAlertRule(a.ctx, rule)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid alert rule: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, updated)
+}
+
+func (a *AlertsApi) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /alerts/rules/" + mux.Vars(r)["id"])
+
+	existing := a.findAlertRule(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	if err := a.alertsService.DeleteAlertRule(a.ctx, existing.Id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete alert rule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AlertsApi) ListAlerts(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /alerts?state=" + r.URL.Query().Get("state"))
+
+	var state *string
+
+	switch value := r.URL.Query().Get("state"); value {
+	case "":
+	case model.AlertFiring, model.AlertResolved:
+		state = &value
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid alert state")
+		return
+	}
+
+	alerts, err := a.alertsService.GetAlerts(a.ctx, state)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list alerts")
+		return
+	}
+
+	writeJson(w, http.StatusOK, alerts)
+}
+
+func (a *AlertsApi) ListNotifiers(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /notifiers")
+
+	names := a.notificationsService.GetNotifierNames()
+	sort.Strings(names)
+
+	writeJson(w, http.StatusOK, names)
+}
+
+func (a *AlertsApi) TestNotifier(w http.ResponseWriter, r *http.Request) {
+
+	name := mux.Vars(r)["name"]
+
+	log.Println("Endpoint hit: POST /notifiers/" + name + "/test")
+
+	if !a.notificationsService.HasNotifier(name) {
+		writeError(w, http.StatusNotFound, "Notifier not found")
+		return
+	}
+
+	err := a.notificationsService.Notify(a.ctx, []string{name}, notify.Notification{
+		Title:    "domicile test notification",
+		Message:  "Notifications from domicile are reaching " + name,
+		Priority: notify.PriorityDefault,
+		Origin:   "api",
+	})
+
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AlertsApi) findAlertRule(w http.ResponseWriter, r *http.Request) *model.AlertRule {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid alert rule id")
+		return nil
+	}
+
+	rule, err := a.alertsService.GetAlertRule(a.ctx, id)
+
+	if rule == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Alert rule not found")
+		return nil
+	}
+
+	return rule
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit = 1000
+)
+
+func NewAuditApi(ctx context.Context, auditService *service.AuditService) *AuditApi {
+	return &AuditApi{ctx: ctx, auditService: auditService}
+}
+
+type AuditApi struct {
+	ctx context.Context
+	auditService *service.AuditService
+}
+
+// ListAuditEntries searches the audit log, newest first, filtered by action, target, origin, originId, outcome, start and end
+func (a *AuditApi) ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /audit?" + r.URL.RawQuery)
+
+	query := r.URL.Query()
+
+	optional := func(name string) *string {
+		if value := query.Get(name); value != "" {
+			return &value
+		}
+		return nil
+	}
+
+	filter := model.AuditFilter{
+		Action: optional("action"),
+		Target: optional("target"),
+		OriginType: optional("origin"),
+		OriginId: optional("originId"),
+		Outcome: optional("outcome"),
+		Limit: defaultAuditLimit,
+	}
+
+	for name, date := range map[string]**time.Time{"start": &filter.StartDate, "end": &filter.EndDate} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, name+" must be an RFC 3339 date")
+				return
+			}
+			*date = &parsed
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := a.auditService.GetAuditEntries(a.ctx, filter)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to search audit log")
+		return
+	}
+
+	writeJson(w, http.StatusOK, entries)
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const SessionCookie = "domicile_session"
+
+type principalKey struct{}
+
+type accessKey struct{}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<html>
+	<head><title>Sign in</title></head>
+	<body>
+		<h1>Sign in</h1>
+		{{if .Failed}}<p><em>Incorrect username or password</em></p>{{end}}
+		<form method="post" action="/login">
+			<input type="hidden" name="next" value="{{.Next}}" />
+			<p><label>Username <input name="username" autofocus /></label></p>
+			<p><label>Password <input name="password" type="password" /></label></p>
+			<p><button type="submit">Sign in</button></p>
+		</form>
+	</body>
+</html>`))
+
+func NewAuthApi(ctx context.Context, authService *service.AuthService, accessService *service.AccessService) *AuthApi {
+	return &AuthApi{ctx: ctx, authService: authService, accessService: accessService}
+}
+
+type AuthApi struct {
+	ctx context.Context
+	authService *service.AuthService
+	accessService *service.AccessService
+}
+
+// PrincipalFromRequest returns who a request was authenticated as, or nil on routes that do not require authentication
+func PrincipalFromRequest(r *http.Request) *model.Principal {
+	principal, _ := r.Context().Value(principalKey{}).(*model.Principal)
+	return principal
+}
+
+// AccessFromRequest returns the areas the principal behind a request may act in, or nil on routes that do not require authentication
+func AccessFromRequest(r *http.Request) *model.AreaAccess {
+	access, _ := r.Context().Value(accessKey{}).(*model.AreaAccess)
+	return access
+}
+
+// principalUserId returns the id of the signed in user, or nil for api keys
+func principalUserId(r *http.Request) *uint64 {
+
+	if principal := PrincipalFromRequest(r); principal != nil && principal.User != nil {
+		return &principal.User.Id
+	}
+
+	return nil
+}
+
+// canModify reports whether the caller may change something saved by the given user, users limited to some
+// areas can only change what they saved themselves
+func canModify(r *http.Request, ownerId *uint64) bool {
+
+	if !AccessFromRequest(r).Restricted() {
+		return true
+	}
+
+	userId := principalUserId(r)
+
+	return ownerId != nil && userId != nil && *ownerId == *userId
+}
+
+// Require wraps a handler so it is only served to a session or api key granted at least the given scope.
+// Browsers without a session are sent to the sign in page, everything else gets a 401. Handlers can check
+// the areas the caller may act in with AccessFromRequest.
+func (a *AuthApi) Require(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal := a.authenticate(r)
+
+		if principal == nil {
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="domicile"`)
+			writeRequestError(w, r, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		if !model.ScopeAllows(principal.Scope, scope) {
+			writeRequestError(w, r, http.StatusForbidden, "The "+scope+" scope is required")
+			return
+		}
+
+		access, err := a.accessService.PrincipalAccess(a.ctx, principal)
+
+		if err != nil {
+			writeRequestError(w, r, http.StatusInternalServerError, "Unable to load area access")
+			return
+		}
+
+		// Admin routes act on the whole installation, so they are closed to users limited to some areas
+		if scope == model.ScopeAdmin && access.Restricted() {
+			writeRequestError(w, r, http.StatusForbidden, "Not available to users limited to some areas")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, principal)
+		ctx = context.WithValue(ctx, accessKey{}, access)
+
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate accepts an api key as a bearer token or X-Api-Key header, falling back to the session cookie
+func (a *AuthApi) authenticate(r *http.Request) *model.Principal {
+
+	key := r.Header.Get("X-Api-Key")
+
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		key = strings.TrimPrefix(authorization, "Bearer ")
+	}
+
+	if key != "" {
+		principal, err := a.authService.AuthenticateApiKey(a.ctx, key)
+		if err != nil {
+			return nil
+		}
+		return principal
+	}
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		principal, err := a.authService.AuthenticateSession(a.ctx, cookie.Value)
+		if err != nil {
+			return nil
+		}
+		return principal
+	}
+
+	return nil
+}
+
+func (a *AuthApi) LoginPage(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	loginTemplate.Execute(w, map[string]interface{}{
+		"Next": safeNext(r.URL.Query().Get("next")),
+		"Failed": r.URL.Query().Get("failed") != "",
+	})
+}
+
+// Login accepts the sign in form, redirecting back to where the user came from, or JSON credentials from scripts
+func (a *AuthApi) Login(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /login")
+
+	form := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	next := "/"
+
+	if form {
+		credentials.Username = r.PostFormValue("username")
+		credentials.Password = r.PostFormValue("password")
+		next = safeNext(r.PostFormValue("next"))
+	} else if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid credentials: "+err.Error())
+		return
+	}
+
+	token, user, err := a.authService.Login(a.ctx, credentials.Username, credentials.Password)
+
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		log.Println("Failed sign in for", credentials.Username, "from", *requestOrigin(r).Client)
+		if form {
+			http.Redirect(w, r, "/login?failed=1&next="+url.QueryEscape(next), http.StatusSeeOther)
+			return
+		}
+		writeError(w, http.StatusUnauthorized, "Incorrect username or password")
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to sign in")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name: SessionCookie,
+		Value: token,
+		Path: "/",
+		MaxAge: int(service.SessionDuration.Seconds()),
+		HttpOnly: true,
+		Secure: r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if form {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	writeJson(w, http.StatusOK, user)
+}
+
+func (a *AuthApi) Logout(w http.ResponseWriter, r *http.Request) {
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		a.authService.Logout(a.ctx, cookie.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AuthApi) GetMe(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, PrincipalFromRequest(r))
+}
+
+func (a *AuthApi) ListUsers(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /users")
+
+	users, err := a.authService.GetUsers(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list users")
+		return
+	}
+
+	writeJson(w, http.StatusOK, users)
+}
+
+func (a *AuthApi) CreateUser(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /users")
+
+	var request struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Scope    string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user: "+err.Error())
+		return
+	}
+
+	user, err := a.authService.CreateUser(a.ctx, request.Username, request.Password, request.Scope)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unable to create user: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusCreated, user)
+}
+
+func (a *AuthApi) DeleteUser(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /users/" + mux.Vars(r)["id"])
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	if principal := PrincipalFromRequest(r); principal.User != nil && principal.User.Id == id {
+		writeError(w, http.StatusBadRequest, "You cannot delete yourself")
+		return
+	}
+
+	if err := a.authService.DeleteUser(a.ctx, id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AuthApi) ListApiKeys(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /apikeys")
+
+	keys, err := a.authService.GetApiKeys(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list api keys")
+		return
+	}
+
+	writeJson(w, http.StatusOK, keys)
+}
+
+// CreateApiKey returns the key itself in the response, this is the only time it is available
+func (a *AuthApi) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /apikeys")
+
+	var request struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid api key: "+err.Error())
+		return
+	}
+
+	key, apiKey, err := a.authService.CreateApiKey(a.ctx, request.Name, request.Scope)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unable to create api key: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusCreated, map[string]interface{}{"key": key, "apiKey": apiKey})
+}
+
+func (a *AuthApi) DeleteApiKey(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /apikeys/" + mux.Vars(r)["id"])
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid api key id")
+		return
+	}
+
+	if err := a.authService.DeleteApiKey(a.ctx, id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// safeNext only allows redirects to paths on this server after signing in
+func safeNext(next string) string {
+
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+
+	return next
+}
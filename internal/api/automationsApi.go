@@ -0,0 +1,168 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func NewAutomationsApi(ctx context.Context, automationsService *service.AutomationsService) *AutomationsApi {
+	return &AutomationsApi{ctx: ctx, automationsService: automationsService}
+}
+
+type AutomationsApi struct {
+	ctx context.Context
+	automationsService *service.AutomationsService
+}
+
+func (a *AutomationsApi) ListAutomations(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /automations")
+
+	automations, err := a.automationsService.GetAutomations(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list automations")
+		return
+	}
+
+	writeJson(w, http.StatusOK, automations)
+}
+
+func (a *AutomationsApi) GetAutomation(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /automations/" + mux.Vars(r)["id"])
+
+	automation := a.findAutomation(w, r)
+
+	if automation == nil {
+		return
+	}
+
+	writeJson(w, http.StatusOK, automation)
+}
+
+func (a *AutomationsApi) CreateAutomation(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /automations")
+
+	var automation model.Automation
+
+	if err := json.NewDecoder(r.Body).Decode(&automation); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid automation: "+err.Error())
+		return
+	}
+
+	automation.OwnerId = principalUserId(r)
+
+	created, err := a.automationsService.CreateAutomation(CommandContext(a.ctx, r), automation)
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), "Invalid automation: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusCreated, created)
+}
+
+func (a *AutomationsApi) UpdateAutomation(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT /automations/" + mux.Vars(r)["id"])
+
+	existing := a.findAutomation(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	if !canModify(r, existing.OwnerId) {
+		writeError(w, http.StatusForbidden, "Only the user who saved this automation can change it")
+		return
+	}
+
+	var automation model.Automation
+
+	if err := json.NewDecoder(r.Body).Decode(&automation); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid automation: "+err.Error())
+		return
+	}
+
+	automation.Id = existing.Id
+	automation.OwnerId = principalUserId(r)
+
+	updated, err := a.automationsService.UpdateAutomation(CommandContext(a.ctx, r), automation)
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), "Invalid automation: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, updated)
+}
+
+func (a *AutomationsApi) DeleteAutomation(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /automations/" + mux.Vars(r)["id"])
+
+	existing := a.findAutomation(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	if !canModify(r, existing.OwnerId) {
+		writeError(w, http.StatusForbidden, "Only the user who saved this automation can change it")
+		return
+	}
+
+	if err := a.automationsService.DeleteAutomation(a.ctx, existing.Id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete automation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AutomationsApi) ListAutomationLogs(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /automations/" + mux.Vars(r)["id"] + "/logs")
+
+	existing := a.findAutomation(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	logs, err := a.automationsService.GetAutomationLogs(a.ctx, existing.Id)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list automation logs")
+		return
+	}
+
+	writeJson(w, http.StatusOK, logs)
+}
+
+func (a *AutomationsApi) findAutomation(w http.ResponseWriter, r *http.Request) *model.Automation {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid automation id")
+		return nil
+	}
+
+	automation, err := a.automationsService.GetAutomation(a.ctx, id)
+
+	if automation == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Automation not found")
+		return nil
+	}
+
+	return automation
+}
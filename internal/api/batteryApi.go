@@ -0,0 +1,71 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"log"
+	"net/http"
+	"time"
+)
+
+const defaultBatteryHistoryDays = 90
+
+func NewBatteryApi(ctx context.Context, batteryService *service.BatteryService) *BatteryApi {
+	return &BatteryApi{ctx: ctx, batteryService: batteryService}
+}
+
+type BatteryApi struct {
+	ctx context.Context
+	batteryService *service.BatteryService
+}
+
+// GetBatteryHistory returns a device's battery readings between the optional start and end dates, defaulting to the last 90 days
+func (a *BatteryApi) GetBatteryHistory(w http.ResponseWriter, r *http.Request) {
+
+	ieeeAddress := mux.Vars(r)["ieee"]
+
+	log.Println("Endpoint hit: GET /devices/" + ieeeAddress + "/battery")
+
+	endDate := time.Now().UTC()
+	startDate := endDate.AddDate(0, 0, -defaultBatteryHistoryDays)
+
+	if value := r.URL.Query().Get("start"); value != "" {
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "start must be an RFC 3339 date")
+			return
+		}
+		startDate = date.UTC()
+	}
+
+	if value := r.URL.Query().Get("end"); value != "" {
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "end must be an RFC 3339 date")
+			return
+		}
+		endDate = date.UTC()
+	}
+
+	if !startDate.Before(endDate) {
+		writeError(w, http.StatusBadRequest, "start must be before end")
+		return
+	}
+
+	history, err := a.batteryService.GetBatteryHistory(a.ctx, ieeeAddress, startDate, endDate)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to load battery history")
+		return
+	}
+
+	writeJson(w, http.StatusOK, history)
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultBridgeEventsLimit = 100
+	maxBridgeEventsLimit = 1000
+)
+
+func NewBridgeApi(ctx context.Context, bridgeService *service.BridgeService) *BridgeApi {
+	return &BridgeApi{ctx: ctx, bridgeService: bridgeService}
+}
+
+type BridgeApi struct {
+	ctx context.Context
+	bridgeService *service.BridgeService
+}
+
+func (a *BridgeApi) GetBridge(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /bridge")
+
+	bridge, err := a.bridgeService.GetBridge(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to load bridge")
+		return
+	}
+
+	if bridge == nil {
+		writeError(w, http.StatusNotFound, "Nothing has been heard from the bridge yet")
+		return
+	}
+
+	writeJson(w, http.StatusOK, bridge)
+}
+
+func (a *BridgeApi) ListBridgeEvents(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /bridge/events?type=" + r.URL.Query().Get("type"))
+
+	var eventType *string
+
+	if value := r.URL.Query().Get("type"); value != "" {
+		eventType = &value
+	}
+
+	limit := defaultBridgeEventsLimit
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxBridgeEventsLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	bridgeEvents, err := a.bridgeService.GetBridgeEvents(a.ctx, eventType, limit)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list bridge events")
+		return
+	}
+
+	writeJson(w, http.StatusOK, bridgeEvents)
+}
+
+func (a *BridgeApi) PermitJoin(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /bridge/permit_join")
+
+	var request model.PermitJoinRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid permit join request: "+err.Error())
+		return
+	}
+
+	response, err := a.bridgeService.PermitJoin(CommandContext(a.ctx, r), request.Time, request.Device)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) RenameDevice(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+
+	log.Println("Endpoint hit: POST /bridge/devices/" + id + "/rename")
+
+	var request model.RenameDeviceRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid rename request: "+err.Error())
+		return
+	}
+
+	response, err := a.bridgeService.RenameDevice(CommandContext(a.ctx, r), id, request.To, request.HomeassistantRename)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) RemoveDevice(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+
+	log.Println("Endpoint hit: DELETE /bridge/devices/" + id)
+
+	response, err := a.bridgeService.RemoveDevice(CommandContext(a.ctx, r), id, queryBool(r, "force"), queryBool(r, "block"))
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) SetDeviceOptions(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+
+	log.Println("Endpoint hit: PUT /bridge/devices/" + id + "/options")
+
+	var options map[string]interface{}
+
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid options: "+err.Error())
+		return
+	}
+
+	response, err := a.bridgeService.SetDeviceOptions(CommandContext(a.ctx, r), id, options)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) ConfigureDevice(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+
+	log.Println("Endpoint hit: POST /bridge/devices/" + id + "/configure")
+
+	response, err := a.bridgeService.ConfigureDevice(CommandContext(a.ctx, r), id)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) AddGroup(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /bridge/groups")
+
+	var request model.CreateGroupRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid group: "+err.Error())
+		return
+	}
+
+	response, err := a.bridgeService.AddGroup(CommandContext(a.ctx, r), request.FriendlyName, request.Id)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) RemoveGroup(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+
+	log.Println("Endpoint hit: DELETE /bridge/groups/" + id)
+
+	response, err := a.bridgeService.RemoveGroup(CommandContext(a.ctx, r), id, queryBool(r, "force"))
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+
+	group := mux.Vars(r)["id"]
+
+	log.Println("Endpoint hit: POST /bridge/groups/" + group + "/members")
+
+	var request model.GroupMemberRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid group member: "+err.Error())
+		return
+	}
+
+	response, err := a.bridgeService.AddGroupMember(CommandContext(a.ctx, r), group, request.Device, request.Endpoint)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+func (a *BridgeApi) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+
+	group := mux.Vars(r)["id"]
+	device := mux.Vars(r)["device"]
+
+	log.Println("Endpoint hit: DELETE /bridge/groups/" + group + "/members/" + device)
+
+	var endpoint *int
+
+	if value := r.URL.Query().Get("endpoint"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid endpoint")
+			return
+		}
+		endpoint = &parsed
+	}
+
+	response, err := a.bridgeService.RemoveGroupMember(CommandContext(a.ctx, r), group, device, endpoint)
+
+	a.writeBridgeResponse(w, response, err)
+}
+
+// writeBridgeResponse returns the data of a successful response, or maps the failure onto a status code
+func (a *BridgeApi) writeBridgeResponse(w http.ResponseWriter, response *model.BridgeResponse, err error) {
+
+	var bridgeError *service.BridgeError
+
+	switch {
+	case err == nil:
+		if len(response.Data) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJson(w, http.StatusOK, response.Data)
+	case errors.Is(err, service.ErrInvalidBridgeRequest):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrBridgeTimeout):
+		writeError(w, http.StatusGatewayTimeout, err.Error())
+	case errors.As(err, &bridgeError):
+		writeError(w, http.StatusUnprocessableEntity, bridgeError.Message)
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
+
+func queryBool(r *http.Request, name string) bool {
+	value, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return value
+}
@@ -4,7 +4,9 @@ import (
 	"78concepts.com/domicile/internal/broker"
 	"78concepts.com/domicile/internal/service"
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/gorilla/mux"
 	"log"
 	"net/http"
 )
@@ -27,4 +29,35 @@ func (a *DevicesApi) GetState(w http.ResponseWriter, r *http.Request) {
 
 	//fmt.Fprintf(w, service.DevicesService.GetDeviceState(a.client, "Office Ceiling Light 1"))
 
-}
\ No newline at end of file
+}
+
+// SetArea moves a device into the area given as {"areaId": 3}, or out of any area with {"areaId": null}
+func (a *DevicesApi) SetArea(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT /devices/" + mux.Vars(r)["ieee"] + "/area")
+
+	device, err := a.devicesService.GetDevice(a.ctx, mux.Vars(r)["ieee"])
+
+	if device == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	var request struct {
+		AreaId *uint64 `json:"areaId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid area: "+err.Error())
+		return
+	}
+
+	updated, err := a.devicesService.UpdateDeviceArea(CommandContext(a.ctx, r), device, request.AreaId)
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), "Unable to set area: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, updated)
+}
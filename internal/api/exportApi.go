@@ -0,0 +1,136 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/export"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func NewExportApi(ctx context.Context, reportsService *service.ReportsService) *ExportApi {
+	return &ExportApi{ctx: ctx, reportsService: reportsService}
+}
+
+type ExportApi struct {
+	ctx context.Context
+	reportsService *service.ReportsService
+}
+
+// ExportReports streams report history as a download in ?format=csv, jsonl or parquet, csv by default.
+//
+// ?measurement=, ?area= and ?device= are comma separated lists narrowing the reports, every one the caller may view
+// by default. ?start= and ?end= are RFC 3339 dates bounding the range, which is unbounded when they are left out.
+func (a *ExportApi) ExportReports(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + r.URL.Path + "?" + r.URL.RawQuery)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCsv
+	}
+
+	filter, err := exportFilter(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := &exportResponse{w: w, format: format}
+	writer, err := export.NewReportWriter(response, format)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = a.reportsService.ExportReports(CommandContext(a.ctx, r), filter, writer)
+
+	if err == nil {
+		return
+	}
+
+	// Once the download has started the status is sent, so the error can only end it early
+	if response.started {
+		log.Println("Unable to finish report export", err)
+		return
+	}
+
+	if errors.Is(err, service.ErrUnknownMeasurement) || errors.Is(err, service.ErrForbidden) {
+		writeError(w, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	log.Println("Unable to export reports", err)
+	writeError(w, http.StatusInternalServerError, "Unable to export reports")
+}
+
+func exportFilter(r *http.Request) (model.ReportFilter, error) {
+
+	values := r.URL.Query()
+	filter := model.ReportFilter{}
+
+	if value := values.Get("measurement"); value != "" {
+		for _, measurement := range strings.Split(value, ",") {
+			filter.Measurements = append(filter.Measurements, strings.TrimSpace(measurement))
+		}
+	}
+
+	if value := values.Get("area"); value != "" {
+		for _, id := range strings.Split(value, ",") {
+			areaId, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				return filter, errors.New("area must be a comma separated list of area ids")
+			}
+			filter.AreaIds = append(filter.AreaIds, areaId)
+		}
+	}
+
+	if value := values.Get("device"); value != "" {
+		for _, ieeeAddress := range strings.Split(value, ",") {
+			filter.DeviceIds = append(filter.DeviceIds, strings.TrimSpace(ieeeAddress))
+		}
+	}
+
+	for name, date := range map[string]**time.Time{"start": &filter.StartDate, "end": &filter.EndDate} {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, errors.New(name + " must be an RFC 3339 date")
+			}
+			*date = &parsed
+		}
+	}
+
+	if filter.StartDate != nil && filter.EndDate != nil && !filter.EndDate.After(*filter.StartDate) {
+		return filter, errors.New("the start must be before the end")
+	}
+
+	return filter, nil
+}
+
+// exportResponse sends the download headers with the first bytes of the file, leaving the response free for an
+// error until then
+type exportResponse struct {
+	w http.ResponseWriter
+	format string
+	started bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", export.ContentType(e.format))
+		e.w.Header().Set("Content-Disposition", "attachment; filename=\""+export.FileName("reports", e.format)+"\"")
+		e.w.Header().Set("Cache-Control", "no-store")
+	}
+
+	return e.w.Write(p)
+}
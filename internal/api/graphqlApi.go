@@ -0,0 +1,40 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/graph"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func NewGraphqlApi(ctx context.Context, graph *graph.Graph) *GraphqlApi {
+	return &GraphqlApi{ctx: ctx, graph: graph}
+}
+
+type GraphqlApi struct {
+	ctx context.Context
+	graph *graph.Graph
+}
+
+// Query runs a GraphQL request posted as {"query": "...", "operationName": "...", "variables": {...}}. Queries
+// need the read scope, mutations the control scope, and both only see the areas the caller may view.
+func (a *GraphqlApi) Query(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /graphql")
+
+	var request struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Query == "" {
+		writeError(w, http.StatusBadRequest, "Expected a JSON body with a query")
+		return
+	}
+
+	response := a.graph.Exec(CommandContext(r.Context(), r), PrincipalFromRequest(r).Scope, request.Query, request.OperationName, request.Variables)
+
+	writeJson(w, http.StatusOK, response)
+}
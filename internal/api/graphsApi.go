@@ -0,0 +1,186 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/chart"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGraphRange = 24 * time.Hour
+	maxGraphRange = 366 * 24 * time.Hour
+)
+
+func NewGraphsApi(ctx context.Context, chartsService *service.ChartsService) *GraphsApi {
+	return &GraphsApi{ctx: ctx, chartsService: chartsService}
+}
+
+type GraphsApi struct {
+	ctx context.Context
+	chartsService *service.ChartsService
+}
+
+// GetReportGraph draws an area's readings of a measurement as SVG or PNG, by the extension of the path.
+//
+// The range is ?start= to ?end=, both RFC 3339, or the ?hours= before the end, the last 24 hours by default.
+// ?bucket= is the seconds each point summarises, ?series=device draws each device in the area separately and
+// ?compare=4,7 adds other areas. ?width= and ?height= size the image in pixels.
+func (a *GraphsApi) GetReportGraph(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + r.URL.Path + "?" + r.URL.RawQuery)
+
+	format := service.ChartFormatSvg
+	if strings.HasSuffix(r.URL.Path, ".png") {
+		format = service.ChartFormatPng
+	}
+
+	areaId, _ := strconv.ParseUint(mux.Vars(r)["area"], 10, 64)
+
+	query, err := graphQuery(r, areaId, mux.Vars(r)["measurement"])
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Areas the caller may not view are reported as missing, as elsewhere
+	for _, id := range query.AreaIds {
+		if !AccessFromRequest(r).Allows(&id, model.RoleView) {
+			writeError(w, http.StatusNotFound, "Area not found")
+			return
+		}
+	}
+
+	c, err := a.chartsService.GetReportChart(CommandContext(a.ctx, r), query)
+
+	if errors.Is(err, service.ErrUnknownMeasurement) {
+		writeError(w, http.StatusNotFound, "Unknown measurement "+query.Measurement)
+		return
+	}
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	// Render before writing the header, so a failure can still be answered with an error
+	var image bytes.Buffer
+
+	if err := a.chartsService.RenderChart(&image, c, format); err != nil {
+		log.Println("Unable to render graph", err)
+		writeError(w, http.StatusInternalServerError, "Unable to render graph")
+		return
+	}
+
+	if format == service.ChartFormatPng {
+		w.Header().Set("Content-Type", "image/png")
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	w.Write(image.Bytes())
+}
+
+func graphQuery(r *http.Request, areaId uint64, measurement string) (model.ReportChartQuery, error) {
+
+	values := r.URL.Query()
+
+	query := model.ReportChartQuery{
+		Measurement: measurement,
+		AreaIds: []uint64{areaId},
+		ByDevice: values.Get("series") == "device",
+		EndDate: time.Now().UTC(),
+	}
+
+	if series := values.Get("series"); series != "" && series != "area" && series != "device" {
+		return query, errors.New("series must be area or device")
+	}
+
+	if value := values.Get("end"); value != "" {
+		end, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, errors.New("end must be an RFC 3339 date")
+		}
+		query.EndDate = end
+	}
+
+	query.StartDate = query.EndDate.Add(-defaultGraphRange)
+
+	if value := values.Get("hours"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours <= 0 {
+			return query, errors.New("hours must be a positive number")
+		}
+		query.StartDate = query.EndDate.Add(-time.Duration(hours) * time.Hour)
+	}
+
+	if value := values.Get("start"); value != "" {
+		start, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, errors.New("start must be an RFC 3339 date")
+		}
+		query.StartDate = start
+	}
+
+	if query.EndDate.Sub(query.StartDate) > maxGraphRange {
+		return query, errors.New("the range can be at most 366 days")
+	}
+
+	if value := values.Get("bucket"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return query, errors.New("bucket must be a positive number of seconds")
+		}
+		query.Bucket = time.Duration(seconds) * time.Second
+	}
+
+	if value := values.Get("compare"); value != "" {
+		for _, id := range strings.Split(value, ",") {
+			compareId, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				return query, errors.New("compare must be a comma separated list of area ids")
+			}
+			if compareId != areaId {
+				query.AreaIds = append(query.AreaIds, compareId)
+			}
+		}
+	}
+
+	var err error
+
+	if query.Width, err = imageSize(values.Get("width"), chart.MinWidth, chart.MaxWidth); err != nil {
+		return query, errors.New("width must be between " + strconv.Itoa(chart.MinWidth) + " and " + strconv.Itoa(chart.MaxWidth))
+	}
+
+	if query.Height, err = imageSize(values.Get("height"), chart.MinHeight, chart.MaxHeight); err != nil {
+		return query, errors.New("height must be between " + strconv.Itoa(chart.MinHeight) + " and " + strconv.Itoa(chart.MaxHeight))
+	}
+
+	return query, nil
+}
+
+// imageSize parses an optional size in pixels, zero when it is not given
+func imageSize(value string, min int, max int) (int, error) {
+
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.Atoi(value)
+
+	if err != nil || size < min || size > max {
+		return 0, errors.New("out of range")
+	}
+
+	return size, nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var maintenanceTemplate = template.Must(template.New("maintenance").Funcs(template.FuncMap{
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Local().Format("Mon Jan 2 15:04")
+	},
+	"days": func(days *float64) float64 {
+		return *days
+	},
+}).Parse(`<html>
+	<head><title>Maintenance</title></head>
+	<body>
+		<h1>Maintenance</h1>
+		<h2>Batteries</h2>
+		<table>
+			<tr><th>Device</th><th>Battery</th><th>Days to empty</th><th>Last seen</th></tr>
+			{{range .Batteries}}<tr><td>{{.FriendlyName}}</td><td>{{printf "%.0f" .Battery}}%</td><td>{{with .DaysToEmpty}}{{printf "%.0f" (days .)}}{{else}}-{{end}}</td><td>{{date .LastSeen}}</td></tr>
+			{{else}}<tr><td colspan="4"><em>No battery powered devices</em></td></tr>{{end}}
+		</table>
+		<h2>Not reporting</h2>
+		<table>
+			<tr><th>Device</th><th>Last seen</th><th>Expected every</th></tr>
+			{{range .Stale}}<tr><td>{{.FriendlyName}}</td><td>{{date .LastSeen}}</td><td>{{.ExpectedInterval}} minutes</td></tr>
+			{{else}}<tr><td colspan="3"><em>All devices are reporting</em></td></tr>{{end}}
+		</table>
+		<h2>Weak links</h2>
+		<table>
+			<tr><th>Device</th><th>Link quality</th></tr>
+			{{range .WeakLinks}}<tr><td>{{.FriendlyName}}</td><td>{{.LinkQuality}}</td></tr>
+			{{else}}<tr><td colspan="2"><em>No weak links</em></td></tr>{{end}}
+		</table>
+	</body>
+</html>`))
+
+func NewMaintenanceApi(ctx context.Context, maintenanceService *service.MaintenanceService) *MaintenanceApi {
+	return &MaintenanceApi{ctx: ctx, maintenanceService: maintenanceService}
+}
+
+type MaintenanceApi struct {
+	ctx context.Context
+	maintenanceService *service.MaintenanceService
+}
+
+// GetMaintenance renders the report as a page for browsers and as JSON for everything else
+func (a *MaintenanceApi) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: /maintenance")
+
+	report, err := a.maintenanceService.GetMaintenanceReport(a.ctx, time.Now().UTC())
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to build maintenance report")
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		a.renderMaintenance(w, report)
+		return
+	}
+
+	writeJson(w, http.StatusOK, report)
+}
+
+func (a *MaintenanceApi) SendDigest(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /maintenance/digest")
+
+	if err := a.maintenanceService.SendDigest(a.ctx); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *MaintenanceApi) renderMaintenance(w http.ResponseWriter, report *model.MaintenanceReport) {
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := maintenanceTemplate.Execute(w, report); err != nil {
+		log.Println("Unable to render maintenance report", err)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultNetworkSnapshotsLimit = 50
+)
+
+func NewNetworkApi(ctx context.Context, networkService *service.NetworkService) *NetworkApi {
+	return &NetworkApi{ctx: ctx, networkService: networkService}
+}
+
+type NetworkApi struct {
+	ctx context.Context
+	networkService *service.NetworkService
+}
+
+// GetNetworkMap returns the current map as JSON, or as SVG when asked for with Accept or /network.svg.
+// Pass refresh=true to scan the network again instead of using the cached map.
+func (a *NetworkApi) GetNetworkMap(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + r.URL.Path)
+
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+
+	networkMap, err := a.networkService.GetNetworkMap(CommandContext(a.ctx, r), refresh)
+
+	if errors.Is(err, service.ErrBridgeTimeout) {
+		writeError(w, http.StatusGatewayTimeout, err.Error())
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "Unable to load network map: "+err.Error())
+		return
+	}
+
+	a.writeNetworkMap(w, r, networkMap)
+}
+
+func (a *NetworkApi) ListNetworkMapSnapshots(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /network/snapshots")
+
+	snapshots, err := a.networkService.GetNetworkMapSnapshots(a.ctx, defaultNetworkSnapshotsLimit)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list network map snapshots")
+		return
+	}
+
+	writeJson(w, http.StatusOK, snapshots)
+}
+
+func (a *NetworkApi) GetNetworkMapSnapshot(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + r.URL.Path)
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid snapshot id")
+		return
+	}
+
+	networkMap, err := a.networkService.GetNetworkMapSnapshot(a.ctx, id)
+
+	if networkMap == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Network map snapshot not found")
+		return
+	}
+
+	a.writeNetworkMap(w, r, networkMap)
+}
+
+func (a *NetworkApi) writeNetworkMap(w http.ResponseWriter, r *http.Request, networkMap *model.NetworkMap) {
+
+	if !strings.HasSuffix(r.URL.Path, ".svg") && !strings.Contains(r.Header.Get("Accept"), "image/svg+xml") {
+		writeJson(w, http.StatusOK, networkMap)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+
+	if err := a.networkService.RenderNetworkMap(w, networkMap); err != nil {
+		log.Println("Unable to render network map", err)
+	}
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+// openApiJson describes every route of the api, the test in cmd/api checks it against the router
+//go:embed openapi.json
+var openApiJson []byte
+
+// OpenApiDocument serves the OpenAPI 3 description of the api. It is public so clients can be generated from it.
+func OpenApiDocument(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/openapi.json")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openApiJson)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// CommandContext attributes the commands sent while handling a request to the client that made it,
+// and limits them to the areas the client may act in
+func CommandContext(ctx context.Context, r *http.Request) context.Context {
+	return service.WithAccess(service.WithOrigin(ctx, requestOrigin(r)), AccessFromRequest(r))
+}
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For header is believed, set once at startup
+var trustedProxies []*net.IPNet
+
+// TrustProxies sets the reverse proxies, given as addresses or CIDR ranges, allowed to name the client of a request
+func TrustProxies(proxies []string) error {
+
+	networks := make([]*net.IPNet, 0, len(proxies))
+
+	for _, proxy := range proxies {
+
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+
+		networks = append(networks, network)
+	}
+
+	trustedProxies = networks
+
+	return nil
+}
+
+func isTrustedProxy(address string) bool {
+
+	ip := net.ParseIP(address)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func requestOrigin(r *http.Request) model.AuditOrigin {
+
+	client := r.RemoteAddr
+
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	// Behind a trusted reverse proxy the first forwarded address is the real client, anyone else could make it up
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && isTrustedProxy(client) {
+		client = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	origin := model.AuditOrigin{Type: model.OriginHttp, Client: &client}
+
+	if principal := PrincipalFromRequest(r); principal != nil {
+		id := principal.Type + ":" + principal.Name
+		origin.Id = &id
+	}
+
+	return origin
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestOrigin(t *testing.T) {
+
+	if err := TrustProxies([]string{"10.0.0.1", "fd00::/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer TrustProxies(nil)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"direct", "192.168.1.20:51234", "", "192.168.1.20"},
+		{"forged", "192.168.1.20:51234", "127.0.0.1", "192.168.1.20"},
+		{"trusted proxy", "10.0.0.1:443", "203.0.113.7, 10.0.0.1", "203.0.113.7"},
+		{"other proxy", "10.0.0.2:443", "203.0.113.7", "10.0.0.2"},
+		{"trusted range", "[fd12::1]:443", "2001:db8::7", "2001:db8::7"},
+		{"proxy without header", "10.0.0.1:443", "", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+
+		r := httptest.NewRequest("GET", "/devices", nil)
+		r.RemoteAddr = test.remoteAddr
+
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		if client := *requestOrigin(r).Client; client != test.expected {
+			t.Errorf("%s: client %s, expected %s", test.name, client, test.expected)
+		}
+	}
+}
+
+func TestTrustProxies(t *testing.T) {
+
+	defer TrustProxies(nil)
+
+	for _, proxies := range [][]string{{"proxy.local"}, {"10.0.0.0/33"}} {
+		if err := TrustProxies(proxies); err == nil {
+			t.Errorf("TrustProxies(%v) succeeded", proxies)
+		}
+	}
+}
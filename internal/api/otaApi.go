@@ -0,0 +1,165 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func NewOtaApi(ctx context.Context, otaService *service.OtaService, devicesService *service.DevicesService) *OtaApi {
+	return &OtaApi{ctx: ctx, otaService: otaService, devicesService: devicesService}
+}
+
+type OtaApi struct {
+	ctx context.Context
+	otaService *service.OtaService
+	devicesService *service.DevicesService
+}
+
+// ListFirmware returns the firmware and update state of every active device
+func (a *OtaApi) ListFirmware(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /ota")
+
+	devices, err := a.devicesService.GetDevices(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list devices")
+		return
+	}
+
+	active := make([]model.Device, 0)
+	for _, device := range devices {
+		if device.Active {
+			active = append(active, device)
+		}
+	}
+
+	writeJson(w, http.StatusOK, active)
+}
+
+func (a *OtaApi) StartCheckAll(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /ota/check")
+
+	job, err := a.otaService.StartCheckAll(CommandContext(a.ctx, r))
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to start update check")
+		return
+	}
+
+	writeJson(w, http.StatusAccepted, job)
+}
+
+func (a *OtaApi) GetCheckJob(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /ota/check/" + mux.Vars(r)["id"])
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid job id")
+		return
+	}
+
+	job := a.otaService.GetCheckJob(id)
+
+	if job == nil {
+		writeError(w, http.StatusNotFound, "Update check not found")
+		return
+	}
+
+	writeJson(w, http.StatusOK, job)
+}
+
+func (a *OtaApi) CheckDevice(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /devices/" + mux.Vars(r)["ieee"] + "/ota/check")
+
+	device := a.findDevice(w, r)
+
+	if device == nil {
+		return
+	}
+
+	available, err := a.otaService.CheckDevice(CommandContext(a.ctx, r), device)
+
+	if err != nil {
+		writeOtaError(w, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]bool{"updateAvailable": available})
+}
+
+func (a *OtaApi) StartUpdate(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /devices/" + mux.Vars(r)["ieee"] + "/ota/update")
+
+	device := a.findDevice(w, r)
+
+	if device == nil {
+		return
+	}
+
+	if err := a.otaService.StartUpdate(CommandContext(a.ctx, r), device); err != nil {
+		writeOtaError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *OtaApi) ListFirmwareHistory(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /devices/" + mux.Vars(r)["ieee"] + "/firmware")
+
+	device := a.findDevice(w, r)
+
+	if device == nil {
+		return
+	}
+
+	history, err := a.devicesService.GetFirmwareHistory(a.ctx, device.IeeeAddress)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list firmware history")
+		return
+	}
+
+	writeJson(w, http.StatusOK, history)
+}
+
+func (a *OtaApi) findDevice(w http.ResponseWriter, r *http.Request) *model.Device {
+
+	device, err := a.devicesService.GetDevice(a.ctx, mux.Vars(r)["ieee"])
+
+	if device == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Device not found")
+		return nil
+	}
+
+	return device
+}
+
+func writeOtaError(w http.ResponseWriter, err error) {
+
+	var bridgeError *service.BridgeError
+
+	switch {
+	case errors.Is(err, service.ErrUpdateInProgress):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrBridgeTimeout):
+		writeError(w, http.StatusGatewayTimeout, err.Error())
+	case errors.As(err, &bridgeError):
+		writeError(w, http.StatusUnprocessableEntity, bridgeError.Message)
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
@@ -1,10 +1,9 @@
 package api
 
 import (
+	"78concepts.com/domicile/internal/model"
 	"78concepts.com/domicile/internal/service"
 	"context"
-	"encoding/json"
-	"fmt"
 	"github.com/gofrs/uuid"
 	"log"
 	"net/http"
@@ -29,49 +28,40 @@ func (a *ReportsApi) ListReports(w http.ResponseWriter, r *http.Request) {
 	area, err := a.areasService.GetArea(a.ctx, uuid)
 
 	if area == nil || err != nil {
-		json, _ := json.Marshal(map[string]interface{} {"status": 404, "error": "Area not found"})
-		w.WriteHeader(404)
-		fmt.Fprintf(w, string(json))
+		writeError(w, http.StatusNotFound, "Area not found")
 		return
 	}
 
-	var response string
+	if !AccessFromRequest(r).Allows(&area.Id, model.RoleView) {
+		writeError(w, http.StatusForbidden, "Not permitted in this area")
+		return
+	}
+
+	var data interface{}
 
 	loc, err := time.LoadLocation("Australia/Melbourne")
 	now := time.Now().In(loc)
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
 
-	if area == nil || err != nil {
-		//middleware.NotFound(w, "group", r.URL.Query().Get("group"))
-		return
-	}
-
 	switch reportType := r.URL.Query().Get("type"); reportType {
 		case "temperature":
-			data, _ := a.reportsService.GetTemperatureReports(a.ctx, area.Id, startOfDay.In(time.UTC), now.In(time.UTC))
-			json, _ := json.Marshal(data)
-			response = string(json)
+			data, err = a.reportsService.GetTemperatureReports(a.ctx, area.Id, startOfDay.In(time.UTC), now.In(time.UTC))
 		case "humidity":
-			data, _ := a.reportsService.GetHumidityReports(a.ctx, area.Id)
-			json, _ := json.Marshal(data)
-			response = string(json)
+			data, err = a.reportsService.GetHumidityReports(a.ctx, area.Id)
 		case "pressure":
-			data, _ := a.reportsService.GetPressureReports(a.ctx, area.Id)
-			json, _ := json.Marshal(data)
-			response = string(json)
+			data, err = a.reportsService.GetPressureReports(a.ctx, area.Id)
 		case "illuminance":
-			data, _ := a.reportsService.GetIlluminanceReports(a.ctx, area.Id)
-			log.Println(data)
-			json, _ := json.Marshal(data)
-			response = string(json)
+			data, err = a.reportsService.GetIlluminanceReports(a.ctx, area.Id)
 		default:
-			json, _ := json.Marshal(map[string]interface{} {"status": 400, "error": "Invalid report type"})
-			w.WriteHeader(400)
-			fmt.Fprintf(w, string(json))
+			writeError(w, http.StatusBadRequest, "Invalid report type")
 			return
 	}
 
-	fmt.Fprintf(w, response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list reports")
+		return
+	}
 
+	writeJson(w, http.StatusOK, data)
 }
 
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// V1Prefix is the path of the versioned api, which answers every error with an ErrorBody
+const V1Prefix = "/api/v1"
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit = 500
+)
+
+// ErrorBody is the error envelope of the versioned api
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Page is one page of a list from the versioned api, Next is the url of the following page if there is one
+type Page struct {
+	Items  interface{} `json:"items"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Next   *string     `json:"next"`
+}
+
+func writeJson(w http.ResponseWriter, status int, object interface{}) {
+
+	data, err := json.Marshal(object)
+
+	if err != nil {
+		log.Println("Unable to encode response", err)
+		writeError(w, http.StatusInternalServerError, "Unable to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+
+	data, _ := json.Marshal(map[string]interface{}{"status": status, "error": message})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// errorStatus is the status for an error from a service, a 403 when the caller is not permitted in an area
+// and otherwise the given fallback
+func errorStatus(err error, fallback int) int {
+
+	if errors.Is(err, service.ErrForbidden) {
+		return http.StatusForbidden
+	}
+
+	return fallback
+}
+
+// writeV1Error writes the versioned api's error envelope, the code is the status text in snake case, e.g. not_found
+func writeV1Error(w http.ResponseWriter, status int, message string) {
+
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+
+	data, _ := json.Marshal(ErrorBody{Error: ErrorDetail{Status: status, Code: code, Message: message}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// writeRequestError writes an error in the envelope of the api version the request was made to
+func writeRequestError(w http.ResponseWriter, r *http.Request, status int, message string) {
+
+	if strings.HasPrefix(r.URL.Path, V1Prefix+"/") {
+		writeV1Error(w, status, message)
+		return
+	}
+
+	writeError(w, status, message)
+}
+
+// V1NotFound and V1MethodNotAllowed answer requests the versioned api has no route for
+func V1NotFound(w http.ResponseWriter, r *http.Request) {
+	writeV1Error(w, http.StatusNotFound, "No such resource: "+r.URL.Path)
+}
+
+func V1MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeV1Error(w, http.StatusMethodNotAllowed, r.Method+" is not supported on "+r.URL.Path)
+}
+
+// pageParams reads the limit and offset query parameters of a list request
+func pageParams(r *http.Request) (int, int, error) {
+
+	limit, offset := defaultPageLimit, 0
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		limit = parsed
+	}
+
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset must be zero or more")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+// pageBounds returns the slice of a list of n items on the requested page, and whether more follow it
+func pageBounds(n int, limit int, offset int) (int, int, bool) {
+
+	if offset > n {
+		offset = n
+	}
+
+	end := offset + limit
+
+	if end > n {
+		end = n
+	}
+
+	return offset, end, end < n
+}
+
+// writePage writes a page of items, linking to the next page when more follow
+func writePage(w http.ResponseWriter, r *http.Request, items interface{}, limit int, offset int, more bool) {
+
+	page := Page{Items: items, Limit: limit, Offset: offset}
+
+	if more {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset+limit))
+		next := (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+		page.Next = &next
+	}
+
+	writeJson(w, http.StatusOK, page)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func NewScenesApi(ctx context.Context, client *broker.MqttClient, scenesService *service.ScenesService) *ScenesApi {
+	return &ScenesApi{ctx: ctx, client: client, scenesService: scenesService}
+}
+
+type ScenesApi struct {
+	ctx context.Context
+	client *broker.MqttClient
+	scenesService *service.ScenesService
+}
+
+func (a *ScenesApi) ListScenes(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /scenes")
+
+	scenes, err := a.scenesService.GetScenes(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list scenes")
+		return
+	}
+
+	writeJson(w, http.StatusOK, scenes)
+}
+
+func (a *ScenesApi) GetScene(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /scenes/" + mux.Vars(r)["id"])
+
+	scene := a.findScene(w, r)
+
+	if scene == nil {
+		return
+	}
+
+	writeJson(w, http.StatusOK, scene)
+}
+
+func (a *ScenesApi) CaptureScene(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /scenes")
+
+	var capture model.SceneCapture
+
+	if err := json.NewDecoder(r.Body).Decode(&capture); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid scene: "+err.Error())
+		return
+	}
+
+	scene, err := a.scenesService.CaptureScene(CommandContext(a.ctx, r), a.client, capture)
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), "Unable to capture scene: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusCreated, scene)
+}
+
+func (a *ScenesApi) RecallScene(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /scenes/" + mux.Vars(r)["id"] + "/recall")
+
+	scene := a.findScene(w, r)
+
+	if scene == nil {
+		return
+	}
+
+	var options struct {
+		Transition *float64 `json:"transition"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid recall options: "+err.Error())
+		return
+	}
+
+	if err := a.scenesService.RecallScene(CommandContext(a.ctx, r), a.client, scene, options.Transition); err != nil {
+		writeError(w, errorStatus(err, http.StatusBadGateway), "Unable to recall scene: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *ScenesApi) DeleteScene(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /scenes/" + mux.Vars(r)["id"])
+
+	scene := a.findScene(w, r)
+
+	if scene == nil {
+		return
+	}
+
+	if err := a.scenesService.DeleteScene(a.ctx, scene.Id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete scene")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *ScenesApi) findScene(w http.ResponseWriter, r *http.Request) *model.Scene {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid scene id")
+		return nil
+	}
+
+	scene, err := a.scenesService.GetScene(a.ctx, id)
+
+	if scene == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Scene not found")
+		return nil
+	}
+
+	return scene
+}
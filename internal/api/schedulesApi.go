@@ -0,0 +1,148 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func NewSchedulesApi(ctx context.Context, schedulesService *service.SchedulesService) *SchedulesApi {
+	return &SchedulesApi{ctx: ctx, schedulesService: schedulesService}
+}
+
+type SchedulesApi struct {
+	ctx context.Context
+	schedulesService *service.SchedulesService
+}
+
+func (a *SchedulesApi) ListSchedules(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /schedules")
+
+	schedules, err := a.schedulesService.GetSchedules(a.ctx)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to list schedules")
+		return
+	}
+
+	writeJson(w, http.StatusOK, schedules)
+}
+
+func (a *SchedulesApi) GetSchedule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /schedules/" + mux.Vars(r)["id"])
+
+	schedule := a.findSchedule(w, r)
+
+	if schedule == nil {
+		return
+	}
+
+	writeJson(w, http.StatusOK, schedule)
+}
+
+func (a *SchedulesApi) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST /schedules")
+
+	var schedule model.Schedule
+
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid schedule: "+err.Error())
+		return
+	}
+
+	schedule.OwnerId = principalUserId(r)
+
+	created, err := a.schedulesService.CreateSchedule(CommandContext(a.ctx, r), schedule)
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), "Invalid schedule: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusCreated, created)
+}
+
+func (a *SchedulesApi) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT /schedules/" + mux.Vars(r)["id"])
+
+	existing := a.findSchedule(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	if !canModify(r, existing.OwnerId) {
+		writeError(w, http.StatusForbidden, "Only the user who saved this schedule can change it")
+		return
+	}
+
+	var schedule model.Schedule
+
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid schedule: "+err.Error())
+		return
+	}
+
+	schedule.Id = existing.Id
+	schedule.OwnerId = principalUserId(r)
+
+	updated, err := a.schedulesService.UpdateSchedule(CommandContext(a.ctx, r), schedule)
+
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), "Invalid schedule: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, updated)
+}
+
+func (a *SchedulesApi) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: DELETE /schedules/" + mux.Vars(r)["id"])
+
+	existing := a.findSchedule(w, r)
+
+	if existing == nil {
+		return
+	}
+
+	if !canModify(r, existing.OwnerId) {
+		writeError(w, http.StatusForbidden, "Only the user who saved this schedule can change it")
+		return
+	}
+
+	if err := a.schedulesService.DeleteSchedule(a.ctx, existing.Id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to delete schedule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *SchedulesApi) findSchedule(w http.ResponseWriter, r *http.Request) *model.Schedule {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid schedule id")
+		return nil
+	}
+
+	schedule, err := a.schedulesService.GetSchedule(a.ctx, id)
+
+	if schedule == nil || err != nil {
+		writeError(w, http.StatusNotFound, "Schedule not found")
+		return nil
+	}
+
+	return schedule
+}
@@ -0,0 +1,435 @@
+package api
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Measurements that can be listed through /areas/{id}/reports/{measurement}
+var v1Measurements = map[string]bool{"temperature": true, "humidity": true, "pressure": true, "illuminance": true}
+
+func NewV1Api(
+	ctx context.Context,
+	client *broker.MqttClient,
+	devicesService *service.DevicesService,
+	groupsService *service.GroupsService,
+	areasService *service.AreasService,
+	reportsService *service.ReportsService,
+	auditService *service.AuditService,
+) *V1Api {
+	return &V1Api{
+		ctx: ctx,
+		client: client,
+		devicesService: devicesService,
+		groupsService: groupsService,
+		areasService: areasService,
+		reportsService: reportsService,
+		auditService: auditService}
+}
+
+// V1Api serves the versioned resource routes under V1Prefix. Every error is answered with an ErrorBody and
+// every list is paged with limit and offset.
+type V1Api struct {
+	ctx context.Context
+	client *broker.MqttClient
+	devicesService *service.DevicesService
+	groupsService *service.GroupsService
+	areasService *service.AreasService
+	reportsService *service.ReportsService
+	auditService *service.AuditService
+}
+
+// ListDevices lists the devices in areas the caller may view, optionally only those in ?area=
+func (a *V1Api) ListDevices(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/devices?" + r.URL.RawQuery)
+
+	limit, offset, err := pageParams(r)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var areaId *uint64
+
+	if value := r.URL.Query().Get("area"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeV1Error(w, http.StatusBadRequest, "area must be an area id")
+			return
+		}
+		areaId = &parsed
+	}
+
+	devices, err := a.devicesService.GetDevices(a.ctx)
+
+	if err != nil {
+		writeV1Error(w, http.StatusInternalServerError, "Unable to list devices")
+		return
+	}
+
+	access := AccessFromRequest(r)
+	visible := make([]model.Device, 0, len(devices))
+
+	for _, device := range devices {
+		if areaId != nil && (device.AreaId == nil || *device.AreaId != *areaId) {
+			continue
+		}
+		if access.Allows(device.AreaId, model.RoleView) {
+			visible = append(visible, device)
+		}
+	}
+
+	start, end, more := pageBounds(len(visible), limit, offset)
+
+	writePage(w, r, visible[start:end], limit, offset, more)
+}
+
+func (a *V1Api) GetDevice(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/devices/" + mux.Vars(r)["ieee"])
+
+	device, ok := a.device(w, r)
+
+	if !ok {
+		return
+	}
+
+	writeJson(w, http.StatusOK, device)
+}
+
+// SetDeviceArea moves a device into the area given as {"areaId": 3}, or out of any area with {"areaId": null}
+func (a *V1Api) SetDeviceArea(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: PUT " + V1Prefix + "/devices/" + mux.Vars(r)["ieee"] + "/area")
+
+	device, ok := a.device(w, r)
+
+	if !ok {
+		return
+	}
+
+	var request struct {
+		AreaId *uint64 `json:"areaId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Invalid area: "+err.Error())
+		return
+	}
+
+	updated, err := a.devicesService.UpdateDeviceArea(CommandContext(a.ctx, r), device, request.AreaId)
+
+	if err != nil {
+		writeV1Error(w, errorStatus(err, http.StatusBadRequest), "Unable to set area: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, updated)
+}
+
+// SendDeviceCommand publishes the request body, a zigbee2mqtt set payload such as {"state": "on"}, to a device.
+// The command is accepted once published, the device reports its new state asynchronously.
+func (a *V1Api) SendDeviceCommand(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST " + V1Prefix + "/devices/" + mux.Vars(r)["ieee"] + "/commands")
+
+	device, ok := a.device(w, r)
+
+	if !ok {
+		return
+	}
+
+	payload, ok := commandPayload(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := a.devicesService.SetDeviceState(CommandContext(a.ctx, r), a.client, device, payload); err != nil {
+		writeV1Error(w, errorStatus(err, http.StatusBadGateway), "Unable to send command: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusAccepted, payload)
+}
+
+// ListGroups lists the groups whose every member is in an area the caller may view
+func (a *V1Api) ListGroups(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/groups?" + r.URL.RawQuery)
+
+	limit, offset, err := pageParams(r)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups, err := a.groupsService.GetGroups(a.ctx)
+
+	if err != nil {
+		writeV1Error(w, http.StatusInternalServerError, "Unable to list groups")
+		return
+	}
+
+	ctx := CommandContext(a.ctx, r)
+	visible := make([]model.Group, 0, len(groups))
+
+	for _, group := range groups {
+		if a.groupsService.CheckGroupAccess(ctx, &group, model.RoleView) == nil {
+			visible = append(visible, group)
+		}
+	}
+
+	start, end, more := pageBounds(len(visible), limit, offset)
+
+	writePage(w, r, visible[start:end], limit, offset, more)
+}
+
+func (a *V1Api) GetGroup(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/groups/" + mux.Vars(r)["id"])
+
+	group, ok := a.group(w, r)
+
+	if !ok {
+		return
+	}
+
+	writeJson(w, http.StatusOK, group)
+}
+
+// SendGroupCommand publishes the request body, a zigbee2mqtt set payload such as {"state": "off"}, to a group
+func (a *V1Api) SendGroupCommand(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST " + V1Prefix + "/groups/" + mux.Vars(r)["id"] + "/commands")
+
+	group, ok := a.group(w, r)
+
+	if !ok {
+		return
+	}
+
+	payload, ok := commandPayload(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := a.groupsService.SetGroupState(CommandContext(a.ctx, r), a.client, group, payload); err != nil {
+		writeV1Error(w, errorStatus(err, http.StatusBadGateway), "Unable to send command: "+err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusAccepted, payload)
+}
+
+func (a *V1Api) ListAreas(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/areas?" + r.URL.RawQuery)
+
+	limit, offset, err := pageParams(r)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	areas, err := a.areasService.GetAreas(a.ctx)
+
+	if err != nil {
+		writeV1Error(w, http.StatusInternalServerError, "Unable to list areas")
+		return
+	}
+
+	access := AccessFromRequest(r)
+	visible := make([]model.Area, 0, len(areas))
+
+	for _, area := range areas {
+		if access.Allows(&area.Id, model.RoleView) {
+			visible = append(visible, area)
+		}
+	}
+
+	start, end, more := pageBounds(len(visible), limit, offset)
+
+	writePage(w, r, visible[start:end], limit, offset, more)
+}
+
+func (a *V1Api) GetArea(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/areas/" + mux.Vars(r)["id"])
+
+	area, ok := a.area(w, r)
+
+	if !ok {
+		return
+	}
+
+	writeJson(w, http.StatusOK, area)
+}
+
+// ListAreaReports pages through an area's readings of a measurement, oldest first, between ?start= and ?end=
+// (RFC 3339, the last 24 hours by default)
+func (a *V1Api) ListAreaReports(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/areas/" + mux.Vars(r)["id"] + "/reports/" + mux.Vars(r)["measurement"] + "?" + r.URL.RawQuery)
+
+	measurement := mux.Vars(r)["measurement"]
+
+	if !v1Measurements[measurement] {
+		writeV1Error(w, http.StatusNotFound, "Unknown measurement "+measurement)
+		return
+	}
+
+	area, ok := a.area(w, r)
+
+	if !ok {
+		return
+	}
+
+	limit, offset, err := pageParams(r)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+
+	for name, date := range map[string]*time.Time{"start": &start, "end": &end} {
+		if value := r.URL.Query().Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeV1Error(w, http.StatusBadRequest, name+" must be an RFC 3339 date")
+				return
+			}
+			*date = parsed
+		}
+	}
+
+	// One more than the page is fetched to tell whether another page follows
+	reports, err := a.reportsService.GetReports(a.ctx, measurement, area.Id, start, end, limit+1, offset)
+
+	if err != nil {
+		writeV1Error(w, http.StatusInternalServerError, "Unable to list reports")
+		return
+	}
+
+	more := len(reports) > limit
+
+	if more {
+		reports = reports[:limit]
+	}
+
+	writePage(w, r, reports, limit, offset, more)
+}
+
+// ListCommands pages through the commands sent to devices and groups, newest first
+func (a *V1Api) ListCommands(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + V1Prefix + "/commands?" + r.URL.RawQuery)
+
+	limit, offset, err := pageParams(r)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	direction := model.AuditOutbound
+
+	entries, err := a.auditService.GetAuditEntries(a.ctx, model.AuditFilter{Direction: &direction, Limit: limit + 1, Offset: offset})
+
+	if err != nil {
+		writeV1Error(w, http.StatusInternalServerError, "Unable to list commands")
+		return
+	}
+
+	more := len(entries) > limit
+
+	if more {
+		entries = entries[:limit]
+	}
+
+	writePage(w, r, entries, limit, offset, more)
+}
+
+// device loads the device in the path, answering 404 for devices that do not exist or that the caller may not see
+func (a *V1Api) device(w http.ResponseWriter, r *http.Request) (*model.Device, bool) {
+
+	device, err := a.devicesService.GetDevice(a.ctx, mux.Vars(r)["ieee"])
+
+	if device == nil || err != nil || !AccessFromRequest(r).Allows(device.AreaId, model.RoleView) {
+		writeV1Error(w, http.StatusNotFound, "Device not found")
+		return nil, false
+	}
+
+	return device, true
+}
+
+func (a *V1Api) group(w http.ResponseWriter, r *http.Request) (*model.Group, bool) {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Invalid group id")
+		return nil, false
+	}
+
+	group, err := a.groupsService.GetGroup(a.ctx, id)
+
+	if group == nil || err != nil || a.groupsService.CheckGroupAccess(CommandContext(a.ctx, r), group, model.RoleView) != nil {
+		writeV1Error(w, http.StatusNotFound, "Group not found")
+		return nil, false
+	}
+
+	return group, true
+}
+
+func (a *V1Api) area(w http.ResponseWriter, r *http.Request) (*model.Area, bool) {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Invalid area id")
+		return nil, false
+	}
+
+	area, err := a.areasService.GetAreaById(a.ctx, id)
+
+	if area == nil || err != nil || !AccessFromRequest(r).Allows(&area.Id, model.RoleView) {
+		writeV1Error(w, http.StatusNotFound, "Area not found")
+		return nil, false
+	}
+
+	return area, true
+}
+
+func commandPayload(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+
+	var payload map[string]interface{}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeV1Error(w, http.StatusBadRequest, "Invalid command: "+err.Error())
+		return nil, false
+	}
+
+	if len(payload) == 0 {
+		writeV1Error(w, http.StatusBadRequest, "Invalid command: the payload is empty")
+		return nil, false
+	}
+
+	return payload, true
+}
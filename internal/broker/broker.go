@@ -3,7 +3,6 @@ package broker
 import (
 	"78concepts.com/domicile/internal/config"
 	"context"
-	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"log"
 )
@@ -35,12 +34,29 @@ func NewMqttClient(ctx context.Context, ctxCancel context.CancelFunc, source str
 
 	configuration := config.GetConfig()
 
+	user, pass, err := configuration.Broker.GetCredentials()
+
+	if err != nil {
+		log.Fatalf("Unable to read broker credentials: %v\n", err)
+	}
+
+	tlsConfig, err := newTLSConfig(configuration.Broker)
+
+	if err != nil {
+		log.Fatalf("Invalid broker TLS configuration: %v\n", err)
+	}
+
 	// Create message broker client
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", configuration.Broker.Host, configuration.Broker.Port))
+	opts.AddBroker(configuration.Broker.GetUrl())
 	opts.SetClientID(configuration.Broker.ClientId + source)
-	opts.SetUsername(configuration.Broker.User)
-	opts.SetPassword(configuration.Broker.Pass)
+	opts.SetUsername(user)
+	opts.SetPassword(pass)
+
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
 	opts.SetDefaultPublishHandler(messagePublishHandler)
 	opts.OnConnect = connectHandler
 	opts.OnConnectionLost = connectLostHandler
@@ -0,0 +1,75 @@
+package broker
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+)
+
+// Broker url schemes that paho dials over TLS
+var secureSchemes = map[string]bool{"ssl": true, "tls": true, "mqtts": true, "mqtt+ssl": true, "tcps": true, "wss": true}
+
+// newTLSConfig builds the TLS settings for a secure broker url, trusting CaFile in addition to the system roots
+// and presenting CertFile and KeyFile as the client certificate. Plain urls get nil.
+func newTLSConfig(configuration config.BrokerConfiguration) (*tls.Config, error) {
+
+	brokerUrl, err := url.Parse(configuration.GetUrl())
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker url: %w", err)
+	}
+
+	if !secureSchemes[brokerUrl.Scheme] {
+		if configuration.CaFile != "" || configuration.CertFile != "" {
+			return nil, fmt.Errorf("TLS files are configured but %s is not a secure broker url", brokerUrl.Scheme)
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: configuration.ServerName,
+	}
+
+	if configuration.CaFile != "" {
+
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(configuration.CaFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", configuration.CaFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if (configuration.CertFile == "") != (configuration.KeyFile == "") {
+		return nil, errors.New("a client certificate needs both CertFile and KeyFile")
+	}
+
+	if configuration.CertFile != "" {
+
+		certificate, err := tls.LoadX509KeyPair(configuration.CertFile, configuration.KeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,338 @@
+// Package certs provides the certificate served by the api over HTTPS, either from files provided by the user or
+// issued from a self-signed CA kept on disk, so that devices only need to trust the CA once.
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	CaCertFile = "ca.pem"
+	CaKeyFile = "ca.key"
+	ServerCertFile = "server.pem"
+	ServerKeyFile = "server.key"
+
+	caValidity = 10 * 365 * 24 * time.Hour
+	// Browsers reject server certificates valid for longer than 398 days
+	serverValidity = 397 * 24 * time.Hour
+	// Reissue the server certificate once it is this close to expiring
+	renewBefore = 30 * 24 * time.Hour
+	// A failed renewal is tried again by the first handshake after this long
+	renewRetry = time.Hour
+)
+
+// Source serves the current certificate through GetCertificate and swaps it for a freshly loaded one on Reload.
+// A renewing source also reloads in the background once the certificate is close to expiring, so a long running
+// api never serves an expired self-signed certificate.
+type Source struct {
+	mutex sync.RWMutex
+	certificate *tls.Certificate
+	notAfter time.Time
+	load func() (*tls.Certificate, error)
+	renew bool
+	renewing bool
+	renewAttempt time.Time
+}
+
+// NewFileSource serves the certificate and key in the given PEM files
+func NewFileSource(certFile string, keyFile string) (*Source, error) {
+	return newSource(func() (*tls.Certificate, error) {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &certificate, err
+	}, false)
+}
+
+// NewSelfSignedSource serves a certificate for the hostnames issued from the CA in directory, creating the CA
+// on first use and reissuing the certificate when it is missing, about to expire or does not cover the hostnames
+func NewSelfSignedSource(directory string, hostnames []string) (*Source, error) {
+	return newSource(func() (*tls.Certificate, error) {
+		return ensureServerCertificate(directory, hostnames)
+	}, true)
+}
+
+func newSource(load func() (*tls.Certificate, error), renew bool) (*Source, error) {
+
+	source := &Source{load: load, renew: renew}
+
+	if err := source.Reload(); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// Reload loads the certificate again, keeping the current one if that fails
+func (s *Source) Reload() error {
+
+	certificate, err := s.load()
+
+	if err != nil {
+		return err
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.certificate = certificate
+	s.notAfter = leaf.NotAfter
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// GetCertificate returns the current certificate, starting its renewal when it is close to expiring. The handshake
+// goes on with the current certificate, which is still valid until then.
+func (s *Source) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.renew && !s.renewing && time.Until(s.notAfter) < renewBefore && time.Since(s.renewAttempt) > renewRetry {
+		s.renewing = true
+		s.renewAttempt = time.Now()
+		go s.renewCertificate()
+	}
+
+	return s.certificate, nil
+}
+
+func (s *Source) renewCertificate() {
+
+	if err := s.Reload(); err != nil {
+		log.Println("Unable to renew the certificate, keeping the current one:", err)
+	}
+
+	s.mutex.Lock()
+	s.renewing = false
+	s.mutex.Unlock()
+}
+
+// DefaultHostnames are the names a self-signed certificate covers when none are configured: this machine's
+// hostname, localhost and every address of its network interfaces, so it can be reached by IP on the local network
+func DefaultHostnames() []string {
+
+	hostnames := []string{"localhost"}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		hostnames = append(hostnames, hostname)
+	}
+
+	addresses, err := net.InterfaceAddrs()
+
+	if err != nil {
+		log.Println("Unable to list interface addresses", err)
+		return hostnames
+	}
+
+	for _, address := range addresses {
+		if network, ok := address.(*net.IPNet); ok {
+			hostnames = append(hostnames, network.IP.String())
+		}
+	}
+
+	return hostnames
+}
+
+func ensureServerCertificate(directory string, hostnames []string) (*tls.Certificate, error) {
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	ca, caKey, err := ensureCa(directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	certPath := filepath.Join(directory, ServerCertFile)
+	keyPath := filepath.Join(directory, ServerKeyFile)
+
+	if certificate, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+
+		if err == nil && time.Until(leaf.NotAfter) > renewBefore && covers(leaf, hostnames) && leaf.CheckSignatureFrom(ca) == nil {
+			return &certificate, nil
+		}
+	}
+
+	log.Println("Issuing a server certificate for", hostnames)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := newTemplate(hostnames[0], serverValidity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	for _, hostname := range hostnames {
+		if ip := net.ParseIP(hostname); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, hostname)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+
+	return &certificate, err
+}
+
+// ensureCa loads the CA from directory, creating it if there is none yet. The CA is never replaced, since that
+// would need every device to trust the new one.
+func ensureCa(directory string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+
+	certPath := filepath.Join(directory, CaCertFile)
+	keyPath := filepath.Join(directory, CaKeyFile)
+
+	if pair, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+
+		if !ok {
+			return nil, nil, errors.New("the CA key in " + keyPath + " is not an ECDSA key")
+		}
+
+		return ca, key, nil
+
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	log.Println("Creating a certificate authority in", directory)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newTemplate("domicile local CA", caValidity)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := x509.ParseCertificate(der)
+
+	return ca, key, err
+}
+
+func newTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{CommonName: commonName, Organization: []string{"domicile"}},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter: now.Add(validity),
+	}, nil
+}
+
+func covers(certificate *x509.Certificate, hostnames []string) bool {
+
+	for _, hostname := range hostnames {
+		if certificate.VerifyHostname(hostname) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeKeyPair(certPath string, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	var certPem, keyPem bytes.Buffer
+
+	if err := pem.Encode(&certPem, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return err
+	}
+
+	if err := pem.Encode(&keyPem, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(keyPath, keyPem.Bytes(), 0600); err != nil {
+		return fmt.Errorf("unable to write %s: %w", keyPath, err)
+	}
+
+	if err := ioutil.WriteFile(certPath, certPem.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", certPath, err)
+	}
+
+	return nil
+}
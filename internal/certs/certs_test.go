@@ -0,0 +1,242 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// leaf parses the certificate served to clients
+func leaf(t *testing.T, certificate *tls.Certificate) *x509.Certificate {
+
+	t.Helper()
+
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed
+}
+
+// issue replaces the server certificate in directory with one from its CA that expires after validity
+func issue(t *testing.T, directory string, hostnames []string, validity time.Duration) {
+
+	t.Helper()
+
+	ca, caKey, err := ensureCa(directory)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := newTemplate(hostnames[0], validity)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hostname := range hostnames {
+		if ip := net.ParseIP(hostname); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, hostname)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeKeyPair(filepath.Join(directory, ServerCertFile), filepath.Join(directory, ServerKeyFile), der, key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// selfSigned creates a certificate for localhost that expires after validity
+func selfSigned(t *testing.T, validity time.Duration) *tls.Certificate {
+
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := newTemplate("localhost", validity)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestEnsureServerCertificate(t *testing.T) {
+
+	directory := filepath.Join(t.TempDir(), "certs")
+	hostnames := []string{"domicile.local", "localhost", "192.168.1.10"}
+
+	certificate, err := ensureServerCertificate(directory, hostnames)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPem, err := ioutil.ReadFile(filepath.Join(directory, CaCertFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+
+	if !roots.AppendCertsFromPEM(caPem) {
+		t.Fatal("the CA file holds no certificate")
+	}
+
+	first := leaf(t, certificate)
+
+	for _, hostname := range hostnames {
+		if _, err := first.Verify(x509.VerifyOptions{DNSName: hostname, Roots: roots}); err != nil {
+			t.Errorf("certificate for %s: %v", hostname, err)
+		}
+	}
+
+	if validity := first.NotAfter.Sub(first.NotBefore); validity > serverValidity+time.Hour {
+		t.Errorf("certificate valid for %s, browsers reject more than 398 days", validity)
+	}
+
+	reissued := func(hostnames []string) bool {
+
+		t.Helper()
+
+		previous, err := tls.LoadX509KeyPair(filepath.Join(directory, ServerCertFile), filepath.Join(directory, ServerKeyFile))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certificate, err := ensureServerCertificate(directory, hostnames)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return leaf(t, certificate).SerialNumber.Cmp(leaf(t, &previous).SerialNumber) != 0
+	}
+
+	if reissued(hostnames) {
+		t.Error("a valid certificate was reissued")
+	}
+
+	if reissued(hostnames[:2]) {
+		t.Error("a certificate covering more hostnames than needed was reissued")
+	}
+
+	if !reissued(append(hostnames, "domicile")) {
+		t.Error("a certificate missing a hostname was kept")
+	}
+
+	issue(t, directory, hostnames, renewBefore+24*time.Hour)
+
+	if reissued(hostnames) {
+		t.Error("a certificate expiring after the renewal window was reissued")
+	}
+
+	issue(t, directory, hostnames, renewBefore-24*time.Hour)
+
+	if !reissued(hostnames) {
+		t.Error("a certificate expiring within the renewal window was kept")
+	}
+
+	caAfter, err := ioutil.ReadFile(filepath.Join(directory, CaCertFile))
+
+	if err != nil || string(caAfter) != string(caPem) {
+		t.Error("the CA was replaced")
+	}
+}
+
+func TestSourceRenewal(t *testing.T) {
+
+	expiring := selfSigned(t, renewBefore-time.Hour)
+	renewed := selfSigned(t, serverValidity)
+	loads := 0
+
+	source, err := newSource(func() (*tls.Certificate, error) {
+		loads++
+		if loads == 1 {
+			return expiring, nil
+		}
+		return renewed, nil
+	}, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if served, _ := source.GetCertificate(nil); served != expiring {
+		t.Error("the handshake waited for the renewal")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+
+		if served, _ := source.GetCertificate(nil); served == renewed {
+			if loads != 2 {
+				t.Errorf("loaded %d times, expected 2", loads)
+			}
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("the certificate was not renewed")
+}
+
+func TestFileSourceNotRenewed(t *testing.T) {
+
+	directory := t.TempDir()
+
+	issue(t, directory, []string{"localhost"}, renewBefore-time.Hour)
+
+	source, err := NewFileSource(filepath.Join(directory, ServerCertFile), filepath.Join(directory, ServerKeyFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source.GetCertificate(nil)
+
+	source.mutex.RLock()
+	defer source.mutex.RUnlock()
+
+	if source.renewing {
+		t.Error("a certificate provided by the user was renewed")
+	}
+}
@@ -0,0 +1,280 @@
+// Package chart draws line charts of readings over time as SVG or PNG.
+//
+// Each series is drawn as a line through its averages over a band from its minimums to its maximums, on axes
+// scaled to the data with ticks at round values and times. Both formats share one layout so they look the same.
+package chart
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultWidth = 800
+	DefaultHeight = 400
+	MinWidth = 200
+	MinHeight = 120
+	MaxWidth = 4000
+	MaxHeight = 3000
+
+	marginLeft = 70.0
+	marginRight = 20.0
+	marginTop = 36.0
+	marginBottom = 56.0
+
+	yTickCount = 5
+	xTickCount = 8
+)
+
+const (
+	colourGrid = "#e4e7eb"
+	colourAxis = "#9aa5b1"
+	colourLabel = "#616e7c"
+	bandOpacity = 0.15
+)
+
+// Colours of the series in order, repeating when there are more series than colours
+var palette = []string{"#2680c2", "#d9534f", "#5cb85c", "#f0ad4e", "#8e44ad", "#16a085", "#7f8c8d", "#e67e22"}
+
+// Spacing of the time axis ticks, the first that gives no more than xTickCount ticks is used
+var timeSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 2 * 24 * time.Hour, 7 * 24 * time.Hour, 14 * 24 * time.Hour, 28 * 24 * time.Hour,
+}
+
+// Chart is a line chart of one measurement over time with one line per series
+type Chart struct {
+	Title  string
+	Unit   string
+	Start  time.Time
+	End    time.Time
+	// Bucket is the time each point summarises, lines are broken where points are more than two buckets apart
+	Bucket time.Duration
+	Series []Series
+	// Width and Height are in pixels, DefaultWidth and DefaultHeight when zero
+	Width  int
+	Height int
+	// Location is the time zone of the time axis, the local one when nil
+	Location *time.Location
+}
+
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// Point is the average of the readings over a bucket with the smallest and largest of them
+type Point struct {
+	Time  time.Time
+	Value float64
+	Min   float64
+	Max   float64
+}
+
+type tick struct {
+	position float64
+	label    string
+}
+
+type pixel struct {
+	x, y, min, max float64
+}
+
+// layout is a chart resolved to pixels, which the renderers only have to draw
+type layout struct {
+	width, height float64
+	left, right, top, bottom float64
+	title string
+	empty bool
+	yTicks []tick
+	xTicks []tick
+	series []seriesLayout
+}
+
+type seriesLayout struct {
+	name string
+	colour string
+	// segments are the runs of points without gaps, each drawn as its own line
+	segments [][]pixel
+	band bool
+}
+
+func newLayout(c Chart) layout {
+
+	width, height := float64(c.Width), float64(c.Height)
+	if c.Width == 0 {
+		width = DefaultWidth
+	}
+	if c.Height == 0 {
+		height = DefaultHeight
+	}
+
+	location := c.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	l := layout{
+		width: width,
+		height: height,
+		left: marginLeft,
+		right: width - marginRight,
+		top: marginTop,
+		bottom: height - marginBottom,
+		title: c.Title,
+	}
+
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, series := range c.Series {
+		for _, point := range series.Points {
+			minValue = math.Min(minValue, math.Min(point.Min, point.Value))
+			maxValue = math.Max(maxValue, math.Max(point.Max, point.Value))
+		}
+	}
+
+	start, end := c.Start, c.End
+	if !end.After(start) {
+		end = start.Add(time.Hour)
+	}
+
+	l.xTicks = timeTicks(start, end, location, l.left, l.right)
+
+	if math.IsInf(minValue, 1) {
+		l.empty = true
+		return l
+	}
+
+	if maxValue-minValue < 1e-9 {
+		minValue, maxValue = minValue-1, maxValue+1
+	}
+
+	low, high, step := niceRange(minValue, maxValue, yTickCount)
+
+	y := func(value float64) float64 {
+		return l.bottom - (value-low)/(high-low)*(l.bottom-l.top)
+	}
+
+	x := func(t time.Time) float64 {
+		return l.left + float64(t.Sub(start))/float64(end.Sub(start))*(l.right-l.left)
+	}
+
+	decimals := int(math.Max(0, -math.Floor(math.Log10(step)+1e-9)))
+
+	for i := 0; low+float64(i)*step <= high+step/2; i++ {
+		value := low + float64(i)*step
+		label := formatValue(value, decimals)
+		if c.Unit != "" {
+			label += " " + c.Unit
+		}
+		l.yTicks = append(l.yTicks, tick{position: y(value), label: label})
+	}
+
+	gap := 2 * c.Bucket
+
+	for i, series := range c.Series {
+
+		s := seriesLayout{name: series.Name, colour: palette[i%len(palette)]}
+
+		var segment []pixel
+		var previous time.Time
+
+		for _, point := range series.Points {
+
+			if point.Time.Before(start) || point.Time.After(end) {
+				continue
+			}
+
+			if gap > 0 && len(segment) > 0 && point.Time.Sub(previous) > gap {
+				s.segments = append(s.segments, segment)
+				segment = nil
+			}
+
+			segment = append(segment, pixel{x: x(point.Time), y: y(point.Value), min: y(point.Min), max: y(point.Max)})
+			s.band = s.band || point.Max-point.Min > 1e-9
+			previous = point.Time
+		}
+
+		if len(segment) > 0 {
+			s.segments = append(s.segments, segment)
+		}
+
+		l.series = append(l.series, s)
+	}
+
+	return l
+}
+
+// niceRange widens a range to multiples of a step of 1, 2 or 5 times a power of ten, giving about count steps
+func niceRange(min float64, max float64, count int) (float64, float64, float64) {
+
+	raw := (max - min) / float64(count)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+
+	step := 10 * magnitude
+	for _, factor := range []float64{1, 2, 5} {
+		if raw <= factor*magnitude {
+			step = factor * magnitude
+			break
+		}
+	}
+
+	return math.Floor(min/step) * step, math.Ceil(max/step) * step, step
+}
+
+// timeTicks places ticks at round times, such as every 3 hours from midnight, in the location
+func timeTicks(start time.Time, end time.Time, location *time.Location, left float64, right float64) []tick {
+
+	span := end.Sub(start)
+
+	step := timeSteps[len(timeSteps)-1]
+	for _, candidate := range timeSteps {
+		if span/candidate <= xTickCount {
+			step = candidate
+			break
+		}
+	}
+
+	format := "15:04"
+	if step >= 24*time.Hour {
+		format = "2 Jan"
+	} else if span > 24*time.Hour {
+		format = "2 Jan 15:04"
+	}
+
+	local := start.In(location)
+	first := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+
+	// Steps of a week or more count from the first of the month, shorter ones from midnight
+	if step >= 7*24*time.Hour {
+		first = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, location)
+	}
+
+	for first.Before(start) {
+		first = first.Add(step)
+	}
+
+	ticks := make([]tick, 0, xTickCount+1)
+	for t := first; !t.After(end); t = t.Add(step) {
+		position := left + float64(t.Sub(start))/float64(span)*(right-left)
+		ticks = append(ticks, tick{position: position, label: t.In(location).Format(format)})
+	}
+
+	return ticks
+}
+
+// legendWidth is the space a series takes in the legend, with characters as wide as the PNG font's
+func legendWidth(name string) float64 {
+	return 16 + float64(len([]rune(name))*glyphAdvance) + 20
+}
+
+func formatValue(value float64, decimals int) string {
+
+	// Avoid labelling a tick -0
+	if math.Abs(value) < math.Pow(10, -float64(decimals))/2 {
+		value = 0
+	}
+
+	return strconv.FormatFloat(value, 'f', decimals, 64)
+}
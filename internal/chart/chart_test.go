@@ -0,0 +1,297 @@
+package chart
+
+import (
+	"bytes"
+	"flag"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// melbourne is a fixed zone so the ticks do not depend on the time zone database
+var melbourne = time.FixedZone("AEST", 10*60*60)
+
+func TestNiceRange(t *testing.T) {
+
+	tests := []struct {
+		min, max        float64
+		low, high, step float64
+	}{
+		{18.3, 24.9, 18, 26, 2},
+		{0, 100, 0, 100, 20},
+		{-4.2, 3.1, -6, 4, 2},
+		{0.21, 0.58, 0.2, 0.6, 0.1},
+		{995.2, 1031.7, 990, 1040, 10},
+		{21, 23, 21, 23, 0.5},
+		{0, 1, 0, 1, 0.2},
+	}
+
+	for _, test := range tests {
+
+		low, high, step := niceRange(test.min, test.max, yTickCount)
+
+		if !near(low, test.low) || !near(high, test.high) || !near(step, test.step) {
+			t.Errorf("niceRange(%v, %v) = %v, %v, %v, expected %v, %v, %v", test.min, test.max, low, high, step, test.low, test.high, test.step)
+		}
+	}
+}
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestTimeTicks(t *testing.T) {
+
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, melbourne)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		labels     []string
+	}{
+		{
+			name:   "six hours",
+			start:  at(time.March, 4, 0, 0),
+			end:    at(time.March, 4, 6, 0),
+			labels: []string{"00:00", "01:00", "02:00", "03:00", "04:00", "05:00", "06:00"},
+		},
+		{
+			name:   "off the hour",
+			start:  at(time.March, 4, 10, 20),
+			end:    at(time.March, 4, 14, 20),
+			labels: []string{"10:30", "11:00", "11:30", "12:00", "12:30", "13:00", "13:30", "14:00"},
+		},
+		{
+			name:   "a day",
+			start:  at(time.March, 4, 8, 0),
+			end:    at(time.March, 5, 8, 0),
+			labels: []string{"09:00", "12:00", "15:00", "18:00", "21:00", "00:00", "03:00", "06:00"},
+		},
+		{
+			name:   "two days",
+			start:  at(time.March, 4, 0, 0),
+			end:    at(time.March, 6, 0, 0),
+			labels: []string{"4 Mar 00:00", "4 Mar 06:00", "4 Mar 12:00", "4 Mar 18:00", "5 Mar 00:00", "5 Mar 06:00", "5 Mar 12:00", "5 Mar 18:00", "6 Mar 00:00"},
+		},
+		{
+			name:   "a week",
+			start:  at(time.March, 4, 12, 0),
+			end:    at(time.March, 11, 12, 0),
+			labels: []string{"5 Mar", "6 Mar", "7 Mar", "8 Mar", "9 Mar", "10 Mar", "11 Mar"},
+		},
+		{
+			name:   "a quarter from the first of the month",
+			start:  at(time.January, 10, 0, 0),
+			end:    at(time.April, 10, 0, 0),
+			labels: []string{"15 Jan", "29 Jan", "12 Feb", "26 Feb", "12 Mar", "26 Mar", "9 Apr"},
+		},
+	}
+
+	for _, test := range tests {
+
+		ticks := timeTicks(test.start, test.end, melbourne, 100, 500)
+
+		labels := make([]string, 0, len(ticks))
+		for _, tick := range ticks {
+			labels = append(labels, tick.label)
+		}
+
+		if strings.Join(labels, ", ") != strings.Join(test.labels, ", ") {
+			t.Errorf("%s: ticks %v, expected %v", test.name, labels, test.labels)
+			continue
+		}
+
+		for i, tick := range ticks {
+			if tick.position < 100 || tick.position > 500 || (i > 0 && tick.position <= ticks[i-1].position) {
+				t.Errorf("%s: tick %s at %v, out of order or off the axis", test.name, tick.label, tick.position)
+			}
+		}
+	}
+
+	// The first tick of a day starting at midnight is on the axis
+	if ticks := timeTicks(at(time.March, 4, 0, 0), at(time.March, 5, 0, 0), melbourne, 100, 500); ticks[0].position != 100 || ticks[len(ticks)-1].position != 500 {
+		t.Errorf("ticks from %v to %v, expected the ends of the axis", ticks[0].position, ticks[len(ticks)-1].position)
+	}
+}
+
+// readings is a day of hourly readings with a gap in the afternoon
+func readings() Chart {
+
+	start := time.Date(2026, time.March, 4, 0, 0, 0, 0, melbourne)
+
+	chart := Chart{
+		Title:    "Temperature <inside>",
+		Unit:     "°C",
+		Start:    start,
+		End:      start.Add(24 * time.Hour),
+		Bucket:   time.Hour,
+		Location: melbourne,
+	}
+
+	lounge := Series{Name: "Lounge"}
+	bedroom := Series{Name: "Bedroom & ensuite"}
+
+	for hour := 0; hour <= 24; hour++ {
+
+		value := 18 + 4*math.Sin(float64(hour)/24*2*math.Pi)
+		at := start.Add(time.Duration(hour) * time.Hour)
+
+		lounge.Points = append(lounge.Points, Point{Time: at, Value: value, Min: value - 0.5, Max: value + 0.5})
+
+		if hour < 13 || hour > 16 {
+			bedroom.Points = append(bedroom.Points, Point{Time: at, Value: value - 2, Min: value - 2, Max: value - 2})
+		}
+	}
+
+	chart.Series = []Series{lounge, bedroom}
+
+	return chart
+}
+
+func TestNewLayout(t *testing.T) {
+
+	l := newLayout(readings())
+
+	if l.empty || l.width != DefaultWidth || l.height != DefaultHeight {
+		t.Fatalf("layout %vx%v, empty %v", l.width, l.height, l.empty)
+	}
+
+	// Readings from 12.0 to 22.5 are a range of 2.1 per tick, rounded up to ticks every 5 degrees from 10 to 25
+	if len(l.yTicks) != 4 || l.yTicks[0].label != "10 °C" || l.yTicks[3].label != "25 °C" {
+		t.Fatalf("y ticks %+v", l.yTicks)
+	}
+
+	if l.yTicks[0].position != l.bottom || l.yTicks[3].position != l.top {
+		t.Errorf("y ticks from %v to %v, expected %v to %v", l.yTicks[0].position, l.yTicks[3].position, l.bottom, l.top)
+	}
+
+	lounge, bedroom := l.series[0], l.series[1]
+
+	if len(lounge.segments) != 1 || len(lounge.segments[0]) != 25 || !lounge.band {
+		t.Errorf("lounge has %d segments, band %v", len(lounge.segments), lounge.band)
+	}
+
+	// Four missing hours are more than two buckets, the line is broken there
+	if len(bedroom.segments) != 2 || len(bedroom.segments[0]) != 13 || len(bedroom.segments[1]) != 8 || bedroom.band {
+		t.Errorf("bedroom has %d segments, band %v", len(bedroom.segments), bedroom.band)
+	}
+
+	if first := lounge.segments[0][0]; first.x != l.left || first.min < first.y || first.max > first.y {
+		t.Errorf("first point %+v", first)
+	}
+
+	// Points outside the time range are left out
+	chart := readings()
+	chart.End = chart.Start.Add(6 * time.Hour)
+
+	if points := len(newLayout(chart).series[0].segments[0]); points != 7 {
+		t.Errorf("%d points in six hours, expected 7", points)
+	}
+}
+
+func TestNewLayoutFlatAndEmpty(t *testing.T) {
+
+	start := time.Date(2026, time.March, 4, 0, 0, 0, 0, melbourne)
+
+	flat := newLayout(Chart{
+		Start:    start,
+		End:      start.Add(time.Hour),
+		Series:   []Series{{Points: []Point{{Time: start, Value: 50, Min: 50, Max: 50}, {Time: start.Add(time.Hour), Value: 50, Min: 50, Max: 50}}}},
+		Location: melbourne,
+	})
+
+	// A flat series is given a range of one either side so it is drawn across the middle
+	if len(flat.yTicks) == 0 || flat.yTicks[0].label != "49.0" || flat.yTicks[len(flat.yTicks)-1].label != "51.0" {
+		t.Errorf("flat y ticks %+v", flat.yTicks)
+	}
+
+	if y := flat.series[0].segments[0][0].y; !near(y, (flat.top+flat.bottom)/2) {
+		t.Errorf("flat series at %v, expected the middle %v", y, (flat.top+flat.bottom)/2)
+	}
+
+	for _, chart := range []Chart{
+		{Start: start, End: start.Add(time.Hour), Location: melbourne},
+		{Start: start, End: start.Add(time.Hour), Series: []Series{{Name: "Lounge"}}, Location: melbourne},
+		// An empty time range is drawn as an hour
+		{Start: start, End: start, Location: melbourne},
+	} {
+
+		empty := newLayout(chart)
+
+		if !empty.empty || len(empty.yTicks) != 0 || len(empty.series) != 0 {
+			t.Errorf("empty layout %+v", empty)
+		}
+
+		if len(empty.xTicks) == 0 || empty.xTicks[0].label != "00:00" || empty.xTicks[len(empty.xTicks)-1].label != "01:00" {
+			t.Errorf("empty layout x ticks %+v", empty.xTicks)
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+
+	golden := func(name string, chart Chart) {
+
+		t.Helper()
+
+		var svg bytes.Buffer
+
+		if err := RenderSVG(&svg, chart); err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join("testdata", name)
+
+		if *update {
+			if err := ioutil.WriteFile(path, svg.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(svg.Bytes(), expected) {
+			t.Errorf("%s differs from the rendered chart, run go test -update after checking it:\n%s", path, svg.String())
+		}
+	}
+
+	golden("readings.svg", readings())
+
+	start := time.Date(2026, time.March, 4, 0, 0, 0, 0, melbourne)
+
+	golden("empty.svg", Chart{Title: "Humidity", Start: start, End: start.Add(6 * time.Hour), Width: 400, Height: 200, Location: melbourne})
+}
+
+func TestRenderPNG(t *testing.T) {
+
+	var data bytes.Buffer
+
+	chart := readings()
+	chart.Width, chart.Height = 640, 320
+
+	if err := RenderPNG(&data, chart); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := img.Bounds().Size(); size.X != 640 || size.Y != 320 {
+		t.Errorf("image of %v, expected 640x320", size)
+	}
+}
@@ -0,0 +1,148 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+)
+
+// RenderPNG writes the chart as a PNG image, for clients that cannot show SVG such as most mail readers
+func RenderPNG(w io.Writer, c Chart) error {
+
+	l := newLayout(c)
+
+	img := image.NewRGBA(image.Rect(0, 0, int(l.width), int(l.height)))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	grid, axis, label := parseColour(colourGrid), parseColour(colourAxis), parseColour(colourLabel)
+
+	if l.title != "" {
+		drawText(img, int(l.left), 8, l.title, 2, color.Black)
+	}
+
+	for _, t := range l.yTicks {
+		y := int(math.Round(t.position))
+		drawLine(img, l.left, t.position, l.right, t.position, 1, grid)
+		drawText(img, int(l.left)-6-textWidth(t.label, 1), y-glyphHeight/2, t.label, 1, label)
+	}
+
+	for _, t := range l.xTicks {
+		drawLine(img, t.position, l.bottom, t.position, l.bottom+4, 1, axis)
+		drawText(img, int(t.position)-textWidth(t.label, 1)/2, int(l.bottom)+9, t.label, 1, label)
+	}
+
+	drawLine(img, l.left, l.bottom, l.right, l.bottom, 1, axis)
+
+	if l.empty {
+		text := "No readings"
+		drawText(img, int((l.left+l.right)/2)-textWidth(text, 1)/2, int((l.top+l.bottom)/2), text, 1, label)
+	}
+
+	for _, s := range l.series {
+		if !s.band {
+			continue
+		}
+		colour := parseColour(s.colour)
+		for _, segment := range s.segments {
+			fillBand(img, segment, colour)
+		}
+	}
+
+	for _, s := range l.series {
+		colour := parseColour(s.colour)
+		for _, segment := range s.segments {
+			if len(segment) == 1 {
+				drawLine(img, segment[0].x-1, segment[0].y, segment[0].x+1, segment[0].y, 3, colour)
+			}
+			for i := 1; i < len(segment); i++ {
+				drawLine(img, segment[i-1].x, segment[i-1].y, segment[i].x, segment[i].y, 2, colour)
+			}
+		}
+	}
+
+	x := l.left
+	for _, s := range l.series {
+		if s.name == "" {
+			continue
+		}
+		colour := parseColour(s.colour)
+		draw.Draw(img, image.Rect(int(x), int(l.height)-16, int(x)+12, int(l.height)-12), image.NewUniform(colour), image.Point{}, draw.Src)
+		drawText(img, int(x)+16, int(l.height)-17, s.name, 1, color.Black)
+		x += legendWidth(s.name)
+	}
+
+	return png.Encode(w, img)
+}
+
+// drawLine draws a line of the given width by stepping along its longer axis
+func drawLine(img *image.RGBA, x0 float64, y0 float64, x1 float64, y1 float64, width int, c color.Color) {
+
+	steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+
+	for i := 0; i <= steps; i++ {
+
+		t := float64(i) / float64(steps)
+		x := int(math.Round(x0 + (x1-x0)*t))
+		y := int(math.Round(y0 + (y1-y0)*t))
+
+		for dy := 0; dy < width; dy++ {
+			for dx := 0; dx < width; dx++ {
+				img.Set(x+dx-width/2, y+dy-width/2, c)
+			}
+		}
+	}
+}
+
+// fillBand shades each column between the minimum and maximum lines of a segment
+func fillBand(img *image.RGBA, segment []pixel, c color.RGBA) {
+
+	for i := 1; i < len(segment); i++ {
+
+		from, to := segment[i-1], segment[i]
+
+		for x := int(math.Ceil(from.x)); float64(x) <= to.x; x++ {
+
+			t := 0.0
+			if to.x > from.x {
+				t = (float64(x) - from.x) / (to.x - from.x)
+			}
+
+			top := from.max + (to.max-from.max)*t
+			bottom := from.min + (to.min-from.min)*t
+
+			for y := int(math.Round(top)); y <= int(math.Round(bottom)); y++ {
+				blend(img, x, y, c, bandOpacity)
+			}
+		}
+	}
+}
+
+func blend(img *image.RGBA, x int, y int, c color.RGBA, opacity float64) {
+
+	if !(image.Point{X: x, Y: y}).In(img.Bounds()) {
+		return
+	}
+
+	under := img.RGBAAt(x, y)
+	mix := func(a uint8, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-opacity) + float64(b)*opacity))
+	}
+
+	img.SetRGBA(x, y, color.RGBA{R: mix(under.R, c.R), G: mix(under.G, c.G), B: mix(under.B, c.B), A: 255})
+}
+
+// parseColour reads a #rrggbb colour
+func parseColour(hex string) color.RGBA {
+
+	value, err := strconv.ParseUint(hex[1:], 16, 32)
+
+	if len(hex) != 7 || err != nil {
+		return color.RGBA{A: 255}
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}
+}
@@ -0,0 +1,98 @@
+package chart
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// RenderSVG writes the chart as an SVG document
+func RenderSVG(w io.Writer, c Chart) error {
+
+	l := newLayout(c)
+
+	var svg strings.Builder
+
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="11">`+"\n", l.width, l.height, l.width, l.height)
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+
+	if l.title != "" {
+		fmt.Fprintf(&svg, `<text x="%.1f" y="22" font-size="14" font-weight="bold">%s</text>`+"\n", l.left, html.EscapeString(l.title))
+	}
+
+	for _, t := range l.yTicks {
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", l.left, t.position, l.right, t.position, colourGrid)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="end" fill="%s">%s</text>`+"\n", l.left-6, t.position+4, colourLabel, html.EscapeString(t.label))
+	}
+
+	for _, t := range l.xTicks {
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", t.position, l.bottom, t.position, l.bottom+4, colourAxis)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="%s">%s</text>`+"\n", t.position, l.bottom+16, colourLabel, html.EscapeString(t.label))
+	}
+
+	fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", l.left, l.bottom, l.right, l.bottom, colourAxis)
+
+	if l.empty {
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="%s">No readings</text>`+"\n", (l.left+l.right)/2, (l.top+l.bottom)/2, colourLabel)
+	}
+
+	for _, s := range l.series {
+		if !s.band {
+			continue
+		}
+		for _, segment := range s.segments {
+			fmt.Fprintf(&svg, `<polygon points="%s" fill="%s" fill-opacity="%.2f"/>`+"\n", bandPoints(segment), s.colour, bandOpacity)
+		}
+	}
+
+	for _, s := range l.series {
+		for _, segment := range s.segments {
+			if len(segment) == 1 {
+				fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="2" fill="%s"/>`+"\n", segment[0].x, segment[0].y, s.colour)
+				continue
+			}
+			fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"/>`+"\n", linePoints(segment), s.colour)
+		}
+	}
+
+	x := l.left
+	for _, s := range l.series {
+		if s.name == "" {
+			continue
+		}
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="12" height="4" fill="%s"/>`+"\n", x, l.height-16, s.colour)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f">%s</text>`+"\n", x+16, l.height-11, html.EscapeString(s.name))
+		x += legendWidth(s.name)
+	}
+
+	svg.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, svg.String())
+
+	return err
+}
+
+func linePoints(segment []pixel) string {
+
+	points := make([]string, 0, len(segment))
+	for _, p := range segment {
+		points = append(points, fmt.Sprintf("%.1f,%.1f", p.x, p.y))
+	}
+
+	return strings.Join(points, " ")
+}
+
+// bandPoints goes along the maximums and back along the minimums
+func bandPoints(segment []pixel) string {
+
+	points := make([]string, 0, 2*len(segment))
+	for _, p := range segment {
+		points = append(points, fmt.Sprintf("%.1f,%.1f", p.x, p.max))
+	}
+	for i := len(segment) - 1; i >= 0; i-- {
+		points = append(points, fmt.Sprintf("%.1f,%.1f", segment[i].x, segment[i].min))
+	}
+
+	return strings.Join(points, " ")
+}
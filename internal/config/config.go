@@ -3,22 +3,40 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"path"
 	"runtime"
+	"strings"
+	"time"
 )
 
 type Configuration struct {
 	Broker BrokerConfiguration
 	Database DatabaseConfiguration
+	Location LocationConfiguration
+	Notifiers []NotifierConfiguration
+	Maintenance MaintenanceConfiguration
+	Http HttpConfiguration
+	Ingest IngestConfiguration
 }
 
+// BrokerConfiguration connects to Url when set, e.g. ssl://broker:8883 or wss://broker/mqtt, otherwise tcp://Host:Port.
+// The TLS files are PEM encoded, and UserFile and PassFile take precedence over User and Pass.
 type BrokerConfiguration struct {
 	Host string
 	Port int
+	Url string
 	ClientId string
 	User string
 	Pass string
+	UserFile string
+	PassFile string
+	CaFile string
+	CertFile string
+	KeyFile string
+	ServerName string
 }
 
 type DatabaseConfiguration struct {
@@ -31,6 +49,65 @@ type DatabaseConfiguration struct {
 	IlluminanceReportsCollection string
 }
 
+type LocationConfiguration struct {
+	Timezone string
+	Latitude float64
+	Longitude float64
+}
+
+// NotifierConfiguration describes one notification channel, the fields used depend on its type
+type NotifierConfiguration struct {
+	Name string
+	Type string
+	Url string
+	Token string
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+	To []string
+}
+
+// MaintenanceConfiguration intervals are in minutes, ReportingIntervals overrides them per device model id
+type MaintenanceConfiguration struct {
+	BatteryReportingInterval int
+	MainsReportingInterval int
+	ReportingIntervals map[string]int
+	WeakLinkQuality int
+	DigestNotifier string
+	DigestSchedule string
+}
+
+// HttpConfiguration serves the api over plain HTTP on Address and over HTTPS on TlsAddress, either of which can be
+// left out. HTTPS uses CertFile and KeyFile when given, otherwise a certificate for Hostnames issued from a
+// self-signed CA kept in CertDirectory. With RedirectHttp, Address only redirects to HTTPS. The client named in
+// X-Forwarded-For is only believed from the TrustedProxies, given as addresses or CIDR ranges.
+type HttpConfiguration struct {
+	Address string
+	TlsAddress string
+	CertFile string
+	KeyFile string
+	CertDirectory string
+	Hostnames []string
+	RedirectHttp bool
+	TrustedProxies []string
+}
+
+// IngestConfiguration sizes the queue of readings waiting to be written, in batches of up to BatchSize at least every
+// FlushInterval milliseconds. A full queue holds back the broker for up to EnqueueTimeout milliseconds before the
+// reading is dropped. Counters are logged and published on the event bus every StatsInterval minutes. Zero values
+// take the defaults. Readings are kept in SpoolDirectory, "spool" when not set, while the database is unavailable,
+// along with the devices to record them from.
+type IngestConfiguration struct {
+	QueueSize int
+	BatchSize int
+	FlushInterval int
+	EnqueueTimeout int
+	StatsInterval int
+	SpoolDirectory string
+}
+
 var configurationFiles map[string]*Configuration
 
 func GetConfig(params ...string) Configuration {
@@ -80,4 +157,64 @@ func cacheConfiguration(filename string, configuration Configuration) {
 
 	configurationFiles[filename] = &configuration
 
-}
\ No newline at end of file
+}
+// GetUrl returns the broker url, defaulting to plain tcp on the configured host and port
+func (c BrokerConfiguration) GetUrl() string {
+
+	if c.Url != "" {
+		return c.Url
+	}
+
+	return fmt.Sprintf("tcp://%s:%d", c.Host, c.Port)
+}
+
+// GetCredentials returns the broker username and password, read from UserFile and PassFile when they are set
+func (c BrokerConfiguration) GetCredentials() (string, string, error) {
+
+	user, err := readSecret(c.UserFile, c.User)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	pass, err := readSecret(c.PassFile, c.Pass)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return user, pass, nil
+}
+
+// readSecret returns the contents of a file without a trailing newline, or the fallback when no file is given
+func readSecret(filename string, fallback string) (string, error) {
+
+	if filename == "" {
+		return fallback, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// GetTimezone returns the configured timezone, falling back to the system timezone
+func (c LocationConfiguration) GetTimezone() *time.Location {
+
+	if c.Timezone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(c.Timezone)
+
+	if err != nil {
+		log.Printf("Unable to load timezone %s: %v\n", c.Timezone, err)
+		return time.Local
+	}
+
+	return location
+}
@@ -0,0 +1,258 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five field cron expression: minute hour day-of-month month day-of-week
+type Schedule struct {
+	Expression string
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	anyDay     bool
+	anyWeekday bool
+}
+
+// Every bit of the hours field, a schedule like this follows real time across the clocks changing
+const everyHour = 1<<24 - 1
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func Parse(expression string) (*Schedule, error) {
+
+	spec := strings.TrimSpace(expression)
+
+	if shortcut, ok := shortcuts[strings.ToLower(spec)]; ok {
+		spec = shortcut
+	}
+
+	fields := strings.Fields(spec)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, found %d in %q", len(fields), expression)
+	}
+
+	schedule := Schedule{Expression: expression}
+
+	var err error
+
+	if schedule.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.days, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if schedule.weekdays, err = parseField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, err
+	}
+
+	// Both 0 and 7 mean Sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+
+	schedule.anyDay = unrestricted(fields[2])
+	schedule.anyWeekday = unrestricted(fields[4])
+
+	return &schedule, nil
+}
+
+// Matches reports whether the schedule fires in the minute containing t
+func (s *Schedule) Matches(t time.Time) bool {
+
+	if s.minutes&(1<<uint(t.Minute())) == 0 || s.hours&(1<<uint(t.Hour())) == 0 || s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	return s.matchesDay(t)
+}
+
+// Next returns the first time strictly after t at which the schedule fires, in t's location. As in Vixie cron, a
+// schedule for certain hours fires once in an hour repeated when the clocks go back, and fires as soon as they
+// resume for a time that fell in an hour they skipped going forward.
+func (s *Schedule) Next(t time.Time) time.Time {
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+
+		var next time.Time
+
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		var skipped bool
+
+		if t, skipped = s.clockChange(t, next); skipped {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// clockChange adjusts a step from t to next that crosses the clocks changing, reporting whether the step went past
+// a time the schedule fires at that never happened
+func (s *Schedule) clockChange(t time.Time, next time.Time) (time.Time, bool) {
+
+	if s.hours == everyHour {
+		return next, false
+	}
+
+	wall, nextWall := wallClock(t), wallClock(next)
+
+	// The clocks went back, the times until they pass where they were have been tried already
+	if !nextWall.After(wall) {
+		return next.Add(wall.Sub(nextWall) + time.Minute), false
+	}
+
+	// The clocks went forward, skipping the times between
+	if gap := nextWall.Sub(wall) - next.Sub(t); gap > 0 {
+		for skipped := nextWall.Add(-gap); skipped.Before(nextWall); skipped = skipped.Add(time.Minute) {
+			if s.Matches(skipped) {
+				return next, true
+			}
+		}
+	}
+
+	return next, false
+}
+
+// wallClock is the time shown on a clock in t's location, as a time that never skips nor repeats
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+
+	// As in Vixie cron, when both day fields are restricted either one may match
+	if !s.anyDay && !s.anyWeekday {
+		return day || weekday
+	}
+
+	return day && weekday
+}
+
+// unrestricted reports whether a day field starts from the whole range, stepped or not. As in Vixie cron, */2 in one
+// day field still leaves the other to decide alone rather than either one matching.
+func unrestricted(field string) bool {
+	return strings.HasPrefix(field, "*") || strings.HasPrefix(field, "?")
+}
+
+func parseField(field string, min int, max int, names map[string]int) (uint64, error) {
+
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+
+		if part == "" {
+			return 0, errors.New("cron: empty list item in " + field)
+		}
+
+		step := 1
+		rangePart := part
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron: invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		start, end := min, max
+
+		if rangePart != "*" && rangePart != "?" {
+
+			bounds := strings.SplitN(rangePart, "-", 2)
+
+			var err error
+
+			if start, err = parseValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+
+			end = start
+
+			if len(bounds) == 2 {
+				if end, err = parseValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("cron: %q out of range %d-%d", part, min, max)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+
+	if names != nil {
+		if i, ok := names[strings.ToLower(value)]; ok {
+			return i, nil
+		}
+	}
+
+	i, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value %q", value)
+	}
+
+	return i, nil
+}
@@ -0,0 +1,209 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"1,,2 * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expression); err == nil {
+			t.Errorf("Parse(%q) succeeded, expected an error", expression)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+
+	// A Wednesday
+	wednesday := time.Date(2026, time.January, 14, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expression string
+		time       time.Time
+		matches    bool
+	}{
+		{"* * * * *", wednesday, true},
+		{"30 9 * * *", wednesday, true},
+		{"31 9 * * *", wednesday, false},
+		{"*/15 * * * *", wednesday, true},
+		{"*/20 * * * *", wednesday, false},
+		{"0-30/10 9-17 * * mon-fri", wednesday, true},
+		{"30 9 * jan wed", wednesday, true},
+		{"30 9 * feb *", wednesday, false},
+		{"@hourly", wednesday, false},
+		// Both 0 and 7 are Sunday
+		{"30 9 * * 7", wednesday.AddDate(0, 0, 4), true},
+		{"30 9 * * 0", wednesday.AddDate(0, 0, 4), true},
+		// With both day fields restricted either one may match
+		{"30 9 1 * wed", wednesday, true},
+		{"30 9 14 * mon", wednesday, true},
+		{"30 9 1 * mon", wednesday, false},
+		// A step over the whole range leaves the other day field to decide alone
+		{"30 9 */2 * mon", wednesday, false},
+		{"30 9 */2 * wed", wednesday, false},
+		{"30 9 */2 * wed", wednesday.AddDate(0, 0, 7), true},
+		{"30 9 1 * */2", wednesday, false},
+		{"30 9 14 * */2", wednesday, false},
+		{"30 9 14 * */3", wednesday, true},
+	}
+
+	for _, test := range tests {
+
+		schedule, err := Parse(test.expression)
+
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", test.expression, err)
+		}
+
+		if matches := schedule.Matches(test.time); matches != test.matches {
+			t.Errorf("%q Matches(%s) = %v, expected %v", test.expression, test.time.Format(time.RFC3339), matches, test.matches)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+
+	melbourne, err := time.LoadLocation("Australia/Melbourne")
+
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	// The clocks go back from 3:00 to 2:00 on the 5th of April 2026 and forward from 2:00 to 3:00 on the 4th of
+	// October 2026, in Melbourne
+	firstTwoOClock := time.Date(2026, time.April, 4, 15, 0, 0, 0, time.UTC).In(melbourne)
+	secondTwoOClock := firstTwoOClock.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		expression string
+		from       time.Time
+		expected   []time.Time
+	}{
+		{
+			name:       "daily",
+			expression: "0 9 * * *",
+			from:       time.Date(2026, time.January, 14, 9, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2026, time.January, 15, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.January, 16, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "end of month",
+			expression: "0 0 31 * *",
+			from:       time.Date(2026, time.January, 31, 12, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, time.May, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "leap day",
+			expression: "0 12 29 feb *",
+			from:       time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "weekly digest",
+			expression: "0 9 * * sun",
+			from:       time.Date(2026, time.January, 14, 9, 30, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2026, time.January, 18, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.January, 25, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "fixed time in the repeated hour fires once",
+			expression: "30 2 * * *",
+			from:       firstTwoOClock,
+			expected: []time.Time{
+				firstTwoOClock.Add(30 * time.Minute),
+				time.Date(2026, time.April, 6, 2, 30, 0, 0, melbourne),
+			},
+		},
+		{
+			name:       "fixed time before the repeated hour fires once",
+			expression: "30 2 * * *",
+			from:       time.Date(2026, time.April, 5, 0, 0, 0, 0, melbourne),
+			expected: []time.Time{
+				secondTwoOClock.Add(30 * time.Minute),
+				time.Date(2026, time.April, 6, 2, 30, 0, 0, melbourne),
+			},
+		},
+		{
+			name:       "every hour follows real time through the repeated hour",
+			expression: "0 * * * *",
+			from:       firstTwoOClock.Add(-30 * time.Minute),
+			expected: []time.Time{
+				firstTwoOClock,
+				secondTwoOClock,
+				secondTwoOClock.Add(time.Hour),
+			},
+		},
+		{
+			name:       "fixed time in the skipped hour fires when the clocks resume",
+			expression: "30 2 * * *",
+			from:       time.Date(2026, time.October, 4, 1, 0, 0, 0, melbourne),
+			expected: []time.Time{
+				time.Date(2026, time.October, 4, 3, 0, 0, 0, melbourne),
+				time.Date(2026, time.October, 5, 2, 30, 0, 0, melbourne),
+			},
+		},
+		{
+			name:       "every twenty minutes follows real time through the skipped hour",
+			expression: "*/20 * * * *",
+			from:       time.Date(2026, time.October, 4, 1, 30, 0, 0, melbourne),
+			expected: []time.Time{
+				time.Date(2026, time.October, 4, 1, 40, 0, 0, melbourne),
+				time.Date(2026, time.October, 4, 3, 0, 0, 0, melbourne),
+				time.Date(2026, time.October, 4, 3, 20, 0, 0, melbourne),
+			},
+		},
+		{
+			name:       "never",
+			expression: "0 0 30 feb *",
+			from:       time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+			expected:   []time.Time{{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			schedule, err := Parse(test.expression)
+
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", test.expression, err)
+			}
+
+			next := test.from
+
+			for _, expected := range test.expected {
+
+				next = schedule.Next(next)
+
+				if !next.Equal(expected) {
+					t.Fatalf("Next = %s, expected %s", next.Format(time.RFC3339), expected.Format(time.RFC3339))
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,21 @@ package database
 import (
 	"78concepts.com/domicile/internal/config"
 	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
 	"log"
+	"net"
 	"os"
+	"strings"
+	"time"
+)
+
+const (
+	minConnectBackoff = time.Second
+	maxConnectBackoff = time.Minute
 )
 
 type DB struct {
@@ -28,3 +40,113 @@ func NewPGXPool() *pgxpool.Pool {
 	return dbPool
 }
 
+// NewLazyPGXPool returns a pool that connects when first used rather than straight away, for services that should
+// start and outlast the database restarting. Queries fail as unavailable until it can be reached.
+func NewLazyPGXPool() (*pgxpool.Pool, error) {
+
+	poolConfig, err := pgxpool.ParseConfig(config.GetConfig().Database.ConnectionString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	poolConfig.LazyConnect = true
+
+	return pgxpool.ConnectConfig(context.Background(), poolConfig)
+}
+
+// WaitForPGXPool waits until the pool reaches the database, retrying with backoff. Once connected the pool
+// reconnects by itself.
+func WaitForPGXPool(ctx context.Context, dbPool *pgxpool.Pool) error {
+
+	backoff := NewBackoff(minConnectBackoff, maxConnectBackoff)
+
+	for {
+
+		err := dbPool.Ping(ctx)
+
+		if err == nil {
+			log.Println("Connection to database successful")
+			return nil
+		}
+
+		delay := backoff.Next()
+
+		log.Printf("Unable to connect to database, retrying in %s: %v\n", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// IsUnavailable reports whether err means the database could not be reached or is not taking queries, rather than
+// that it refused the query itself
+func IsUnavailable(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	// Failing to connect for any reason, even a server error such as a bad password, leaves nothing to retry but
+	// the connection
+	if isConnectError(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+
+	// Connection exceptions, insufficient resources and the server shutting down or starting up
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+
+	var netErr net.Error
+
+	// A connection lost part way through a query
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || pgconn.SafeToRetry(err)
+}
+
+// isConnectError finds the error pgconn returns when it cannot connect, which it does not export
+func isConnectError(err error) bool {
+
+	for ; err != nil; err = errors.Unwrap(err) {
+		if fmt.Sprintf("%T", err) == "*pgconn.connectError" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Backoff doubles the delay between retries from min up to max
+type Backoff struct {
+	min time.Duration
+	max time.Duration
+	next time.Duration
+}
+
+func NewBackoff(min time.Duration, max time.Duration) *Backoff {
+	return &Backoff{min: min, max: max, next: min}
+}
+
+func (b *Backoff) Next() time.Duration {
+
+	delay := b.next
+
+	if b.next *= 2; b.next > b.max {
+		b.next = b.max
+	}
+
+	return delay
+}
+
+func (b *Backoff) Reset() {
+	b.next = b.min
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsUnavailable(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{"no error", nil, false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"invalid value", fmt.Errorf("copying: %w", &pgconn.PgError{Code: "22P02"}), false},
+		{"undefined table", &pgconn.PgError{Code: "42P01"}, false},
+		{"client error", errors.New("CopyReports: unknown measurement noise"), false},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"admin shutdown", fmt.Errorf("copying: %w", &pgconn.PgError{Code: "57P01"}), true},
+		{"starting up", &pgconn.PgError{Code: "57P03"}, true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{"connection dropped", fmt.Errorf("receive message failed: %w", io.ErrUnexpectedEOF), true},
+		{"deadline", fmt.Errorf("copying: %w", context.DeadlineExceeded), true},
+	}
+
+	for _, test := range tests {
+		if unavailable := IsUnavailable(test.err); unavailable != test.unavailable {
+			t.Errorf("%s: IsUnavailable(%v) = %v, expected %v", test.name, test.err, unavailable, test.unavailable)
+		}
+	}
+}
+
+func TestIsUnavailableWhenNothingListens(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = pgconn.Connect(ctx, fmt.Sprintf("postgres://domicile@127.0.0.1:%d/domicile?sslmode=disable", port))
+
+	if err == nil {
+		t.Fatal("connected with nothing listening")
+	}
+
+	if !isConnectError(err) || !IsUnavailable(err) {
+		t.Errorf("IsUnavailable(%v) = false", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+
+	backoff := NewBackoff(time.Second, 5*time.Second)
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := backoff.Next(); delay != expected {
+			t.Fatalf("Next = %s, expected %s", delay, expected)
+		}
+	}
+
+	backoff.Reset()
+
+	if delay := backoff.Next(); delay != time.Second {
+		t.Errorf("Next after Reset = %s, expected %s", delay, time.Second)
+	}
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	TopicEvents = "domicile/events"
+)
+
+const (
+	DeviceDiscovered    = "device_discovered"
+	DeviceRenamed       = "device_renamed"
+	DeviceRemoved       = "device_removed"
+	DeviceStateChanged  = "device_state_changed"
+	MeasurementRecorded = "measurement_recorded"
+	GroupChanged        = "group_changed"
+
+	DeviceAvailabilityChanged = "device_availability_changed"
+	AutomationChanged         = "automation_changed"
+	NotificationRequested     = "notification_requested"
+	ScheduleChanged           = "schedule_changed"
+	AlertRuleChanged          = "alert_rule_changed"
+	BridgeStateChanged        = "bridge_state_changed"
+	IngestStatsReported       = "ingest_stats_reported"
+)
+
+// Event is the envelope published on the bus, the payload is one of the *Event structs below
+type Event struct {
+	Type    string          `json:"type"`
+	Source  string          `json:"source"`
+	Date    time.Time       `json:"date"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type Handler func(ctx context.Context, event Event)
+
+type IEventBus interface {
+	Publish(eventType string, payload interface{}) error
+	Subscribe(handler Handler, eventTypes ...string) error
+}
+
+type DeviceEvent struct {
+	Device               model.Device `json:"device"`
+	PreviousFriendlyName *string      `json:"previousFriendlyName,omitempty"`
+}
+
+type DeviceStateEvent struct {
+	IeeeAddress  string                 `json:"ieeeAddress"`
+	FriendlyName string                 `json:"friendlyName"`
+	AreaId       *uint64                `json:"areaId"`
+	State        map[string]interface{} `json:"state"`
+}
+
+type MeasurementEvent struct {
+	DeviceId    string    `json:"deviceId"`
+	AreaId      uint64    `json:"areaId"`
+	Measurement string    `json:"measurement"`
+	Date        time.Time `json:"date"`
+	Value       float64   `json:"value"`
+}
+
+type GroupEvent struct {
+	Group model.Group `json:"group"`
+}
+
+type DeviceAvailabilityEvent struct {
+	IeeeAddress  string `json:"ieeeAddress"`
+	FriendlyName string `json:"friendlyName"`
+	Available    bool   `json:"available"`
+}
+
+type AutomationEvent struct {
+	AutomationId uint64 `json:"automationId"`
+}
+
+type ScheduleEvent struct {
+	ScheduleId uint64 `json:"scheduleId"`
+}
+
+type AlertRuleEvent struct {
+	AlertRuleId uint64 `json:"alertRuleId"`
+}
+
+type BridgeEvent struct {
+	Bridge model.Bridge `json:"bridge"`
+}
+
+type IngestStatsEvent struct {
+	Stats model.IngestStats `json:"stats"`
+}
+
+type NotificationEvent struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Origin  string `json:"origin"`
+}
+
+func (e Event) Decode(payload interface{}) error {
+	return json.Unmarshal(e.Payload, payload)
+}
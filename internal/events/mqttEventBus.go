@@ -0,0 +1,88 @@
+package events
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"encoding/json"
+	"errors"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"log"
+	"time"
+)
+
+// MqttEventBus carries domain events between the controller and api processes on an internal
+// topic namespace of the broker they both already connect to
+func NewMqttEventBus(mqttClient *broker.MqttClient, source string) *MqttEventBus {
+	return &MqttEventBus{mqttClient: mqttClient, source: source}
+}
+
+type MqttEventBus struct {
+	mqttClient *broker.MqttClient
+	source     string
+}
+
+// Publish sends the event without waiting for the broker, so only encoding errors are returned
+func (b *MqttEventBus) Publish(eventType string, payload interface{}) error {
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	event, err := json.Marshal(Event{
+		Type:    eventType,
+		Source:  b.source,
+		Date:    time.Now().UTC(),
+		Payload: data,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	token := b.mqttClient.Conn.Publish(TopicEvents+"/"+eventType, 1, false, event)
+
+	// Events are published from inside message handlers, where waiting on the broker's acknowledgement would hold up
+	// paho's ordered router, and with it the acknowledgement itself
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Publish event %s: %v\n", eventType, token.Error())
+		}
+	}()
+
+	return nil
+}
+
+func (b *MqttEventBus) Subscribe(handler Handler, eventTypes ...string) error {
+
+	if handler == nil {
+		return errors.New("Subscribe: Handler is null")
+	}
+
+	topics := make(map[string]byte)
+
+	if len(eventTypes) == 0 {
+		topics[TopicEvents+"/#"] = 1
+	}
+
+	for _, eventType := range eventTypes {
+		topics[TopicEvents+"/"+eventType] = 1
+	}
+
+	if token := b.mqttClient.Conn.SubscribeMultiple(topics, func(client mqtt.Client, msg mqtt.Message) {
+
+		var event Event
+
+		if err := json.Unmarshal(msg.Payload(), &event); err != nil {
+			log.Printf("Unable to decode event from topic %s: %v\n", msg.Topic(), err)
+			return
+		}
+
+		handler(b.mqttClient.Ctx, event)
+
+	}); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
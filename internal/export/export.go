@@ -0,0 +1,122 @@
+package export
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCsv = "csv"
+	FormatJsonLines = "jsonl"
+	FormatParquet = "parquet"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv, jsonl or parquet")
+
+// ReportWriter writes reports one at a time, Close must be called to finish the file
+type ReportWriter interface {
+	Write(report model.Report) error
+	Close() error
+}
+
+// NewReportWriter writes reports to w in one of FormatCsv, FormatJsonLines or FormatParquet. Nothing is held but
+// the current Parquet row group, so exports of any size stream in constant memory.
+func NewReportWriter(w io.Writer, format string) (ReportWriter, error) {
+
+	switch format {
+		case FormatCsv:
+			return newCsvWriter(w), nil
+		case FormatJsonLines:
+			return newJsonLinesWriter(w), nil
+		case FormatParquet:
+			return newParquetWriter(w), nil
+		default:
+			return nil, ErrUnknownFormat
+	}
+}
+
+func ContentType(format string) string {
+
+	switch format {
+		case FormatCsv:
+			return "text/csv; charset=utf-8"
+		case FormatJsonLines:
+			return "application/x-ndjson"
+		default:
+			return "application/vnd.apache.parquet"
+	}
+}
+
+func FileName(name string, format string) string {
+	return name + "." + format
+}
+
+type csvWriter struct {
+	w *csv.Writer
+	header bool
+}
+
+func newCsvWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(report model.Report) error {
+
+	if !c.header {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	return c.w.Write([]string{
+		report.Measurement,
+		report.DeviceId,
+		strconv.FormatUint(report.AreaId, 10),
+		report.Date.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(report.Value, 'f', -1, 64),
+	})
+}
+
+func (c *csvWriter) Close() error {
+
+	// An export with no reports is still a file with a header
+	if !c.header {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	c.header = true
+	return c.w.Write([]string{"measurement", "ieee_addr", "area_id", "date", "value"})
+}
+
+type jsonLinesWriter struct {
+	buffer *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newJsonLinesWriter(w io.Writer) *jsonLinesWriter {
+	buffer := bufio.NewWriter(w)
+	return &jsonLinesWriter{buffer: buffer, encoder: json.NewEncoder(buffer)}
+}
+
+func (j *jsonLinesWriter) Write(report model.Report) error {
+	report.Date = report.Date.UTC()
+	return j.encoder.Encode(report)
+}
+
+func (j *jsonLinesWriter) Close() error {
+	return j.buffer.Flush()
+}
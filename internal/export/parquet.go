@@ -0,0 +1,243 @@
+package export
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	parquetMagic = "PAR1"
+	// Rows are buffered per column until a row group of this many is written, which bounds the memory an export
+	// takes to a few megabytes however many reports it has
+	parquetRowGroupRows = 64 * 1024
+
+	parquetInt64 = 2
+	parquetDouble = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetUtf8 = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRle = 3
+	parquetUncompressed = 0
+	parquetDataPage = 0
+)
+
+type parquetColumn struct {
+	name string
+	physicalType int32
+	// convertedType is the logical type of the column, -1 for none
+	convertedType int32
+	// values are the plain encoded values of the row group being buffered
+	values bytes.Buffer
+}
+
+type parquetChunk struct {
+	offset int64
+	size int64
+}
+
+type parquetRowGroup struct {
+	rows int64
+	size int64
+	chunks []parquetChunk
+}
+
+// parquetWriter writes reports as an uncompressed Parquet file with one plain encoded page per column and row
+// group, which any Parquet reader accepts
+type parquetWriter struct {
+	w io.Writer
+	offset int64
+	columns []*parquetColumn
+	rows int
+	totalRows int64
+	rowGroups []parquetRowGroup
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{
+		w: w,
+		columns: []*parquetColumn{
+			{name: "measurement", physicalType: parquetByteArray, convertedType: parquetUtf8},
+			{name: "ieee_addr", physicalType: parquetByteArray, convertedType: parquetUtf8},
+			{name: "area_id", physicalType: parquetInt64, convertedType: -1},
+			{name: "date", physicalType: parquetInt64, convertedType: parquetTimestampMillis},
+			{name: "value", physicalType: parquetDouble, convertedType: -1},
+		}}
+}
+
+func (p *parquetWriter) Write(report model.Report) error {
+
+	putByteArray(&p.columns[0].values, report.Measurement)
+	putByteArray(&p.columns[1].values, report.DeviceId)
+	putUint64(&p.columns[2].values, report.AreaId)
+	putUint64(&p.columns[3].values, uint64(report.Date.UnixNano()/1e6))
+	putUint64(&p.columns[4].values, math.Float64bits(report.Value))
+
+	p.rows++
+
+	if p.rows == parquetRowGroupRows {
+		return p.writeRowGroup()
+	}
+
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+
+	if p.rows > 0 {
+		if err := p.writeRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	if err := p.writeMagic(); err != nil {
+		return err
+	}
+
+	footer := p.footer()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+
+	return p.write(footer, length[:], []byte(parquetMagic))
+}
+
+func (p *parquetWriter) writeRowGroup() error {
+
+	if err := p.writeMagic(); err != nil {
+		return err
+	}
+
+	group := parquetRowGroup{rows: int64(p.rows)}
+
+	for _, column := range p.columns {
+
+		header := newThriftWriter()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(column.values.Len()))
+		header.i32(3, int32(column.values.Len()))
+		header.structBegin(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRle)
+		header.i32(4, parquetRle)
+		header.structEnd()
+
+		chunk := parquetChunk{offset: p.offset}
+
+		if err := p.write(header.end(), column.values.Bytes()); err != nil {
+			return err
+		}
+
+		chunk.size = p.offset - chunk.offset
+		group.size += chunk.size
+		group.chunks = append(group.chunks, chunk)
+
+		column.values.Reset()
+	}
+
+	p.rowGroups = append(p.rowGroups, group)
+	p.totalRows += group.rows
+	p.rows = 0
+
+	return nil
+}
+
+// footer is the FileMetaData, describing the schema and where each column chunk is
+func (p *parquetWriter) footer() []byte {
+
+	footer := newThriftWriter()
+	footer.i32(1, 1)
+
+	footer.listBegin(2, thriftStruct, len(p.columns)+1)
+	footer.structBegin(0)
+	footer.string(4, "schema")
+	footer.i32(5, int32(len(p.columns)))
+	footer.structEnd()
+	for _, column := range p.columns {
+		footer.structBegin(0)
+		footer.i32(1, column.physicalType)
+		footer.i32(3, parquetRequired)
+		footer.string(4, column.name)
+		if column.convertedType >= 0 {
+			footer.i32(6, column.convertedType)
+		}
+		footer.structEnd()
+	}
+
+	footer.i64(3, p.totalRows)
+
+	footer.listBegin(4, thriftStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		footer.structBegin(0)
+		footer.listBegin(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			column := p.columns[i]
+			footer.structBegin(0)
+			footer.i64(2, chunk.offset)
+			footer.structBegin(3)
+			footer.i32(1, column.physicalType)
+			footer.listBegin(2, thriftI32, 2)
+			footer.i32Element(parquetPlain)
+			footer.i32Element(parquetRle)
+			footer.listBegin(3, thriftBinary, 1)
+			footer.binary(column.name)
+			footer.i32(4, parquetUncompressed)
+			footer.i64(5, group.rows)
+			footer.i64(6, chunk.size)
+			footer.i64(7, chunk.size)
+			footer.i64(9, chunk.offset)
+			footer.structEnd()
+			footer.structEnd()
+		}
+		footer.i64(2, group.size)
+		footer.i64(3, group.rows)
+		footer.structEnd()
+	}
+
+	footer.string(6, "domicile")
+
+	return footer.end()
+}
+
+// writeMagic starts the file the first time anything is written
+func (p *parquetWriter) writeMagic() error {
+
+	if p.offset > 0 {
+		return nil
+	}
+
+	return p.write([]byte(parquetMagic))
+}
+
+func (p *parquetWriter) write(parts ...[]byte) error {
+
+	for _, part := range parts {
+		n, err := p.w.Write(part)
+		p.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func putByteArray(buffer *bytes.Buffer, value string) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(value)))
+	buffer.Write(length[:])
+	buffer.WriteString(value)
+}
+
+func putUint64(buffer *bytes.Buffer, value uint64) {
+	var scratch [8]byte
+	binary.LittleEndian.PutUint64(scratch[:], value)
+	buffer.Write(scratch[:])
+}
@@ -0,0 +1,417 @@
+package export
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into generic values: structs become maps from field id to
+// value, lists slices, integers int64 and binaries strings
+type thriftReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+
+	if r.pos >= len(r.data) {
+		r.t.Fatalf("thrift: truncated at %d", r.pos)
+	}
+
+	b := r.data[r.pos]
+	r.pos++
+
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+
+	value, n := binary.Uvarint(r.data[r.pos:])
+
+	if n <= 0 {
+		r.t.Fatalf("thrift: bad varint at %d", r.pos)
+	}
+
+	r.pos += n
+
+	return value
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+
+	fields := map[int16]interface{}{}
+	last := int16(0)
+
+	for {
+		header := r.byte()
+
+		if header == 0 {
+			return fields
+		}
+
+		id := last + int16(header>>4)
+
+		if header>>4 == 0 {
+			id = int16(unzigzag(r.varint()))
+		}
+
+		if _, ok := fields[id]; ok {
+			r.t.Fatalf("thrift: field %d written twice", id)
+		}
+
+		if id <= last {
+			r.t.Fatalf("thrift: field %d after field %d", id, last)
+		}
+
+		fields[id] = r.readValue(header & 0x0f)
+		last = id
+	}
+}
+
+func (r *thriftReader) readValue(valueType byte) interface{} {
+
+	switch valueType {
+	case thriftI32, thriftI64:
+		return unzigzag(r.varint())
+	case thriftBinary:
+		size := int(r.varint())
+		if r.pos+size > len(r.data) {
+			r.t.Fatalf("thrift: binary of %d bytes runs past the end", size)
+		}
+		value := string(r.data[r.pos : r.pos+size])
+		r.pos += size
+		return value
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.varint())
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			elements[i] = r.readValue(header & 0x0f)
+		}
+		return elements
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		r.t.Fatalf("thrift: unexpected type %d at %d", valueType, r.pos)
+		return nil
+	}
+}
+
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func TestThriftWriterRoundTrip(t *testing.T) {
+
+	writer := newThriftWriter()
+	writer.i32(1, -7)
+	writer.i64(2, math.MaxInt64)
+	// Ids more than 15 apart take a full header
+	writer.string(40, "ümlaut")
+	writer.structBegin(41)
+	writer.i32(1, 1)
+	writer.structBegin(2)
+	writer.i64(3, -1)
+	writer.structEnd()
+	// The nested struct kept its own last id, so this is a delta from 2 and not from 3
+	writer.i32(20, 20)
+	writer.structEnd()
+	writer.listBegin(42, thriftI32, 20)
+	for i := 0; i < 20; i++ {
+		writer.i32Element(int32(i - 10))
+	}
+	writer.listBegin(43, thriftBinary, 2)
+	writer.binary("a")
+	writer.binary("")
+
+	reader := &thriftReader{t: t, data: writer.end()}
+	decoded := reader.readStruct()
+
+	if reader.pos != len(reader.data) {
+		t.Errorf("decoded %d of %d bytes", reader.pos, len(reader.data))
+	}
+
+	if decoded[1] != int64(-7) || decoded[2] != int64(math.MaxInt64) || decoded[40] != "ümlaut" {
+		t.Errorf("decoded %v", decoded)
+	}
+
+	nested := decoded[41].(map[int16]interface{})
+
+	if nested[1] != int64(1) || nested[2].(map[int16]interface{})[3] != int64(-1) || nested[20] != int64(20) {
+		t.Errorf("decoded struct %v", nested)
+	}
+
+	list := decoded[42].([]interface{})
+
+	if len(list) != 20 || list[0] != int64(-10) || list[19] != int64(9) {
+		t.Errorf("decoded list %v", list)
+	}
+
+	if strings := decoded[43].([]interface{}); len(strings) != 2 || strings[0] != "a" || strings[1] != "" {
+		t.Errorf("decoded binaries %v", strings)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+
+	date := time.Date(2026, time.January, 14, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		reports   int
+		rowGroups []int64
+	}{
+		{"empty", 0, nil},
+		{"one row group", 3, []int64{3}},
+		{"full row group", parquetRowGroupRows, []int64{parquetRowGroupRows}},
+		{"row group and a row", parquetRowGroupRows + 1, []int64{parquetRowGroupRows, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var reports []model.Report
+
+			for i := 0; i < test.reports; i++ {
+				reports = append(reports, model.Report{
+					Measurement: []string{"temperature", "humidity"}[i%2],
+					DeviceId:    "0x00158d0001a2b3c" + string(rune('0'+i%10)),
+					AreaId:      uint64(i % 3),
+					Date:        date.Add(time.Duration(i) * time.Second),
+					Value:       float64(i) - 0.5,
+				})
+			}
+
+			var file bytes.Buffer
+
+			writer, err := NewReportWriter(&file, FormatParquet)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, report := range reports {
+				if err := writer.Write(report); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			checkParquet(t, file.Bytes(), reports, test.rowGroups)
+		})
+	}
+}
+
+// checkParquet reads the file back through its footer and page headers, and compares every value with the reports
+func checkParquet(t *testing.T, data []byte, reports []model.Report, rowGroups []int64) {
+
+	t.Helper()
+
+	if len(data) < 12 || string(data[:4]) != parquetMagic || string(data[len(data)-4:]) != parquetMagic {
+		t.Fatalf("file is not framed by %s", parquetMagic)
+	}
+
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLength
+
+	reader := &thriftReader{t: t, data: data[:len(data)-8], pos: footerStart}
+	footer := reader.readStruct()
+
+	if reader.pos != len(data)-8 {
+		t.Fatalf("footer ends at %d, expected %d", reader.pos, len(data)-8)
+	}
+
+	if footer[1] != int64(1) || footer[6] != "domicile" {
+		t.Errorf("version %v, created by %v", footer[1], footer[6])
+	}
+
+	expectedSchema := []struct {
+		name          string
+		physicalType  int64
+		convertedType interface{}
+	}{
+		{"measurement", parquetByteArray, int64(parquetUtf8)},
+		{"ieee_addr", parquetByteArray, int64(parquetUtf8)},
+		{"area_id", parquetInt64, nil},
+		{"date", parquetInt64, int64(parquetTimestampMillis)},
+		{"value", parquetDouble, nil},
+	}
+
+	schema := footer[2].([]interface{})
+
+	if len(schema) != len(expectedSchema)+1 {
+		t.Fatalf("schema has %d elements", len(schema))
+	}
+
+	if root := schema[0].(map[int16]interface{}); root[4] != "schema" || root[5] != int64(len(expectedSchema)) {
+		t.Errorf("schema root %v", root)
+	}
+
+	for i, expected := range expectedSchema {
+
+		element := schema[i+1].(map[int16]interface{})
+
+		if element[4] != expected.name || element[1] != expected.physicalType || element[3] != int64(parquetRequired) || element[6] != expected.convertedType {
+			t.Errorf("schema element %d = %v, expected %+v", i, element, expected)
+		}
+	}
+
+	if footer[3] != int64(len(reports)) {
+		t.Errorf("num_rows = %v, expected %d", footer[3], len(reports))
+	}
+
+	groups := footer[4].([]interface{})
+
+	if len(groups) != len(rowGroups) {
+		t.Fatalf("%d row groups, expected %d", len(groups), len(rowGroups))
+	}
+
+	row := 0
+	// Chunks must follow each other from just after the leading magic to the footer
+	offset := int64(len(parquetMagic))
+
+	for g, value := range groups {
+
+		group := value.(map[int16]interface{})
+		rows := group[3].(int64)
+
+		if rows != rowGroups[g] {
+			t.Errorf("row group %d has %d rows, expected %d", g, rows, rowGroups[g])
+		}
+
+		chunks := group[1].([]interface{})
+
+		if len(chunks) != len(expectedSchema) {
+			t.Fatalf("row group %d has %d chunks", g, len(chunks))
+		}
+
+		groupSize := int64(0)
+		columns := make([][]byte, len(chunks))
+
+		for c, value := range chunks {
+
+			chunk := value.(map[int16]interface{})
+			meta := chunk[3].(map[int16]interface{})
+			size := meta[6].(int64)
+
+			if chunk[2] != offset || meta[9] != offset {
+				t.Fatalf("chunk %d.%d is at %v and %v, expected %d", g, c, chunk[2], meta[9], offset)
+			}
+
+			if path := meta[3].([]interface{}); len(path) != 1 || path[0] != expectedSchema[c].name {
+				t.Errorf("chunk %d.%d path %v", g, c, path)
+			}
+
+			if meta[1] != expectedSchema[c].physicalType || meta[4] != int64(parquetUncompressed) || meta[5] != rows || meta[7] != size {
+				t.Errorf("chunk %d.%d metadata %v", g, c, meta)
+			}
+
+			page := &thriftReader{t: t, data: data[:offset+size], pos: int(offset)}
+			header := page.readStruct()
+			dataHeader := header[5].(map[int16]interface{})
+			values := data[page.pos : offset+size]
+
+			if header[1] != int64(parquetDataPage) || header[2] != int64(len(values)) || header[3] != int64(len(values)) {
+				t.Errorf("chunk %d.%d page header %v with %d bytes of values", g, c, header, len(values))
+			}
+
+			if dataHeader[1] != rows || dataHeader[2] != int64(parquetPlain) {
+				t.Errorf("chunk %d.%d data page header %v", g, c, dataHeader)
+			}
+
+			columns[c] = values
+			offset += size
+			groupSize += size
+		}
+
+		if group[2] != groupSize {
+			t.Errorf("row group %d size %v, expected %d", g, group[2], groupSize)
+		}
+
+		for i := int64(0); i < rows; i++ {
+
+			if row >= len(reports) {
+				t.Fatalf("more rows than the %d reports written", len(reports))
+			}
+
+			expected := reports[row]
+
+			actual := model.Report{
+				Measurement: takeByteArray(t, &columns[0]),
+				DeviceId:    takeByteArray(t, &columns[1]),
+				AreaId:      takeUint64(t, &columns[2]),
+				Date:        time.Unix(0, int64(takeUint64(t, &columns[3]))*1e6).UTC(),
+				Value:       math.Float64frombits(takeUint64(t, &columns[4])),
+			}
+
+			if actual.Date.Equal(expected.Date) {
+				actual.Date = expected.Date
+			}
+
+			if actual != expected {
+				t.Fatalf("row %d = %+v, expected %+v", row, actual, expected)
+			}
+
+			row++
+		}
+
+		for c, rest := range columns {
+			if len(rest) != 0 {
+				t.Errorf("chunk %d.%d has %d bytes past its last value", g, c, len(rest))
+			}
+		}
+	}
+
+	if row != len(reports) {
+		t.Errorf("read %d rows, expected %d", row, len(reports))
+	}
+
+	if offset != int64(footerStart) {
+		t.Errorf("chunks end at %d, the footer starts at %d", offset, footerStart)
+	}
+}
+
+func takeByteArray(t *testing.T, values *[]byte) string {
+
+	t.Helper()
+
+	if len(*values) < 4 {
+		t.Fatal("byte array length runs past the page")
+	}
+
+	size := int(binary.LittleEndian.Uint32(*values))
+
+	if len(*values) < 4+size {
+		t.Fatal("byte array runs past the page")
+	}
+
+	value := string((*values)[4 : 4+size])
+	*values = (*values)[4+size:]
+
+	return value
+}
+
+func takeUint64(t *testing.T, values *[]byte) uint64 {
+
+	t.Helper()
+
+	if len(*values) < 8 {
+		t.Fatal("value runs past the page")
+	}
+
+	value := binary.LittleEndian.Uint64(*values)
+	*values = (*values)[8:]
+
+	return value
+}
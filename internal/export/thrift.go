@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Types of the Thrift compact protocol, which Parquet encodes its page headers and footer with
+const (
+	thriftI32 = 5
+	thriftI64 = 6
+	thriftBinary = 8
+	thriftList = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes Thrift structs in the compact protocol. Fields are written in increasing id order with
+// their header holding the difference from the previous id, so each struct keeps its own last id.
+type thriftWriter struct {
+	buffer bytes.Buffer
+	lastIds []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{lastIds: []int16{0}}
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+
+	last := &t.lastIds[len(t.lastIds)-1]
+
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buffer.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buffer.WriteByte(fieldType)
+		t.varint(zigzag(int64(id)))
+	}
+
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(zigzag(value))
+}
+
+func (t *thriftWriter) string(id int16, value string) {
+	t.fieldHeader(id, thriftBinary)
+	t.binary(value)
+}
+
+// structBegin starts a struct field, or a struct in a list when id is 0
+func (t *thriftWriter) structBegin(id int16) {
+	if id != 0 {
+		t.fieldHeader(id, thriftStruct)
+	}
+	t.lastIds = append(t.lastIds, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buffer.WriteByte(0)
+	t.lastIds = t.lastIds[:len(t.lastIds)-1]
+}
+
+// listBegin starts a list field, whose elements are then written without field headers
+func (t *thriftWriter) listBegin(id int16, elementType byte, size int) {
+
+	t.fieldHeader(id, thriftList)
+
+	if size < 15 {
+		t.buffer.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		t.buffer.WriteByte(0xf0 | elementType)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) i32Element(value int32) {
+	t.varint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) binary(value string) {
+	t.varint(uint64(len(value)))
+	t.buffer.WriteString(value)
+}
+
+// end finishes the outermost struct
+func (t *thriftWriter) end() []byte {
+	t.buffer.WriteByte(0)
+	return t.buffer.Bytes()
+}
+
+func (t *thriftWriter) varint(value uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	t.buffer.Write(scratch[:binary.PutUvarint(scratch[:], value)])
+}
+
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
@@ -0,0 +1,256 @@
+// Package graph serves domicile's areas, devices, groups and reports over GraphQL. Nested fields are resolved
+// through per-request batches, so a query over many areas or devices costs one query per field rather than one
+// per object.
+package graph
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// ErrScope is returned by mutations when the caller only has the read scope
+var ErrScope = errors.New("the control scope is required")
+
+func NewGraph(
+	client *broker.MqttClient,
+	devicesService *service.DevicesService,
+	groupsService *service.GroupsService,
+	areasService *service.AreasService,
+	reportsService *service.ReportsService,
+) *Graph {
+
+	resolver := &Resolver{
+		client: client,
+		devicesService: devicesService,
+		groupsService: groupsService,
+		areasService: areasService,
+		reportsService: reportsService}
+
+	return &Graph{
+		schema: graphql.MustParseSchema(schema, resolver, graphql.UseStringDescriptions(), graphql.MaxDepth(8)),
+		resolver: resolver}
+}
+
+// Graph is the parsed schema with the Resolver behind it
+type Graph struct {
+	schema *graphql.Schema
+	resolver *Resolver
+}
+
+type scopeKey struct{}
+
+// Exec runs a query or mutation for a caller with the given scope. The context must carry the caller's area
+// access, see service.WithAccess, and for mutations the origin recorded in the audit log.
+func (g *Graph) Exec(ctx context.Context, scope string, query string, operationName string, variables map[string]interface{}) *graphql.Response {
+
+	ctx = context.WithValue(ctx, scopeKey{}, scope)
+	ctx = context.WithValue(ctx, loadersKey{}, newLoaders(g.resolver))
+
+	return g.schema.Exec(ctx, query, operationName, variables)
+}
+
+// Resolver answers the Query and Mutation fields
+type Resolver struct {
+	client *broker.MqttClient
+	devicesService *service.DevicesService
+	groupsService *service.GroupsService
+	areasService *service.AreasService
+	reportsService *service.ReportsService
+}
+
+func (r *Resolver) Areas(ctx context.Context) ([]*areaResolver, error) {
+
+	areas, err := r.areasService.GetAreas(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newAreaResolvers(ctx, r, areas), nil
+}
+
+func (r *Resolver) Area(ctx context.Context, args struct{ Id graphql.ID }) (*areaResolver, error) {
+
+	id, err := strconv.ParseUint(string(args.Id), 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid area id %s", args.Id)
+	}
+
+	return newAreaResolver(ctx, r, id)
+}
+
+func (r *Resolver) Devices(ctx context.Context, args struct{ Area *graphql.ID }) ([]*deviceResolver, error) {
+
+	var devices []model.Device
+	var err error
+
+	if args.Area != nil {
+
+		areaId, parseErr := strconv.ParseUint(string(*args.Area), 10, 64)
+
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid area id %s", *args.Area)
+		}
+
+		devices, err = loadersFromContext(ctx).devicesInArea(ctx, areaId)
+
+	} else {
+		devices, err = r.devicesService.GetDevices(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newDeviceResolvers(ctx, r, devices), nil
+}
+
+func (r *Resolver) Device(ctx context.Context, args struct{ IeeeAddr string }) (*deviceResolver, error) {
+
+	loaders := loadersFromContext(ctx)
+	loaders.seeDevices(args.IeeeAddr)
+
+	device, err := loaders.device(ctx, args.IeeeAddr)
+
+	if device == nil || err != nil || !service.AccessFromContext(ctx).Allows(device.AreaId, model.RoleView) {
+		return nil, err
+	}
+
+	return newDeviceResolvers(ctx, r, []model.Device{*device})[0], nil
+}
+
+func (r *Resolver) Groups(ctx context.Context) ([]*groupResolver, error) {
+
+	groups, err := r.groupsService.GetGroups(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newGroupResolvers(ctx, r, groups), nil
+}
+
+func (r *Resolver) Group(ctx context.Context, args struct{ Id graphql.ID }) (*groupResolver, error) {
+
+	id, err := strconv.ParseUint(string(args.Id), 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid group id %s", args.Id)
+	}
+
+	group, err := r.groupsService.GetGroup(ctx, id)
+
+	if group == nil || err != nil {
+		return nil, nil
+	}
+
+	resolvers := newGroupResolvers(ctx, r, []model.Group{*group})
+
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+
+	return resolvers[0], nil
+}
+
+func (r *Resolver) SendDeviceCommand(ctx context.Context, args struct {
+	IeeeAddr string
+	Command  JSON
+}) (bool, error) {
+
+	payload, err := commandPayload(ctx, args.Command)
+
+	if err != nil {
+		return false, err
+	}
+
+	device, err := r.devicesService.GetDevice(ctx, args.IeeeAddr)
+
+	if device == nil || err != nil || !service.AccessFromContext(ctx).Allows(device.AreaId, model.RoleView) {
+		return false, errors.New("device not found")
+	}
+
+	if err := r.devicesService.SetDeviceState(ctx, r.client, device, payload); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *Resolver) SendGroupCommand(ctx context.Context, args struct {
+	Id      graphql.ID
+	Command JSON
+}) (bool, error) {
+
+	payload, err := commandPayload(ctx, args.Command)
+
+	if err != nil {
+		return false, err
+	}
+
+	id, err := strconv.ParseUint(string(args.Id), 10, 64)
+
+	if err != nil {
+		return false, fmt.Errorf("invalid group id %s", args.Id)
+	}
+
+	group, err := r.groupsService.GetGroup(ctx, id)
+
+	if group == nil || err != nil || r.groupsService.CheckGroupAccess(ctx, group, model.RoleView) != nil {
+		return false, errors.New("group not found")
+	}
+
+	if err := r.groupsService.SetGroupState(ctx, r.client, group, payload); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func commandPayload(ctx context.Context, command JSON) (map[string]interface{}, error) {
+
+	scope, _ := ctx.Value(scopeKey{}).(string)
+
+	if !model.ScopeAllows(scope, model.ScopeControl) {
+		return nil, ErrScope
+	}
+
+	payload, ok := command.Value.(map[string]interface{})
+
+	if !ok || len(payload) == 0 {
+		return nil, errors.New("the command must be a non-empty object")
+	}
+
+	return payload, nil
+}
+
+// JSON is the JSON scalar, any value that encodes to JSON
+type JSON struct {
+	Value interface{}
+}
+
+func (JSON) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+func (j *JSON) UnmarshalGraphQL(input interface{}) error {
+	j.Value = input
+	return nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Value)
+}
@@ -0,0 +1,329 @@
+package graph
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// batch loads values by key, fetching every key queued so far in one call the first time any of them is needed.
+// Resolvers queue the keys of their children as they create them, so a list of n areas costs one query for all
+// their devices rather than n.
+type batch struct {
+	mutex sync.Mutex
+	pending map[string]bool
+	results map[string]interface{}
+	fetch func(ctx context.Context, keys []string) (map[string]interface{}, error)
+}
+
+func newBatch(fetch func(ctx context.Context, keys []string) (map[string]interface{}, error), keys []string) *batch {
+
+	b := &batch{pending: make(map[string]bool), results: make(map[string]interface{}), fetch: fetch}
+	b.add(keys...)
+
+	return b
+}
+
+// add queues keys to be fetched with the next load
+func (b *batch) add(keys ...string) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, key := range keys {
+		if _, ok := b.results[key]; !ok {
+			b.pending[key] = true
+		}
+	}
+}
+
+// load returns the value of a key, which is nil when the fetch found nothing for it
+func (b *batch) load(ctx context.Context, key string) (interface{}, error) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if value, ok := b.results[key]; ok {
+		return value, nil
+	}
+
+	b.pending[key] = true
+
+	keys := make([]string, 0, len(b.pending))
+	for pending := range b.pending {
+		keys = append(keys, pending)
+	}
+
+	found, err := b.fetch(ctx, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fetched := range keys {
+		b.results[fetched] = found[fetched]
+		delete(b.pending, fetched)
+	}
+
+	return b.results[key], nil
+}
+
+// loaders are the batches of one request. Batches that depend on arguments, such as a measurement, are created
+// on first use and primed with every area or device the request has seen so far.
+type loaders struct {
+	root *Resolver
+	// now is when the request started, so default date ranges are the same for every object in it
+	now time.Time
+	mutex sync.Mutex
+	areaIds []string
+	ieeeAddresses []string
+	areas *batch
+	devices *batch
+	devicesByArea *batch
+	latest map[string]*batch
+	buckets map[string]*batch
+}
+
+type loadersKey struct{}
+
+func newLoaders(root *Resolver) *loaders {
+
+	l := &loaders{root: root, now: time.Now().UTC(), latest: make(map[string]*batch), buckets: make(map[string]*batch)}
+
+	l.areas = newBatch(l.fetchAreas, nil)
+	l.devices = newBatch(l.fetchDevices, nil)
+	l.devicesByArea = newBatch(l.fetchDevicesByArea, nil)
+
+	return l
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// seeAreas queues the areas for every batch keyed by area
+func (l *loaders) seeAreas(ids ...uint64) {
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, strconv.FormatUint(id, 10))
+	}
+
+	l.mutex.Lock()
+	l.areaIds = append(l.areaIds, keys...)
+	batches := []*batch{l.areas, l.devicesByArea}
+	for _, b := range l.buckets {
+		batches = append(batches, b)
+	}
+	l.mutex.Unlock()
+
+	for _, b := range batches {
+		b.add(keys...)
+	}
+}
+
+// seeDevices queues the devices for every batch keyed by device
+func (l *loaders) seeDevices(ieeeAddresses ...string) {
+
+	l.mutex.Lock()
+	l.ieeeAddresses = append(l.ieeeAddresses, ieeeAddresses...)
+	batches := []*batch{l.devices}
+	for _, b := range l.latest {
+		batches = append(batches, b)
+	}
+	l.mutex.Unlock()
+
+	for _, b := range batches {
+		b.add(ieeeAddresses...)
+	}
+}
+
+func (l *loaders) area(ctx context.Context, id uint64) (*model.Area, error) {
+
+	value, err := l.areas.load(ctx, strconv.FormatUint(id, 10))
+
+	if value == nil || err != nil {
+		return nil, err
+	}
+
+	return value.(*model.Area), nil
+}
+
+func (l *loaders) device(ctx context.Context, ieeeAddress string) (*model.Device, error) {
+
+	value, err := l.devices.load(ctx, ieeeAddress)
+
+	if value == nil || err != nil {
+		return nil, err
+	}
+
+	return value.(*model.Device), nil
+}
+
+func (l *loaders) devicesInArea(ctx context.Context, areaId uint64) ([]model.Device, error) {
+
+	value, err := l.devicesByArea.load(ctx, strconv.FormatUint(areaId, 10))
+
+	if value == nil || err != nil {
+		return nil, err
+	}
+
+	return value.([]model.Device), nil
+}
+
+func (l *loaders) latestReport(ctx context.Context, measurement string, ieeeAddress string) (*model.Report, error) {
+
+	l.mutex.Lock()
+	b, ok := l.latest[measurement]
+	if !ok {
+		b = newBatch(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			return l.fetchLatest(ctx, measurement, keys)
+		}, l.ieeeAddresses)
+		l.latest[measurement] = b
+	}
+	l.mutex.Unlock()
+
+	value, err := b.load(ctx, ieeeAddress)
+
+	if value == nil || err != nil {
+		return nil, err
+	}
+
+	return value.(*model.Report), nil
+}
+
+func (l *loaders) reportBuckets(ctx context.Context, measurement string, areaId uint64, start time.Time, end time.Time, bucket time.Duration) ([]model.ReportBucket, error) {
+
+	key := measurement + " " + start.Format(time.RFC3339Nano) + " " + end.Format(time.RFC3339Nano) + " " + bucket.String()
+
+	l.mutex.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBatch(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			return l.fetchBuckets(ctx, measurement, keys, start, end, bucket)
+		}, l.areaIds)
+		l.buckets[key] = b
+	}
+	l.mutex.Unlock()
+
+	value, err := b.load(ctx, strconv.FormatUint(areaId, 10))
+
+	if value == nil || err != nil {
+		return nil, err
+	}
+
+	return value.([]model.ReportBucket), nil
+}
+
+func (l *loaders) fetchAreas(ctx context.Context, keys []string) (map[string]interface{}, error) {
+
+	areas, err := l.root.areasService.GetAreasByIds(ctx, parseIds(keys))
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]interface{}, len(areas))
+	for i := range areas {
+		found[strconv.FormatUint(areas[i].Id, 10)] = &areas[i]
+	}
+
+	return found, nil
+}
+
+func (l *loaders) fetchDevices(ctx context.Context, keys []string) (map[string]interface{}, error) {
+
+	devices, err := l.root.devicesService.GetDevicesByIeeeAddresses(ctx, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]interface{}, len(devices))
+	for i := range devices {
+		found[devices[i].IeeeAddress] = &devices[i]
+	}
+
+	return found, nil
+}
+
+func (l *loaders) fetchDevicesByArea(ctx context.Context, keys []string) (map[string]interface{}, error) {
+
+	devices, err := l.root.devicesService.GetDevicesByAreas(ctx, parseIds(keys))
+
+	if err != nil {
+		return nil, err
+	}
+
+	byArea := make(map[string][]model.Device, len(keys))
+	for _, key := range keys {
+		byArea[key] = make([]model.Device, 0)
+	}
+	for _, device := range devices {
+		key := strconv.FormatUint(*device.AreaId, 10)
+		byArea[key] = append(byArea[key], device)
+	}
+
+	found := make(map[string]interface{}, len(byArea))
+	for key, devices := range byArea {
+		found[key] = devices
+	}
+
+	return found, nil
+}
+
+func (l *loaders) fetchLatest(ctx context.Context, measurement string, keys []string) (map[string]interface{}, error) {
+
+	reports, err := l.root.reportsService.GetLatestDeviceReports(ctx, measurement, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]interface{}, len(reports))
+	for i := range reports {
+		found[reports[i].DeviceId] = &reports[i]
+	}
+
+	return found, nil
+}
+
+func (l *loaders) fetchBuckets(ctx context.Context, measurement string, keys []string, start time.Time, end time.Time, bucket time.Duration) (map[string]interface{}, error) {
+
+	buckets, err := l.root.reportsService.GetReportBuckets(ctx, measurement, parseIds(keys), start, end, bucket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byArea := make(map[string][]model.ReportBucket, len(keys))
+	for _, key := range keys {
+		byArea[key] = make([]model.ReportBucket, 0)
+	}
+	for _, b := range buckets {
+		key := strconv.FormatUint(b.AreaId, 10)
+		byArea[key] = append(byArea[key], b)
+	}
+
+	found := make(map[string]interface{}, len(byArea))
+	for key, buckets := range byArea {
+		found[key] = buckets
+	}
+
+	return found, nil
+}
+
+func parseIds(keys []string) []uint64 {
+
+	ids := make([]uint64, 0, len(keys))
+
+	for _, key := range keys {
+		if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,391 @@
+package graph
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+const (
+	defaultBucket = 5 * time.Minute
+	defaultReportsRange = 24 * time.Hour
+	// Keep a single query from summarising more than this many buckets per area
+	maxBuckets = 10000
+)
+
+type areaResolver struct {
+	root *Resolver
+	area model.Area
+}
+
+// newAreaResolvers keeps the areas the caller may view, queuing them for the batches keyed by area
+func newAreaResolvers(ctx context.Context, root *Resolver, areas []model.Area) []*areaResolver {
+
+	access := service.AccessFromContext(ctx)
+	resolvers := make([]*areaResolver, 0, len(areas))
+	ids := make([]uint64, 0, len(areas))
+
+	for _, area := range areas {
+		if access.Allows(&area.Id, model.RoleView) {
+			resolvers = append(resolvers, &areaResolver{root: root, area: area})
+			ids = append(ids, area.Id)
+		}
+	}
+
+	loadersFromContext(ctx).seeAreas(ids...)
+
+	return resolvers
+}
+
+func newAreaResolver(ctx context.Context, root *Resolver, id uint64) (*areaResolver, error) {
+
+	loaders := loadersFromContext(ctx)
+	loaders.seeAreas(id)
+
+	area, err := loaders.area(ctx, id)
+
+	if area == nil || err != nil {
+		return nil, err
+	}
+
+	resolvers := newAreaResolvers(ctx, root, []model.Area{*area})
+
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+
+	return resolvers[0], nil
+}
+
+func (r *areaResolver) Id() graphql.ID {
+	return graphql.ID(strconv.FormatUint(r.area.Id, 10))
+}
+
+func (r *areaResolver) Uuid() string {
+	return r.area.Uuid.UUID.String()
+}
+
+func (r *areaResolver) Name() string {
+	return r.area.Name
+}
+
+func (r *areaResolver) DateCreated() graphql.Time {
+	return graphql.Time{Time: r.area.DateCreated}
+}
+
+func (r *areaResolver) Parent(ctx context.Context) (*areaResolver, error) {
+
+	if r.area.ParentId == nil {
+		return nil, nil
+	}
+
+	return newAreaResolver(ctx, r.root, *r.area.ParentId)
+}
+
+func (r *areaResolver) Devices(ctx context.Context) ([]*deviceResolver, error) {
+
+	devices, err := loadersFromContext(ctx).devicesInArea(ctx, r.area.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newDeviceResolvers(ctx, r.root, devices), nil
+}
+
+func (r *areaResolver) Reports(ctx context.Context, args struct {
+	Measurement string
+	Start       *graphql.Time
+	End         *graphql.Time
+	Bucket      *int32
+}) ([]*reportBucketResolver, error) {
+
+	loaders := loadersFromContext(ctx)
+
+	end := loaders.now
+	if args.End != nil {
+		end = args.End.Time
+	}
+
+	start := end.Add(-defaultReportsRange)
+	if args.Start != nil {
+		start = args.Start.Time
+	}
+
+	bucket := defaultBucket
+	if args.Bucket != nil {
+		bucket = time.Duration(*args.Bucket) * time.Second
+	}
+
+	if bucket <= 0 {
+		return nil, errors.New("bucket must be a positive number of seconds")
+	}
+
+	if end.Sub(start)/bucket > maxBuckets {
+		return nil, errors.New("the range covers more than " + strconv.Itoa(maxBuckets) + " buckets, use a larger bucket")
+	}
+
+	buckets, err := loaders.reportBuckets(ctx, args.Measurement, r.area.Id, start, end, bucket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*reportBucketResolver, 0, len(buckets))
+	for _, b := range buckets {
+		resolvers = append(resolvers, &reportBucketResolver{bucket: b})
+	}
+
+	return resolvers, nil
+}
+
+type deviceResolver struct {
+	root *Resolver
+	device model.Device
+}
+
+// newDeviceResolvers keeps the devices the caller may view, queuing them for the batches keyed by device
+func newDeviceResolvers(ctx context.Context, root *Resolver, devices []model.Device) []*deviceResolver {
+
+	access := service.AccessFromContext(ctx)
+	resolvers := make([]*deviceResolver, 0, len(devices))
+	ieeeAddresses := make([]string, 0, len(devices))
+	areaIds := make([]uint64, 0)
+
+	for _, device := range devices {
+		if access.Allows(device.AreaId, model.RoleView) {
+			resolvers = append(resolvers, &deviceResolver{root: root, device: device})
+			ieeeAddresses = append(ieeeAddresses, device.IeeeAddress)
+			if device.AreaId != nil {
+				areaIds = append(areaIds, *device.AreaId)
+			}
+		}
+	}
+
+	loaders := loadersFromContext(ctx)
+	loaders.seeDevices(ieeeAddresses...)
+	loaders.seeAreas(areaIds...)
+
+	return resolvers
+}
+
+func (r *deviceResolver) IeeeAddr() string {
+	return r.device.IeeeAddress
+}
+
+func (r *deviceResolver) FriendlyName() string {
+	return r.device.FriendlyName
+}
+
+func (r *deviceResolver) Area(ctx context.Context) (*areaResolver, error) {
+
+	if r.device.AreaId == nil {
+		return nil, nil
+	}
+
+	return newAreaResolver(ctx, r.root, *r.device.AreaId)
+}
+
+func (r *deviceResolver) Type() *string {
+	return r.device.Type
+}
+
+func (r *deviceResolver) Model() *string {
+	return r.device.ModelId
+}
+
+func (r *deviceResolver) Manufacturer() *string {
+	return r.device.Manufacturer
+}
+
+func (r *deviceResolver) LastSeen() *graphql.Time {
+
+	if r.device.LastSeen == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: *r.device.LastSeen}
+}
+
+func (r *deviceResolver) Battery() *float64 {
+
+	if r.device.Battery == nil {
+		return nil
+	}
+
+	battery := float64(*r.device.Battery)
+
+	return &battery
+}
+
+func (r *deviceResolver) LinkQuality() *int32 {
+
+	if r.device.LinkQuality == nil {
+		return nil
+	}
+
+	linkQuality := int32(*r.device.LinkQuality)
+
+	return &linkQuality
+}
+
+func (r *deviceResolver) Active() bool {
+	return r.device.Active
+}
+
+func (r *deviceResolver) State() *deviceStateResolver {
+
+	state := r.root.devicesService.GetDeviceState(r.device.IeeeAddress)
+
+	if state == nil {
+		return nil
+	}
+
+	return &deviceStateResolver{state: *state}
+}
+
+func (r *deviceResolver) Latest(ctx context.Context, args struct{ Measurement string }) (*reportResolver, error) {
+
+	report, err := loadersFromContext(ctx).latestReport(ctx, args.Measurement, r.device.IeeeAddress)
+
+	if report == nil || err != nil {
+		return nil, err
+	}
+
+	return &reportResolver{report: *report}, nil
+}
+
+type deviceStateResolver struct {
+	state model.DeviceState
+}
+
+func (r *deviceStateResolver) Date() graphql.Time {
+	return graphql.Time{Time: r.state.Date}
+}
+
+func (r *deviceStateResolver) State() JSON {
+	return JSON{Value: r.state.State}
+}
+
+type groupResolver struct {
+	root *Resolver
+	group model.Group
+}
+
+// newGroupResolvers keeps the groups whose every member the caller may view, queuing the members' devices
+func newGroupResolvers(ctx context.Context, root *Resolver, groups []model.Group) []*groupResolver {
+
+	resolvers := make([]*groupResolver, 0, len(groups))
+	ieeeAddresses := make([]string, 0)
+
+	for _, group := range groups {
+		if root.groupsService.CheckGroupAccess(ctx, &group, model.RoleView) == nil {
+			resolvers = append(resolvers, &groupResolver{root: root, group: group})
+			for _, member := range group.Members {
+				ieeeAddresses = append(ieeeAddresses, member.IeeeAddress)
+			}
+		}
+	}
+
+	loadersFromContext(ctx).seeDevices(ieeeAddresses...)
+
+	return resolvers
+}
+
+func (r *groupResolver) Id() graphql.ID {
+	return graphql.ID(strconv.FormatUint(r.group.Id, 10))
+}
+
+func (r *groupResolver) FriendlyName() string {
+	return r.group.FriendlyName
+}
+
+func (r *groupResolver) Active() bool {
+	return r.group.Active
+}
+
+func (r *groupResolver) Members() []*memberResolver {
+
+	resolvers := make([]*memberResolver, 0, len(r.group.Members))
+
+	for _, member := range r.group.Members {
+		resolvers = append(resolvers, &memberResolver{root: r.root, member: member})
+	}
+
+	return resolvers
+}
+
+type memberResolver struct {
+	root *Resolver
+	member model.GroupMember
+}
+
+func (r *memberResolver) IeeeAddr() string {
+	return r.member.IeeeAddress
+}
+
+func (r *memberResolver) FriendlyName() string {
+	return r.member.FriendlyName
+}
+
+func (r *memberResolver) Device(ctx context.Context) (*deviceResolver, error) {
+
+	device, err := loadersFromContext(ctx).device(ctx, r.member.IeeeAddress)
+
+	if device == nil || err != nil {
+		return nil, err
+	}
+
+	resolvers := newDeviceResolvers(ctx, r.root, []model.Device{*device})
+
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+
+	return resolvers[0], nil
+}
+
+type reportResolver struct {
+	report model.Report
+}
+
+func (r *reportResolver) IeeeAddr() string {
+	return r.report.DeviceId
+}
+
+func (r *reportResolver) Date() graphql.Time {
+	return graphql.Time{Time: r.report.Date}
+}
+
+func (r *reportResolver) Value() float64 {
+	return r.report.Value
+}
+
+type reportBucketResolver struct {
+	bucket model.ReportBucket
+}
+
+func (r *reportBucketResolver) Start() graphql.Time {
+	return graphql.Time{Time: r.bucket.Start}
+}
+
+func (r *reportBucketResolver) Average() float64 {
+	return r.bucket.Average
+}
+
+func (r *reportBucketResolver) Min() float64 {
+	return r.bucket.Min
+}
+
+func (r *reportBucketResolver) Max() float64 {
+	return r.bucket.Max
+}
+
+func (r *reportBucketResolver) Count() int32 {
+	return int32(r.bucket.Count)
+}
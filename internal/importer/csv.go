@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// csvReader reads a CSV file with a header row, one reading per row
+type csvReader struct {
+	r *csv.Reader
+	mapping Mapping
+	columns map[string]int
+	line int
+}
+
+func newCsvReader(r io.Reader, mapping Mapping) (*csvReader, error) {
+
+	if mapping.Time == "" {
+		mapping.Time = "time"
+	}
+
+	if mapping.Value == "" {
+		mapping.Value = "value"
+	}
+
+	c := &csvReader{r: csv.NewReader(r), mapping: mapping, columns: make(map[string]int)}
+	c.r.FieldsPerRecord = -1
+	c.r.ReuseRecord = true
+
+	header, err := c.r.Read()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the header: %w", err)
+	}
+
+	c.line = 1
+
+	// Files saved from spreadsheets often start with a byte order mark
+	for i, name := range header {
+		c.columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	for _, name := range []string{mapping.Time, mapping.Value, mapping.Device, mapping.Area, mapping.Measurement} {
+		if _, ok := c.columns[name]; name != "" && !ok {
+			return nil, fmt.Errorf("there is no %s column", name)
+		}
+	}
+
+	if mapping.Device == "" {
+		return nil, errors.New("the mapping must name the device column")
+	}
+
+	if mapping.Measurement == "" && mapping.DefaultMeasurement == "" {
+		return nil, errors.New("the mapping must name the measurement column or give a default measurement")
+	}
+
+	return c, nil
+}
+
+func (c *csvReader) Read() (Row, error) {
+
+	record, err := c.r.Read()
+
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+
+	c.line++
+
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return Row{}, &RowError{Line: c.line, Err: parseError.Err}
+		}
+		return Row{}, err
+	}
+
+	row, err := c.row(record)
+
+	if err != nil {
+		return Row{}, &RowError{Line: c.line, Err: err}
+	}
+
+	return row, nil
+}
+
+func (c *csvReader) row(record []string) (Row, error) {
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && name != "" && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	date, err := c.mapping.parseTime(field(c.mapping.Time))
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	value, err := strconv.ParseFloat(field(c.mapping.Value), 64)
+
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Row{}, fmt.Errorf("invalid value %q", field(c.mapping.Value))
+	}
+
+	areaId, err := c.mapping.area(field(c.mapping.Area))
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	return Row{Line: c.line, Report: model.Report{
+		DeviceId: c.mapping.device(field(c.mapping.Device)),
+		AreaId: areaId,
+		Measurement: c.mapping.measurement(field(c.mapping.Measurement)),
+		Date: date,
+		Value: value,
+	}}, nil
+}
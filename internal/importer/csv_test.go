@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCsvReader(t *testing.T) {
+
+	input := "\ufefftime, sensor ,room,kind,reading\n" +
+		"2026-01-14 09:30:00,kitchen,3,temp,21.5\n" +
+		"2026-01-14 09:31:00,\"0x02\",,humidity, 40 \n" +
+		"2026-01-14 09:32:00,kitchen,3,temp,warm\n" +
+		"yesterday,kitchen,3,temp,20\n" +
+		"2026-01-14 09:33:00,kitchen,attic,temp,20\n" +
+		"2026-01-14 09:34:00,kitchen,3,noise,55\n"
+
+	mapping := Mapping{
+		TimeFormat:         "2006-01-02 15:04:05",
+		Location:           "Australia/Melbourne",
+		Value:              "reading",
+		Device:             "sensor",
+		Area:               "room",
+		Measurement:        "kind",
+		DefaultMeasurement: "illuminance",
+		Devices:            map[string]string{"kitchen": "0x01"},
+		Measurements:       map[string]string{"temp": "temperature"},
+	}
+
+	melbourne, err := time.LoadLocation("Australia/Melbourne")
+
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	reader, err := NewReader(strings.NewReader(input), FormatCsv, mapping, known)
+
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	rows, rowErrors := readAll(t, reader)
+
+	checkReports(t, rows, []model.Report{
+		{DeviceId: "0x01", AreaId: 3, Measurement: "temperature", Date: time.Date(2026, time.January, 14, 9, 30, 0, 0, melbourne), Value: 21.5},
+		{DeviceId: "0x02", Measurement: "humidity", Date: time.Date(2026, time.January, 14, 9, 31, 0, 0, melbourne), Value: 40},
+		{DeviceId: "0x01", AreaId: 3, Measurement: "illuminance", Date: time.Date(2026, time.January, 14, 9, 34, 0, 0, melbourne), Value: 55},
+	})
+
+	if len(rows) == 3 && (rows[0].Line != 2 || rows[2].Line != 7) {
+		t.Errorf("rows are on lines %d and %d, expected 2 and 7", rows[0].Line, rows[2].Line)
+	}
+
+	if len(rowErrors) != 3 || rowErrors[0].Line != 4 || rowErrors[2].Line != 6 {
+		t.Errorf("errors %v, expected lines 4 to 6", rowErrors)
+	}
+}
+
+func TestNewCsvReaderChecksTheMapping(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		mapping Mapping
+	}{
+		{"missing column", Mapping{Device: "sensor", Measurement: "kind", Area: "room"}},
+		{"no device", Mapping{Measurement: "kind"}},
+		{"no measurement", Mapping{Device: "sensor"}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewReader(strings.NewReader("time,value,sensor,kind\n"), FormatCsv, test.mapping, known); err == nil {
+			t.Errorf("%s: NewReader succeeded", test.name)
+		}
+	}
+}
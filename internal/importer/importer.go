@@ -0,0 +1,211 @@
+package importer
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCsv = "csv"
+	FormatLineProtocol = "lineprotocol"
+
+	TimeRfc3339 = "rfc3339"
+	TimeUnix = "unix"
+	TimeUnixMs = "unix_ms"
+	TimeUnixUs = "unix_us"
+	TimeUnixNs = "unix_ns"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or lineprotocol")
+
+// Mapping says where in the source each part of a report is and how the names of the previous system translate.
+//
+// Time, Value, Device, Area and Measurement name CSV columns, or line protocol tags for the last three. Line
+// protocol takes the time from each line's timestamp and every numeric field is a reading unless Value names one.
+type Mapping struct {
+	Time string `json:"time"`
+	// TimeFormat is rfc3339, unix, unix_ms, unix_us, unix_ns or a Go layout, in Location when it has no zone
+	TimeFormat string `json:"timeFormat"`
+	Location string `json:"location"`
+	Value string `json:"value"`
+	Device string `json:"device"`
+	// Area is left empty to file each reading under the area its device is in now
+	Area string `json:"area"`
+	Measurement string `json:"measurement"`
+	// DefaultMeasurement is used for readings whose measurement is not given or not known
+	DefaultMeasurement string `json:"defaultMeasurement"`
+	// Devices translates source names to IEEE addresses, names not listed are taken to be addresses already
+	Devices map[string]string `json:"devices"`
+	// Areas translates source names to area ids, names not listed must be ids
+	Areas map[string]uint64 `json:"areas"`
+	// Measurements translates source names to temperature, humidity, pressure or illuminance. Line protocol tries
+	// the measurement tag, then "measurement.field", the field and the line's measurement.
+	Measurements map[string]string `json:"measurements"`
+
+	location *time.Location
+	known map[string]string
+}
+
+// Row is a reading parsed from the source, an AreaId of 0 means the device's current area
+type Row struct {
+	Line int
+	Report model.Report
+}
+
+// RowError is a line that could not be read, the reader carries on with the next one
+type RowError struct {
+	Line int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads rows one at a time, returning a *RowError for a bad line and io.EOF at the end
+type Reader interface {
+	Read() (Row, error)
+}
+
+func LoadMapping(path string) (Mapping, error) {
+
+	var mapping Mapping
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return mapping, err
+	}
+
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return mapping, fmt.Errorf("invalid mapping %s: %w", path, err)
+	}
+
+	return mapping, nil
+}
+
+// NewReader reads the source in FormatCsv or FormatLineProtocol. Names found in known, keyed by measurement, are
+// taken as measurements without being listed in the mapping.
+func NewReader(r io.Reader, format string, mapping Mapping, known map[string]string) (Reader, error) {
+
+	mapping.known = known
+
+	if mapping.TimeFormat == "" {
+		mapping.TimeFormat = TimeRfc3339
+		if format == FormatLineProtocol {
+			mapping.TimeFormat = TimeUnixNs
+		}
+	}
+
+	mapping.location = time.UTC
+
+	if mapping.Location != "" {
+		location, err := time.LoadLocation(mapping.Location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid location %s: %w", mapping.Location, err)
+		}
+		mapping.location = location
+	}
+
+	switch format {
+		case FormatCsv:
+			return newCsvReader(r, mapping)
+		case FormatLineProtocol:
+			return newLineProtocolReader(r, mapping)
+		default:
+			return nil, ErrUnknownFormat
+	}
+}
+
+func (m *Mapping) parseTime(value string) (time.Time, error) {
+
+	unit := map[string]float64{TimeUnix: 1e9, TimeUnixMs: 1e6, TimeUnixUs: 1e3, TimeUnixNs: 1}
+
+	if scale, ok := unit[m.TimeFormat]; ok {
+
+		// Whole numbers are kept exact, nanoseconds since 1970 are beyond a float's precision
+		if whole, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(0, whole*int64(scale)).UTC(), nil
+		}
+
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return time.Time{}, fmt.Errorf("invalid %s time %q", m.TimeFormat, value)
+		}
+
+		return time.Unix(0, int64(number*scale)).UTC(), nil
+	}
+
+	layout := m.TimeFormat
+	if layout == TimeRfc3339 {
+		layout = time.RFC3339Nano
+	}
+
+	date, err := time.ParseInLocation(layout, value, m.location)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+
+	return date, nil
+}
+
+func (m *Mapping) device(name string) string {
+
+	if address, ok := m.Devices[name]; ok {
+		return address
+	}
+
+	return name
+}
+
+func (m *Mapping) area(name string) (uint64, error) {
+
+	if name == "" {
+		return 0, nil
+	}
+
+	if id, ok := m.Areas[name]; ok {
+		return id, nil
+	}
+
+	id, err := strconv.ParseUint(name, 10, 64)
+
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("unknown area %q", name)
+	}
+
+	return id, nil
+}
+
+// measurement translates the first of the names that is mapped or already a measurement's name
+func (m *Mapping) measurement(names ...string) string {
+
+	for _, name := range names {
+
+		if name == "" {
+			continue
+		}
+
+		if measurement, ok := m.Measurements[name]; ok {
+			return measurement
+		}
+
+		if _, ok := m.known[name]; ok {
+			return name
+		}
+	}
+
+	return m.DefaultMeasurement
+}
@@ -0,0 +1,220 @@
+package importer
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// lineProtocolReader reads InfluxDB line protocol, measurement,tag=value field=value timestamp, with a reading for
+// each numeric field of a line
+type lineProtocolReader struct {
+	scanner *bufio.Scanner
+	mapping Mapping
+	line int
+	pending []Row
+}
+
+func newLineProtocolReader(r io.Reader, mapping Mapping) (*lineProtocolReader, error) {
+
+	if mapping.Device == "" {
+		return nil, errors.New("the mapping must name the device tag")
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &lineProtocolReader{scanner: scanner, mapping: mapping}, nil
+}
+
+func (l *lineProtocolReader) Read() (Row, error) {
+
+	for len(l.pending) == 0 {
+
+		if !l.scanner.Scan() {
+			if err := l.scanner.Err(); err != nil {
+				return Row{}, err
+			}
+			return Row{}, io.EOF
+		}
+
+		l.line++
+
+		text := strings.TrimSpace(l.scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rows, err := l.rows(text)
+
+		if err != nil {
+			return Row{}, &RowError{Line: l.line, Err: err}
+		}
+
+		l.pending = rows
+	}
+
+	row := l.pending[0]
+	l.pending = l.pending[1:]
+
+	return row, nil
+}
+
+func (l *lineProtocolReader) rows(text string) ([]Row, error) {
+
+	sections := splitUnescaped(text, ' ')
+
+	if len(sections) < 3 {
+		return nil, errors.New("expected a measurement, fields and a timestamp")
+	}
+
+	if len(sections) > 3 {
+		return nil, errors.New("unexpected text after the timestamp")
+	}
+
+	series := splitUnescaped(sections[0], ',')
+	name := unescape(series[0])
+	tags := make(map[string]string, len(series)-1)
+
+	for _, tag := range series[1:] {
+		key, value, err := splitPair(tag)
+		if err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+
+	date, err := l.mapping.parseTime(sections[2])
+
+	if err != nil {
+		return nil, err
+	}
+
+	areaId, err := l.mapping.area(tags[l.mapping.Area])
+
+	if err != nil {
+		return nil, err
+	}
+
+	device := tags[l.mapping.Device]
+
+	if device == "" {
+		return nil, fmt.Errorf("there is no %s tag", l.mapping.Device)
+	}
+
+	rows := make([]Row, 0, 1)
+
+	for _, field := range splitUnescaped(sections[1], ',') {
+
+		key, raw, err := splitPair(field)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if l.mapping.Value != "" && key != l.mapping.Value {
+			continue
+		}
+
+		value, ok := fieldValue(raw)
+
+		// Strings and booleans are not readings
+		if !ok {
+			continue
+		}
+
+		measurement := l.mapping.measurement(tags[l.mapping.Measurement], name+"."+key, key, name)
+
+		if measurement == "" {
+			continue
+		}
+
+		rows = append(rows, Row{Line: l.line, Report: model.Report{
+			DeviceId: l.mapping.device(device),
+			AreaId: areaId,
+			Measurement: measurement,
+			Date: date,
+			Value: value,
+		}})
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("no numeric field with a known measurement")
+	}
+
+	return rows, nil
+}
+
+// fieldValue reads a float, or an integer with its i or u suffix
+func fieldValue(raw string) (float64, bool) {
+
+	if strings.HasSuffix(raw, "i") || strings.HasSuffix(raw, "u") {
+		raw = raw[:len(raw)-1]
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+
+	return value, true
+}
+
+func splitPair(text string) (string, string, error) {
+
+	parts := splitUnescaped(text, '=')
+
+	if len(parts) < 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("expected key=value, not %q", text)
+	}
+
+	// Only the first equals sign separates, the rest belong to the value
+	return unescape(parts[0]), unescape(strings.Join(parts[1:], "=")), nil
+}
+
+// splitUnescaped splits on separators that are neither escaped with a backslash nor inside a quoted string value
+func splitUnescaped(text string, separator byte) []string {
+
+	parts := make([]string, 0, 4)
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(text); i++ {
+		switch {
+			case text[i] == '\\':
+				i++
+			case text[i] == '"':
+				quoted = !quoted
+			case text[i] == separator && !quoted:
+				parts = append(parts, text[start:i])
+				start = i + 1
+		}
+	}
+
+	return append(parts, text[start:])
+}
+
+func unescape(text string) string {
+
+	if !strings.Contains(text, "\\") {
+		return text
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+		}
+		b.WriteByte(text[i])
+	}
+
+	return b.String()
+}
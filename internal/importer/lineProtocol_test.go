@@ -0,0 +1,253 @@
+package importer
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var known = map[string]string{"temperature": "°C", "humidity": "%", "pressure": "hPa", "illuminance": "lx"}
+
+func TestLineProtocolReader(t *testing.T) {
+
+	// 2026-01-14T09:30:00.123456789Z, which a float64 could not hold to the nanosecond
+	const timestamp = "1768383000123456789"
+	date := time.Date(2026, time.January, 14, 9, 30, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name     string
+		mapping  Mapping
+		input    string
+		expected []model.Report
+	}{
+		{
+			name:     "one field",
+			mapping:  Mapping{Device: "device"},
+			input:    "climate,device=0x01 temperature=21.5 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 21.5}},
+		},
+		{
+			name:    "each numeric field is a reading",
+			mapping: Mapping{Device: "device"},
+			input:   "climate,device=0x01 temperature=21.5,humidity=40i,pressure=1013u,status=\"ok\",open=true " + timestamp,
+			expected: []model.Report{
+				{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 21.5},
+				{DeviceId: "0x01", Measurement: "humidity", Date: date, Value: 40},
+				{DeviceId: "0x01", Measurement: "pressure", Date: date, Value: 1013},
+			},
+		},
+		{
+			name:     "value names the field",
+			mapping:  Mapping{Device: "device", Value: "humidity"},
+			input:    "climate,device=0x01 temperature=21.5,humidity=40 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "humidity", Date: date, Value: 40}},
+		},
+		{
+			name:     "escaped tag values",
+			mapping:  Mapping{Device: "device", Devices: map[string]string{"living room,east=1": "0x02"}},
+			input:    "climate,device=living\\ room\\,east\\=1 temperature=20 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x02", Measurement: "temperature", Date: date, Value: 20}},
+		},
+		{
+			name:     "escaped tag keys",
+			mapping:  Mapping{Device: "sensor id"},
+			input:    "climate,sensor\\ id=0x01 temperature=20 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 20}},
+		},
+		{
+			name:     "escaped measurement names",
+			mapping:  Mapping{Device: "device", Measurements: map[string]string{"air temp": "temperature"}},
+			input:    "air\\ temp,device=0x01 value=19 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 19}},
+		},
+		{
+			name:     "quoted strings hold separators",
+			mapping:  Mapping{Device: "device"},
+			input:    "climate,device=0x01 note=\"a b,c=d \\\"e\\\"\",temperature=18 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 18}},
+		},
+		{
+			name: "measurement tag before field and line names",
+			mapping: Mapping{Device: "device", Measurement: "kind", Measurements: map[string]string{
+				"temp":          "temperature",
+				"climate.level": "humidity",
+			}},
+			input: "climate,device=0x01,kind=temp level=20 " + timestamp + "\n" +
+				"climate,device=0x01 level=45 " + timestamp,
+			expected: []model.Report{
+				{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 20},
+				{DeviceId: "0x01", Measurement: "humidity", Date: date, Value: 45},
+			},
+		},
+		{
+			name:     "default measurement",
+			mapping:  Mapping{Device: "device", DefaultMeasurement: "illuminance"},
+			input:    "light,device=0x01 lux=300 " + timestamp,
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "illuminance", Date: date, Value: 300}},
+		},
+		{
+			name:    "areas by name and id",
+			mapping: Mapping{Device: "device", Area: "room", Areas: map[string]uint64{"kitchen": 3}},
+			input: "climate,device=0x01,room=kitchen temperature=20 " + timestamp + "\n" +
+				"climate,device=0x01,room=7 temperature=21 " + timestamp,
+			expected: []model.Report{
+				{DeviceId: "0x01", AreaId: 3, Measurement: "temperature", Date: date, Value: 20},
+				{DeviceId: "0x01", AreaId: 7, Measurement: "temperature", Date: date, Value: 21},
+			},
+		},
+		{
+			name:     "timestamps in seconds",
+			mapping:  Mapping{Device: "device", TimeFormat: TimeUnix},
+			input:    "climate,device=0x01 temperature=20 1768383000",
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "temperature", Date: date.Truncate(time.Second), Value: 20}},
+		},
+		{
+			name:     "blank lines and comments",
+			mapping:  Mapping{Device: "device"},
+			input:    "# exported from influx\n\n  climate,device=0x01 temperature=20 " + timestamp + "  \r\n",
+			expected: []model.Report{{DeviceId: "0x01", Measurement: "temperature", Date: date, Value: 20}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			reader, err := NewReader(strings.NewReader(test.input), FormatLineProtocol, test.mapping, known)
+
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+
+			rows, rowErrors := readAll(t, reader)
+
+			if len(rowErrors) > 0 {
+				t.Fatalf("unexpected errors %v", rowErrors)
+			}
+
+			checkReports(t, rows, test.expected)
+		})
+	}
+}
+
+func TestLineProtocolReaderSkipsBadLines(t *testing.T) {
+
+	input := strings.Join([]string{
+		"climate,device=0x01 temperature=20 1768383000000000000",
+		"climate,device=0x01 temperature=20",
+		"climate,device=0x01 temperature=20 1768383000000000000 extra",
+		"climate,room=kitchen temperature=20 1768383000000000000",
+		"climate,device temperature=20 1768383000000000000",
+		"climate,device=0x01 temperature=20 yesterday",
+		"climate,device=0x01,room=attic temperature=20 1768383000000000000",
+		"climate,device=0x01 status=\"ok\",temperature=NaN 1768383000000000000",
+		"climate,device=0x01 =20 1768383000000000000",
+		"# the last line is still read",
+		"climate,device=0x01 humidity=40 1768383000000000000",
+	}, "\n")
+
+	reader, err := NewReader(strings.NewReader(input), FormatLineProtocol, Mapping{Device: "device", Area: "room"}, known)
+
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	rows, rowErrors := readAll(t, reader)
+
+	if len(rows) != 2 || rows[0].Line != 1 || rows[1].Line != 11 {
+		t.Errorf("rows %+v, expected lines 1 and 11", rows)
+	}
+
+	var lines []int
+
+	for _, rowError := range rowErrors {
+		lines = append(lines, rowError.Line)
+	}
+
+	if len(lines) != 8 || lines[0] != 2 || lines[7] != 9 {
+		t.Errorf("errors on lines %v, expected 2 to 9", lines)
+	}
+}
+
+func TestNewLineProtocolReaderNeedsTheDeviceTag(t *testing.T) {
+	if _, err := NewReader(strings.NewReader(""), FormatLineProtocol, Mapping{}, known); err == nil {
+		t.Error("NewReader accepted a mapping without a device tag")
+	}
+}
+
+func TestSplitUnescaped(t *testing.T) {
+
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"a,b,c", []string{"a", "b", "c"}},
+		{"a\\,b,c", []string{"a\\,b", "c"}},
+		{"a=\"x,y\",b=1", []string{"a=\"x,y\"", "b=1"}},
+		{"a=\"x\\\",y\",b=1", []string{"a=\"x\\\",y\"", "b=1"}},
+		{"a,", []string{"a", ""}},
+		{"a\\", []string{"a\\"}},
+	}
+
+	for _, test := range tests {
+		if parts := splitUnescaped(test.text, ','); strings.Join(parts, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("splitUnescaped(%q) = %q, expected %q", test.text, parts, test.expected)
+		}
+	}
+}
+
+// readAll reads to the end, collecting the bad lines the reader carried on past
+func readAll(t *testing.T, reader Reader) ([]Row, []*RowError) {
+
+	t.Helper()
+
+	var rows []Row
+	var rowErrors []*RowError
+
+	for {
+		row, err := reader.Read()
+
+		if err == io.EOF {
+			return rows, rowErrors
+		}
+
+		var rowError *RowError
+
+		if errors.As(err, &rowError) {
+			rowErrors = append(rowErrors, rowError)
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+func checkReports(t *testing.T, rows []Row, expected []model.Report) {
+
+	t.Helper()
+
+	if len(rows) != len(expected) {
+		t.Fatalf("read %d rows, expected %d: %+v", len(rows), len(expected), rows)
+	}
+
+	for i, row := range rows {
+
+		report := row.Report
+
+		if !report.Date.Equal(expected[i].Date) {
+			t.Errorf("row %d date = %s, expected %s", i, report.Date.Format(time.RFC3339Nano), expected[i].Date.Format(time.RFC3339Nano))
+		}
+
+		report.Date = expected[i].Date
+
+		if report != expected[i] {
+			t.Errorf("row %d = %+v, expected %+v", i, report, expected[i])
+		}
+	}
+}
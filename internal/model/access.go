@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+// Roles are granted per area and apply to every area beneath it, each includes the ones before it
+const (
+	RoleView = "view"
+	RoleControl = "control"
+	RoleAdminister = "administer"
+)
+
+var roleLevels = map[string]int{RoleView: 1, RoleControl: 2, RoleAdminister: 3}
+
+// scopeRoles is the role an api scope grants in every area, and the most an area role can grant under that scope
+var scopeRoles = map[string]string{ScopeRead: RoleView, ScopeControl: RoleControl, ScopeAdmin: RoleAdminister}
+
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// RoleAllows reports whether a principal holding role may do what required needs
+func RoleAllows(role string, required string) bool {
+	return roleLevels[role] >= roleLevels[required] && roleLevels[required] > 0
+}
+
+// ScopeRole returns the role a scope grants in every area
+func ScopeRole(scope string) string {
+	return scopeRoles[scope]
+}
+
+// HigherRole returns whichever of the two roles grants more
+func HigherRole(a string, b string) string {
+	if roleLevels[b] > roleLevels[a] {
+		return b
+	}
+	return a
+}
+
+type AreaRole struct {
+	UserId      uint64    `json:"userId"`
+	AreaId      uint64    `json:"areaId"`
+	DateCreated time.Time `json:"dateCreated"`
+	Role        string    `json:"role"`
+}
+
+// AreaAccess is what a principal may do in each area. Users without area roles get Default everywhere, users
+// with them are restricted to the areas in Roles, where roles granted on an area are already applied to its subtree.
+type AreaAccess struct {
+	Default string            `json:"default,omitempty"`
+	Roles   map[uint64]string `json:"roles,omitempty"`
+}
+
+// Restricted reports whether the access is limited to some areas, a nil access is domicile itself and unrestricted
+func (a *AreaAccess) Restricted() bool {
+	return a != nil && a.Roles != nil
+}
+
+// Allows reports whether role is granted in the area, devices without an area are only allowed to unrestricted access
+func (a *AreaAccess) Allows(areaId *uint64, role string) bool {
+
+	if a == nil {
+		return true
+	}
+
+	if !a.Restricted() {
+		return RoleAllows(a.Default, role)
+	}
+
+	if areaId == nil {
+		return false
+	}
+
+	return RoleAllows(a.Roles[*areaId], role)
+}
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+const (
+	AlertMeasurement = "measurement"
+	AlertBattery     = "battery"
+	AlertOffline     = "offline"
+
+	AlertAbove = "above"
+	AlertBelow = "below"
+
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRule fires when a device's value stays beyond Threshold for ForMinutes, and resolves once it
+// has come back past Threshold by Hysteresis. Offline rules compare the minutes since the device was last seen.
+type AlertRule struct {
+	Id           uint64    `json:"id"`
+	DateCreated  time.Time `json:"dateCreated"`
+	DateModified time.Time `json:"dateModified"`
+	Name         string    `json:"name"`
+	Enabled      bool      `json:"enabled"`
+	Type         string    `json:"type"`
+	Measurement  *string   `json:"measurement"`
+	AreaId       *uint64   `json:"areaId"`
+	IeeeAddress  *string   `json:"ieeeAddress"`
+	Operator     string    `json:"operator"`
+	Threshold    float64   `json:"threshold"`
+	Hysteresis   float64   `json:"hysteresis"`
+	ForMinutes   int       `json:"forMinutes"`
+	Channels     []string  `json:"channels"`
+}
+
+type Alert struct {
+	Id           uint64     `json:"id"`
+	RuleId       uint64     `json:"ruleId"`
+	IeeeAddress  string     `json:"ieeeAddress"`
+	State        string     `json:"state"`
+	Value        float64    `json:"value"`
+	DateFired    time.Time  `json:"dateFired"`
+	DateResolved *time.Time `json:"dateResolved"`
+}
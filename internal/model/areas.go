@@ -9,5 +9,6 @@ type Area struct {
 	Id uint64 `json:"id"`
 	Uuid uuid.UUID `json:"uuid"`
 	DateCreated time.Time `json:"dateCreated"`
-	Name string `json:"id"`
+	Name string `json:"name"`
+	ParentId *uint64 `json:"parentId"`
 }
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+const (
+	AuditOutbound = "outbound"
+	AuditInbound = "inbound"
+
+	AuditOutcomeOk = "ok"
+	AuditOutcomeError = "error"
+
+	AuditDeviceSet = "device_set"
+	AuditGroupSet = "group_set"
+	AuditBridgeRequest = "bridge_request"
+	AuditDeviceRenamed = "device_renamed"
+	AuditDeviceAreaChanged = "device_area_changed"
+
+	OriginSystem = "system"
+	OriginHttp = "http"
+	OriginAutomation = "automation"
+	OriginSchedule = "schedule"
+	OriginZigbee2mqtt = "zigbee2mqtt"
+)
+
+// AuditOrigin says who or what caused a command, Id is the automation or schedule id, Client the address of an http client
+type AuditOrigin struct {
+	Type   string  `json:"type"`
+	Id     *string `json:"id"`
+	Client *string `json:"client"`
+}
+
+type AuditEntry struct {
+	Id        uint64      `json:"id"`
+	Date      time.Time   `json:"date"`
+	Direction string      `json:"direction"`
+	Action    string      `json:"action"`
+	Target    string      `json:"target"`
+	Payload   interface{} `json:"payload"`
+	Origin    AuditOrigin `json:"origin"`
+	Outcome   string      `json:"outcome"`
+	Error     *string     `json:"error"`
+}
+
+// AuditFilter narrows a search of the audit log, nil fields match everything
+type AuditFilter struct {
+	Action     *string
+	Target     *string
+	OriginType *string
+	OriginId   *string
+	Outcome    *string
+	StartDate  *time.Time
+	EndDate    *time.Time
+	Direction  *string
+	Limit      int
+	Offset     int
+}
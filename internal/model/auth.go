@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+// Scopes grant increasing access, each includes the ones before it
+const (
+	ScopeRead = "read"
+	ScopeControl = "control"
+	ScopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{ScopeRead: 1, ScopeControl: 2, ScopeAdmin: 3}
+
+func ValidScope(scope string) bool {
+	_, ok := scopeLevels[scope]
+	return ok
+}
+
+// ScopeAllows reports whether a principal granted scope may use a route requiring required
+func ScopeAllows(scope string, required string) bool {
+	return scopeLevels[scope] >= scopeLevels[required] && scopeLevels[required] > 0
+}
+
+type User struct {
+	Id           uint64     `json:"id"`
+	DateCreated  time.Time  `json:"dateCreated"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Scope        string     `json:"scope"`
+	DateLastSeen *time.Time `json:"dateLastSeen"`
+}
+
+type Session struct {
+	TokenHash   string    `json:"-"`
+	UserId      uint64    `json:"userId"`
+	DateCreated time.Time `json:"dateCreated"`
+	DateExpires time.Time `json:"dateExpires"`
+}
+
+// ApiKey is a long lived credential for scripts, only its hash is stored and the key itself is shown once on creation
+type ApiKey struct {
+	Id           uint64     `json:"id"`
+	DateCreated  time.Time  `json:"dateCreated"`
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"`
+	KeyHash      string     `json:"-"`
+	Scope        string     `json:"scope"`
+	DateLastUsed *time.Time `json:"dateLastUsed"`
+}
+
+// Principal is the user or api key a request was authenticated as
+type Principal struct {
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Scope string  `json:"scope"`
+	User  *User   `json:"user,omitempty"`
+	Key   *ApiKey `json:"key,omitempty"`
+}
+
+const (
+	PrincipalUser = "user"
+	PrincipalApiKey = "apikey"
+)
@@ -0,0 +1,88 @@
+package model
+
+import "time"
+
+const (
+	TriggerState        = "state"
+	TriggerMeasurement  = "measurement"
+	TriggerTime         = "time"
+	TriggerCron         = "cron"
+	TriggerAvailability = "availability"
+
+	ConditionMeasurement = "measurement"
+	ConditionTime        = "time"
+	ConditionState       = "state"
+
+	ActionDevice = "device"
+	ActionGroup  = "group"
+	ActionScene  = "scene"
+	ActionNotify = "notify"
+	ActionDelay  = "delay"
+
+	AutomationSucceeded = "succeeded"
+	AutomationFailed    = "failed"
+)
+
+type Automation struct {
+	Id           uint64                `json:"id"`
+	DateCreated  time.Time             `json:"dateCreated"`
+	DateModified time.Time             `json:"dateModified"`
+	Name         string                `json:"name"`
+	Enabled      bool                  `json:"enabled"`
+	Triggers     []AutomationTrigger   `json:"triggers"`
+	Conditions   []AutomationCondition `json:"conditions"`
+	Actions      []AutomationAction    `json:"actions"`
+	OwnerId      *uint64               `json:"ownerId"`
+}
+
+// AutomationTrigger starts an automation, only the fields relevant to Type are set
+type AutomationTrigger struct {
+	Type         string      `json:"type"`
+	IeeeAddress  *string     `json:"ieeeAddress,omitempty"`
+	AreaId       *uint64     `json:"areaId,omitempty"`
+	Attribute    *string     `json:"attribute,omitempty"`
+	Value        interface{} `json:"value,omitempty"`
+	Measurement  *string     `json:"measurement,omitempty"`
+	Above        *float64    `json:"above,omitempty"`
+	Below        *float64    `json:"below,omitempty"`
+	Time         *string     `json:"time,omitempty"`
+	Weekdays     []int       `json:"weekdays,omitempty"`
+	Cron         *string     `json:"cron,omitempty"`
+	Availability *string     `json:"availability,omitempty"`
+}
+
+// AutomationCondition must hold for a triggered automation to run its actions
+type AutomationCondition struct {
+	Type        string      `json:"type"`
+	AreaId      *uint64     `json:"areaId,omitempty"`
+	Measurement *string     `json:"measurement,omitempty"`
+	Above       *float64    `json:"above,omitempty"`
+	Below       *float64    `json:"below,omitempty"`
+	After       *string     `json:"after,omitempty"`
+	Before      *string     `json:"before,omitempty"`
+	Weekdays    []int       `json:"weekdays,omitempty"`
+	IeeeAddress *string     `json:"ieeeAddress,omitempty"`
+	Attribute   *string     `json:"attribute,omitempty"`
+	Value       interface{} `json:"value,omitempty"`
+}
+
+type AutomationAction struct {
+	Type        string                 `json:"type"`
+	IeeeAddress *string                `json:"ieeeAddress,omitempty"`
+	GroupId     *uint64                `json:"groupId,omitempty"`
+	SceneId     *uint64                `json:"sceneId,omitempty"`
+	Transition  *float64               `json:"transition,omitempty"`
+	Payload     map[string]interface{} `json:"payload,omitempty"`
+	Title       *string                `json:"title,omitempty"`
+	Message     *string                `json:"message,omitempty"`
+	Delay       *string                `json:"delay,omitempty"`
+}
+
+type AutomationLog struct {
+	Id           uint64    `json:"id"`
+	AutomationId uint64    `json:"automationId"`
+	Date         time.Time `json:"date"`
+	Trigger      string    `json:"trigger"`
+	Status       string    `json:"status"`
+	Message      *string   `json:"message"`
+}
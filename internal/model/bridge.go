@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	BridgeStatusOk = "ok"
+	BridgeStatusError = "error"
+)
+
+// BridgeResponse is the reply zigbee2mqtt publishes on bridge/response/* for a bridge/request/*
+type BridgeResponse struct {
+	Data        json.RawMessage `json:"data"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Transaction string          `json:"transaction,omitempty"`
+}
+
+type PermitJoinRequest struct {
+	Time   int     `json:"time"`
+	Device *string `json:"device"`
+}
+
+type RenameDeviceRequest struct {
+	To                  string `json:"to"`
+	HomeassistantRename bool   `json:"homeassistantRename"`
+}
+
+type CreateGroupRequest struct {
+	FriendlyName string  `json:"friendlyName"`
+	Id           *uint64 `json:"id"`
+}
+
+type GroupMemberRequest struct {
+	Device   string `json:"device"`
+	Endpoint *int   `json:"endpoint"`
+}
+
+const (
+	BridgeOnline = "online"
+	BridgeOffline = "offline"
+
+	BridgeEventDeviceJoined = "device_joined"
+	BridgeEventDeviceInterview = "device_interview"
+	BridgeEventDeviceLeave = "device_leave"
+	BridgeEventDeviceAnnounce = "device_announce"
+)
+
+// Bridge is the last known state and info of the zigbee2mqtt bridge
+type Bridge struct {
+	DateModified           time.Time `json:"dateModified"`
+	State                  string    `json:"state"`
+	Version                *string   `json:"version"`
+	Commit                 *string   `json:"commit"`
+	CoordinatorType        *string   `json:"coordinatorType"`
+	CoordinatorIeeeAddress *string   `json:"coordinatorIeeeAddress"`
+	Channel                *int      `json:"channel"`
+	PanId                  *int      `json:"panId"`
+	PermitJoin             bool      `json:"permitJoin"`
+}
+
+// BridgeEvent is a message received on bridge/event, kept for the event history
+type BridgeEvent struct {
+	Id           uint64                 `json:"id"`
+	Date         time.Time              `json:"date"`
+	Type         string                 `json:"type"`
+	IeeeAddress  *string                `json:"ieeeAddress"`
+	FriendlyName *string                `json:"friendlyName"`
+	Data         map[string]interface{} `json:"data"`
+}
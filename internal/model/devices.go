@@ -2,6 +2,9 @@ package model
 
 import "time"
 
+// DeviceTypeUnknown is stored for devices that joined before zigbee2mqtt reported their definition
+const DeviceTypeUnknown = "Unknown"
+
 type Device struct {
 	IeeeAddress  string     `json:"ieeeAddr"`
 	DateCreated  time.Time  `json:"dateCreated"`
@@ -17,5 +20,18 @@ type Device struct {
 	Vendor       *string    `json:"vendor"`
 	Type         *string    `json:"type"`
 	Battery      *float32   `json:"battery"`
-	Active       bool       `json:"active""`
+	Active       bool       `json:"active"`
+	LinkQuality  *int       `json:"linkQuality"`
+
+	SoftwareBuildId *string  `json:"softwareBuildId"`
+	UpdateState     *string  `json:"updateState"`
+	UpdateProgress  *float64 `json:"updateProgress"`
+	UpdateRemaining *int     `json:"updateRemaining"`
+}
+
+// DeviceState is the last state a device reported, e.g. {"state": "ON", "brightness": 120}
+type DeviceState struct {
+	IeeeAddress string                 `json:"ieeeAddr"`
+	Date        time.Time              `json:"date"`
+	State       map[string]interface{} `json:"state"`
 }
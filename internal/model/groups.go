@@ -7,7 +7,7 @@ type Group struct {
 	DateCreated time.Time `json:"dateCreated"`
 	DateModified time.Time `json:"dateModified"`
 	FriendlyName string `json:"friendlyName"`
-	Active bool `json:"active""`
+	Active bool `json:"active"`
 	Members []GroupMember `json:"members"`
 }
 
@@ -15,5 +15,6 @@ type GroupMember struct {
 	GroupId uint64 `json:"groupId"`
 	IeeeAddress string `json:"ieeeAddress"`
 	FriendlyName string `json:"friendlyName"`
+	AreaId *uint64 `json:"areaId"`
 }
 
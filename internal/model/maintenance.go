@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+type MaintenanceReport struct {
+	Date      time.Time           `json:"date"`
+	Batteries []BatteryStatus     `json:"batteries"`
+	Stale     []StaleDevice       `json:"stale"`
+	WeakLinks []LinkQualityStatus `json:"weakLinks"`
+}
+
+type BatteryStatus struct {
+	IeeeAddress  string     `json:"ieeeAddress"`
+	FriendlyName string     `json:"friendlyName"`
+	AreaId       *uint64    `json:"areaId"`
+	Battery      float32    `json:"battery"`
+	LastSeen     *time.Time `json:"lastSeen"`
+	DaysToEmpty  *float64   `json:"daysToEmpty"`
+}
+
+type StaleDevice struct {
+	IeeeAddress      string     `json:"ieeeAddress"`
+	FriendlyName     string     `json:"friendlyName"`
+	AreaId           *uint64    `json:"areaId"`
+	LastSeen         *time.Time `json:"lastSeen"`
+	ExpectedInterval int        `json:"expectedIntervalMinutes"`
+}
+
+type LinkQualityStatus struct {
+	IeeeAddress  string  `json:"ieeeAddress"`
+	FriendlyName string  `json:"friendlyName"`
+	AreaId       *uint64 `json:"areaId"`
+	LinkQuality  int     `json:"linkQuality"`
+}
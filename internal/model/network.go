@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// NetworkMap is a snapshot of the zigbee mesh, with nodes annotated from the devices and areas in the database
+type NetworkMap struct {
+	Id    uint64        `json:"id"`
+	Date  time.Time     `json:"date"`
+	Nodes []NetworkNode `json:"nodes"`
+	Links []NetworkLink `json:"links"`
+}
+
+type NetworkNode struct {
+	IeeeAddress    string  `json:"ieeeAddress"`
+	NetworkAddress int     `json:"networkAddress"`
+	FriendlyName   string  `json:"friendlyName"`
+	Type           string  `json:"type"`
+	AreaId         *uint64 `json:"areaId"`
+	AreaName       *string `json:"areaName"`
+}
+
+// NetworkLink is a neighbour table entry, reported by the router or coordinator at Target about the node at Source
+type NetworkLink struct {
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	LinkQuality  int    `json:"linkQuality"`
+	Depth        int    `json:"depth"`
+	Relationship int    `json:"relationship"`
+}
+
+// NetworkMapSummary lists a stored snapshot without its nodes and links
+type NetworkMapSummary struct {
+	Id    uint64    `json:"id"`
+	Date  time.Time `json:"date"`
+	Nodes int       `json:"nodes"`
+	Links int       `json:"links"`
+}
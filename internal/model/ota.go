@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+const (
+	UpdateStateIdle = "idle"
+	UpdateStateAvailable = "available"
+	UpdateStateUpdating = "updating"
+)
+
+// FirmwareChange records a device reporting a different firmware than before, usually after an over-the-air update
+type FirmwareChange struct {
+	DeviceId                string    `json:"deviceId"`
+	Date                    time.Time `json:"date"`
+	PreviousSoftwareBuildId *string   `json:"previousSoftwareBuildId"`
+	PreviousDateCode        *string   `json:"previousDateCode"`
+	SoftwareBuildId         *string   `json:"softwareBuildId"`
+	DateCode                *string   `json:"dateCode"`
+}
+
+// OtaCheckJob tracks a check for updates across all devices, run one device at a time in the background
+type OtaCheckJob struct {
+	Id           uint64            `json:"id"`
+	DateStarted  time.Time         `json:"dateStarted"`
+	DateFinished *time.Time        `json:"dateFinished"`
+	Total        int               `json:"total"`
+	Checked      int               `json:"checked"`
+	Available    []string          `json:"available"`
+	Unsupported  []string          `json:"unsupported"`
+	Failed       map[string]string `json:"failed"`
+}
@@ -28,6 +28,100 @@ type IlluminanceReport struct {
 	AreaId uint64 `json:"areaId"`
 	Date time.Time `json:"date"`
 	Value float64 `json:"value"`
-	ValueLux float64 `json:"value"`
+	ValueLux float64 `json:"valueLux"`
 }
 
+// Report is a reading of any measurement in the same shape, illuminance is in lux with the raw reading in RawValue
+// when it is known
+type Report struct {
+	DeviceId string `json:"ieeeAddr"`
+	AreaId uint64 `json:"areaId"`
+	Measurement string `json:"measurement"`
+	Date time.Time `json:"date"`
+	Value float64 `json:"value"`
+	RawValue *float64 `json:"rawValue,omitempty"`
+}
+
+// ReportBucket summarises the readings of a measurement in an area, or of one device in it, from Start over one
+// bucket of time
+type ReportBucket struct {
+	AreaId uint64 `json:"areaId"`
+	DeviceId string `json:"ieeeAddr,omitempty"`
+	Measurement string `json:"measurement"`
+	Start time.Time `json:"start"`
+	Average float64 `json:"average"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Count int `json:"count"`
+}
+
+// ReportChartQuery selects the readings drawn on a chart, one series per area or per device in the areas
+type ReportChartQuery struct {
+	Measurement string
+	AreaIds []uint64
+	ByDevice bool
+	StartDate time.Time
+	EndDate time.Time
+	Bucket time.Duration
+	Width int
+	Height int
+}
+
+// ReportFilter selects the reports to stream, empty lists and nil dates select everything
+type ReportFilter struct {
+	Measurements []string
+	AreaIds []uint64
+	DeviceIds []string
+	StartDate *time.Time
+	EndDate *time.Time
+}
+
+// ImportProgress counts the readings of an import so far, Imported are those loaded or, in a dry run, that would be
+type ImportProgress struct {
+	Read int64 `json:"read"`
+	Imported int64 `json:"imported"`
+	Duplicates int64 `json:"duplicates"`
+	Invalid int64 `json:"invalid"`
+}
+
+// IngestStats counts the readings passed through the write queue since the controller started. Queued and the
+// spool sizes are those waiting now.
+type IngestStats struct {
+	Queued int `json:"queued"`
+	Capacity int `json:"capacity"`
+	Enqueued int64 `json:"enqueued"`
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"`
+	Failed int64 `json:"failed"`
+	Batches int64 `json:"batches"`
+	Spooled int64 `json:"spooled"`
+	Replayed int64 `json:"replayed"`
+	SpoolSegments int `json:"spoolSegments"`
+	SpoolReports int64 `json:"spoolReports"`
+	SpoolBytes int64 `json:"spoolBytes"`
+}
+
+type BatteryReport struct {
+	DeviceId string `json:"ieeeAddr"`
+	Date time.Time `json:"date"`
+	Battery float64 `json:"battery"`
+	Voltage *float64 `json:"voltage"`
+}
+
+type BatteryReplacement struct {
+	DeviceId string `json:"ieeeAddr"`
+	Date time.Time `json:"date"`
+	PreviousBattery float64 `json:"previousBattery"`
+	Battery float64 `json:"battery"`
+}
+
+// BatteryHistory summarises a device's battery readings, DrainRate is in percentage points per day
+type BatteryHistory struct {
+	DeviceId string `json:"ieeeAddr"`
+	FriendlyName string `json:"friendlyName"`
+	Battery *float32 `json:"battery"`
+	DrainRate *float64 `json:"drainRate"`
+	DaysToEmpty *float64 `json:"daysToEmpty"`
+	Replacements []BatteryReplacement `json:"replacements"`
+	Reports []BatteryReport `json:"reports"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type Scene struct {
+	Id            uint64        `json:"id"`
+	DateCreated   time.Time     `json:"dateCreated"`
+	DateModified  time.Time     `json:"dateModified"`
+	Name          string        `json:"name"`
+	AreaId        *uint64       `json:"areaId"`
+	GroupId       *uint64       `json:"groupId"`
+	NativeSceneId *uint64       `json:"nativeSceneId"`
+	Members       []SceneMember `json:"members"`
+}
+
+// SceneMember holds the captured state of one device, sent back as its /set payload on recall
+type SceneMember struct {
+	SceneId      uint64                 `json:"sceneId"`
+	IeeeAddress  string                 `json:"ieeeAddress"`
+	FriendlyName string                 `json:"friendlyName"`
+	State        map[string]interface{} `json:"state"`
+}
+
+// SceneCapture describes which devices to snapshot into a new scene, either listed, those in an area or those in a group.
+// With both GroupId and NativeSceneId set the scene is also stored in zigbee2mqtt so it can be recalled with one broadcast.
+type SceneCapture struct {
+	Name          string   `json:"name"`
+	AreaId        *uint64  `json:"areaId"`
+	GroupId       *uint64  `json:"groupId"`
+	NativeSceneId *uint64  `json:"nativeSceneId"`
+	Devices       []string `json:"devices"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	ScheduleCron    = "cron"
+	ScheduleSunrise = "sunrise"
+	ScheduleSunset  = "sunset"
+
+	ScheduleTargetDevice = "device"
+	ScheduleTargetGroup  = "group"
+
+	MissedRunSkip    = "skip"
+	MissedRunCatchUp = "catch_up"
+)
+
+type Schedule struct {
+	Id            uint64                 `json:"id"`
+	DateCreated   time.Time              `json:"dateCreated"`
+	DateModified  time.Time              `json:"dateModified"`
+	Name          string                 `json:"name"`
+	Enabled       bool                   `json:"enabled"`
+	Type          string                 `json:"type"`
+	Cron          *string                `json:"cron"`
+	OffsetMinutes int                    `json:"offsetMinutes"`
+	Weekdays      []int                  `json:"weekdays"`
+	TargetType    string                 `json:"targetType"`
+	IeeeAddress   *string                `json:"ieeeAddress"`
+	GroupId       *uint64                `json:"groupId"`
+	Payload       map[string]interface{} `json:"payload"`
+	MissedRun     string                 `json:"missedRun"`
+	LastRun       *time.Time             `json:"lastRun"`
+	NextRun       *time.Time             `json:"nextRun"`
+	OwnerId       *uint64                `json:"ownerId"`
+}
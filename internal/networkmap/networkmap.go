@@ -0,0 +1,286 @@
+// Package networkmap renders a zigbee network map as an SVG graph.
+//
+// Nodes are laid out in rings by their hop count from the coordinator, so routers sit close to the centre and the end
+// devices hanging off them on the outside. Links are coloured and labelled by link quality to make weak links stand out.
+package networkmap
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	ringSpacing = 160.0
+	margin = 120.0
+
+	coordinatorType = "Coordinator"
+	routerType = "Router"
+
+	colourWeak = "#d9534f"
+	colourFair = "#f0ad4e"
+	colourGood = "#5cb85c"
+	// Links at or above this quality are drawn as good, those below the weak threshold as weak
+	fairLinkQuality = 100
+)
+
+// Parse reads the nodes and links of the data of a zigbee2mqtt raw networkmap response
+func Parse(data []byte) (*model.NetworkMap, error) {
+
+	var response struct {
+		Value struct {
+			Nodes []struct {
+				IeeeAddr       string `json:"ieeeAddr"`
+				FriendlyName   string `json:"friendlyName"`
+				Type           string `json:"type"`
+				NetworkAddress int    `json:"networkAddress"`
+			} `json:"nodes"`
+			Links []struct {
+				Source struct {
+					IeeeAddr string `json:"ieeeAddr"`
+				} `json:"source"`
+				Target struct {
+					IeeeAddr string `json:"ieeeAddr"`
+				} `json:"target"`
+				LinkQuality  int `json:"linkquality"`
+				Depth        int `json:"depth"`
+				Relationship int `json:"relationship"`
+			} `json:"links"`
+		} `json:"value"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Value.Nodes == nil {
+		return nil, errors.New("networkmap: response has no nodes")
+	}
+
+	networkMap := model.NetworkMap{
+		Nodes: make([]model.NetworkNode, 0, len(response.Value.Nodes)),
+		Links: make([]model.NetworkLink, 0, len(response.Value.Links)),
+	}
+
+	for _, object := range response.Value.Nodes {
+		networkMap.Nodes = append(networkMap.Nodes, model.NetworkNode{
+			IeeeAddress: object.IeeeAddr,
+			NetworkAddress: object.NetworkAddress,
+			FriendlyName: object.FriendlyName,
+			Type: object.Type,
+		})
+	}
+
+	for _, object := range response.Value.Links {
+		networkMap.Links = append(networkMap.Links, model.NetworkLink{
+			Source: object.Source.IeeeAddr,
+			Target: object.Target.IeeeAddr,
+			LinkQuality: object.LinkQuality,
+			Depth: object.Depth,
+			Relationship: object.Relationship,
+		})
+	}
+
+	return &networkMap, nil
+}
+
+type position struct {
+	x, y, angle float64
+}
+
+// Render writes the network map as SVG, drawing links below weakLinkQuality in red
+func Render(w io.Writer, networkMap model.NetworkMap, weakLinkQuality int) error {
+
+	depths := nodeDepths(networkMap)
+	positions, radius := layout(networkMap, depths)
+	size := 2 * (radius + margin)
+	centre := size / 2
+
+	var svg strings.Builder
+
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="11">`+"\n", size, size, size, size)
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+
+	if len(networkMap.Nodes) == 0 {
+		fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" text-anchor="middle">No devices in the network map</text>`+"\n", centre, centre)
+	}
+
+	for _, link := range uniqueLinks(networkMap.Links) {
+
+		source, ok := positions[link.Source]
+		target, ok2 := positions[link.Target]
+
+		if !ok || !ok2 {
+			continue
+		}
+
+		colour := colourGood
+		if link.LinkQuality < weakLinkQuality {
+			colour = colourWeak
+		} else if link.LinkQuality < fairLinkQuality {
+			colour = colourFair
+		}
+
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1.5" stroke-opacity="0.8"/>`+"\n",
+			centre+source.x, centre+source.y, centre+target.x, centre+target.y, colour)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="9" fill="%s">%d</text>`+"\n",
+			centre+(source.x+target.x)/2, centre+(source.y+target.y)/2-2, colour, link.LinkQuality)
+	}
+
+	for _, node := range networkMap.Nodes {
+
+		p := positions[node.IeeeAddress]
+		x, y := centre+p.x, centre+p.y
+
+		switch node.Type {
+		case coordinatorType:
+			fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="24" height="24" fill="#333333"/>`+"\n", x-12, y-12)
+		case routerType:
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="10" fill="#337ab7"/>`+"\n", x, y)
+		default:
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="6" fill="#999999"/>`+"\n", x, y)
+		}
+
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n", x, y+24, html.EscapeString(node.FriendlyName))
+
+		if node.AreaName != nil {
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="9" fill="#777777">%s</text>`+"\n", x, y+36, html.EscapeString(*node.AreaName))
+		}
+	}
+
+	svg.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, svg.String())
+
+	return err
+}
+
+// nodeDepths returns the hop count of every node from the coordinator, nodes without a path are placed one ring further out
+func nodeDepths(networkMap model.NetworkMap) map[string]int {
+
+	neighbours := make(map[string][]string)
+
+	for _, link := range networkMap.Links {
+		neighbours[link.Source] = append(neighbours[link.Source], link.Target)
+		neighbours[link.Target] = append(neighbours[link.Target], link.Source)
+	}
+
+	depths := make(map[string]int)
+	queue := make([]string, 0)
+
+	for _, node := range networkMap.Nodes {
+		if node.Type == coordinatorType {
+			depths[node.IeeeAddress] = 0
+			queue = append(queue, node.IeeeAddress)
+		}
+	}
+
+	deepest := 0
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, next := range neighbours[current] {
+			if _, seen := depths[next]; !seen {
+				depths[next] = depths[current] + 1
+				if depths[next] > deepest {
+					deepest = depths[next]
+				}
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	for _, node := range networkMap.Nodes {
+		if _, seen := depths[node.IeeeAddress]; !seen {
+			depths[node.IeeeAddress] = deepest + 1
+		}
+	}
+
+	return depths
+}
+
+// layout spreads each ring evenly, ordering nodes by the angle of the neighbour that brought them into the ring so
+// children stay close to their parents
+func layout(networkMap model.NetworkMap, depths map[string]int) (map[string]position, float64) {
+
+	parents := make(map[string]string)
+
+	for _, link := range networkMap.Links {
+		for _, pair := range [][2]string{{link.Source, link.Target}, {link.Target, link.Source}} {
+			child, parent := pair[0], pair[1]
+			if _, ok := parents[child]; !ok && depths[parent] == depths[child]-1 {
+				parents[child] = parent
+			}
+		}
+	}
+
+	rings := make(map[int][]model.NetworkNode)
+	deepest := 0
+
+	for _, node := range networkMap.Nodes {
+		depth := depths[node.IeeeAddress]
+		rings[depth] = append(rings[depth], node)
+		if depth > deepest {
+			deepest = depth
+		}
+	}
+
+	positions := make(map[string]position)
+
+	for depth := 0; depth <= deepest; depth++ {
+
+		ring := rings[depth]
+
+		sort.SliceStable(ring, func(i, j int) bool {
+			a, b := positions[parents[ring[i].IeeeAddress]].angle, positions[parents[ring[j].IeeeAddress]].angle
+			if a != b {
+				return a < b
+			}
+			return ring[i].FriendlyName < ring[j].FriendlyName
+		})
+
+		radius := float64(depth) * ringSpacing
+
+		for i, node := range ring {
+			angle := 2*math.Pi*float64(i)/float64(len(ring)) - math.Pi/2
+			positions[node.IeeeAddress] = position{x: radius * math.Cos(angle), y: radius * math.Sin(angle), angle: angle}
+		}
+	}
+
+	return positions, float64(deepest) * ringSpacing
+}
+
+// uniqueLinks keeps the weakest of the links reported in each direction between two nodes
+func uniqueLinks(links []model.NetworkLink) []model.NetworkLink {
+
+	index := make(map[[2]string]int)
+	unique := make([]model.NetworkLink, 0, len(links))
+
+	for _, link := range links {
+
+		key := [2]string{link.Source, link.Target}
+		if key[1] < key[0] {
+			key = [2]string{link.Target, link.Source}
+		}
+
+		if i, ok := index[key]; ok {
+			if link.LinkQuality < unique[i].LinkQuality {
+				unique[i] = link
+			}
+			continue
+		}
+
+		index[key] = len(unique)
+		unique = append(unique, link)
+	}
+
+	return unique
+}
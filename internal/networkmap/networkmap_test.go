@@ -0,0 +1,185 @@
+package networkmap
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+const (
+	coordinator   = "0x00124b0001a2b3c4"
+	hallPlug      = "0x0017880100a1b2c3"
+	garagePlug    = "0x0017880100d4e5f6"
+	kitchenSensor = "0x00158d0001a1a1a1"
+	bedroomSensor = "0x00158d0001b2b2b2"
+	shedSensor    = "0x00158d0001c3c3c3"
+	letterbox     = "0x00158d0001d4d4d4"
+)
+
+// recorded parses testdata/networkmap.json, the data of a zigbee2mqtt raw networkmap response. The letterbox has
+// dropped off the mesh and is in no neighbour table.
+func recorded(t *testing.T) *model.NetworkMap {
+
+	t.Helper()
+
+	data, err := ioutil.ReadFile("testdata/networkmap.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	networkMap, err := Parse(data)
+
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	return networkMap
+}
+
+func TestParse(t *testing.T) {
+
+	networkMap := recorded(t)
+
+	if len(networkMap.Nodes) != 7 || len(networkMap.Links) != 7 {
+		t.Fatalf("parsed %d nodes and %d links, expected 7 of each", len(networkMap.Nodes), len(networkMap.Links))
+	}
+
+	if node := networkMap.Nodes[1]; node != (model.NetworkNode{IeeeAddress: hallPlug, NetworkAddress: 4711, FriendlyName: "Hall plug", Type: routerType}) {
+		t.Errorf("node %+v", node)
+	}
+
+	if link := networkMap.Links[3]; link != (model.NetworkLink{Source: garagePlug, Target: hallPlug, LinkQuality: 90, Depth: 2, Relationship: 2}) {
+		t.Errorf("link %+v", link)
+	}
+
+	for _, data := range []string{`{"value": {"links": []}}`, `{"value": `} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) succeeded", data)
+		}
+	}
+}
+
+func TestNodeDepths(t *testing.T) {
+
+	depths := nodeDepths(*recorded(t))
+
+	expected := map[string]int{
+		coordinator:   0,
+		hallPlug:      1,
+		bedroomSensor: 1,
+		garagePlug:    2,
+		kitchenSensor: 2,
+		shedSensor:    3,
+		// Nodes without a path go one ring past the deepest
+		letterbox: 4,
+	}
+
+	for ieeeAddress, depth := range expected {
+		if depths[ieeeAddress] != depth {
+			t.Errorf("depth of %s = %d, expected %d", ieeeAddress, depths[ieeeAddress], depth)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+
+	networkMap := *recorded(t)
+	depths := nodeDepths(networkMap)
+	positions, radius := layout(networkMap, depths)
+
+	if radius != 4*ringSpacing {
+		t.Errorf("radius %v, expected %v", radius, 4*ringSpacing)
+	}
+
+	for _, node := range networkMap.Nodes {
+
+		p := positions[node.IeeeAddress]
+
+		if distance := math.Hypot(p.x, p.y); math.Abs(distance-float64(depths[node.IeeeAddress])*ringSpacing) > 1e-9 {
+			t.Errorf("%s is %v from the centre, expected ring %d", node.FriendlyName, distance, depths[node.IeeeAddress])
+		}
+	}
+
+	// Nodes sharing a parent are ordered by name, each ring starting at the top and going clockwise
+	angles := []struct {
+		ieeeAddress string
+		angle       float64
+	}{
+		{bedroomSensor, -math.Pi / 2},
+		{hallPlug, math.Pi / 2},
+		{garagePlug, -math.Pi / 2},
+		{kitchenSensor, math.Pi / 2},
+		{shedSensor, -math.Pi / 2},
+	}
+
+	for _, expected := range angles {
+		if angle := positions[expected.ieeeAddress].angle; math.Abs(angle-expected.angle) > 1e-9 {
+			t.Errorf("angle of %s = %v, expected %v", expected.ieeeAddress, angle, expected.angle)
+		}
+	}
+}
+
+func TestUniqueLinks(t *testing.T) {
+
+	links := uniqueLinks(recorded(t).Links)
+
+	if len(links) != 5 {
+		t.Fatalf("%d unique links, expected 5: %+v", len(links), links)
+	}
+
+	// Of the two directions the weakest is kept
+	for _, link := range links {
+		if (link.Source == hallPlug || link.Target == hallPlug) && (link.Source == coordinator || link.Target == coordinator) && link.LinkQuality != 180 {
+			t.Errorf("coordinator link quality %d, expected 180", link.LinkQuality)
+		}
+		if (link.Source == hallPlug || link.Target == hallPlug) && (link.Source == garagePlug || link.Target == garagePlug) && link.LinkQuality != 90 {
+			t.Errorf("router link quality %d, expected 90", link.LinkQuality)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+
+	var svg strings.Builder
+
+	if err := Render(&svg, *recorded(t), 30); err != nil {
+		t.Fatal(err)
+	}
+
+	output := svg.String()
+
+	// Four rings of 160 and a margin of 120 each side
+	if !strings.HasPrefix(output, `<svg xmlns="http://www.w3.org/2000/svg" width="1520" height="1520" viewBox="0 0 1520 1520"`) || !strings.HasSuffix(output, "</svg>\n") {
+		t.Errorf("unexpected document %q", output)
+	}
+
+	counts := map[string]int{
+		"<line ":                      5,
+		`stroke="` + colourWeak + `"`: 1,
+		`stroke="` + colourFair + `"`: 2,
+		`stroke="` + colourGood + `"`: 2,
+		`<rect x=`:                    1,
+		`r="10"`:                      2,
+		`r="6"`:                       4,
+		"Letterbox &amp; gate":        1,
+	}
+
+	for text, count := range counts {
+		if actual := strings.Count(output, text); actual != count {
+			t.Errorf("%d of %s, expected %d", actual, text, count)
+		}
+	}
+
+	svg.Reset()
+
+	if err := Render(&svg, model.NetworkMap{}, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(svg.String(), "No devices in the network map") {
+		t.Errorf("empty map rendered as %q", svg.String())
+	}
+}
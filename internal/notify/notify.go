@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	TypeWebhook = "webhook"
+	TypeSmtp    = "smtp"
+	TypeNtfy    = "ntfy"
+
+	PriorityDefault = "default"
+	PriorityHigh    = "high"
+)
+
+type Notification struct {
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Priority string    `json:"priority"`
+	Origin   string    `json:"origin"`
+	Date     time.Time `json:"date"`
+}
+
+type INotifier interface {
+	Name() string
+	Notify(ctx context.Context, notification Notification) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewNotifier builds the notifier described by one entry of the notifiers configuration
+func NewNotifier(configuration config.NotifierConfiguration) (INotifier, error) {
+
+	switch configuration.Type {
+	case TypeWebhook:
+		return &WebhookNotifier{name: configuration.Name, url: configuration.Url, token: configuration.Token, client: httpClient}, nil
+	case TypeNtfy:
+		return &NtfyNotifier{name: configuration.Name, url: configuration.Url, token: configuration.Token, client: httpClient}, nil
+	case TypeSmtp:
+		return &SmtpNotifier{
+			name: configuration.Name,
+			host: configuration.Host,
+			port: configuration.Port,
+			user: configuration.User,
+			pass: configuration.Pass,
+			from: configuration.From,
+			to:   configuration.To,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown notifier type %q", configuration.Type)
+}
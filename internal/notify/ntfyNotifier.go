@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NtfyNotifier publishes to an ntfy style topic URL: the message is the body, the title and priority are headers
+type NtfyNotifier struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (n *NtfyNotifier) Name() string {
+	return n.name
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, notification Notification) error {
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(notification.Message))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if notification.Title != "" {
+		request.Header.Set("Title", notification.Title)
+	}
+
+	if notification.Priority != "" {
+		request.Header.Set("Priority", notification.Priority)
+	}
+
+	if n.token != "" {
+		request.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	response, err := n.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("ntfy %s responded %s", n.name, response.Status)
+	}
+
+	return nil
+}
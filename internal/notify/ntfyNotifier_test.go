@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNtfyNotifier(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		token        string
+		notification Notification
+		headers      map[string]string
+	}{
+		{
+			name:         "all headers",
+			token:        "tk_secret",
+			notification: Notification{Title: "Alert: freezer", Message: "Freezer is at -2 °C\nCheck the door", Priority: PriorityHigh},
+			headers: map[string]string{
+				"Title":         "Alert: freezer",
+				"Priority":      "high",
+				"Authorization": "Bearer tk_secret",
+				"Content-Type":  "text/plain; charset=utf-8",
+			},
+		},
+		{
+			name:         "message only",
+			notification: Notification{Message: "Batteries are fine"},
+			headers: map[string]string{
+				"Title":         "",
+				"Priority":      "",
+				"Authorization": "",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var body string
+			var header http.Header
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				if r.Method != http.MethodPost || r.URL.Path != "/domicile" {
+					t.Errorf("request = %s %s, expected POST /domicile", r.Method, r.URL.Path)
+				}
+
+				data, _ := ioutil.ReadAll(r.Body)
+				body, header = string(data), r.Header
+			}))
+
+			defer server.Close()
+
+			notifier := newTestNotifier(t, config.NotifierConfiguration{Name: "phone", Type: TypeNtfy, Url: server.URL + "/domicile", Token: test.token})
+
+			if err := notifier.Notify(context.Background(), test.notification); err != nil {
+				t.Fatalf("Notify: %v", err)
+			}
+
+			if body != test.notification.Message {
+				t.Errorf("body = %q, expected %q", body, test.notification.Message)
+			}
+
+			for name, expected := range test.headers {
+				if got := header.Get(name); got != expected {
+					t.Errorf("%s = %q, expected %q", name, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestNtfyNotifierRejected(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+
+	defer server.Close()
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{Name: "phone", Type: TypeNtfy, Url: server.URL})
+
+	if err := notifier.Notify(context.Background(), Notification{Message: "x"}); err == nil {
+		t.Error("Notify succeeded against a server responding 401")
+	}
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The whole conversation with the server must finish in this long when ctx has no earlier deadline
+const smtpTimeout = 30 * time.Second
+
+// SmtpNotifier sends the notification as a plain text email, authenticating only when a user is configured
+type SmtpNotifier struct {
+	name string
+	host string
+	port int
+	user string
+	pass string
+	from string
+	to   []string
+}
+
+func (n *SmtpNotifier) Name() string {
+	return n.name
+}
+
+func (n *SmtpNotifier) Notify(ctx context.Context, notification Notification) error {
+
+	if len(n.to) == 0 {
+		return errors.New("smtp " + n.name + " has no recipients")
+	}
+
+	var auth smtp.Auth
+
+	if n.user != "" {
+		auth = smtp.PlainAuth("", n.user, n.pass, n.host)
+	}
+
+	date := notification.Date
+
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var message strings.Builder
+
+	fmt.Fprintf(&message, "From: %s\r\n", n.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Title))
+	fmt.Fprintf(&message, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&message, "\r\n%s\r\n", strings.ReplaceAll(notification.Message, "\n", "\r\n"))
+
+	return n.send(ctx, auth, []byte(message.String()))
+}
+
+// send does what smtp.SendMail does, on a connection that gives up at ctx's deadline or when ctx is cancelled
+func (n *SmtpNotifier) send(ctx context.Context, auth smtp.Auth, message []byte) error {
+
+	dialer := net.Dialer{Timeout: smtpTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.host, strconv.Itoa(n.port)))
+
+	if err != nil {
+		return err
+	}
+
+	deadline, ok := ctx.Deadline()
+
+	if !ok || time.Until(deadline) > smtpTimeout {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, n.host)
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp " + n.name + " server does not support authentication")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+
+	for _, to := range n.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
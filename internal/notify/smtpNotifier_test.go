@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSmtpServer accepts one conversation at a time, recording the envelope and message of each mail
+type fakeSmtpServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	auth     string
+	from     string
+	to       []string
+	data     string
+	// silent accepts connections without ever greeting, like a hung server
+	silent bool
+}
+
+func newFakeSmtpServer(t *testing.T, silent bool) *fakeSmtpServer {
+
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeSmtpServer{listener: listener, silent: silent}
+
+	go server.serve()
+
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+func (s *fakeSmtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtpServer) serve() {
+
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		if s.silent {
+			defer conn.Close()
+			continue
+		}
+
+		s.converse(conn)
+	}
+}
+
+func (s *fakeSmtpServer) converse(conn net.Conn) {
+
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 fake ESMTP")
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		s.mutex.Lock()
+
+		switch command {
+		case "EHLO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = line
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.from = line
+			reply("250 OK")
+		case "RCPT":
+			s.to = append(s.to, line)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					s.mutex.Unlock()
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.data = data.String()
+			reply("250 OK queued")
+		case "QUIT":
+			reply("221 Bye")
+			s.mutex.Unlock()
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+
+		s.mutex.Unlock()
+	}
+}
+
+func TestSmtpNotifier(t *testing.T) {
+
+	server := newFakeSmtpServer(t, false)
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{
+		Name: "email",
+		Type: TypeSmtp,
+		Host: "127.0.0.1",
+		Port: server.port(),
+		User: "domicile",
+		Pass: "secret",
+		From: "domicile@example.com",
+		To:   []string{"one@example.com", "two@example.com"},
+	})
+
+	err := notifier.Notify(context.Background(), Notification{
+		Title:   "Alert: fräezer",
+		Message: "Freezer is at -2 °C\nCheck the door",
+		Date:    time.Date(2026, time.January, 14, 9, 30, 0, 0, time.UTC),
+	})
+
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	expectedAuth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00domicile\x00secret"))
+
+	if server.auth != expectedAuth {
+		t.Errorf("auth = %q, expected %q", server.auth, expectedAuth)
+	}
+
+	if server.from != "MAIL FROM:<domicile@example.com>" {
+		t.Errorf("from = %q", server.from)
+	}
+
+	if strings.Join(server.to, ",") != "RCPT TO:<one@example.com>,RCPT TO:<two@example.com>" {
+		t.Errorf("to = %q", server.to)
+	}
+
+	for _, expected := range []string{
+		"From: domicile@example.com\r\n",
+		"To: one@example.com, two@example.com\r\n",
+		"Subject: =?utf-8?q?Alert:_fr=C3=A4ezer?=\r\n",
+		"Date: Wed, 14 Jan 2026 09:30:00 +0000\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\nFreezer is at -2 °C\r\nCheck the door\r\n",
+	} {
+		if !strings.Contains(server.data, expected) {
+			t.Errorf("message is missing %q:\n%s", expected, server.data)
+		}
+	}
+}
+
+func TestSmtpNotifierGivesUpOnAHungServer(t *testing.T) {
+
+	server := newFakeSmtpServer(t, true)
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{
+		Name: "email",
+		Type: TypeSmtp,
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "domicile@example.com",
+		To:   []string{"one@example.com"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	if err := notifier.Notify(ctx, Notification{Title: "x", Message: "x"}); err == nil {
+		t.Fatal("Notify succeeded against a server that never greets")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify took %s to give up", elapsed)
+	}
+}
+
+func TestSmtpNotifierNeedsRecipients(t *testing.T) {
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{Name: "email", Type: TypeSmtp, Host: "127.0.0.1", Port: 25})
+
+	if err := notifier.Notify(context.Background(), Notification{}); err == nil {
+		t.Error("Notify succeeded without recipients")
+	}
+}
+
+func TestSmtpNotifierUnreachable(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{
+		Name: "email",
+		Type: TypeSmtp,
+		Host: "127.0.0.1",
+		Port: port,
+		From: "domicile@example.com",
+		To:   []string{"one@example.com"},
+	})
+
+	if err := notifier.Notify(context.Background(), Notification{Title: "x"}); err == nil {
+		t.Error("Notify succeeded with nothing listening on " + strconv.Itoa(port))
+	}
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// WebhookNotifier POSTs the notification as JSON to a URL
+type WebhookNotifier struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+
+	body, err := json.Marshal(notification)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	if n.token != "" {
+		request.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	response, err := n.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", n.name, response.Status)
+	}
+
+	return nil
+}
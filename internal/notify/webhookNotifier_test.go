@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+
+	var received Notification
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, expected POST", r.Method)
+		}
+
+		header = r.Header
+
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer server.Close()
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{Name: "hook", Type: TypeWebhook, Url: server.URL, Token: "secret"})
+
+	notification := Notification{
+		Title:    "Alert: freezer",
+		Message:  "Freezer is at -2 °C, 100% over",
+		Priority: PriorityHigh,
+		Origin:   "alert:1",
+		Date:     time.Date(2026, time.January, 14, 9, 30, 0, 0, time.UTC),
+	}
+
+	if err := notifier.Notify(context.Background(), notification); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if received != notification {
+		t.Errorf("received %+v, expected %+v", received, notification)
+	}
+
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	if got := header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+}
+
+func TestWebhookNotifierFailures(t *testing.T) {
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+			return
+		}
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+
+	defer server.Close()
+	defer close(release)
+
+	notifier := newTestNotifier(t, config.NotifierConfiguration{Name: "hook", Type: TypeWebhook, Url: server.URL})
+
+	if err := notifier.Notify(context.Background(), Notification{Title: "x"}); err == nil {
+		t.Error("Notify succeeded against a server responding 500")
+	}
+
+	slow := newTestNotifier(t, config.NotifierConfiguration{Name: "hook", Type: TypeWebhook, Url: server.URL + "/slow"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := slow.Notify(ctx, Notification{Title: "x"}); err == nil {
+		t.Error("Notify succeeded against a server that never responds")
+	}
+}
+
+func TestNewNotifierRejectsUnknownTypes(t *testing.T) {
+	if _, err := NewNotifier(config.NotifierConfiguration{Name: "pager", Type: "pager"}); err == nil {
+		t.Error("NewNotifier accepted an unknown type")
+	}
+}
+
+func newTestNotifier(t *testing.T, configuration config.NotifierConfiguration) INotifier {
+
+	t.Helper()
+
+	notifier, err := NewNotifier(configuration)
+
+	if err != nil {
+		t.Fatalf("NewNotifier: %v", err)
+	}
+
+	if notifier.Name() != configuration.Name {
+		t.Errorf("Name = %q, expected %q", notifier.Name(), configuration.Name)
+	}
+
+	return notifier
+}
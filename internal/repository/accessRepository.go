@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type IAccessRepository interface {
+	GetAreaRoles(ctx context.Context, userId uint64) ([]model.AreaRole, error)
+	SetAreaRole(ctx context.Context, userId uint64, areaId uint64, role string) (*model.AreaRole, error)
+	DeleteAreaRole(ctx context.Context, userId uint64, areaId uint64) error
+}
+
+type PostgresAccessRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var areaRoleFields = "USER_ID, AREA_ID, DATE_CREATED, ROLE"
+
+var scanAreaRole = func(row pgx.Row, object *model.AreaRole) error {
+	return row.Scan(&object.UserId, &object.AreaId, &object.DateCreated, &object.Role)
+}
+
+func (r *PostgresAccessRepository) GetAreaRoles(ctx context.Context, userId uint64) ([]model.AreaRole, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+areaRoleFields+" FROM AREA_ROLES WHERE USER_ID = $1 ORDER BY AREA_ID", userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.AreaRole, 0)
+
+	for rows.Next() {
+		var row model.AreaRole
+		err = scanAreaRole(rows, &row)
+		if err != nil {
+			log.Println("GetAreaRoles:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAreaRoles:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAccessRepository) SetAreaRole(ctx context.Context, userId uint64, areaId uint64, role string) (*model.AreaRole, error) {
+
+	row := r.Postgres.QueryRow(ctx,
+		"INSERT INTO AREA_ROLES ("+areaRoleFields+") VALUES ($1, $2, $3, $4)"+
+			" ON CONFLICT (USER_ID, AREA_ID) DO UPDATE SET ROLE = EXCLUDED.ROLE RETURNING "+areaRoleFields,
+		userId, areaId, time.Now(), role)
+
+	var object model.AreaRole
+
+	if err := scanAreaRole(row, &object); err != nil {
+		log.Println("SetAreaRole:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAccessRepository) DeleteAreaRole(ctx context.Context, userId uint64, areaId uint64) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM AREA_ROLES WHERE USER_ID = $1 AND AREA_ID = $2", userId, areaId)
+
+	if err != nil {
+		log.Println("DeleteAreaRole:", err)
+	}
+
+	return err
+}
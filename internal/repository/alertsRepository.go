@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type IAlertsRepository interface {
+	GetAlertRules(ctx context.Context) ([]model.AlertRule, error)
+	GetAlertRule(ctx context.Context, id uint64) (*model.AlertRule, error)
+	CreateAlertRule(ctx context.Context, rule model.AlertRule) (*model.AlertRule, error)
+	UpdateAlertRule(ctx context.Context, rule model.AlertRule) (*model.AlertRule, error)
+	DeleteAlertRule(ctx context.Context, id uint64) error
+	GetAlerts(ctx context.Context, state *string, limit int) ([]model.Alert, error)
+	CreateAlert(ctx context.Context, ruleId uint64, ieeeAddress string, value float64, date time.Time) (*model.Alert, error)
+	ResolveAlert(ctx context.Context, id uint64, value float64, date time.Time) (*model.Alert, error)
+}
+
+type PostgresAlertsRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var alertRuleFields = "ID, DATE_CREATED, DATE_MODIFIED, NAME, ENABLED, TYPE, MEASUREMENT, AREA_ID, IEEE_ADDRESS, OPERATOR, THRESHOLD, HYSTERESIS, FOR_MINUTES, CHANNELS"
+
+var alertFields = "ID, RULE_ID, IEEE_ADDRESS, STATE, VALUE, DATE_FIRED, DATE_RESOLVED"
+
+var scanAlertRule = func(row pgx.Row, object *model.AlertRule) error {
+	return row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.Name, &object.Enabled, &object.Type, &object.Measurement,
+		&object.AreaId, &object.IeeeAddress, &object.Operator, &object.Threshold, &object.Hysteresis, &object.ForMinutes, &object.Channels)
+}
+
+var scanAlert = func(row pgx.Row, object *model.Alert) error {
+	return row.Scan(&object.Id, &object.RuleId, &object.IeeeAddress, &object.State, &object.Value, &object.DateFired, &object.DateResolved)
+}
+
+func (r *PostgresAlertsRepository) GetAlertRules(ctx context.Context) ([]model.AlertRule, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+alertRuleFields+" FROM ALERT_RULES ORDER BY ID")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.AlertRule, 0)
+
+	for rows.Next() {
+		var row model.AlertRule
+		err = scanAlertRule(rows, &row)
+		if err != nil {
+			log.Println("GetAlertRules:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAlertRules:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAlertsRepository) GetAlertRule(ctx context.Context, id uint64) (*model.AlertRule, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+alertRuleFields+" FROM ALERT_RULES WHERE ID = $1", id)
+
+	var object model.AlertRule
+
+	err := scanAlertRule(row, &object)
+
+	if err != nil {
+		log.Println("GetAlertRule:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAlertsRepository) CreateAlertRule(ctx context.Context, rule model.AlertRule) (*model.AlertRule, error) {
+
+	dateCreated := time.Now().UTC()
+
+	query := `
+				INSERT INTO ALERT_RULES
+					(DATE_CREATED, DATE_MODIFIED, NAME, ENABLED, TYPE, MEASUREMENT, AREA_ID, IEEE_ADDRESS,
+					 OPERATOR, THRESHOLD, HYSTERESIS, FOR_MINUTES, CHANNELS)
+				VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+				RETURNING ` + alertRuleFields
+
+	row := r.Postgres.QueryRow(ctx, query, dateCreated, dateCreated, rule.Name, rule.Enabled, rule.Type, rule.Measurement, rule.AreaId,
+		rule.IeeeAddress, rule.Operator, rule.Threshold, rule.Hysteresis, rule.ForMinutes, channels(rule.Channels))
+
+	var object model.AlertRule
+
+	err := scanAlertRule(row, &object)
+
+	if err != nil {
+		log.Println("CreateAlertRule:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAlertsRepository) UpdateAlertRule(ctx context.Context, rule model.AlertRule) (*model.AlertRule, error) {
+
+	query := `
+				UPDATE ALERT_RULES SET
+					DATE_MODIFIED = $1, NAME = $2, ENABLED = $3, TYPE = $4, MEASUREMENT = $5, AREA_ID = $6, IEEE_ADDRESS = $7,
+					OPERATOR = $8, THRESHOLD = $9, HYSTERESIS = $10, FOR_MINUTES = $11, CHANNELS = $12
+				WHERE ID = $13
+				RETURNING ` + alertRuleFields
+
+	row := r.Postgres.QueryRow(ctx, query, time.Now().UTC(), rule.Name, rule.Enabled, rule.Type, rule.Measurement, rule.AreaId,
+		rule.IeeeAddress, rule.Operator, rule.Threshold, rule.Hysteresis, rule.ForMinutes, channels(rule.Channels), rule.Id)
+
+	var object model.AlertRule
+
+	err := scanAlertRule(row, &object)
+
+	if err != nil {
+		log.Println("UpdateAlertRule:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAlertsRepository) DeleteAlertRule(ctx context.Context, id uint64) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM ALERT_RULES WHERE ID = $1", id)
+
+	if err != nil {
+		log.Println("DeleteAlertRule:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *PostgresAlertsRepository) GetAlerts(ctx context.Context, state *string, limit int) ([]model.Alert, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+alertFields+" FROM ALERTS WHERE ($1::varchar IS NULL OR STATE = $1) ORDER BY DATE_FIRED DESC LIMIT $2", state, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Alert, 0)
+
+	for rows.Next() {
+		var row model.Alert
+		err = scanAlert(rows, &row)
+		if err != nil {
+			log.Println("GetAlerts:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAlerts:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAlertsRepository) CreateAlert(ctx context.Context, ruleId uint64, ieeeAddress string, value float64, date time.Time) (*model.Alert, error) {
+
+	query := `
+				INSERT INTO ALERTS
+					(RULE_ID, IEEE_ADDRESS, STATE, VALUE, DATE_FIRED)
+				VALUES
+					($1, $2, $3, $4, $5)
+				RETURNING ` + alertFields
+
+	row := r.Postgres.QueryRow(ctx, query, ruleId, ieeeAddress, model.AlertFiring, value, date)
+
+	var object model.Alert
+
+	err := scanAlert(row, &object)
+
+	if err != nil {
+		log.Println("CreateAlert:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAlertsRepository) ResolveAlert(ctx context.Context, id uint64, value float64, date time.Time) (*model.Alert, error) {
+
+	query := "UPDATE ALERTS SET STATE = $1, VALUE = $2, DATE_RESOLVED = $3 WHERE ID = $4 RETURNING " + alertFields
+
+	row := r.Postgres.QueryRow(ctx, query, model.AlertResolved, value, date, id)
+
+	var object model.Alert
+
+	err := scanAlert(row, &object)
+
+	if err != nil {
+		log.Println("ResolveAlert:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func channels(values []string) []string {
+
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
@@ -11,6 +11,9 @@ import (
 type IAreasRepository interface {
 	GetAreas(ctx context.Context) ([]model.Area, error)
 	GetArea(ctx context.Context, uuid uuid.UUID) (*model.Area, error)
+	GetAreaById(ctx context.Context, id uint64) (*model.Area, error)
+	GetAreasByIds(ctx context.Context, ids []uint64) ([]model.Area, error)
+	UpdateAreaParent(ctx context.Context, id uint64, parentId *uint64) (*model.Area, error)
 }
 
 type PostgresAreasRepository struct {
@@ -19,7 +22,7 @@ type PostgresAreasRepository struct {
 
 func (r *PostgresAreasRepository) GetAreas(ctx context.Context) ([]model.Area, error) {
 
-	rows, err := r.Postgres.Query(ctx, "SELECT ID, UUID, DATE_CREATED, NAME FROM AREAS")
+	rows, err := r.Postgres.Query(ctx, "SELECT ID, UUID, DATE_CREATED, NAME, PARENT_ID FROM AREAS")
 
 	if err != nil {
 		return nil, err
@@ -31,16 +34,16 @@ func (r *PostgresAreasRepository) GetAreas(ctx context.Context) ([]model.Area, e
 
 	for rows.Next() {
 		var row model.Area
-		err = rows.Scan(&row.Id, &row.Uuid, &row.DateCreated, &row.Name)
+		err = rows.Scan(&row.Id, &row.Uuid, &row.DateCreated, &row.Name, &row.ParentId)
 		if err != nil {
-			log.Fatal("GetAreas:", err)
+			log.Println("GetAreas:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetAreas:", err)
+		log.Println("GetAreas:", err)
 		return nil, err
 	}
 
@@ -49,11 +52,11 @@ func (r *PostgresAreasRepository) GetAreas(ctx context.Context) ([]model.Area, e
 
 func (r *PostgresAreasRepository) GetArea(ctx context.Context, uuid uuid.UUID) (*model.Area, error) {
 
-	row := r.Postgres.QueryRow(ctx, "SELECT ID, UUID, DATE_CREATED, NAME FROM AREAS WHERE UUID = $1", uuid)
+	row := r.Postgres.QueryRow(ctx, "SELECT ID, UUID, DATE_CREATED, NAME, PARENT_ID FROM AREAS WHERE UUID = $1", uuid)
 
 	var object model.Area
 
-	err := row.Scan(&object.Id, &object.Uuid, &object.DateCreated, &object.Name)
+	err := row.Scan(&object.Id, &object.Uuid, &object.DateCreated, &object.Name, &object.ParentId)
 
 	if err != nil {
 		log.Println("GetArea:", err)
@@ -62,3 +65,66 @@ func (r *PostgresAreasRepository) GetArea(ctx context.Context, uuid uuid.UUID) (
 
 	return &object, nil
 }
+
+func (r *PostgresAreasRepository) GetAreaById(ctx context.Context, id uint64) (*model.Area, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT ID, UUID, DATE_CREATED, NAME, PARENT_ID FROM AREAS WHERE ID = $1", id)
+
+	var object model.Area
+
+	err := row.Scan(&object.Id, &object.Uuid, &object.DateCreated, &object.Name, &object.ParentId)
+
+	if err != nil {
+		log.Println("GetAreaById:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+// GetAreasByIds returns the areas with any of the ids in one query
+func (r *PostgresAreasRepository) GetAreasByIds(ctx context.Context, ids []uint64) ([]model.Area, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT ID, UUID, DATE_CREATED, NAME, PARENT_ID FROM AREAS WHERE ID = ANY($1)", ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Area, 0)
+
+	for rows.Next() {
+		var row model.Area
+		err = rows.Scan(&row.Id, &row.Uuid, &row.DateCreated, &row.Name, &row.ParentId)
+		if err != nil {
+			log.Println("GetAreasByIds:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAreasByIds:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAreasRepository) UpdateAreaParent(ctx context.Context, id uint64, parentId *uint64) (*model.Area, error) {
+
+	row := r.Postgres.QueryRow(ctx, "UPDATE AREAS SET PARENT_ID = $2 WHERE ID = $1 RETURNING ID, UUID, DATE_CREATED, NAME, PARENT_ID", id, parentId)
+
+	var object model.Area
+
+	err := row.Scan(&object.Id, &object.Uuid, &object.DateCreated, &object.Name, &object.ParentId)
+
+	if err != nil {
+		log.Println("UpdateAreaParent:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
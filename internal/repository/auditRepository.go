@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+)
+
+type IAuditRepository interface {
+	GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error)
+	CreateAuditEntry(ctx context.Context, entry model.AuditEntry) error
+}
+
+type PostgresAuditRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var auditFields = "ID, DATE, DIRECTION, ACTION, TARGET, PAYLOAD, ORIGIN_TYPE, ORIGIN_ID, ORIGIN_CLIENT, OUTCOME, ERROR"
+
+var scanAuditEntry = func(row pgx.Row, object *model.AuditEntry) error {
+	return row.Scan(&object.Id, &object.Date, &object.Direction, &object.Action, &object.Target, &object.Payload,
+		&object.Origin.Type, &object.Origin.Id, &object.Origin.Client, &object.Outcome, &object.Error)
+}
+
+func (r *PostgresAuditRepository) GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+
+	query := `
+				SELECT ` + auditFields + ` FROM AUDIT_LOG
+				WHERE ($1::varchar IS NULL OR ACTION = $1)
+					AND ($2::varchar IS NULL OR TARGET = $2)
+					AND ($3::varchar IS NULL OR ORIGIN_TYPE = $3)
+					AND ($4::varchar IS NULL OR ORIGIN_ID = $4)
+					AND ($5::varchar IS NULL OR OUTCOME = $5)
+					AND ($6::timestamptz IS NULL OR DATE >= $6)
+					AND ($7::timestamptz IS NULL OR DATE <= $7)
+					AND ($8::varchar IS NULL OR DIRECTION = $8)
+				ORDER BY DATE DESC LIMIT $9 OFFSET $10`
+
+	rows, err := r.Postgres.Query(ctx, query, filter.Action, filter.Target, filter.OriginType, filter.OriginId, filter.Outcome,
+		filter.StartDate, filter.EndDate, filter.Direction, filter.Limit, filter.Offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.AuditEntry, 0)
+
+	for rows.Next() {
+		var row model.AuditEntry
+		err = scanAuditEntry(rows, &row)
+		if err != nil {
+			log.Println("GetAuditEntries:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAuditEntries:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAuditRepository) CreateAuditEntry(ctx context.Context, entry model.AuditEntry) error {
+
+	var payload *string
+
+	if entry.Payload != nil {
+		data, err := json.Marshal(entry.Payload)
+		if err != nil {
+			return err
+		}
+		x := string(data)
+		payload = &x
+	}
+
+	_, err := r.Postgres.Exec(ctx, `
+				INSERT INTO AUDIT_LOG 
+					(DATE, DIRECTION, ACTION, TARGET, PAYLOAD, ORIGIN_TYPE, ORIGIN_ID, ORIGIN_CLIENT, OUTCOME, ERROR) 
+				VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.Date, entry.Direction, entry.Action, entry.Target, payload, entry.Origin.Type, entry.Origin.Id, entry.Origin.Client,
+		entry.Outcome, entry.Error)
+
+	if err != nil {
+		log.Println("CreateAuditEntry:", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type IAuthRepository interface {
+	GetUsers(ctx context.Context) ([]model.User, error)
+	GetUser(ctx context.Context, id uint64) (*model.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	CreateUser(ctx context.Context, username string, passwordHash string, scope string) (*model.User, error)
+	UpdateUserPassword(ctx context.Context, id uint64, passwordHash string) error
+	DeleteUser(ctx context.Context, id uint64) error
+	TouchUser(ctx context.Context, id uint64, date time.Time) error
+
+	GetSession(ctx context.Context, tokenHash string) (*model.Session, error)
+	CreateSession(ctx context.Context, session model.Session) error
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) error
+
+	GetApiKeys(ctx context.Context) ([]model.ApiKey, error)
+	GetApiKeyByHash(ctx context.Context, keyHash string) (*model.ApiKey, error)
+	CreateApiKey(ctx context.Context, name string, prefix string, keyHash string, scope string) (*model.ApiKey, error)
+	DeleteApiKey(ctx context.Context, id uint64) error
+	TouchApiKey(ctx context.Context, id uint64, date time.Time) error
+}
+
+type PostgresAuthRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var userFields = "ID, DATE_CREATED, USERNAME, PASSWORD_HASH, SCOPE, DATE_LAST_SEEN"
+
+var scanUser = func(row pgx.Row, object *model.User) error {
+	return row.Scan(&object.Id, &object.DateCreated, &object.Username, &object.PasswordHash, &object.Scope, &object.DateLastSeen)
+}
+
+var apiKeyFields = "ID, DATE_CREATED, NAME, PREFIX, KEY_HASH, SCOPE, DATE_LAST_USED"
+
+var scanApiKey = func(row pgx.Row, object *model.ApiKey) error {
+	return row.Scan(&object.Id, &object.DateCreated, &object.Name, &object.Prefix, &object.KeyHash, &object.Scope, &object.DateLastUsed)
+}
+
+func (r *PostgresAuthRepository) GetUsers(ctx context.Context) ([]model.User, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+userFields+" FROM USERS ORDER BY USERNAME")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.User, 0)
+
+	for rows.Next() {
+		var row model.User
+		err = scanUser(rows, &row)
+		if err != nil {
+			log.Println("GetUsers:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetUsers:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAuthRepository) GetUser(ctx context.Context, id uint64) (*model.User, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+userFields+" FROM USERS WHERE ID = $1", id)
+
+	var object model.User
+
+	if err := scanUser(row, &object); err != nil {
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAuthRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+userFields+" FROM USERS WHERE USERNAME = $1", username)
+
+	var object model.User
+
+	if err := scanUser(row, &object); err != nil {
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAuthRepository) CreateUser(ctx context.Context, username string, passwordHash string, scope string) (*model.User, error) {
+
+	row := r.Postgres.QueryRow(ctx, "INSERT INTO USERS (DATE_CREATED, USERNAME, PASSWORD_HASH, SCOPE) VALUES ($1, $2, $3, $4) RETURNING "+userFields,
+		time.Now().UTC(), username, passwordHash, scope)
+
+	var object model.User
+
+	if err := scanUser(row, &object); err != nil {
+		log.Println("CreateUser:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAuthRepository) UpdateUserPassword(ctx context.Context, id uint64, passwordHash string) error {
+
+	_, err := r.Postgres.Exec(ctx, "UPDATE USERS SET PASSWORD_HASH = $1 WHERE ID = $2", passwordHash, id)
+
+	if err != nil {
+		log.Println("UpdateUserPassword:", err)
+	}
+
+	return err
+}
+
+// DeleteUser disables the automations and schedules the user owns before deleting them, since rules without an owner
+// would otherwise run with unrestricted access
+func (r *PostgresAuthRepository) DeleteUser(ctx context.Context, id uint64) error {
+
+	tx, err := r.Postgres.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	for _, query := range []string{
+		"UPDATE AUTOMATIONS SET ENABLED = false WHERE OWNER_ID = $1",
+		"UPDATE SCHEDULES SET ENABLED = false WHERE OWNER_ID = $1",
+		"DELETE FROM USERS WHERE ID = $1",
+	} {
+		if _, err := tx.Exec(ctx, query, id); err != nil {
+			log.Println("DeleteUser:", err)
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+
+	if err != nil {
+		log.Println("DeleteUser:", err)
+	}
+
+	return err
+}
+
+func (r *PostgresAuthRepository) TouchUser(ctx context.Context, id uint64, date time.Time) error {
+
+	_, err := r.Postgres.Exec(ctx, "UPDATE USERS SET DATE_LAST_SEEN = $1 WHERE ID = $2", date, id)
+
+	return err
+}
+
+func (r *PostgresAuthRepository) GetSession(ctx context.Context, tokenHash string) (*model.Session, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT TOKEN_HASH, USER_ID, DATE_CREATED, DATE_EXPIRES FROM SESSIONS WHERE TOKEN_HASH = $1", tokenHash)
+
+	var object model.Session
+
+	if err := row.Scan(&object.TokenHash, &object.UserId, &object.DateCreated, &object.DateExpires); err != nil {
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAuthRepository) CreateSession(ctx context.Context, session model.Session) error {
+
+	_, err := r.Postgres.Exec(ctx, "INSERT INTO SESSIONS (TOKEN_HASH, USER_ID, DATE_CREATED, DATE_EXPIRES) VALUES ($1, $2, $3, $4)",
+		session.TokenHash, session.UserId, session.DateCreated, session.DateExpires)
+
+	if err != nil {
+		log.Println("CreateSession:", err)
+	}
+
+	return err
+}
+
+func (r *PostgresAuthRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM SESSIONS WHERE TOKEN_HASH = $1", tokenHash)
+
+	return err
+}
+
+func (r *PostgresAuthRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM SESSIONS WHERE DATE_EXPIRES < $1", now)
+
+	return err
+}
+
+func (r *PostgresAuthRepository) GetApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+apiKeyFields+" FROM API_KEYS ORDER BY NAME")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.ApiKey, 0)
+
+	for rows.Next() {
+		var row model.ApiKey
+		err = scanApiKey(rows, &row)
+		if err != nil {
+			log.Println("GetApiKeys:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetApiKeys:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAuthRepository) GetApiKeyByHash(ctx context.Context, keyHash string) (*model.ApiKey, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+apiKeyFields+" FROM API_KEYS WHERE KEY_HASH = $1", keyHash)
+
+	var object model.ApiKey
+
+	if err := scanApiKey(row, &object); err != nil {
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAuthRepository) CreateApiKey(ctx context.Context, name string, prefix string, keyHash string, scope string) (*model.ApiKey, error) {
+
+	row := r.Postgres.QueryRow(ctx, "INSERT INTO API_KEYS (DATE_CREATED, NAME, PREFIX, KEY_HASH, SCOPE) VALUES ($1, $2, $3, $4, $5) RETURNING "+apiKeyFields,
+		time.Now().UTC(), name, prefix, keyHash, scope)
+
+	var object model.ApiKey
+
+	if err := scanApiKey(row, &object); err != nil {
+		log.Println("CreateApiKey:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAuthRepository) DeleteApiKey(ctx context.Context, id uint64) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM API_KEYS WHERE ID = $1", id)
+
+	if err != nil {
+		log.Println("DeleteApiKey:", err)
+	}
+
+	return err
+}
+
+func (r *PostgresAuthRepository) TouchApiKey(ctx context.Context, id uint64, date time.Time) error {
+
+	_, err := r.Postgres.Exec(ctx, "UPDATE API_KEYS SET DATE_LAST_USED = $1 WHERE ID = $2", date, id)
+
+	return err
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type IAutomationsRepository interface {
+	GetAutomations(ctx context.Context) ([]model.Automation, error)
+	GetAutomation(ctx context.Context, id uint64) (*model.Automation, error)
+	CreateAutomation(ctx context.Context, automation model.Automation) (*model.Automation, error)
+	UpdateAutomation(ctx context.Context, automation model.Automation) (*model.Automation, error)
+	DeleteAutomation(ctx context.Context, id uint64) error
+	GetAutomationLogs(ctx context.Context, automationId uint64, limit int) ([]model.AutomationLog, error)
+	CreateAutomationLog(ctx context.Context, automationId uint64, trigger string, status string, message *string) (*model.AutomationLog, error)
+}
+
+type PostgresAutomationsRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var automationFields = "ID, DATE_CREATED, DATE_MODIFIED, NAME, ENABLED, TRIGGERS, CONDITIONS, ACTIONS, OWNER_ID"
+
+var scanAutomation = func(row pgx.Row, object *model.Automation) error {
+	return row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.Name, &object.Enabled, &object.Triggers, &object.Conditions, &object.Actions, &object.OwnerId)
+}
+
+func (r *PostgresAutomationsRepository) GetAutomations(ctx context.Context) ([]model.Automation, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+automationFields+" FROM AUTOMATIONS ORDER BY ID")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Automation, 0)
+
+	for rows.Next() {
+		var row model.Automation
+		err = scanAutomation(rows, &row)
+		if err != nil {
+			log.Println("GetAutomations:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAutomations:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAutomationsRepository) GetAutomation(ctx context.Context, id uint64) (*model.Automation, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+automationFields+" FROM AUTOMATIONS WHERE ID = $1", id)
+
+	var object model.Automation
+
+	err := scanAutomation(row, &object)
+
+	if err != nil {
+		log.Println("GetAutomation:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAutomationsRepository) CreateAutomation(ctx context.Context, automation model.Automation) (*model.Automation, error) {
+
+	triggers, conditions, actions, err := marshalAutomation(automation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dateCreated := time.Now().UTC()
+
+	query := `
+				INSERT INTO AUTOMATIONS
+					(DATE_CREATED, DATE_MODIFIED, NAME, ENABLED, TRIGGERS, CONDITIONS, ACTIONS, OWNER_ID)
+				VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING ` + automationFields
+
+	row := r.Postgres.QueryRow(ctx, query, dateCreated, dateCreated, automation.Name, automation.Enabled, triggers, conditions, actions, automation.OwnerId)
+
+	var object model.Automation
+
+	err = scanAutomation(row, &object)
+
+	if err != nil {
+		log.Println("CreateAutomation:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAutomationsRepository) UpdateAutomation(ctx context.Context, automation model.Automation) (*model.Automation, error) {
+
+	triggers, conditions, actions, err := marshalAutomation(automation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+				UPDATE AUTOMATIONS SET
+					DATE_MODIFIED = $1, NAME = $2, ENABLED = $3, TRIGGERS = $4, CONDITIONS = $5, ACTIONS = $6, OWNER_ID = $7
+				WHERE ID = $8
+				RETURNING ` + automationFields
+
+	row := r.Postgres.QueryRow(ctx, query, time.Now().UTC(), automation.Name, automation.Enabled, triggers, conditions, actions, automation.OwnerId, automation.Id)
+
+	var object model.Automation
+
+	err = scanAutomation(row, &object)
+
+	if err != nil {
+		log.Println("UpdateAutomation:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresAutomationsRepository) DeleteAutomation(ctx context.Context, id uint64) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM AUTOMATIONS WHERE ID = $1", id)
+
+	if err != nil {
+		log.Println("DeleteAutomation:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *PostgresAutomationsRepository) GetAutomationLogs(ctx context.Context, automationId uint64, limit int) ([]model.AutomationLog, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT ID, AUTOMATION_ID, DATE, TRIGGER, STATUS, MESSAGE FROM AUTOMATION_LOGS WHERE AUTOMATION_ID = $1 ORDER BY DATE DESC LIMIT $2", automationId, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.AutomationLog, 0)
+
+	for rows.Next() {
+		var row model.AutomationLog
+		err = rows.Scan(&row.Id, &row.AutomationId, &row.Date, &row.Trigger, &row.Status, &row.Message)
+		if err != nil {
+			log.Println("GetAutomationLogs:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetAutomationLogs:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresAutomationsRepository) CreateAutomationLog(ctx context.Context, automationId uint64, trigger string, status string, message *string) (*model.AutomationLog, error) {
+
+	query := `
+				INSERT INTO AUTOMATION_LOGS
+					(AUTOMATION_ID, DATE, TRIGGER, STATUS, MESSAGE)
+				VALUES
+					($1, $2, $3, $4, $5)
+				RETURNING ID, AUTOMATION_ID, DATE, TRIGGER, STATUS, MESSAGE`
+
+	row := r.Postgres.QueryRow(ctx, query, automationId, time.Now().UTC(), trigger, status, message)
+
+	var object model.AutomationLog
+
+	err := row.Scan(&object.Id, &object.AutomationId, &object.Date, &object.Trigger, &object.Status, &object.Message)
+
+	if err != nil {
+		log.Println("CreateAutomationLog:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func marshalAutomation(automation model.Automation) (string, string, string, error) {
+
+	triggers, err := json.Marshal(automation.Triggers)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	conditions, err := json.Marshal(automation.Conditions)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	actions, err := json.Marshal(automation.Actions)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return string(triggers), string(conditions), string(actions), nil
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type IBridgeRepository interface {
+	GetBridge(ctx context.Context) (*model.Bridge, error)
+	UpdateBridgeState(ctx context.Context, state string) (*model.Bridge, error)
+	UpdateBridgeInfo(ctx context.Context, bridge model.Bridge) (*model.Bridge, error)
+	GetBridgeEvents(ctx context.Context, eventType *string, limit int) ([]model.BridgeEvent, error)
+	CreateBridgeEvent(ctx context.Context, event model.BridgeEvent) (*model.BridgeEvent, error)
+}
+
+type PostgresBridgeRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+// There is a single bridge, kept in the row with this id
+const bridgeId = 1
+
+var bridgeFields = "DATE_MODIFIED, STATE, VERSION, COMMIT, COORDINATOR_TYPE, COORDINATOR_IEEE_ADDRESS, CHANNEL, PAN_ID, PERMIT_JOIN"
+
+var scanBridge = func(row pgx.Row, object *model.Bridge) error {
+	return row.Scan(&object.DateModified, &object.State, &object.Version, &object.Commit, &object.CoordinatorType, &object.CoordinatorIeeeAddress, &object.Channel, &object.PanId, &object.PermitJoin)
+}
+
+var bridgeEventFields = "ID, DATE, TYPE, IEEE_ADDRESS, FRIENDLY_NAME, DATA"
+
+var scanBridgeEvent = func(row pgx.Row, object *model.BridgeEvent) error {
+	return row.Scan(&object.Id, &object.Date, &object.Type, &object.IeeeAddress, &object.FriendlyName, &object.Data)
+}
+
+// GetBridge returns nil when nothing has been heard from the bridge yet
+func (r *PostgresBridgeRepository) GetBridge(ctx context.Context) (*model.Bridge, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+bridgeFields+" FROM BRIDGE WHERE ID = $1", bridgeId)
+
+	var object model.Bridge
+
+	err := scanBridge(row, &object)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Println("GetBridge:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresBridgeRepository) UpdateBridgeState(ctx context.Context, state string) (*model.Bridge, error) {
+
+	query := `
+				INSERT INTO BRIDGE (ID, DATE_MODIFIED, STATE) VALUES ($1, $2, $3)
+				ON CONFLICT (ID) DO UPDATE SET DATE_MODIFIED = EXCLUDED.DATE_MODIFIED, STATE = EXCLUDED.STATE
+				RETURNING ` + bridgeFields
+
+	row := r.Postgres.QueryRow(ctx, query, bridgeId, time.Now().UTC(), state)
+
+	var object model.Bridge
+
+	err := scanBridge(row, &object)
+
+	if err != nil {
+		log.Println("UpdateBridgeState:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+// UpdateBridgeInfo stores the version, coordinator and network of the bridge, leaving its state untouched
+func (r *PostgresBridgeRepository) UpdateBridgeInfo(ctx context.Context, bridge model.Bridge) (*model.Bridge, error) {
+
+	query := `
+				INSERT INTO BRIDGE 
+					(ID, DATE_MODIFIED, STATE, VERSION, COMMIT, COORDINATOR_TYPE, COORDINATOR_IEEE_ADDRESS, CHANNEL, PAN_ID, PERMIT_JOIN) 
+				VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				ON CONFLICT (ID) DO UPDATE SET 
+					DATE_MODIFIED = EXCLUDED.DATE_MODIFIED, VERSION = EXCLUDED.VERSION, COMMIT = EXCLUDED.COMMIT,
+					COORDINATOR_TYPE = EXCLUDED.COORDINATOR_TYPE, COORDINATOR_IEEE_ADDRESS = EXCLUDED.COORDINATOR_IEEE_ADDRESS,
+					CHANNEL = EXCLUDED.CHANNEL, PAN_ID = EXCLUDED.PAN_ID, PERMIT_JOIN = EXCLUDED.PERMIT_JOIN
+				RETURNING ` + bridgeFields
+
+	row := r.Postgres.QueryRow(ctx, query, bridgeId, time.Now().UTC(), model.BridgeOnline, bridge.Version, bridge.Commit,
+		bridge.CoordinatorType, bridge.CoordinatorIeeeAddress, bridge.Channel, bridge.PanId, bridge.PermitJoin)
+
+	var object model.Bridge
+
+	err := scanBridge(row, &object)
+
+	if err != nil {
+		log.Println("UpdateBridgeInfo:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresBridgeRepository) GetBridgeEvents(ctx context.Context, eventType *string, limit int) ([]model.BridgeEvent, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+bridgeEventFields+" FROM BRIDGE_EVENTS WHERE ($1::varchar IS NULL OR TYPE = $1) ORDER BY DATE DESC LIMIT $2", eventType, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.BridgeEvent, 0)
+
+	for rows.Next() {
+		var row model.BridgeEvent
+		err = scanBridgeEvent(rows, &row)
+		if err != nil {
+			log.Println("GetBridgeEvents:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetBridgeEvents:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresBridgeRepository) CreateBridgeEvent(ctx context.Context, event model.BridgeEvent) (*model.BridgeEvent, error) {
+
+	data, err := json.Marshal(event.Data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := "INSERT INTO BRIDGE_EVENTS (DATE, TYPE, IEEE_ADDRESS, FRIENDLY_NAME, DATA) VALUES ($1, $2, $3, $4, $5) RETURNING " + bridgeEventFields
+
+	row := r.Postgres.QueryRow(ctx, query, event.Date, event.Type, event.IeeeAddress, event.FriendlyName, string(data))
+
+	var object model.BridgeEvent
+
+	err = scanBridgeEvent(row, &object)
+
+	if err != nil {
+		log.Println("CreateBridgeEvent:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
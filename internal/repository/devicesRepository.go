@@ -11,28 +11,38 @@ import (
 
 type IDevicesRepository interface {
 	GetDevices(ctx context.Context) ([]model.Device, error)
+	GetDevice(ctx context.Context, ieeeAddress string) (*model.Device, error)
 	CreateDevice(ctx context.Context, ieeeAddress string, dateCode *string, name string, manufacturer *string, modelId *string, lastSeen *uint64, deviceType *string) (*model.Device, error)
 	UpdateDevice(ctx context.Context, ieeeAddress string, name string, active bool) (*model.Device, error)
+	UpdateDeviceDefinition(ctx context.Context, ieeeAddress string, dateCode *string, manufacturer *string, modelId *string, deviceType string) (*model.Device, error)
+	UpdateDeviceArea(ctx context.Context, ieeeAddress string, areaId *uint64) (*model.Device, error)
+	UpdateDeviceFirmware(ctx context.Context, ieeeAddress string, softwareBuildId *string, dateCode *string) (*model.Device, error)
+	UpdateDeviceUpdateState(ctx context.Context, ieeeAddress string, state string, progress *float64, remaining *int) error
+	GetFirmwareHistory(ctx context.Context, ieeeAddress string) ([]model.FirmwareChange, error)
+	CreateFirmwareChange(ctx context.Context, change model.FirmwareChange) error
 	UpdateDeviceBattery(ctx context.Context, ieeeAddress string, battery float64) (*model.Device, error)
+	UpdateDeviceLastSeen(ctx context.Context, ieeeAddress string, lastSeen time.Time, linkQuality *int) error
+	GetDevicesByAreas(ctx context.Context, areaIds []uint64) ([]model.Device, error)
+	GetDevicesByIeeeAddresses(ctx context.Context, ieeeAddresses []string) ([]model.Device, error)
 }
 
 type PostgresDevicesRepository struct {
 	Postgres *pgxpool.Pool
 }
 
-var returnFields = "IEEE_ADDRESS, DATE_CREATED, DATE_MODIFIED, DATE_CODE, FRIENDLY_NAME, AREA_ID, MANUFACTURER, MODEL_ID, LAST_SEEN, TYPE, BATTERY, ACTIVE"
+var returnFields = "IEEE_ADDRESS, DATE_CREATED, DATE_MODIFIED, DATE_CODE, FRIENDLY_NAME, AREA_ID, MANUFACTURER, MODEL_ID, LAST_SEEN, TYPE, BATTERY, ACTIVE, LINK_QUALITY, SOFTWARE_BUILD_ID, UPDATE_STATE, UPDATE_PROGRESS, UPDATE_REMAINING"
 
 var scanDeviceRows = func(rows pgx.Rows, object *model.Device) error {
-	return rows.Scan(&object.IeeeAddress, &object.DateCreated, &object.DateModified, &object.DateCode, &object.FriendlyName, &object.AreaId, &object.Manufacturer, &object.ModelId, &object.LastSeen, &object.Type, &object.Battery, &object.Active)
+	return rows.Scan(&object.IeeeAddress, &object.DateCreated, &object.DateModified, &object.DateCode, &object.FriendlyName, &object.AreaId, &object.Manufacturer, &object.ModelId, &object.LastSeen, &object.Type, &object.Battery, &object.Active, &object.LinkQuality, &object.SoftwareBuildId, &object.UpdateState, &object.UpdateProgress, &object.UpdateRemaining)
 }
 
 var scanRow = func(row pgx.Row, object *model.Device) error {
-	return row.Scan(&object.IeeeAddress, &object.DateCreated, &object.DateModified, &object.DateCode, &object.FriendlyName, &object.AreaId, &object.Manufacturer, &object.ModelId, &object.LastSeen, &object.Type, &object.Battery, &object.Active)
+	return row.Scan(&object.IeeeAddress, &object.DateCreated, &object.DateModified, &object.DateCode, &object.FriendlyName, &object.AreaId, &object.Manufacturer, &object.ModelId, &object.LastSeen, &object.Type, &object.Battery, &object.Active, &object.LinkQuality, &object.SoftwareBuildId, &object.UpdateState, &object.UpdateProgress, &object.UpdateRemaining)
 }
 
 func (r *PostgresDevicesRepository) GetDevices(ctx context.Context) (result []model.Device, err error) {
 
-	rows, err := r.Postgres.Query(ctx, "SELECT * FROM DEVICES")
+	rows, err := r.Postgres.Query(ctx, "SELECT "+returnFields+" FROM DEVICES")
 
 	if err != nil {
 		return nil, err
@@ -48,20 +58,76 @@ func (r *PostgresDevicesRepository) GetDevices(ctx context.Context) (result []mo
 		//TODO
 		err = scanDeviceRows(rows, &row)
 		if err != nil {
-			log.Fatal("GetDevices:", err)
+			log.Println("GetDevices:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetDevices:", err)
+		log.Println("GetDevices:", err)
 		return nil, err
 	}
 
 	return objects, nil
 }
 
+// GetDevicesByAreas returns the devices in any of the areas in one query
+func (r *PostgresDevicesRepository) GetDevicesByAreas(ctx context.Context, areaIds []uint64) ([]model.Device, error) {
+	return r.queryDevices(ctx, "GetDevicesByAreas", "SELECT "+returnFields+" FROM DEVICES WHERE AREA_ID = ANY($1)", areaIds)
+}
+
+// GetDevicesByIeeeAddresses returns the devices with any of the addresses in one query
+func (r *PostgresDevicesRepository) GetDevicesByIeeeAddresses(ctx context.Context, ieeeAddresses []string) ([]model.Device, error) {
+	return r.queryDevices(ctx, "GetDevicesByIeeeAddresses", "SELECT "+returnFields+" FROM DEVICES WHERE IEEE_ADDRESS = ANY($1)", ieeeAddresses)
+}
+
+func (r *PostgresDevicesRepository) queryDevices(ctx context.Context, name string, query string, args ...interface{}) ([]model.Device, error) {
+
+	rows, err := r.Postgres.Query(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Device, 0)
+
+	for rows.Next() {
+		var row model.Device
+		err = scanDeviceRows(rows, &row)
+		if err != nil {
+			log.Println(name+":", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(name+":", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresDevicesRepository) GetDevice(ctx context.Context, ieeeAddress string) (*model.Device, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+returnFields+" FROM DEVICES WHERE IEEE_ADDRESS = $1", ieeeAddress)
+
+	var object model.Device
+
+	err := scanRow(row, &object)
+
+	if err != nil {
+		log.Println("GetDevice:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
 func (r *PostgresDevicesRepository) CreateDevice(ctx context.Context, ieeeAddress string, dateCode *string, name string, manufacturer *string, modelId *string, lastSeen *uint64, deviceType *string) (*model.Device, error) {
 
 	dateCreated := time.Now().UTC()
@@ -82,7 +148,7 @@ func (r *PostgresDevicesRepository) CreateDevice(ctx context.Context, ieeeAddres
 	err := scanRow(row, &object)
 
 	if err != nil {
-		log.Fatal("CreateDevice ", err)
+		log.Println("CreateDevice ", err)
 		return nil, err
 	}
 
@@ -100,13 +166,80 @@ func (r *PostgresDevicesRepository) UpdateDevice(ctx context.Context, ieeeAddres
 	err := scanRow(row, &object)
 
 	if err != nil {
-		log.Fatal("UpdateDevice", err)
+		log.Println("UpdateDevice", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresDevicesRepository) UpdateDeviceDefinition(ctx context.Context, ieeeAddress string, dateCode *string, manufacturer *string, modelId *string, deviceType string) (*model.Device, error) {
+
+	query := "UPDATE DEVICES SET DATE_MODIFIED = $1, DATE_CODE = $2, MANUFACTURER = $3, MODEL_ID = $4, TYPE = $5 WHERE IEEE_ADDRESS = $6 RETURNING " + returnFields
+
+	row := r.Postgres.QueryRow(ctx, query, time.Now().UTC(), dateCode, manufacturer, modelId, deviceType, ieeeAddress)
+
+	var object model.Device
+
+	err := scanRow(row, &object)
+
+	if err != nil {
+		log.Println("UpdateDeviceDefinition:", err)
 		return nil, err
 	}
 
 	return &object, nil
 }
 
+func (r *PostgresDevicesRepository) UpdateDeviceArea(ctx context.Context, ieeeAddress string, areaId *uint64) (*model.Device, error) {
+
+	query := "UPDATE DEVICES SET DATE_MODIFIED = $1, AREA_ID = $2 WHERE IEEE_ADDRESS = $3 RETURNING " + returnFields
+
+	row := r.Postgres.QueryRow(ctx, query, time.Now().UTC(), areaId, ieeeAddress)
+
+	var object model.Device
+
+	err := scanRow(row, &object)
+
+	if err != nil {
+		log.Println("UpdateDeviceArea:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresDevicesRepository) UpdateDeviceFirmware(ctx context.Context, ieeeAddress string, softwareBuildId *string, dateCode *string) (*model.Device, error) {
+
+	query := "UPDATE DEVICES SET DATE_MODIFIED = $1, SOFTWARE_BUILD_ID = $2, DATE_CODE = $3 WHERE IEEE_ADDRESS = $4 RETURNING " + returnFields
+
+	row := r.Postgres.QueryRow(ctx, query, time.Now().UTC(), softwareBuildId, dateCode, ieeeAddress)
+
+	var object model.Device
+
+	err := scanRow(row, &object)
+
+	if err != nil {
+		log.Println("UpdateDeviceFirmware:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+// UpdateDeviceUpdateState records the progress of an over-the-air update, progress and remaining are cleared once it is idle
+func (r *PostgresDevicesRepository) UpdateDeviceUpdateState(ctx context.Context, ieeeAddress string, state string, progress *float64, remaining *int) error {
+
+	_, err := r.Postgres.Exec(ctx, "UPDATE DEVICES SET UPDATE_STATE = $1, UPDATE_PROGRESS = $2, UPDATE_REMAINING = $3 WHERE IEEE_ADDRESS = $4", state, progress, remaining, ieeeAddress)
+
+	if err != nil {
+		log.Println("UpdateDeviceUpdateState:", err)
+		return err
+	}
+
+	return nil
+}
+
 func (r *PostgresDevicesRepository) UpdateDeviceBattery(ctx context.Context, ieeeAddress string, battery float64) (*model.Device, error) {
 
 	dateModified := time.Now().UTC()
@@ -120,9 +253,71 @@ func (r *PostgresDevicesRepository) UpdateDeviceBattery(ctx context.Context, iee
 	err := scanRow(row, &object)
 
 	if err != nil {
-		log.Fatal("UpdateDeviceBattery", err)
+		log.Println("UpdateDeviceBattery", err)
 		return nil, err
 	}
 
 	return &object, nil
 }
+
+// UpdateDeviceLastSeen records that a device reported, keeping the previous link quality when the report has none
+func (r *PostgresDevicesRepository) UpdateDeviceLastSeen(ctx context.Context, ieeeAddress string, lastSeen time.Time, linkQuality *int) error {
+
+	_, err := r.Postgres.Exec(ctx, "UPDATE DEVICES SET LAST_SEEN = $1, LINK_QUALITY = COALESCE($2, LINK_QUALITY) WHERE IEEE_ADDRESS = $3", lastSeen, linkQuality, ieeeAddress)
+
+	if err != nil {
+		log.Println("UpdateDeviceLastSeen:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *PostgresDevicesRepository) GetFirmwareHistory(ctx context.Context, ieeeAddress string) ([]model.FirmwareChange, error) {
+
+	rows, err := r.Postgres.Query(ctx, `
+				SELECT DEVICE_ID, DATE, PREVIOUS_SOFTWARE_BUILD_ID, PREVIOUS_DATE_CODE, SOFTWARE_BUILD_ID, DATE_CODE
+				FROM FIRMWARE_HISTORY WHERE DEVICE_ID = $1 ORDER BY DATE DESC`, ieeeAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.FirmwareChange, 0)
+
+	for rows.Next() {
+		var row model.FirmwareChange
+		err = rows.Scan(&row.DeviceId, &row.Date, &row.PreviousSoftwareBuildId, &row.PreviousDateCode, &row.SoftwareBuildId, &row.DateCode)
+		if err != nil {
+			log.Println("GetFirmwareHistory:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetFirmwareHistory:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresDevicesRepository) CreateFirmwareChange(ctx context.Context, change model.FirmwareChange) error {
+
+	_, err := r.Postgres.Exec(ctx, `
+				INSERT INTO FIRMWARE_HISTORY 
+					(DEVICE_ID, DATE, PREVIOUS_SOFTWARE_BUILD_ID, PREVIOUS_DATE_CODE, SOFTWARE_BUILD_ID, DATE_CODE) 
+				VALUES
+					($1, $2, $3, $4, $5, $6)`,
+		change.DeviceId, change.Date, change.PreviousSoftwareBuildId, change.PreviousDateCode, change.SoftwareBuildId, change.DateCode)
+
+	if err != nil {
+		log.Println("CreateFirmwareChange:", err)
+		return err
+	}
+
+	return nil
+}
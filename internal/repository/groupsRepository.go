@@ -14,6 +14,7 @@ type IGroupsRepository interface {
 	CreateGroup(ctx context.Context, id uint64, name string) (*model.Group, error)
 	UpdateGroup(ctx context.Context, id uint64, name string, active bool) (*model.Group, error)
 	GetGroupMembers(ctx context.Context, id uint64) ([]model.GroupMember, error)
+	GetGroupsMembers(ctx context.Context, ids []uint64) ([]model.GroupMember, error)
 	CreateGroupMember(ctx context.Context, id uint64, ieeeAddress string) (*model.GroupMember, error)
 	DeleteGroupMember(ctx context.Context, id uint64, ieeeAddress string) error
 }
@@ -38,14 +39,14 @@ func (r *PostgresGroupsRepository) GetGroups(ctx context.Context) ([]model.Group
 		var row model.Group
 		err = rows.Scan(&row.Id, &row.DateCreated, &row.DateModified, &row.FriendlyName, &row.Active)
 		if err != nil {
-			log.Fatal("GetGroups:", err)
+			log.Println("GetGroups:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetGroups:", err)
+		log.Println("GetGroups:", err)
 		return nil, err
 	}
 
@@ -60,7 +61,7 @@ func (r *PostgresGroupsRepository) GetGroup(ctx context.Context, id uint64) (*mo
 
 	err := row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.FriendlyName, &object.Active)
 	if err != nil {
-		log.Fatal("GetGroup:", err)
+		log.Println("GetGroup:", err)
 		return nil, err
 	}
 
@@ -85,7 +86,7 @@ func (r *PostgresGroupsRepository) CreateGroup(ctx context.Context, id uint64, n
 	err := row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.FriendlyName, &object.Active)
 
 	if err != nil {
-		log.Fatal("CreateGroup ", err)
+		log.Println("CreateGroup:", err)
 		return nil, err
 	}
 
@@ -103,7 +104,7 @@ func (r *PostgresGroupsRepository) UpdateGroup(ctx context.Context, id uint64, n
 	err := row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.FriendlyName, &object.Active)
 
 	if err != nil {
-		log.Fatal("UpdateGroup", err)
+		log.Println("UpdateGroup:", err)
 		return nil, err
 	}
 
@@ -112,7 +113,7 @@ func (r *PostgresGroupsRepository) UpdateGroup(ctx context.Context, id uint64, n
 
 func (r *PostgresGroupsRepository) GetGroupMembers(ctx context.Context, id uint64) ([]model.GroupMember, error) {
 
-	rows, err := r.Postgres.Query(ctx, "SELECT GD.GROUP_ID, GD.IEEE_ADDRESS, D.FRIENDLY_NAME FROM GROUPS_DEVICES GD INNER JOIN DEVICES D ON GD.IEEE_ADDRESS = D.IEEE_ADDRESS WHERE GD.GROUP_ID = $1", id)
+	rows, err := r.Postgres.Query(ctx, "SELECT GD.GROUP_ID, GD.IEEE_ADDRESS, D.FRIENDLY_NAME, D.AREA_ID FROM GROUPS_DEVICES GD INNER JOIN DEVICES D ON GD.IEEE_ADDRESS = D.IEEE_ADDRESS WHERE GD.GROUP_ID = $1", id)
 
 	if err != nil {
 		return nil, err
@@ -124,16 +125,47 @@ func (r *PostgresGroupsRepository) GetGroupMembers(ctx context.Context, id uint6
 
 	for rows.Next() {
 		var row model.GroupMember
-		err = rows.Scan(&row.GroupId, &row.IeeeAddress, &row.FriendlyName)
+		err = rows.Scan(&row.GroupId, &row.IeeeAddress, &row.FriendlyName, &row.AreaId)
 		if err != nil {
-			log.Fatal("GetGroupMembers:", err)
+			log.Println("GetGroupMembers:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetGroupMembers:", err)
+		log.Println("GetGroupMembers:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// GetGroupsMembers returns the members of all the groups in one query
+func (r *PostgresGroupsRepository) GetGroupsMembers(ctx context.Context, ids []uint64) ([]model.GroupMember, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT GD.GROUP_ID, GD.IEEE_ADDRESS, D.FRIENDLY_NAME, D.AREA_ID FROM GROUPS_DEVICES GD INNER JOIN DEVICES D ON GD.IEEE_ADDRESS = D.IEEE_ADDRESS WHERE GD.GROUP_ID = ANY($1)", ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.GroupMember, 0)
+
+	for rows.Next() {
+		var row model.GroupMember
+		err = rows.Scan(&row.GroupId, &row.IeeeAddress, &row.FriendlyName, &row.AreaId)
+		if err != nil {
+			log.Println("GetGroupsMembers:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetGroupsMembers:", err)
 		return nil, err
 	}
 
@@ -156,7 +188,7 @@ func (r *PostgresGroupsRepository) CreateGroupMember(ctx context.Context, id uin
 	err := row.Scan(&object.GroupId, &object.IeeeAddress)
 
 	if err != nil {
-		log.Fatal("CreateGroupMember ", err)
+		log.Println("CreateGroupMember:", err)
 		return nil, err
 	}
 
@@ -170,7 +202,7 @@ func (r *PostgresGroupsRepository) DeleteGroupMember(ctx context.Context, id uin
 	_, err := r.Postgres.Exec(ctx, query, id, ieeeAddress)
 
 	if err != nil {
-		log.Fatal("DeleteGroupMember ", err)
+		log.Println("DeleteGroupMember:", err)
 		return err
 	}
 
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+)
+
+type INetworkRepository interface {
+	GetNetworkMaps(ctx context.Context, limit int) ([]model.NetworkMapSummary, error)
+	GetNetworkMap(ctx context.Context, id uint64) (*model.NetworkMap, error)
+	GetLatestNetworkMap(ctx context.Context) (*model.NetworkMap, error)
+	CreateNetworkMap(ctx context.Context, networkMap model.NetworkMap) (*model.NetworkMap, error)
+}
+
+type PostgresNetworkRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var networkMapFields = "ID, DATE, NODES, LINKS"
+
+var scanNetworkMap = func(row pgx.Row, object *model.NetworkMap) error {
+	return row.Scan(&object.Id, &object.Date, &object.Nodes, &object.Links)
+}
+
+func (r *PostgresNetworkRepository) GetNetworkMaps(ctx context.Context, limit int) ([]model.NetworkMapSummary, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT ID, DATE, JSONB_ARRAY_LENGTH(NODES), JSONB_ARRAY_LENGTH(LINKS) FROM NETWORK_MAPS ORDER BY DATE DESC LIMIT $1", limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.NetworkMapSummary, 0)
+
+	for rows.Next() {
+		var row model.NetworkMapSummary
+		err = rows.Scan(&row.Id, &row.Date, &row.Nodes, &row.Links)
+		if err != nil {
+			log.Println("GetNetworkMaps:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetNetworkMaps:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresNetworkRepository) GetNetworkMap(ctx context.Context, id uint64) (*model.NetworkMap, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+networkMapFields+" FROM NETWORK_MAPS WHERE ID = $1", id)
+
+	var object model.NetworkMap
+
+	err := scanNetworkMap(row, &object)
+
+	if err != nil {
+		log.Println("GetNetworkMap:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+// GetLatestNetworkMap returns nil when no map has been stored yet
+func (r *PostgresNetworkRepository) GetLatestNetworkMap(ctx context.Context) (*model.NetworkMap, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+networkMapFields+" FROM NETWORK_MAPS ORDER BY DATE DESC LIMIT 1")
+
+	var object model.NetworkMap
+
+	err := scanNetworkMap(row, &object)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Println("GetLatestNetworkMap:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresNetworkRepository) CreateNetworkMap(ctx context.Context, networkMap model.NetworkMap) (*model.NetworkMap, error) {
+
+	nodes, err := json.Marshal(networkMap.Nodes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := json.Marshal(networkMap.Links)
+
+	if err != nil {
+		return nil, err
+	}
+
+	row := r.Postgres.QueryRow(ctx, "INSERT INTO NETWORK_MAPS (DATE, NODES, LINKS) VALUES ($1, $2, $3) RETURNING "+networkMapFields,
+		networkMap.Date, string(nodes), string(links))
+
+	var object model.NetworkMap
+
+	err = scanNetworkMap(row, &object)
+
+	if err != nil {
+		log.Println("CreateNetworkMap:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
@@ -3,8 +3,12 @@ package repository
 import (
 	"78concepts.com/domicile/internal/model"
 	"context"
+	"errors"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,6 +21,34 @@ type IReportsRepository interface {
 	GetHumidityReports(ctx context.Context, areaId uint64) ([]model.HumidityReport, error)
 	GetPressureReports(ctx context.Context, areaId uint64) ([]model.PressureReport, error)
 	GetIlluminanceReports(ctx context.Context, areaId uint64) ([]model.IlluminanceReport, error)
+	GetLatestAreaValue(ctx context.Context, measurement string, areaId uint64) (*float64, error)
+	CreateBatteryReport(ctx context.Context, deviceId string, date time.Time, battery float64, voltage *float64) (*model.BatteryReport, error)
+	GetBatteryReports(ctx context.Context, deviceId string, startDate time.Time, endDate time.Time) ([]model.BatteryReport, error)
+	GetReports(ctx context.Context, measurement string, areaId uint64, startDate time.Time, endDate time.Time, limit int, offset int) ([]model.Report, error)
+	GetReportBuckets(ctx context.Context, measurement string, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error)
+	GetDeviceReportBuckets(ctx context.Context, measurement string, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error)
+	GetLatestDeviceReports(ctx context.Context, measurement string, deviceIds []string) ([]model.Report, error)
+	StreamReports(ctx context.Context, filter model.ReportFilter, handle func(report model.Report) error) error
+	CopyReports(ctx context.Context, measurement string, reports []model.Report) (int64, error)
+	GetLatestAreaReports(ctx context.Context, measurement string, areaIds []uint64) ([]model.Report, error)
+	GetLatestBatteryReport(ctx context.Context, deviceId string) (*model.BatteryReport, error)
+	CreateBatteryReplacement(ctx context.Context, deviceId string, date time.Time, previousBattery float64, battery float64) (*model.BatteryReplacement, error)
+	GetBatteryReplacements(ctx context.Context, deviceId string) ([]model.BatteryReplacement, error)
+}
+
+// Value columns of each measurement's report table, illuminance is read in lux
+var reportTables = map[string]string{
+	"temperature": "TEMPERATURE_REPORTS",
+	"humidity":    "HUMIDITY_REPORTS",
+	"pressure":    "PRESSURE_REPORTS",
+	"illuminance": "ILLUMINANCE_REPORTS",
+}
+
+var reportValueColumns = map[string]string{
+	"temperature": "VALUE",
+	"humidity":    "VALUE",
+	"pressure":    "VALUE",
+	"illuminance": "VALUE_LUX",
 }
 
 type PostgresReportsRepository struct {
@@ -34,7 +66,7 @@ func (r *PostgresReportsRepository) CreateTemperatureReport(ctx context.Context,
 	err := row.Scan(&object.DeviceId, &object.AreaId, &object.Date, &object.Value)
 
 	if err != nil {
-		log.Fatal("CreateTemperatureReport", err)
+		log.Println("CreateTemperatureReport", err)
 		return nil, err
 	}
 
@@ -52,7 +84,7 @@ func (r *PostgresReportsRepository) CreateHumidityReport(ctx context.Context, de
 	err := row.Scan(&object.DeviceId, &object.AreaId, &object.Date, &object.Value)
 
 	if err != nil {
-		log.Fatal("CreateHumidityReport", err)
+		log.Println("CreateHumidityReport", err)
 		return nil, err
 	}
 
@@ -70,7 +102,7 @@ func (r *PostgresReportsRepository) CreatePressureReport(ctx context.Context, de
 	err := row.Scan(&object.DeviceId, &object.AreaId, &object.Date, &object.Value)
 
 	if err != nil {
-		log.Fatal("CreatePressureRport", err)
+		log.Println("CreatePressureReport", err)
 		return nil, err
 	}
 
@@ -88,7 +120,7 @@ func (r *PostgresReportsRepository) CreateIlluminanceReport(ctx context.Context,
 	err := row.Scan(&object.DeviceId, &object.AreaId, &object.Date, &object.Value, &object.ValueLux)
 
 	if err != nil {
-		log.Fatal("CreateTemperatureReport", err)
+		log.Println("CreateIlluminanceReport", err)
 		return nil, err
 	}
 
@@ -112,14 +144,14 @@ log.Println(startDate)
 		var row model.TemperatureReport
 		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
 		if err != nil {
-			log.Fatal("GetTemperatureReports:", err)
+			log.Println("GetTemperatureReports:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetTemperatureReports:", err)
+		log.Println("GetTemperatureReports:", err)
 		return nil, err
 	}
 
@@ -142,14 +174,14 @@ func (r *PostgresReportsRepository) GetHumidityReports(ctx context.Context, area
 		var row model.HumidityReport
 		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
 		if err != nil {
-			log.Fatal("GetHumidityReports:", err)
+			log.Println("GetHumidityReports:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetHumidityReports:", err)
+		log.Println("GetHumidityReports:", err)
 		return nil, err
 	}
 
@@ -172,14 +204,14 @@ func (r *PostgresReportsRepository) GetPressureReports(ctx context.Context, area
 		var row model.PressureReport
 		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
 		if err != nil {
-			log.Fatal("GetPressureReports:", err)
+			log.Println("GetPressureReports:", err)
 			return nil, err
 		}
 
 		objects = append(objects, row)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetPressureReports:", err)
+		log.Println("GetPressureReports:", err)
 		return nil, err
 	}
 
@@ -202,7 +234,7 @@ func (r *PostgresReportsRepository) GetIlluminanceReports(ctx context.Context, a
 		var row model.IlluminanceReport
 		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
 		if err != nil {
-			log.Fatal("GetIlluminanceReports:", err)
+			log.Println("GetIlluminanceReports:", err)
 			return nil, err
 		}
 
@@ -210,9 +242,455 @@ func (r *PostgresReportsRepository) GetIlluminanceReports(ctx context.Context, a
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal("GetIlluminanceReports:", err)
+		log.Println("GetIlluminanceReports:", err)
 		return nil, err
 	}
 
 	return objects, nil
-}
\ No newline at end of file
+}
+
+// GetReports pages through an area's readings of a measurement within a date range, oldest first
+func (r *PostgresReportsRepository) GetReports(ctx context.Context, measurement string, areaId uint64, startDate time.Time, endDate time.Time, limit int, offset int) ([]model.Report, error) {
+
+	table, ok := reportTables[measurement]
+
+	if !ok {
+		return nil, errors.New("GetReports: unknown measurement " + measurement)
+	}
+
+	column := reportValueColumns[measurement]
+
+	query := "SELECT DEVICE_ID, AREA_ID, DATE, " + column + " FROM " + table +
+		" WHERE AREA_ID = $1 AND DATE >= $2 AND DATE <= $3 AND " + column + " IS NOT NULL ORDER BY DATE ASC LIMIT $4 OFFSET $5"
+
+	rows, err := r.Postgres.Query(ctx, query, areaId, startDate, endDate, limit, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Report, 0)
+
+	for rows.Next() {
+		row := model.Report{Measurement: measurement}
+		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
+		if err != nil {
+			log.Println("GetReports:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetReports:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// StreamReports passes the reports matching the filter to handle one at a time as they are read from the database,
+// measurement by measurement and oldest first, so exports never hold more than one row in memory. An error from
+// handle stops the stream and is returned. The battery history has no area, its readings come with area 0.
+func (r *PostgresReportsRepository) StreamReports(ctx context.Context, filter model.ReportFilter, handle func(report model.Report) error) error {
+
+	for _, measurement := range filter.Measurements {
+		if _, ok := reportTables[measurement]; !ok && measurement != "battery" {
+			return errors.New("StreamReports: unknown measurement " + measurement)
+		}
+	}
+
+	for _, measurement := range filter.Measurements {
+
+		table, column, area := reportTables[measurement], reportValueColumns[measurement], "AREA_ID"
+
+		if measurement == "battery" {
+			table, column, area = "BATTERY_REPORTS", "BATTERY", "0::bigint"
+		}
+
+		query := "SELECT DEVICE_ID, " + area + ", DATE, " + column + " FROM " + table + " WHERE " + column + " IS NOT NULL"
+		args := make([]interface{}, 0, 4)
+
+		if filter.StartDate != nil {
+			args = append(args, *filter.StartDate)
+			query += " AND DATE >= $" + strconv.Itoa(len(args))
+		}
+
+		if filter.EndDate != nil {
+			args = append(args, *filter.EndDate)
+			query += " AND DATE < $" + strconv.Itoa(len(args))
+		}
+
+		if len(filter.AreaIds) > 0 {
+			args = append(args, filter.AreaIds)
+			query += " AND " + area + " = ANY($" + strconv.Itoa(len(args)) + ")"
+		}
+
+		if len(filter.DeviceIds) > 0 {
+			args = append(args, filter.DeviceIds)
+			query += " AND DEVICE_ID = ANY($" + strconv.Itoa(len(args)) + ")"
+		}
+
+		query += " ORDER BY DATE ASC, DEVICE_ID ASC"
+
+		if err := r.streamReports(ctx, measurement, query, args, handle); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyReports loads reports of one measurement with COPY, which is far quicker than inserting them one by one.
+// Illuminance is copied in lux along with the raw value, which is left empty when the report has none.
+func (r *PostgresReportsRepository) CopyReports(ctx context.Context, measurement string, reports []model.Report) (int64, error) {
+
+	table, ok := reportTables[measurement]
+
+	columns := []string{"device_id", "area_id", "date", strings.ToLower(reportValueColumns[measurement])}
+
+	row := func(report model.Report) []interface{} {
+		return []interface{}{report.DeviceId, report.AreaId, report.Date, report.Value}
+	}
+
+	switch {
+	case measurement == "illuminance":
+		columns = append(columns, "value")
+		row = func(report model.Report) []interface{} {
+			return []interface{}{report.DeviceId, report.AreaId, report.Date, report.Value, report.RawValue}
+		}
+	// Battery readings are the battery history, which has no area and keeps the voltage as the raw value
+	case measurement == "battery":
+		table = "BATTERY_REPORTS"
+		columns = []string{"device_id", "date", "battery", "voltage"}
+		row = func(report model.Report) []interface{} {
+			return []interface{}{report.DeviceId, report.Date, report.Value, report.RawValue}
+		}
+	case !ok:
+		return 0, errors.New("CopyReports: unknown measurement " + measurement)
+	}
+
+	count, err := r.Postgres.CopyFrom(ctx, pgx.Identifier{strings.ToLower(table)}, columns, pgx.CopyFromSlice(len(reports), func(i int) ([]interface{}, error) {
+		return row(reports[i]), nil
+	}))
+
+	if err != nil {
+		log.Println("CopyReports:", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *PostgresReportsRepository) streamReports(ctx context.Context, measurement string, query string, args []interface{}, handle func(report model.Report) error) error {
+
+	rows, err := r.Postgres.Query(ctx, query, args...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		row := model.Report{Measurement: measurement}
+		if err := rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value); err != nil {
+			log.Println("StreamReports:", err)
+			return err
+		}
+
+		if err := handle(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetReportBuckets summarises the readings of a measurement in each of the areas over consecutive buckets of the
+// given length, in one query
+func (r *PostgresReportsRepository) GetReportBuckets(ctx context.Context, measurement string, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error) {
+	return r.getReportBuckets(ctx, "GetReportBuckets", measurement, false, areaIds, startDate, endDate, bucket)
+}
+
+// GetDeviceReportBuckets is GetReportBuckets with the readings of each device in the areas summarised separately
+func (r *PostgresReportsRepository) GetDeviceReportBuckets(ctx context.Context, measurement string, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error) {
+	return r.getReportBuckets(ctx, "GetDeviceReportBuckets", measurement, true, areaIds, startDate, endDate, bucket)
+}
+
+func (r *PostgresReportsRepository) getReportBuckets(ctx context.Context, name string, measurement string, byDevice bool, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error) {
+
+	table, ok := reportTables[measurement]
+
+	if !ok {
+		return nil, errors.New(name + ": unknown measurement " + measurement)
+	}
+
+	column := reportValueColumns[measurement] + "::double precision"
+
+	// Without devices the readings of the whole area are summarised together under an empty device
+	device, group := "''::text", "AREA_ID, BUCKET"
+	if byDevice {
+		device, group = "DEVICE_ID", "AREA_ID, DEVICE_ID, BUCKET"
+	}
+
+	query := "SELECT AREA_ID, " + device + ", to_timestamp(floor(extract(epoch FROM DATE) / $4) * $4) AS BUCKET, " +
+		"AVG(" + column + "), MIN(" + column + "), MAX(" + column + "), COUNT(*) FROM " + table +
+		" WHERE AREA_ID = ANY($1) AND DATE >= $2 AND DATE <= $3 AND " + column + " IS NOT NULL" +
+		" GROUP BY " + group + " ORDER BY " + group
+
+	rows, err := r.Postgres.Query(ctx, query, areaIds, startDate, endDate, bucket.Seconds())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.ReportBucket, 0)
+
+	for rows.Next() {
+		row := model.ReportBucket{Measurement: measurement}
+		err = rows.Scan(&row.AreaId, &row.DeviceId, &row.Start, &row.Average, &row.Min, &row.Max, &row.Count)
+		if err != nil {
+			log.Println(name+":", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(name+":", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// GetLatestDeviceReports returns the most recent reading of a measurement from each of the devices, in one query
+func (r *PostgresReportsRepository) GetLatestDeviceReports(ctx context.Context, measurement string, deviceIds []string) ([]model.Report, error) {
+
+	table, ok := reportTables[measurement]
+
+	if !ok {
+		return nil, errors.New("GetLatestDeviceReports: unknown measurement " + measurement)
+	}
+
+	column := reportValueColumns[measurement]
+
+	query := "SELECT DISTINCT ON (DEVICE_ID) DEVICE_ID, AREA_ID, DATE, " + column + " FROM " + table +
+		" WHERE DEVICE_ID = ANY($1) AND " + column + " IS NOT NULL ORDER BY DEVICE_ID, DATE DESC"
+
+	rows, err := r.Postgres.Query(ctx, query, deviceIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Report, 0)
+
+	for rows.Next() {
+		row := model.Report{Measurement: measurement}
+		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
+		if err != nil {
+			log.Println("GetLatestDeviceReports:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetLatestDeviceReports:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// GetLatestAreaReports returns the most recent reading of a measurement in each of the areas, in one query
+func (r *PostgresReportsRepository) GetLatestAreaReports(ctx context.Context, measurement string, areaIds []uint64) ([]model.Report, error) {
+
+	table, ok := reportTables[measurement]
+
+	if !ok {
+		return nil, errors.New("GetLatestAreaReports: unknown measurement " + measurement)
+	}
+
+	column := reportValueColumns[measurement]
+
+	query := "SELECT DISTINCT ON (AREA_ID) DEVICE_ID, AREA_ID, DATE, " + column + " FROM " + table +
+		" WHERE AREA_ID = ANY($1) AND " + column + " IS NOT NULL ORDER BY AREA_ID, DATE DESC"
+
+	rows, err := r.Postgres.Query(ctx, query, areaIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Report, 0)
+
+	for rows.Next() {
+		row := model.Report{Measurement: measurement}
+		err = rows.Scan(&row.DeviceId, &row.AreaId, &row.Date, &row.Value)
+		if err != nil {
+			log.Println("GetLatestAreaReports:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetLatestAreaReports:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresReportsRepository) GetLatestAreaValue(ctx context.Context, measurement string, areaId uint64) (*float64, error) {
+
+	table, ok := reportTables[measurement]
+
+	if !ok {
+		return nil, errors.New("GetLatestAreaValue: unknown measurement " + measurement)
+	}
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+reportValueColumns[measurement]+" FROM "+table+" WHERE AREA_ID = $1 ORDER BY DATE DESC LIMIT 1", areaId)
+
+	var value *float64
+
+	err := row.Scan(&value)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Println("GetLatestAreaValue:", err)
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (r *PostgresReportsRepository) CreateBatteryReport(ctx context.Context, deviceId string, date time.Time, battery float64, voltage *float64) (*model.BatteryReport, error) {
+
+	query := "INSERT INTO BATTERY_REPORTS (DEVICE_ID, DATE, BATTERY, VOLTAGE) VALUES ($1, $2, $3, $4) RETURNING DEVICE_ID, DATE, BATTERY, VOLTAGE"
+
+	row := r.Postgres.QueryRow(ctx, query, deviceId, date, battery, voltage)
+
+	var object model.BatteryReport
+
+	err := row.Scan(&object.DeviceId, &object.Date, &object.Battery, &object.Voltage)
+
+	if err != nil {
+		log.Println("CreateBatteryReport", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresReportsRepository) GetBatteryReports(ctx context.Context, deviceId string, startDate time.Time, endDate time.Time) ([]model.BatteryReport, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT DEVICE_ID, DATE, BATTERY, VOLTAGE FROM BATTERY_REPORTS WHERE DEVICE_ID = $1 AND DATE >= $2 AND DATE <= $3 ORDER BY DATE ASC", deviceId, startDate, endDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.BatteryReport, 0)
+
+	for rows.Next() {
+		var row model.BatteryReport
+		err = rows.Scan(&row.DeviceId, &row.Date, &row.Battery, &row.Voltage)
+		if err != nil {
+			log.Println("GetBatteryReports:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetBatteryReports:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresReportsRepository) GetLatestBatteryReport(ctx context.Context, deviceId string) (*model.BatteryReport, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT DEVICE_ID, DATE, BATTERY, VOLTAGE FROM BATTERY_REPORTS WHERE DEVICE_ID = $1 ORDER BY DATE DESC LIMIT 1", deviceId)
+
+	var object model.BatteryReport
+
+	err := row.Scan(&object.DeviceId, &object.Date, &object.Battery, &object.Voltage)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Println("GetLatestBatteryReport:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresReportsRepository) CreateBatteryReplacement(ctx context.Context, deviceId string, date time.Time, previousBattery float64, battery float64) (*model.BatteryReplacement, error) {
+
+	query := "INSERT INTO BATTERY_REPLACEMENTS (DEVICE_ID, DATE, PREVIOUS_BATTERY, BATTERY) VALUES ($1, $2, $3, $4) RETURNING DEVICE_ID, DATE, PREVIOUS_BATTERY, BATTERY"
+
+	row := r.Postgres.QueryRow(ctx, query, deviceId, date, previousBattery, battery)
+
+	var object model.BatteryReplacement
+
+	err := row.Scan(&object.DeviceId, &object.Date, &object.PreviousBattery, &object.Battery)
+
+	if err != nil {
+		log.Println("CreateBatteryReplacement", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresReportsRepository) GetBatteryReplacements(ctx context.Context, deviceId string) ([]model.BatteryReplacement, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT DEVICE_ID, DATE, PREVIOUS_BATTERY, BATTERY FROM BATTERY_REPLACEMENTS WHERE DEVICE_ID = $1 ORDER BY DATE DESC", deviceId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.BatteryReplacement, 0)
+
+	for rows.Next() {
+		var row model.BatteryReplacement
+		err = rows.Scan(&row.DeviceId, &row.Date, &row.PreviousBattery, &row.Battery)
+		if err != nil {
+			log.Println("GetBatteryReplacements:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetBatteryReplacements:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
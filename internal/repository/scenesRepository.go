@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type IScenesRepository interface {
+	GetScenes(ctx context.Context) ([]model.Scene, error)
+	GetScene(ctx context.Context, id uint64) (*model.Scene, error)
+	CreateScene(ctx context.Context, scene model.Scene) (*model.Scene, error)
+	DeleteScene(ctx context.Context, id uint64) error
+	GetSceneMembers(ctx context.Context, id uint64) ([]model.SceneMember, error)
+}
+
+type PostgresScenesRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var sceneFields = "ID, DATE_CREATED, DATE_MODIFIED, NAME, AREA_ID, GROUP_ID, NATIVE_SCENE_ID"
+
+var scanScene = func(row pgx.Row, object *model.Scene) error {
+	return row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.Name, &object.AreaId, &object.GroupId, &object.NativeSceneId)
+}
+
+func (r *PostgresScenesRepository) GetScenes(ctx context.Context) ([]model.Scene, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+sceneFields+" FROM SCENES ORDER BY NAME")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Scene, 0)
+
+	for rows.Next() {
+		var row model.Scene
+		err = scanScene(rows, &row)
+		if err != nil {
+			log.Println("GetScenes:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetScenes:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresScenesRepository) GetScene(ctx context.Context, id uint64) (*model.Scene, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+sceneFields+" FROM SCENES WHERE ID = $1", id)
+
+	var object model.Scene
+
+	err := scanScene(row, &object)
+
+	if err != nil {
+		log.Println("GetScene:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+// CreateScene stores a scene and its members in one transaction
+func (r *PostgresScenesRepository) CreateScene(ctx context.Context, scene model.Scene) (*model.Scene, error) {
+
+	tx, err := r.Postgres.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	dateCreated := time.Now().UTC()
+
+	query := `
+				INSERT INTO SCENES
+					(DATE_CREATED, DATE_MODIFIED, NAME, AREA_ID, GROUP_ID, NATIVE_SCENE_ID)
+				VALUES
+					($1, $2, $3, $4, $5, $6)
+				RETURNING ` + sceneFields
+
+	row := tx.QueryRow(ctx, query, dateCreated, dateCreated, scene.Name, scene.AreaId, scene.GroupId, scene.NativeSceneId)
+
+	var object model.Scene
+
+	err = scanScene(row, &object)
+
+	if err != nil {
+		log.Println("CreateScene:", err)
+		return nil, err
+	}
+
+	object.Members = make([]model.SceneMember, 0, len(scene.Members))
+
+	for _, member := range scene.Members {
+
+		state, err := json.Marshal(member.State)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO SCENES_DEVICES (SCENE_ID, IEEE_ADDRESS, STATE) VALUES ($1, $2, $3)", object.Id, member.IeeeAddress, string(state))
+
+		if err != nil {
+			log.Println("CreateScene:", err)
+			return nil, err
+		}
+
+		member.SceneId = object.Id
+		object.Members = append(object.Members, member)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("CreateScene:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresScenesRepository) DeleteScene(ctx context.Context, id uint64) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM SCENES WHERE ID = $1", id)
+
+	if err != nil {
+		log.Println("DeleteScene:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *PostgresScenesRepository) GetSceneMembers(ctx context.Context, id uint64) ([]model.SceneMember, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT SD.SCENE_ID, SD.IEEE_ADDRESS, D.FRIENDLY_NAME, SD.STATE FROM SCENES_DEVICES SD INNER JOIN DEVICES D ON SD.IEEE_ADDRESS = D.IEEE_ADDRESS WHERE SD.SCENE_ID = $1", id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.SceneMember, 0)
+
+	for rows.Next() {
+		var row model.SceneMember
+		err = rows.Scan(&row.SceneId, &row.IeeeAddress, &row.FriendlyName, &row.State)
+		if err != nil {
+			log.Println("GetSceneMembers:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetSceneMembers:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"time"
+)
+
+type ISchedulesRepository interface {
+	GetSchedules(ctx context.Context) ([]model.Schedule, error)
+	GetSchedule(ctx context.Context, id uint64) (*model.Schedule, error)
+	CreateSchedule(ctx context.Context, schedule model.Schedule) (*model.Schedule, error)
+	UpdateSchedule(ctx context.Context, schedule model.Schedule) (*model.Schedule, error)
+	UpdateScheduleRuns(ctx context.Context, id uint64, lastRun *time.Time, nextRun *time.Time) error
+	DeleteSchedule(ctx context.Context, id uint64) error
+}
+
+type PostgresSchedulesRepository struct {
+	Postgres *pgxpool.Pool
+}
+
+var scheduleFields = "ID, DATE_CREATED, DATE_MODIFIED, NAME, ENABLED, TYPE, CRON, OFFSET_MINUTES, WEEKDAYS, TARGET_TYPE, IEEE_ADDRESS, GROUP_ID, PAYLOAD, MISSED_RUN, LAST_RUN, NEXT_RUN, OWNER_ID"
+
+var scanSchedule = func(row pgx.Row, object *model.Schedule) error {
+	return row.Scan(&object.Id, &object.DateCreated, &object.DateModified, &object.Name, &object.Enabled, &object.Type, &object.Cron,
+		&object.OffsetMinutes, &object.Weekdays, &object.TargetType, &object.IeeeAddress, &object.GroupId, &object.Payload,
+		&object.MissedRun, &object.LastRun, &object.NextRun, &object.OwnerId)
+}
+
+func (r *PostgresSchedulesRepository) GetSchedules(ctx context.Context) ([]model.Schedule, error) {
+
+	rows, err := r.Postgres.Query(ctx, "SELECT "+scheduleFields+" FROM SCHEDULES ORDER BY ID")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	objects := make([]model.Schedule, 0)
+
+	for rows.Next() {
+		var row model.Schedule
+		err = scanSchedule(rows, &row)
+		if err != nil {
+			log.Println("GetSchedules:", err)
+			return nil, err
+		}
+
+		objects = append(objects, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("GetSchedules:", err)
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (r *PostgresSchedulesRepository) GetSchedule(ctx context.Context, id uint64) (*model.Schedule, error) {
+
+	row := r.Postgres.QueryRow(ctx, "SELECT "+scheduleFields+" FROM SCHEDULES WHERE ID = $1", id)
+
+	var object model.Schedule
+
+	err := scanSchedule(row, &object)
+
+	if err != nil {
+		log.Println("GetSchedule:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresSchedulesRepository) CreateSchedule(ctx context.Context, schedule model.Schedule) (*model.Schedule, error) {
+
+	payload, err := json.Marshal(schedule.Payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dateCreated := time.Now().UTC()
+
+	query := `
+				INSERT INTO SCHEDULES
+					(DATE_CREATED, DATE_MODIFIED, NAME, ENABLED, TYPE, CRON, OFFSET_MINUTES, WEEKDAYS,
+					 TARGET_TYPE, IEEE_ADDRESS, GROUP_ID, PAYLOAD, MISSED_RUN, NEXT_RUN, OWNER_ID)
+				VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+				RETURNING ` + scheduleFields
+
+	row := r.Postgres.QueryRow(ctx, query, dateCreated, dateCreated, schedule.Name, schedule.Enabled, schedule.Type, schedule.Cron,
+		schedule.OffsetMinutes, weekdays(schedule.Weekdays), schedule.TargetType, schedule.IeeeAddress, schedule.GroupId, string(payload),
+		schedule.MissedRun, schedule.NextRun, schedule.OwnerId)
+
+	var object model.Schedule
+
+	err = scanSchedule(row, &object)
+
+	if err != nil {
+		log.Println("CreateSchedule:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresSchedulesRepository) UpdateSchedule(ctx context.Context, schedule model.Schedule) (*model.Schedule, error) {
+
+	payload, err := json.Marshal(schedule.Payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+				UPDATE SCHEDULES SET
+					DATE_MODIFIED = $1, NAME = $2, ENABLED = $3, TYPE = $4, CRON = $5, OFFSET_MINUTES = $6, WEEKDAYS = $7,
+					TARGET_TYPE = $8, IEEE_ADDRESS = $9, GROUP_ID = $10, PAYLOAD = $11, MISSED_RUN = $12, NEXT_RUN = $13,
+					OWNER_ID = $14
+				WHERE ID = $15
+				RETURNING ` + scheduleFields
+
+	row := r.Postgres.QueryRow(ctx, query, time.Now().UTC(), schedule.Name, schedule.Enabled, schedule.Type, schedule.Cron,
+		schedule.OffsetMinutes, weekdays(schedule.Weekdays), schedule.TargetType, schedule.IeeeAddress, schedule.GroupId, string(payload),
+		schedule.MissedRun, schedule.NextRun, schedule.OwnerId, schedule.Id)
+
+	var object model.Schedule
+
+	err = scanSchedule(row, &object)
+
+	if err != nil {
+		log.Println("UpdateSchedule:", err)
+		return nil, err
+	}
+
+	return &object, nil
+}
+
+func (r *PostgresSchedulesRepository) UpdateScheduleRuns(ctx context.Context, id uint64, lastRun *time.Time, nextRun *time.Time) error {
+
+	_, err := r.Postgres.Exec(ctx, "UPDATE SCHEDULES SET LAST_RUN = $1, NEXT_RUN = $2 WHERE ID = $3", lastRun, nextRun, id)
+
+	if err != nil {
+		log.Println("UpdateScheduleRuns:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *PostgresSchedulesRepository) DeleteSchedule(ctx context.Context, id uint64) error {
+
+	_, err := r.Postgres.Exec(ctx, "DELETE FROM SCHEDULES WHERE ID = $1", id)
+
+	if err != nil {
+		log.Println("DeleteSchedule:", err)
+		return err
+	}
+
+	return nil
+}
+
+// weekdays avoids sending NULL for an empty list into the not null column
+func weekdays(values []int) []int32 {
+
+	result := make([]int32, 0, len(values))
+
+	for _, value := range values {
+		result = append(result, int32(value))
+	}
+
+	return result
+}
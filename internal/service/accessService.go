@@ -0,0 +1,169 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden is returned for commands on devices or groups outside the areas the caller may act in
+var ErrForbidden = errors.New("not permitted in this area")
+
+type areaAccessKey struct{}
+
+// WithAccess limits the commands sent with the returned context to the areas the access allows
+func WithAccess(ctx context.Context, access *model.AreaAccess) context.Context {
+	return context.WithValue(ctx, areaAccessKey{}, access)
+}
+
+// AccessFromContext returns the access set with WithAccess, or nil for commands sent by domicile itself, which are unrestricted
+func AccessFromContext(ctx context.Context) *model.AreaAccess {
+	access, _ := ctx.Value(areaAccessKey{}).(*model.AreaAccess)
+	return access
+}
+
+func NewAccessService(accessRepository repository.IAccessRepository, areasRepository repository.IAreasRepository, authRepository repository.IAuthRepository) *AccessService {
+	return &AccessService{accessRepository: accessRepository, areasRepository: areasRepository, authRepository: authRepository}
+}
+
+type AccessService struct {
+	accessRepository repository.IAccessRepository
+	areasRepository repository.IAreasRepository
+	authRepository repository.IAuthRepository
+}
+
+func (s *AccessService) GetAreaRoles(ctx context.Context, userId uint64) ([]model.AreaRole, error) {
+	return s.accessRepository.GetAreaRoles(ctx, userId)
+}
+
+func (s *AccessService) SetAreaRole(ctx context.Context, userId uint64, areaId uint64, role string) (*model.AreaRole, error) {
+
+	if !model.ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	return s.accessRepository.SetAreaRole(ctx, userId, areaId, role)
+}
+
+func (s *AccessService) DeleteAreaRole(ctx context.Context, userId uint64, areaId uint64) error {
+	return s.accessRepository.DeleteAreaRole(ctx, userId, areaId)
+}
+
+// PrincipalAccess returns the areas an authenticated user or api key may act in, api keys are never restricted to areas
+func (s *AccessService) PrincipalAccess(ctx context.Context, principal *model.Principal) (*model.AreaAccess, error) {
+
+	if principal.User == nil {
+		return &model.AreaAccess{Default: model.ScopeRole(principal.Scope)}, nil
+	}
+
+	return s.userAccess(ctx, principal.User)
+}
+
+// UserAccess returns the areas a user may act in, used to run automations and schedules as the user who saved them
+func (s *AccessService) UserAccess(ctx context.Context, userId uint64) (*model.AreaAccess, error) {
+
+	user, err := s.authRepository.GetUser(ctx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userAccess(ctx, user)
+}
+
+// userAccess applies each of the user's area roles to the area's subtree, keeping the highest where they overlap.
+// No area role grants more than the user's scope.
+func (s *AccessService) userAccess(ctx context.Context, user *model.User) (*model.AreaAccess, error) {
+
+	ceiling := model.ScopeRole(user.Scope)
+
+	roles, err := s.accessRepository.GetAreaRoles(ctx, user.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roles) == 0 {
+		return &model.AreaAccess{Default: ceiling}, nil
+	}
+
+	areas, err := s.areasRepository.GetAreas(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint64][]uint64)
+	for _, area := range areas {
+		if area.ParentId != nil {
+			children[*area.ParentId] = append(children[*area.ParentId], area.Id)
+		}
+	}
+
+	access := &model.AreaAccess{Roles: make(map[uint64]string)}
+
+	for _, role := range roles {
+
+		granted := role.Role
+		if !model.RoleAllows(ceiling, granted) {
+			granted = ceiling
+		}
+
+		visited := make(map[uint64]bool)
+		pending := []uint64{role.AreaId}
+
+		for len(pending) > 0 {
+
+			id := pending[0]
+			pending = pending[1:]
+
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+
+			access.Roles[id] = model.HigherRole(access.Roles[id], granted)
+			pending = append(pending, children[id]...)
+		}
+	}
+
+	return access, nil
+}
+
+// checkAreas returns ErrForbidden unless the access in the context grants role in every one of the areas
+func checkAreas(ctx context.Context, role string, target string, areaIds ...*uint64) error {
+
+	access := AccessFromContext(ctx)
+
+	// A restricted user can only reach a group through its members, so an empty group is out of reach
+	if access.Restricted() && len(areaIds) == 0 {
+		return fmt.Errorf("%w: %s", ErrForbidden, target)
+	}
+
+	for _, areaId := range areaIds {
+		if !access.Allows(areaId, role) {
+			return fmt.Errorf("%w: %s", ErrForbidden, target)
+		}
+	}
+
+	return nil
+}
+
+// OwnerContext limits the commands sent with the returned context to the areas of the user who saved an automation
+// or schedule. Those saved without a user, by an api key or before users existed, run unrestricted.
+func (s *AccessService) OwnerContext(ctx context.Context, ownerId *uint64) (context.Context, error) {
+
+	if ownerId == nil {
+		return ctx, nil
+	}
+
+	access, err := s.UserAccess(ctx, *ownerId)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the access of user %d: %w", *ownerId, err)
+	}
+
+	return WithAccess(ctx, access), nil
+}
@@ -0,0 +1,493 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/notify"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	alertsLimit = 500
+	alertsCheckInterval = time.Minute
+	alertEventQueueSize = 1000
+	// Handling one event or check gives up on the database after this long so the next is not held up
+	alertHandleTimeout = 10 * time.Second
+)
+
+func NewAlertsService(
+	alertsRepository repository.IAlertsRepository,
+	devicesService *DevicesService,
+	notificationsService *NotificationsService,
+	eventBus events.IEventBus,
+) *AlertsService {
+	return &AlertsService{
+		alertsRepository: alertsRepository,
+		devicesService: devicesService,
+		notificationsService: notificationsService,
+		eventBus: eventBus,
+		pending: make(map[string]pendingAlert),
+		firing: make(map[string]model.Alert),
+		names: make(map[string]string),
+		queue: make(chan events.Event, alertEventQueueSize),
+	}
+}
+
+type AlertsService struct {
+	alertsRepository repository.IAlertsRepository
+	devicesService *DevicesService
+	notificationsService *NotificationsService
+	eventBus events.IEventBus
+
+	mutex sync.Mutex
+	rules []model.AlertRule
+	// Breaching values waiting for their rule's ForMinutes to elapse, and open alerts, keyed by rule and device
+	pending map[string]pendingAlert
+	firing map[string]model.Alert
+	names map[string]string
+	queue chan events.Event
+}
+
+type pendingAlert struct {
+	since time.Time
+	value float64
+}
+
+// ManageAlerts evaluates the alert rules against incoming reports and, every minute, against stored device data
+func (s *AlertsService) ManageAlerts(ctx context.Context) {
+
+	s.LoadAlertRules(ctx)
+
+	firing := model.AlertFiring
+	alerts, err := s.alertsRepository.GetAlerts(ctx, &firing, alertsLimit)
+
+	if err != nil {
+		log.Println("ManageAlerts:", err)
+	}
+
+	s.mutex.Lock()
+	for _, alert := range alerts {
+		s.firing[alertKey(alert.RuleId, alert.IeeeAddress)] = alert
+	}
+	s.mutex.Unlock()
+
+	err = s.eventBus.Subscribe(s.HandleEvent, events.MeasurementRecorded, events.DeviceStateChanged, events.AlertRuleChanged)
+
+	if err != nil {
+		log.Fatalf("ManageAlerts: Subscribe error: %s", err)
+	}
+
+	go s.run(ctx)
+}
+
+// run handles queued events and the minute check one at a time, so an alert is only ever fired or resolved once
+func (s *AlertsService) run(ctx context.Context) {
+
+	ticker := time.NewTicker(alertsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			handleCtx, cancel := context.WithTimeout(ctx, alertHandleTimeout)
+			s.handleEvent(handleCtx, event)
+			cancel()
+		case now := <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, alertHandleTimeout)
+			s.CheckDevices(checkCtx, now.UTC())
+			cancel()
+		}
+	}
+}
+
+func (s *AlertsService) LoadAlertRules(ctx context.Context) {
+
+	rules, err := s.alertsRepository.GetAlertRules(ctx)
+
+	if err != nil {
+		log.Println("LoadAlertRules:", err)
+		return
+	}
+
+	s.mutex.Lock()
+	s.rules = rules
+	s.pending = make(map[string]pendingAlert)
+	s.mutex.Unlock()
+
+	log.Printf("Loaded %d alert rules\n", len(rules))
+}
+
+// HandleEvent queues the event for run, evaluating it can read and write the database and must not hold up paho's router
+func (s *AlertsService) HandleEvent(ctx context.Context, event events.Event) {
+
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Alert event queue full, dropping %s\n", event.Type)
+	}
+}
+
+func (s *AlertsService) handleEvent(ctx context.Context, event events.Event) {
+
+	switch event.Type {
+
+	case events.AlertRuleChanged:
+		s.LoadAlertRules(ctx)
+
+	case events.MeasurementRecorded:
+		var payload events.MeasurementEvent
+		if err := event.Decode(&payload); err != nil {
+			log.Println("handleEvent:", err)
+			return
+		}
+		areaId := payload.AreaId
+		s.evaluate(ctx, model.AlertMeasurement, &payload.Measurement, payload.DeviceId, &areaId, payload.Value, event.Date)
+
+	case events.DeviceStateChanged:
+		var payload events.DeviceStateEvent
+		if err := event.Decode(&payload); err != nil {
+			log.Println("handleEvent:", err)
+			return
+		}
+		s.mutex.Lock()
+		s.names[payload.IeeeAddress] = payload.FriendlyName
+		s.mutex.Unlock()
+		if battery, ok := payload.State["battery"].(float64); ok {
+			s.evaluate(ctx, model.AlertBattery, nil, payload.IeeeAddress, payload.AreaId, battery, event.Date)
+		}
+	}
+}
+
+// CheckDevices evaluates offline rules against each device's last seen time and fires alerts whose delay has elapsed
+func (s *AlertsService) CheckDevices(ctx context.Context, now time.Time) {
+
+	devices, err := s.devicesService.GetDevices(ctx)
+
+	if err != nil {
+		log.Println("CheckDevices:", err)
+		return
+	}
+
+	for _, device := range devices {
+
+		s.mutex.Lock()
+		s.names[device.IeeeAddress] = device.FriendlyName
+		s.mutex.Unlock()
+
+		if !device.Active || device.LastSeen == nil {
+			continue
+		}
+
+		s.evaluate(ctx, model.AlertOffline, nil, device.IeeeAddress, device.AreaId, now.Sub(*device.LastSeen).Minutes(), now)
+	}
+
+	// Rules with a delay fire once it has elapsed, even if the device has not reported since
+	s.mutex.Lock()
+	rules := s.rules
+	due := make(map[string]pendingAlert)
+	for key, pending := range s.pending {
+		due[key] = pending
+	}
+	s.mutex.Unlock()
+
+	for key, pending := range due {
+		ruleId, ieeeAddress := splitAlertKey(key)
+		for _, rule := range rules {
+			if rule.Id == ruleId && now.Sub(pending.since) >= time.Duration(rule.ForMinutes)*time.Minute {
+				s.fire(ctx, rule, ieeeAddress, pending.value, now)
+			}
+		}
+	}
+}
+
+func (s *AlertsService) evaluate(ctx context.Context, ruleType string, measurement *string, ieeeAddress string, areaId *uint64, value float64, now time.Time) {
+
+	s.mutex.Lock()
+	rules := s.rules
+	s.mutex.Unlock()
+
+	for _, rule := range rules {
+
+		if !rule.Enabled || rule.Type != ruleType {
+			continue
+		}
+
+		if ruleType == model.AlertMeasurement && (rule.Measurement == nil || measurement == nil || *rule.Measurement != *measurement) {
+			continue
+		}
+
+		if rule.IeeeAddress != nil && *rule.IeeeAddress != ieeeAddress {
+			continue
+		}
+
+		if rule.AreaId != nil && (areaId == nil || *rule.AreaId != *areaId) {
+			continue
+		}
+
+		key := alertKey(rule.Id, ieeeAddress)
+
+		s.mutex.Lock()
+		_, isFiring := s.firing[key]
+		pending, isPending := s.pending[key]
+		s.mutex.Unlock()
+
+		switch {
+
+		case isFiring:
+			if recovered(rule, value) {
+				s.resolve(ctx, rule, ieeeAddress, value, now)
+			}
+
+		case breaching(rule, value):
+			if !isPending {
+				pending = pendingAlert{since: now}
+			}
+			pending.value = value
+
+			if now.Sub(pending.since) >= time.Duration(rule.ForMinutes)*time.Minute {
+				s.fire(ctx, rule, ieeeAddress, value, now)
+			} else {
+				s.mutex.Lock()
+				s.pending[key] = pending
+				s.mutex.Unlock()
+			}
+
+		case isPending:
+			s.mutex.Lock()
+			delete(s.pending, key)
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// fire and resolve are only reached from run, so checking firing and then writing the alert cannot race another event
+func (s *AlertsService) fire(ctx context.Context, rule model.AlertRule, ieeeAddress string, value float64, now time.Time) {
+
+	key := alertKey(rule.Id, ieeeAddress)
+
+	s.mutex.Lock()
+	delete(s.pending, key)
+	_, isFiring := s.firing[key]
+	s.mutex.Unlock()
+
+	if isFiring {
+		return
+	}
+
+	alert, err := s.alertsRepository.CreateAlert(ctx, rule.Id, ieeeAddress, value, now)
+
+	if err != nil {
+		log.Printf("Alert %s for %s: %v\n", rule.Name, ieeeAddress, err)
+		return
+	}
+
+	s.mutex.Lock()
+	s.firing[key] = *alert
+	s.mutex.Unlock()
+
+	log.Printf("Alert %s firing for %s with %v\n", rule.Name, ieeeAddress, value)
+
+	s.notificationsService.Dispatch(rule.Channels, notify.Notification{
+		Title:    "Alert: " + rule.Name,
+		Message:  s.describe(rule, ieeeAddress, value),
+		Priority: notify.PriorityHigh,
+		Origin:   fmt.Sprintf("alert:%d", rule.Id),
+		Date:     now,
+	})
+}
+
+func (s *AlertsService) resolve(ctx context.Context, rule model.AlertRule, ieeeAddress string, value float64, now time.Time) {
+
+	key := alertKey(rule.Id, ieeeAddress)
+
+	s.mutex.Lock()
+	alert, isFiring := s.firing[key]
+	delete(s.firing, key)
+	s.mutex.Unlock()
+
+	if !isFiring {
+		return
+	}
+
+	if _, err := s.alertsRepository.ResolveAlert(ctx, alert.Id, value, now); err != nil {
+		log.Printf("Alert %s for %s: %v\n", rule.Name, ieeeAddress, err)
+		return
+	}
+
+	log.Printf("Alert %s resolved for %s with %v\n", rule.Name, ieeeAddress, value)
+
+	s.notificationsService.Dispatch(rule.Channels, notify.Notification{
+		Title:    "Resolved: " + rule.Name,
+		Message:  s.describe(rule, ieeeAddress, value),
+		Priority: notify.PriorityDefault,
+		Origin:   fmt.Sprintf("alert:%d", rule.Id),
+		Date:     now,
+	})
+}
+
+func (s *AlertsService) describe(rule model.AlertRule, ieeeAddress string, value float64) string {
+
+	s.mutex.Lock()
+	name := s.names[ieeeAddress]
+	s.mutex.Unlock()
+
+	if name == "" {
+		name = ieeeAddress
+	}
+
+	switch rule.Type {
+	case model.AlertBattery:
+		return fmt.Sprintf("%s battery is %.0f%% (%s %v)", name, value, rule.Operator, rule.Threshold)
+	case model.AlertOffline:
+		return fmt.Sprintf("%s has not been seen for %.0f minutes", name, value)
+	}
+
+	return fmt.Sprintf("%s %s is %.1f (%s %v)", name, *rule.Measurement, value, rule.Operator, rule.Threshold)
+}
+
+func (s *AlertsService) GetAlertRules(ctx context.Context) ([]model.AlertRule, error) {
+	return s.alertsRepository.GetAlertRules(ctx)
+}
+
+func (s *AlertsService) GetAlertRule(ctx context.Context, id uint64) (*model.AlertRule, error) {
+	return s.alertsRepository.GetAlertRule(ctx, id)
+}
+
+func (s *AlertsService) CreateAlertRule(ctx context.Context, rule model.AlertRule) (*model.AlertRule, error) {
+
+	if err := s.ValidateAlertRule(&rule); err != nil {
+		return nil, err
+	}
+
+	created, err := s.alertsRepository.CreateAlertRule(ctx, rule)
+
+	if err == nil {
+		s.publishChanged(created.Id)
+	}
+
+	return created, err
+}
+
+func (s *AlertsService) UpdateAlertRule(ctx context.Context, rule model.AlertRule) (*model.AlertRule, error) {
+
+	if err := s.ValidateAlertRule(&rule); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.alertsRepository.UpdateAlertRule(ctx, rule)
+
+	if err == nil {
+		s.publishChanged(updated.Id)
+	}
+
+	return updated, err
+}
+
+func (s *AlertsService) DeleteAlertRule(ctx context.Context, id uint64) error {
+
+	err := s.alertsRepository.DeleteAlertRule(ctx, id)
+
+	if err == nil {
+		s.publishChanged(id)
+	}
+
+	return err
+}
+
+func (s *AlertsService) GetAlerts(ctx context.Context, state *string) ([]model.Alert, error) {
+	return s.alertsRepository.GetAlerts(ctx, state, alertsLimit)
+}
+
+func (s *AlertsService) publishChanged(id uint64) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(events.AlertRuleChanged, events.AlertRuleEvent{AlertRuleId: id}); err != nil {
+		log.Println("AlertsService: unable to publish event", err)
+	}
+}
+
+// ValidateAlertRule checks a rule and fills in the operator implied by battery and offline rules
+func (s *AlertsService) ValidateAlertRule(rule *model.AlertRule) error {
+
+	if strings.TrimSpace(rule.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	switch rule.Type {
+	case model.AlertMeasurement:
+		if rule.Measurement == nil {
+			return errors.New("measurement is required")
+		}
+	case model.AlertBattery:
+		if rule.Operator == "" {
+			rule.Operator = model.AlertBelow
+		}
+	case model.AlertOffline:
+		rule.Operator = model.AlertAbove
+		if rule.Threshold <= 0 {
+			return errors.New("threshold must be a positive number of minutes")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", rule.Type)
+	}
+
+	if rule.Operator != model.AlertAbove && rule.Operator != model.AlertBelow {
+		return fmt.Errorf("unknown operator %q", rule.Operator)
+	}
+
+	if rule.Hysteresis < 0 || rule.ForMinutes < 0 {
+		return errors.New("hysteresis and forMinutes cannot be negative")
+	}
+
+	for _, channel := range rule.Channels {
+		if !s.notificationsService.HasNotifier(channel) {
+			return fmt.Errorf("notifier %q is not configured", channel)
+		}
+	}
+
+	return nil
+}
+
+func breaching(rule model.AlertRule, value float64) bool {
+
+	if rule.Operator == model.AlertAbove {
+		return value > rule.Threshold
+	}
+
+	return value < rule.Threshold
+}
+
+// recovered applies the hysteresis, so a value hovering around the threshold does not resolve and refire repeatedly
+func recovered(rule model.AlertRule, value float64) bool {
+
+	if rule.Operator == model.AlertAbove {
+		return value <= rule.Threshold-rule.Hysteresis
+	}
+
+	return value >= rule.Threshold+rule.Hysteresis
+}
+
+func alertKey(ruleId uint64, ieeeAddress string) string {
+	return strconv.FormatUint(ruleId, 10) + "/" + ieeeAddress
+}
+
+func splitAlertKey(key string) (uint64, string) {
+
+	parts := strings.SplitN(key, "/", 2)
+	ruleId, _ := strconv.ParseUint(parts[0], 10, 64)
+
+	return ruleId, parts[1]
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/notify"
+	"context"
+	"strings"
+	"testing"
+)
+
+type namedNotifier string
+
+func (n namedNotifier) Name() string {
+	return string(n)
+}
+
+func (n namedNotifier) Notify(ctx context.Context, notification notify.Notification) error {
+	return nil
+}
+
+func TestBreachingAndRecovered(t *testing.T) {
+
+	above := model.AlertRule{Operator: model.AlertAbove, Threshold: 30, Hysteresis: 2}
+	below := model.AlertRule{Operator: model.AlertBelow, Threshold: 20, Hysteresis: 5}
+
+	tests := []struct {
+		name      string
+		rule      model.AlertRule
+		value     float64
+		breaching bool
+		recovered bool
+	}{
+		{"above the threshold", above, 30.5, true, false},
+		{"at the threshold", above, 30, false, false},
+		{"inside the hysteresis", above, 29, false, false},
+		{"back past the hysteresis", above, 28, false, true},
+		{"below the threshold", below, 19, true, false},
+		{"at a low threshold", below, 20, false, false},
+		{"inside a low hysteresis", below, 24.9, false, false},
+		{"back past a low hysteresis", below, 25, false, true},
+		{"no hysteresis", model.AlertRule{Operator: model.AlertBelow, Threshold: 20}, 20, false, true},
+	}
+
+	for _, test := range tests {
+
+		if breaching := breaching(test.rule, test.value); breaching != test.breaching {
+			t.Errorf("%s: breaching(%v) = %v, expected %v", test.name, test.value, breaching, test.breaching)
+		}
+
+		if recovered := recovered(test.rule, test.value); recovered != test.recovered {
+			t.Errorf("%s: recovered(%v) = %v, expected %v", test.name, test.value, recovered, test.recovered)
+		}
+	}
+}
+
+func TestValidateAlertRule(t *testing.T) {
+
+	s := &AlertsService{notificationsService: &NotificationsService{notifiers: map[string]notify.INotifier{"phone": namedNotifier("phone")}}}
+
+	tests := []struct {
+		name     string
+		rule     model.AlertRule
+		operator string
+		err      string
+	}{
+		{"measurement", model.AlertRule{Name: "Hot", Type: model.AlertMeasurement, Measurement: stringRef("temperature"), Operator: model.AlertAbove, Threshold: 30}, model.AlertAbove, ""},
+		{"blank name", model.AlertRule{Name: " ", Type: model.AlertBattery}, "", "name is required"},
+		{"measurement without measurement", model.AlertRule{Name: "Hot", Type: model.AlertMeasurement, Operator: model.AlertAbove}, "", "measurement is required"},
+		{"measurement without operator", model.AlertRule{Name: "Hot", Type: model.AlertMeasurement, Measurement: stringRef("temperature")}, "", "unknown operator"},
+		{"battery defaults to below", model.AlertRule{Name: "Flat", Type: model.AlertBattery, Threshold: 10}, model.AlertBelow, ""},
+		{"battery keeps its operator", model.AlertRule{Name: "Charged", Type: model.AlertBattery, Operator: model.AlertAbove, Threshold: 95}, model.AlertAbove, ""},
+		{"offline is always above", model.AlertRule{Name: "Gone", Type: model.AlertOffline, Operator: model.AlertBelow, Threshold: 60}, model.AlertAbove, ""},
+		{"offline without minutes", model.AlertRule{Name: "Gone", Type: model.AlertOffline}, "", "threshold must be a positive number"},
+		{"unknown type", model.AlertRule{Name: "Loud", Type: "noise"}, "", "unknown type"},
+		{"negative hysteresis", model.AlertRule{Name: "Flat", Type: model.AlertBattery, Hysteresis: -1}, "", "cannot be negative"},
+		{"negative delay", model.AlertRule{Name: "Flat", Type: model.AlertBattery, ForMinutes: -5}, "", "cannot be negative"},
+		{"configured channel", model.AlertRule{Name: "Flat", Type: model.AlertBattery, Channels: []string{"phone"}}, model.AlertBelow, ""},
+		{"unknown channel", model.AlertRule{Name: "Flat", Type: model.AlertBattery, Channels: []string{"pager"}}, "", `notifier "pager" is not configured`},
+	}
+
+	for _, test := range tests {
+
+		rule := test.rule
+		err := s.ValidateAlertRule(&rule)
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: ValidateAlertRule = %v", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: ValidateAlertRule = %v, expected %q", test.name, err, test.err)
+		}
+
+		if test.err == "" && rule.Operator != test.operator {
+			t.Errorf("%s: operator %q, expected %q", test.name, rule.Operator, test.operator)
+		}
+	}
+}
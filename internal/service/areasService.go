@@ -4,9 +4,15 @@ import (
 	"78concepts.com/domicile/internal/model"
 	"78concepts.com/domicile/internal/repository"
 	"context"
+	"errors"
 	"github.com/gofrs/uuid"
 )
 
+var (
+	ErrAreaNotFound = errors.New("area not found")
+	ErrAreaCycle = errors.New("an area cannot be nested beneath itself")
+)
+
 func NewAreasService(areasRepository repository.IAreasRepository) *AreasService {
 	return &AreasService{areasRepository: areasRepository}
 }
@@ -24,4 +30,42 @@ func (s *AreasService) GetArea(ctx context.Context, uuid uuid.UUID) (*model.Area
 		ctx,
 		uuid,
 	)
-}
\ No newline at end of file
+}
+func (s *AreasService) GetAreaById(ctx context.Context, id uint64) (*model.Area, error) {
+	return s.areasRepository.GetAreaById(ctx, id)
+}
+
+// SetAreaParent nests an area beneath another, or makes it top level with a nil parent
+func (s *AreasService) GetAreasByIds(ctx context.Context, ids []uint64) ([]model.Area, error) {
+	return s.areasRepository.GetAreasByIds(ctx, ids)
+}
+
+func (s *AreasService) SetAreaParent(ctx context.Context, area *model.Area, parentId *uint64) (*model.Area, error) {
+
+	if parentId != nil {
+
+		areas, err := s.areasRepository.GetAreas(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parents := make(map[uint64]*uint64)
+		for _, a := range areas {
+			parents[a.Id] = a.ParentId
+		}
+
+		if _, ok := parents[*parentId]; !ok {
+			return nil, ErrAreaNotFound
+		}
+
+		// Walk up from the new parent, reaching the area itself would make it its own ancestor
+		for id := parentId; id != nil; id = parents[*id] {
+			if *id == area.Id {
+				return nil, ErrAreaCycle
+			}
+		}
+	}
+
+	return s.areasRepository.UpdateAreaParent(ctx, area.Id, parentId)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+type auditOriginKey struct{}
+
+// WithOrigin records who or what is behind the commands sent with the returned context
+func WithOrigin(ctx context.Context, origin model.AuditOrigin) context.Context {
+	return context.WithValue(ctx, auditOriginKey{}, origin)
+}
+
+// OriginFromContext returns the origin set with WithOrigin, commands without one were sent by domicile itself
+func OriginFromContext(ctx context.Context) model.AuditOrigin {
+
+	if origin, ok := ctx.Value(auditOriginKey{}).(model.AuditOrigin); ok {
+		return origin
+	}
+
+	return model.AuditOrigin{Type: model.OriginSystem}
+}
+
+func automationOrigin(id uint64) model.AuditOrigin {
+	x := strconv.FormatUint(id, 10)
+	return model.AuditOrigin{Type: model.OriginAutomation, Id: &x}
+}
+
+func scheduleOrigin(id uint64) model.AuditOrigin {
+	x := strconv.FormatUint(id, 10)
+	return model.AuditOrigin{Type: model.OriginSchedule, Id: &x}
+}
+
+func NewAuditService(auditRepository repository.IAuditRepository) *AuditService {
+	return &AuditService{auditRepository: auditRepository}
+}
+
+type AuditService struct {
+	auditRepository repository.IAuditRepository
+}
+
+// RecordCommand logs a command published by domicile along with its origin, taken from the context, and its outcome
+func (s *AuditService) RecordCommand(ctx context.Context, action string, target string, payload interface{}, err error) {
+	s.record(ctx, model.AuditOutbound, action, target, payload, OriginFromContext(ctx), err)
+}
+
+// RecordChange logs a change that reached domicile from outside, such as a device renamed in zigbee2mqtt
+func (s *AuditService) RecordChange(ctx context.Context, action string, target string, payload interface{}, origin model.AuditOrigin) {
+	s.record(ctx, model.AuditInbound, action, target, payload, origin, nil)
+}
+
+func (s *AuditService) GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	return s.auditRepository.GetAuditEntries(ctx, filter)
+}
+
+func (s *AuditService) record(ctx context.Context, direction string, action string, target string, payload interface{}, origin model.AuditOrigin, err error) {
+
+	if s == nil {
+		return
+	}
+
+	entry := model.AuditEntry{
+		Date: time.Now().UTC(),
+		Direction: direction,
+		Action: action,
+		Target: target,
+		Payload: payload,
+		Origin: origin,
+		Outcome: model.AuditOutcomeOk,
+	}
+
+	if err != nil {
+		message := err.Error()
+		entry.Outcome = model.AuditOutcomeError
+		entry.Error = &message
+	}
+
+	if err := s.auditRepository.CreateAuditEntry(ctx, entry); err != nil {
+		log.Printf("AuditService: unable to record %s of %s: %v\n", action, target, err)
+	}
+}
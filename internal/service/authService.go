@@ -0,0 +1,252 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	SessionDuration = 30 * 24 * time.Hour
+	MinPasswordLength = 8
+
+	apiKeyPrefix = "dom_"
+	// Last used dates are only written this often, rather than on every request
+	touchInterval = time.Minute
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Compared against when a username does not exist, so unknown and known users take as long to reject
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("domicile"), bcrypt.DefaultCost)
+
+func NewAuthService(authRepository repository.IAuthRepository) *AuthService {
+	return &AuthService{authRepository: authRepository}
+}
+
+// AuthService manages users, their sessions and api keys. Session tokens and api keys are random, so only their sha256 is
+// stored, while passwords are hashed with bcrypt.
+type AuthService struct {
+	authRepository repository.IAuthRepository
+}
+
+func (s *AuthService) GetUsers(ctx context.Context) ([]model.User, error) {
+	return s.authRepository.GetUsers(ctx)
+}
+
+func (s *AuthService) CreateUser(ctx context.Context, username string, password string, scope string) (*model.User, error) {
+
+	username = strings.TrimSpace(username)
+
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	if !model.ValidScope(scope) {
+		return nil, fmt.Errorf("unknown scope %q", scope)
+	}
+
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authRepository.CreateUser(ctx, username, hash, scope)
+}
+
+func (s *AuthService) SetPassword(ctx context.Context, username string, password string) error {
+
+	user, err := s.authRepository.GetUserByUsername(ctx, username)
+
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	return s.authRepository.UpdateUserPassword(ctx, user.Id, hash)
+}
+
+func (s *AuthService) DeleteUser(ctx context.Context, id uint64) error {
+	return s.authRepository.DeleteUser(ctx, id)
+}
+
+// Login checks a username and password, returning a new session token for the cookie
+func (s *AuthService) Login(ctx context.Context, username string, password string) (string, *model.User, error) {
+
+	user, err := s.authRepository.GetUserByUsername(ctx, username)
+
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return "", nil, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+
+	token, err := randomToken(32)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+
+	err = s.authRepository.CreateSession(ctx, model.Session{
+		TokenHash: hashToken(token),
+		UserId: user.Id,
+		DateCreated: now,
+		DateExpires: now.Add(SessionDuration),
+	})
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.authRepository.DeleteExpiredSessions(ctx, now)
+
+	return token, user, nil
+}
+
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	return s.authRepository.DeleteSession(ctx, hashToken(token))
+}
+
+// AuthenticateSession returns the user behind a session cookie, or ErrInvalidCredentials if it is unknown or expired
+func (s *AuthService) AuthenticateSession(ctx context.Context, token string) (*model.Principal, error) {
+
+	session, err := s.authRepository.GetSession(ctx, hashToken(token))
+
+	if err != nil || time.Now().After(session.DateExpires) {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := s.authRepository.GetUser(ctx, session.UserId)
+
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if now := time.Now().UTC(); user.DateLastSeen == nil || now.Sub(*user.DateLastSeen) > touchInterval {
+		s.authRepository.TouchUser(ctx, user.Id, now)
+	}
+
+	return &model.Principal{Type: model.PrincipalUser, Name: user.Username, Scope: user.Scope, User: user}, nil
+}
+
+func (s *AuthService) GetApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	return s.authRepository.GetApiKeys(ctx)
+}
+
+// CreateApiKey returns the new key, which cannot be recovered later, along with its stored details
+func (s *AuthService) CreateApiKey(ctx context.Context, name string, scope string) (string, *model.ApiKey, error) {
+
+	if strings.TrimSpace(name) == "" {
+		return "", nil, errors.New("name is required")
+	}
+
+	if !model.ValidScope(scope) {
+		return "", nil, fmt.Errorf("unknown scope %q", scope)
+	}
+
+	prefix, err := randomHex(4)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := randomToken(32)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := apiKeyPrefix + prefix + "_" + secret
+
+	apiKey, err := s.authRepository.CreateApiKey(ctx, strings.TrimSpace(name), apiKeyPrefix+prefix, hashToken(key), scope)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	log.Printf("Created %s api key %s (%s)\n", scope, apiKey.Name, apiKey.Prefix)
+
+	return key, apiKey, nil
+}
+
+func (s *AuthService) DeleteApiKey(ctx context.Context, id uint64) error {
+	return s.authRepository.DeleteApiKey(ctx, id)
+}
+
+func (s *AuthService) AuthenticateApiKey(ctx context.Context, key string) (*model.Principal, error) {
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidCredentials
+	}
+
+	apiKey, err := s.authRepository.GetApiKeyByHash(ctx, hashToken(key))
+
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if now := time.Now().UTC(); apiKey.DateLastUsed == nil || now.Sub(*apiKey.DateLastUsed) > touchInterval {
+		s.authRepository.TouchApiKey(ctx, apiKey.Id, now)
+	}
+
+	return &model.Principal{Type: model.PrincipalApiKey, Name: apiKey.Name, Scope: apiKey.Scope, Key: apiKey}, nil
+}
+
+func hashPassword(password string) (string, error) {
+
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	return string(hash), err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+
+	data := make([]byte, size)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func randomHex(size int) (string, error) {
+
+	data := make([]byte, size)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,762 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/config"
+	"78concepts.com/domicile/internal/cron"
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	automationLogLimit = 100
+	automationLoadTimeout = 10 * time.Second
+)
+
+func NewAutomationsService(
+	automationsRepository repository.IAutomationsRepository,
+	devicesService *DevicesService,
+	groupsService *GroupsService,
+	reportsService *ReportsService,
+	scenesService *ScenesService,
+	accessService *AccessService,
+	eventBus events.IEventBus,
+) *AutomationsService {
+	return &AutomationsService{
+		automationsRepository: automationsRepository,
+		devicesService: devicesService,
+		groupsService: groupsService,
+		reportsService: reportsService,
+		scenesService: scenesService,
+		accessService: accessService,
+		eventBus: eventBus,
+		location: config.GetConfig().Location.GetTimezone(),
+		deviceStates: make(map[string]map[string]interface{}),
+		measurements: make(map[string]float64),
+		reloads: make(chan struct{}, 1),
+	}
+}
+
+type AutomationsService struct {
+	automationsRepository repository.IAutomationsRepository
+	devicesService *DevicesService
+	groupsService *GroupsService
+	reportsService *ReportsService
+	scenesService *ScenesService
+	accessService *AccessService
+	eventBus events.IEventBus
+	location *time.Location
+
+	mutex sync.Mutex
+	mqttClient *broker.MqttClient
+	automations []model.Automation
+	schedules map[string]*cron.Schedule
+	deviceStates map[string]map[string]interface{}
+	measurements map[string]float64
+	reloads chan struct{}
+}
+
+// ManageAutomations loads the stored rules and evaluates them against the event bus and a minute clock
+func (s *AutomationsService) ManageAutomations(mqttClient *broker.MqttClient) {
+
+	s.mqttClient = mqttClient
+
+	s.LoadAutomations(mqttClient.Ctx)
+
+	err := s.eventBus.Subscribe(s.HandleEvent,
+		events.DeviceStateChanged,
+		events.MeasurementRecorded,
+		events.DeviceAvailabilityChanged,
+		events.AutomationChanged,
+	)
+
+	if err != nil {
+		log.Fatalf("ManageAutomations: Subscribe error: %s", err)
+	}
+
+	go s.reloadAutomations(mqttClient.Ctx)
+	go s.runClock(mqttClient.Ctx)
+}
+
+func (s *AutomationsService) LoadAutomations(ctx context.Context) {
+
+	automations, err := s.automationsRepository.GetAutomations(ctx)
+
+	if err != nil {
+		log.Println("LoadAutomations:", err)
+		return
+	}
+
+	schedules := make(map[string]*cron.Schedule)
+
+	for _, automation := range automations {
+		for _, trigger := range automation.Triggers {
+			if trigger.Type == model.TriggerCron && trigger.Cron != nil {
+				if schedule, err := cron.Parse(*trigger.Cron); err == nil {
+					schedules[*trigger.Cron] = schedule
+				}
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	s.automations = automations
+	s.schedules = schedules
+	s.mutex.Unlock()
+
+	log.Printf("Loaded %d automations\n", len(automations))
+}
+
+// reloadAutomations reads the rules again after they change, away from the event handler so the database read does
+// not hold up paho's router. Changes arriving during a reload are folded into a single further one
+func (s *AutomationsService) reloadAutomations(ctx context.Context) {
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.reloads:
+			loadCtx, cancel := context.WithTimeout(ctx, automationLoadTimeout)
+			s.LoadAutomations(loadCtx)
+			cancel()
+		}
+	}
+}
+
+func (s *AutomationsService) HandleEvent(ctx context.Context, event events.Event) {
+
+	switch event.Type {
+
+	case events.AutomationChanged:
+		select {
+		case s.reloads <- struct{}{}:
+		default:
+		}
+
+	case events.DeviceStateChanged:
+		var payload events.DeviceStateEvent
+		if err := event.Decode(&payload); err != nil {
+			log.Println("HandleEvent:", err)
+			return
+		}
+		s.handleDeviceState(ctx, payload)
+
+	case events.MeasurementRecorded:
+		var payload events.MeasurementEvent
+		if err := event.Decode(&payload); err != nil {
+			log.Println("HandleEvent:", err)
+			return
+		}
+		s.handleMeasurement(ctx, payload)
+
+	case events.DeviceAvailabilityChanged:
+		var payload events.DeviceAvailabilityEvent
+		if err := event.Decode(&payload); err != nil {
+			log.Println("HandleEvent:", err)
+			return
+		}
+		s.handleAvailability(ctx, payload)
+	}
+}
+
+func (s *AutomationsService) handleDeviceState(ctx context.Context, payload events.DeviceStateEvent) {
+
+	s.mutex.Lock()
+	previous, seen := s.deviceStates[payload.IeeeAddress]
+	s.deviceStates[payload.IeeeAddress] = payload.State
+	s.mutex.Unlock()
+
+	// The first state after a restart only seeds the last known one, zigbee2mqtt republishes retained states on
+	// connect and none of them is a change
+	if !seen {
+		return
+	}
+
+	s.fire(ctx, func(trigger model.AutomationTrigger) (string, bool) {
+
+		if trigger.Type != model.TriggerState || trigger.IeeeAddress == nil || *trigger.IeeeAddress != payload.IeeeAddress {
+			return "", false
+		}
+
+		attribute := "state"
+		if trigger.Attribute != nil {
+			attribute = *trigger.Attribute
+		}
+
+		value, ok := payload.State[attribute]
+		previousValue, known := previous[attribute]
+
+		if !ok || !known || valuesEqual(previousValue, value) {
+			return "", false
+		}
+
+		if trigger.Value != nil && !valuesEqual(trigger.Value, value) {
+			return "", false
+		}
+
+		return fmt.Sprintf("%s %s changed to %v", payload.FriendlyName, attribute, value), true
+	})
+}
+
+func (s *AutomationsService) handleMeasurement(ctx context.Context, payload events.MeasurementEvent) {
+
+	key := payload.DeviceId + "/" + payload.Measurement
+
+	s.mutex.Lock()
+	previous, seen := s.measurements[key]
+	s.measurements[key] = payload.Value
+	s.mutex.Unlock()
+
+	// The first reading after a restart is only the baseline, nothing is known about what it crossed from
+	if !seen {
+		return
+	}
+
+	s.fire(ctx, func(trigger model.AutomationTrigger) (string, bool) {
+
+		if trigger.Type != model.TriggerMeasurement || trigger.Measurement == nil || *trigger.Measurement != payload.Measurement {
+			return "", false
+		}
+
+		if trigger.IeeeAddress != nil && *trigger.IeeeAddress != payload.DeviceId {
+			return "", false
+		}
+
+		if trigger.AreaId != nil && *trigger.AreaId != payload.AreaId {
+			return "", false
+		}
+
+		// Only fire when the value crosses into the range, not on every report inside it
+		if !inRange(payload.Value, trigger.Above, trigger.Below) || inRange(previous, trigger.Above, trigger.Below) {
+			return "", false
+		}
+
+		return fmt.Sprintf("%s of %s crossed to %v", payload.Measurement, payload.DeviceId, payload.Value), true
+	})
+}
+
+func (s *AutomationsService) handleAvailability(ctx context.Context, payload events.DeviceAvailabilityEvent) {
+
+	availability := "offline"
+	if payload.Available {
+		availability = "online"
+	}
+
+	s.fire(ctx, func(trigger model.AutomationTrigger) (string, bool) {
+
+		if trigger.Type != model.TriggerAvailability {
+			return "", false
+		}
+
+		if trigger.IeeeAddress != nil && *trigger.IeeeAddress != payload.IeeeAddress {
+			return "", false
+		}
+
+		if trigger.Availability != nil && *trigger.Availability != availability {
+			return "", false
+		}
+
+		return fmt.Sprintf("%s is %s", payload.FriendlyName, availability), true
+	})
+}
+
+func (s *AutomationsService) runClock(ctx context.Context) {
+
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+			s.handleTick(ctx, next.In(s.location))
+		}
+	}
+}
+
+func (s *AutomationsService) handleTick(ctx context.Context, now time.Time) {
+
+	s.mutex.Lock()
+	schedules := s.schedules
+	s.mutex.Unlock()
+
+	s.fire(ctx, func(trigger model.AutomationTrigger) (string, bool) {
+
+		switch trigger.Type {
+
+		case model.TriggerTime:
+			if trigger.Time == nil || *trigger.Time != now.Format("15:04") || !matchesWeekday(trigger.Weekdays, now) {
+				return "", false
+			}
+			return "time is " + *trigger.Time, true
+
+		case model.TriggerCron:
+			if trigger.Cron == nil || schedules[*trigger.Cron] == nil || !schedules[*trigger.Cron].Matches(now) {
+				return "", false
+			}
+			return "cron " + *trigger.Cron, true
+		}
+
+		return "", false
+	})
+}
+
+// fire runs every enabled automation with a trigger accepted by match
+func (s *AutomationsService) fire(ctx context.Context, match func(trigger model.AutomationTrigger) (string, bool)) {
+
+	s.mutex.Lock()
+	automations := s.automations
+	s.mutex.Unlock()
+
+	for _, automation := range automations {
+
+		if !automation.Enabled {
+			continue
+		}
+
+		for _, trigger := range automation.Triggers {
+			if description, ok := match(trigger); ok {
+				go s.Execute(ctx, automation, description)
+				break
+			}
+		}
+	}
+}
+
+// Execute checks the conditions of an automation and runs its actions, recording the outcome in its log
+func (s *AutomationsService) Execute(ctx context.Context, automation model.Automation, trigger string) {
+
+	for _, condition := range automation.Conditions {
+		if !s.checkCondition(ctx, condition) {
+			log.Printf("Automation %d (%s): conditions not met for %s\n", automation.Id, automation.Name, trigger)
+			return
+		}
+	}
+
+	log.Printf("Automation %d (%s): running for %s\n", automation.Id, automation.Name, trigger)
+
+	status := model.AutomationSucceeded
+	var message *string
+
+	ownerCtx, err := s.accessService.OwnerContext(ctx, automation.OwnerId)
+
+	if err != nil {
+		text := err.Error()
+		log.Printf("Automation %d (%s): %s\n", automation.Id, automation.Name, text)
+		s.recordLog(ctx, automation, trigger, model.AutomationFailed, &text)
+		return
+	}
+
+	ctx = ownerCtx
+
+	for i, action := range automation.Actions {
+		if err := s.runAction(ctx, automation, action); err != nil {
+			status = model.AutomationFailed
+			text := fmt.Sprintf("action %d (%s): %v", i+1, action.Type, err)
+			message = &text
+			log.Printf("Automation %d (%s): %s\n", automation.Id, automation.Name, text)
+			break
+		}
+	}
+
+	s.recordLog(ctx, automation, trigger, status, message)
+}
+
+func (s *AutomationsService) recordLog(ctx context.Context, automation model.Automation, trigger string, status string, message *string) {
+
+	if _, err := s.automationsRepository.CreateAutomationLog(ctx, automation.Id, trigger, status, message); err != nil {
+		log.Printf("Automation %d (%s): unable to record the run: %v\n", automation.Id, automation.Name, err)
+	}
+}
+
+func (s *AutomationsService) checkCondition(ctx context.Context, condition model.AutomationCondition) bool {
+
+	switch condition.Type {
+
+	case model.ConditionMeasurement:
+		if condition.AreaId == nil || condition.Measurement == nil {
+			return false
+		}
+		value, err := s.reportsService.GetLatestAreaValue(ctx, *condition.Measurement, *condition.AreaId)
+		if err != nil || value == nil {
+			return false
+		}
+		return inRange(*value, condition.Above, condition.Below)
+
+	case model.ConditionTime:
+		now := time.Now().In(s.location)
+		if !matchesWeekday(condition.Weekdays, now) {
+			return false
+		}
+		return inTimeWindow(now, condition.After, condition.Before)
+
+	case model.ConditionState:
+		if condition.IeeeAddress == nil {
+			return false
+		}
+		attribute := "state"
+		if condition.Attribute != nil {
+			attribute = *condition.Attribute
+		}
+		s.mutex.Lock()
+		state := s.deviceStates[*condition.IeeeAddress]
+		s.mutex.Unlock()
+		return state != nil && valuesEqual(condition.Value, state[attribute])
+	}
+
+	return false
+}
+
+func (s *AutomationsService) runAction(ctx context.Context, automation model.Automation, action model.AutomationAction) error {
+
+	ctx = WithOrigin(ctx, automationOrigin(automation.Id))
+
+	switch action.Type {
+
+	case model.ActionDevice:
+		if action.IeeeAddress == nil {
+			return errors.New("device action requires an IEEE address")
+		}
+		device, err := s.devicesService.GetDevice(ctx, *action.IeeeAddress)
+		if err != nil {
+			return err
+		}
+		return s.devicesService.SetDeviceState(ctx, s.mqttClient, device, action.Payload)
+
+	case model.ActionGroup:
+		if action.GroupId == nil {
+			return errors.New("group action requires a group id")
+		}
+		group, err := s.groupsService.GetGroup(ctx, *action.GroupId)
+		if err != nil {
+			return err
+		}
+		return s.groupsService.SetGroupState(ctx, s.mqttClient, group, action.Payload)
+
+	case model.ActionScene:
+		if action.SceneId == nil {
+			return errors.New("scene action requires a scene id")
+		}
+		scene, err := s.scenesService.GetScene(ctx, *action.SceneId)
+		if err != nil {
+			return err
+		}
+		return s.scenesService.RecallScene(ctx, s.mqttClient, scene, action.Transition)
+
+	case model.ActionNotify:
+		notification := events.NotificationEvent{Title: automation.Name, Origin: fmt.Sprintf("automation:%d", automation.Id)}
+		if action.Title != nil {
+			notification.Title = *action.Title
+		}
+		if action.Message != nil {
+			notification.Message = *action.Message
+		}
+		return s.eventBus.Publish(events.NotificationRequested, notification)
+
+	case model.ActionDelay:
+		if action.Delay == nil {
+			return errors.New("delay action requires a duration")
+		}
+		delay, err := time.ParseDuration(*action.Delay)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+			return nil
+		}
+	}
+
+	return errors.New("unknown action type " + action.Type)
+}
+
+func (s *AutomationsService) GetAutomations(ctx context.Context) ([]model.Automation, error) {
+	return s.automationsRepository.GetAutomations(ctx)
+}
+
+func (s *AutomationsService) GetAutomation(ctx context.Context, id uint64) (*model.Automation, error) {
+	return s.automationsRepository.GetAutomation(ctx, id)
+}
+
+func (s *AutomationsService) CreateAutomation(ctx context.Context, automation model.Automation) (*model.Automation, error) {
+
+	if err := ValidateAutomation(automation); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkActions(ctx, automation); err != nil {
+		return nil, err
+	}
+
+	created, err := s.automationsRepository.CreateAutomation(ctx, automation)
+
+	if err == nil {
+		s.publishChanged(created.Id)
+	}
+
+	return created, err
+}
+
+func (s *AutomationsService) UpdateAutomation(ctx context.Context, automation model.Automation) (*model.Automation, error) {
+
+	if err := ValidateAutomation(automation); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkActions(ctx, automation); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.automationsRepository.UpdateAutomation(ctx, automation)
+
+	if err == nil {
+		s.publishChanged(updated.Id)
+	}
+
+	return updated, err
+}
+
+// checkActions refuses to save an automation with actions on devices, groups or scenes the caller could not control directly
+func (s *AutomationsService) checkActions(ctx context.Context, automation model.Automation) error {
+
+	for _, action := range automation.Actions {
+
+		switch action.Type {
+
+		case model.ActionDevice:
+			device, err := s.devicesService.GetDevice(ctx, *action.IeeeAddress)
+			if err != nil {
+				return errors.New("device not found: " + *action.IeeeAddress)
+			}
+			if err := checkAreas(ctx, model.RoleControl, device.FriendlyName, device.AreaId); err != nil {
+				return err
+			}
+
+		case model.ActionGroup:
+			group, err := s.groupsService.GetGroup(ctx, *action.GroupId)
+			if err != nil {
+				return errors.New("group not found")
+			}
+			if err := s.groupsService.CheckGroupAccess(ctx, group, model.RoleControl); err != nil {
+				return err
+			}
+
+		case model.ActionScene:
+			scene, err := s.scenesService.GetScene(ctx, *action.SceneId)
+			if err != nil {
+				return errors.New("scene not found")
+			}
+			if err := s.scenesService.CheckSceneAccess(ctx, scene); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *AutomationsService) DeleteAutomation(ctx context.Context, id uint64) error {
+
+	err := s.automationsRepository.DeleteAutomation(ctx, id)
+
+	if err == nil {
+		s.publishChanged(id)
+	}
+
+	return err
+}
+
+func (s *AutomationsService) GetAutomationLogs(ctx context.Context, id uint64) ([]model.AutomationLog, error) {
+	return s.automationsRepository.GetAutomationLogs(ctx, id, automationLogLimit)
+}
+
+func (s *AutomationsService) publishChanged(id uint64) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(events.AutomationChanged, events.AutomationEvent{AutomationId: id}); err != nil {
+		log.Println("AutomationsService: unable to publish event", err)
+	}
+}
+
+// ValidateAutomation rejects rules the engine could never evaluate, so mistakes surface when saving them
+func ValidateAutomation(automation model.Automation) error {
+
+	if strings.TrimSpace(automation.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	if len(automation.Triggers) == 0 {
+		return errors.New("at least one trigger is required")
+	}
+
+	if len(automation.Actions) == 0 {
+		return errors.New("at least one action is required")
+	}
+
+	for i, trigger := range automation.Triggers {
+		var err error
+
+		switch trigger.Type {
+		case model.TriggerState:
+			if trigger.IeeeAddress == nil {
+				err = errors.New("ieeeAddress is required")
+			}
+		case model.TriggerMeasurement:
+			if trigger.Measurement == nil || (trigger.Above == nil && trigger.Below == nil) {
+				err = errors.New("measurement and above or below are required")
+			}
+		case model.TriggerTime:
+			if trigger.Time == nil {
+				err = errors.New("time is required")
+			} else {
+				err = validateClock(*trigger.Time)
+			}
+		case model.TriggerCron:
+			if trigger.Cron == nil {
+				err = errors.New("cron is required")
+			} else {
+				_, err = cron.Parse(*trigger.Cron)
+			}
+		case model.TriggerAvailability:
+			if trigger.Availability != nil && *trigger.Availability != "online" && *trigger.Availability != "offline" {
+				err = errors.New("availability must be online or offline")
+			}
+		default:
+			err = errors.New("unknown type " + trigger.Type)
+		}
+
+		if err != nil {
+			return fmt.Errorf("trigger %d: %v", i+1, err)
+		}
+	}
+
+	for i, condition := range automation.Conditions {
+		var err error
+
+		switch condition.Type {
+		case model.ConditionMeasurement:
+			if condition.AreaId == nil || condition.Measurement == nil {
+				err = errors.New("areaId and measurement are required")
+			}
+		case model.ConditionTime:
+			for _, value := range []*string{condition.After, condition.Before} {
+				if value != nil && validateClock(*value) != nil {
+					err = validateClock(*value)
+				}
+			}
+		case model.ConditionState:
+			if condition.IeeeAddress == nil {
+				err = errors.New("ieeeAddress is required")
+			}
+		default:
+			err = errors.New("unknown type " + condition.Type)
+		}
+
+		if err != nil {
+			return fmt.Errorf("condition %d: %v", i+1, err)
+		}
+	}
+
+	for i, action := range automation.Actions {
+		var err error
+
+		switch action.Type {
+		case model.ActionDevice:
+			if action.IeeeAddress == nil || len(action.Payload) == 0 {
+				err = errors.New("ieeeAddress and payload are required")
+			}
+		case model.ActionGroup:
+			if action.GroupId == nil || len(action.Payload) == 0 {
+				err = errors.New("groupId and payload are required")
+			}
+		case model.ActionScene:
+			if action.SceneId == nil {
+				err = errors.New("sceneId is required")
+			}
+		case model.ActionNotify:
+			if action.Message == nil {
+				err = errors.New("message is required")
+			}
+		case model.ActionDelay:
+			if action.Delay == nil {
+				err = errors.New("delay is required")
+			} else {
+				_, err = time.ParseDuration(*action.Delay)
+			}
+		default:
+			err = errors.New("unknown type " + action.Type)
+		}
+
+		if err != nil {
+			return fmt.Errorf("action %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// validateClock accepts zero padded 24 hour HH:MM times, the format they are compared in
+func validateClock(value string) error {
+
+	if _, err := time.Parse("15:04", value); err != nil || len(value) != 5 {
+		return fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	return nil
+}
+
+func inRange(value float64, above *float64, below *float64) bool {
+	return (above == nil || value > *above) && (below == nil || value < *below)
+}
+
+func valuesEqual(a interface{}, b interface{}) bool {
+	return strings.EqualFold(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func matchesWeekday(weekdays []int, t time.Time) bool {
+
+	if len(weekdays) == 0 {
+		return true
+	}
+
+	for _, weekday := range weekdays {
+		if time.Weekday(weekday%7) == t.Weekday() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inTimeWindow compares HH:MM bounds against t, a window whose end is before its start wraps past midnight
+func inTimeWindow(t time.Time, after *string, before *string) bool {
+
+	current := t.Format("15:04")
+
+	switch {
+	case after != nil && before != nil && *before < *after:
+		return current >= *after || current < *before
+	case after != nil && before != nil:
+		return current >= *after && current < *before
+	case after != nil:
+		return current >= *after
+	case before != nil:
+		return current < *before
+	}
+
+	return true
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stringRef(value string) *string {
+	return &value
+}
+
+func floatRef(value float64) *float64 {
+	return &value
+}
+
+func idRef(value uint64) *uint64 {
+	return &value
+}
+
+func TestValidateAutomation(t *testing.T) {
+
+	valid := func() model.Automation {
+		return model.Automation{
+			Name:     "Hall light",
+			Triggers: []model.AutomationTrigger{{Type: model.TriggerState, IeeeAddress: stringRef("0x01")}},
+			Actions:  []model.AutomationAction{{Type: model.ActionNotify, Message: stringRef("on")}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(automation *model.Automation)
+		err    string
+	}{
+		{"valid", func(automation *model.Automation) {}, ""},
+		{"blank name", func(automation *model.Automation) { automation.Name = "  " }, "name is required"},
+		{"no triggers", func(automation *model.Automation) { automation.Triggers = nil }, "at least one trigger"},
+		{"no actions", func(automation *model.Automation) { automation.Actions = nil }, "at least one action"},
+		{"state trigger without device", func(automation *model.Automation) {
+			automation.Triggers = []model.AutomationTrigger{{Type: model.TriggerState}}
+		}, "trigger 1: ieeeAddress is required"},
+		{"measurement trigger without bounds", func(automation *model.Automation) {
+			automation.Triggers = []model.AutomationTrigger{{Type: model.TriggerMeasurement, Measurement: stringRef("temperature")}}
+		}, "trigger 1: measurement and above or below"},
+		{"measurement trigger", func(automation *model.Automation) {
+			automation.Triggers = []model.AutomationTrigger{{Type: model.TriggerMeasurement, Measurement: stringRef("temperature"), Below: floatRef(18)}}
+		}, ""},
+		{"unpadded time", func(automation *model.Automation) {
+			automation.Triggers = []model.AutomationTrigger{{Type: model.TriggerTime, Time: stringRef("7:30")}}
+		}, "trigger 1: invalid time"},
+		{"bad cron", func(automation *model.Automation) {
+			automation.Triggers = append(automation.Triggers, model.AutomationTrigger{Type: model.TriggerCron, Cron: stringRef("61 * * * *")})
+		}, "trigger 2:"},
+		{"bad availability", func(automation *model.Automation) {
+			automation.Triggers = []model.AutomationTrigger{{Type: model.TriggerAvailability, Availability: stringRef("away")}}
+		}, "trigger 1: availability must be online or offline"},
+		{"unknown trigger", func(automation *model.Automation) {
+			automation.Triggers = []model.AutomationTrigger{{Type: "sunrise"}}
+		}, "trigger 1: unknown type sunrise"},
+		{"bad condition time", func(automation *model.Automation) {
+			automation.Conditions = []model.AutomationCondition{{Type: model.ConditionTime, After: stringRef("22:00"), Before: stringRef("25:00")}}
+		}, "condition 1: invalid time"},
+		{"measurement condition without area", func(automation *model.Automation) {
+			automation.Conditions = []model.AutomationCondition{{Type: model.ConditionMeasurement, Measurement: stringRef("humidity")}}
+		}, "condition 1: areaId and measurement"},
+		{"device action without payload", func(automation *model.Automation) {
+			automation.Actions = []model.AutomationAction{{Type: model.ActionDevice, IeeeAddress: stringRef("0x01")}}
+		}, "action 1: ieeeAddress and payload"},
+		{"group action", func(automation *model.Automation) {
+			automation.Actions = []model.AutomationAction{{Type: model.ActionGroup, GroupId: idRef(2), Payload: map[string]interface{}{"state": "ON"}}}
+		}, ""},
+		{"bad delay", func(automation *model.Automation) {
+			automation.Actions = append(automation.Actions, model.AutomationAction{Type: model.ActionDelay, Delay: stringRef("soon")})
+		}, "action 2:"},
+	}
+
+	for _, test := range tests {
+
+		automation := valid()
+		test.change(&automation)
+
+		err := ValidateAutomation(automation)
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: ValidateAutomation = %v", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+			t.Errorf("%s: ValidateAutomation = %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestInTimeWindow(t *testing.T) {
+
+	tests := []struct {
+		clock    string
+		after    *string
+		before   *string
+		expected bool
+	}{
+		{"12:00", nil, nil, true},
+		{"07:59", stringRef("08:00"), stringRef("17:00"), false},
+		{"08:00", stringRef("08:00"), stringRef("17:00"), true},
+		{"17:00", stringRef("08:00"), stringRef("17:00"), false},
+		{"23:30", stringRef("22:00"), stringRef("06:00"), true},
+		{"05:59", stringRef("22:00"), stringRef("06:00"), true},
+		{"12:00", stringRef("22:00"), stringRef("06:00"), false},
+		{"21:00", stringRef("20:00"), nil, true},
+		{"19:59", stringRef("20:00"), nil, false},
+		{"06:59", nil, stringRef("07:00"), true},
+		{"07:00", nil, stringRef("07:00"), false},
+	}
+
+	for _, test := range tests {
+
+		now, _ := time.Parse("15:04", test.clock)
+
+		if inWindow := inTimeWindow(now, test.after, test.before); inWindow != test.expected {
+			t.Errorf("inTimeWindow(%s, %s, %s) = %v, expected %v", test.clock, describe(test.after), describe(test.before), inWindow, test.expected)
+		}
+	}
+}
+
+func describe(value *string) string {
+
+	if value == nil {
+		return "none"
+	}
+
+	return *value
+}
+
+func TestMatchesWeekday(t *testing.T) {
+
+	// A Sunday
+	sunday := time.Date(2026, time.January, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		weekdays []int
+		date     time.Time
+		expected bool
+	}{
+		{nil, sunday, true},
+		{[]int{0}, sunday, true},
+		{[]int{7}, sunday, true},
+		{[]int{1, 2, 3, 4, 5}, sunday, false},
+		{[]int{1, 2, 3, 4, 5}, sunday.AddDate(0, 0, 1), true},
+		{[]int{6}, sunday.AddDate(0, 0, -1), true},
+	}
+
+	for _, test := range tests {
+		if matches := matchesWeekday(test.weekdays, test.date); matches != test.expected {
+			t.Errorf("matchesWeekday(%v, %s) = %v, expected %v", test.weekdays, test.date.Weekday(), matches, test.expected)
+		}
+	}
+}
+
+func TestValuesEqual(t *testing.T) {
+
+	tests := []struct {
+		a        interface{}
+		b        interface{}
+		expected bool
+	}{
+		{"ON", "on", true},
+		{"ON", "OFF", false},
+		{true, "true", true},
+		{float64(20), 20, true},
+		{21.5, "21.5", true},
+		{nil, "off", false},
+		{nil, nil, true},
+	}
+
+	for _, test := range tests {
+		if equal := valuesEqual(test.a, test.b); equal != test.expected {
+			t.Errorf("valuesEqual(%#v, %#v) = %v, expected %v", test.a, test.b, equal, test.expected)
+		}
+	}
+}
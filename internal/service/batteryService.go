@@ -0,0 +1,123 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"time"
+)
+
+const (
+	// Battery history used to estimate drain rates
+	batteryProjectionWindow = 60 * 24 * time.Hour
+	// A rise of this many percentage points to at least batteryReplacedLevel means the battery was replaced
+	batteryReplacementJump = 20.0
+	batteryReplacedLevel = 90.0
+)
+
+func NewBatteryService(devicesService *DevicesService, reportsService *ReportsService) *BatteryService {
+	return &BatteryService{devicesService: devicesService, reportsService: reportsService}
+}
+
+type BatteryService struct {
+	devicesService *DevicesService
+	reportsService *ReportsService
+}
+
+// GetBatteryHistory returns the readings of a device between two dates, its replacements and its current drain rate
+func (s *BatteryService) GetBatteryHistory(ctx context.Context, ieeeAddress string, startDate time.Time, endDate time.Time) (*model.BatteryHistory, error) {
+
+	device, err := s.devicesService.GetDevice(ctx, ieeeAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := s.reportsService.GetBatteryReports(ctx, ieeeAddress, startDate, endDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	replacements, err := s.reportsService.GetBatteryReplacements(ctx, ieeeAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The drain rate always reflects recent behaviour, whatever range was asked for
+	now := time.Now().UTC()
+	recent, err := s.reportsService.GetBatteryReports(ctx, ieeeAddress, now.Add(-batteryProjectionWindow), now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.BatteryHistory{
+		DeviceId:     device.IeeeAddress,
+		FriendlyName: device.FriendlyName,
+		Battery:      device.Battery,
+		DrainRate:    BatteryDrainRate(recent),
+		DaysToEmpty:  ProjectDaysToEmpty(recent),
+		Replacements: replacements,
+		Reports:      reports,
+	}, nil
+}
+
+func IsBatteryReplacement(previous float64, current float64) bool {
+	return current-previous >= batteryReplacementJump && current >= batteryReplacedLevel
+}
+
+// BatteryDrainRate fits a line through the readings since the last replacement, returning the percentage points lost per day
+func BatteryDrainRate(reports []model.BatteryReport) *float64 {
+
+	start := 0
+
+	for i := 1; i < len(reports); i++ {
+		if IsBatteryReplacement(reports[i-1].Battery, reports[i].Battery) {
+			start = i
+		}
+	}
+
+	reports = reports[start:]
+
+	if len(reports) < 2 || reports[len(reports)-1].Date.Sub(reports[0].Date) < 24*time.Hour {
+		return nil
+	}
+
+	origin := reports[0].Date
+
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(reports))
+
+	for _, report := range reports {
+		x := report.Date.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += report.Battery
+		sumXY += x * report.Battery
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+
+	if denominator == 0 {
+		return nil
+	}
+
+	rate := -(n*sumXY - sumX*sumY) / denominator
+
+	return &rate
+}
+
+// ProjectDaysToEmpty extrapolates the drain rate from the latest reading down to zero
+func ProjectDaysToEmpty(reports []model.BatteryReport) *float64 {
+
+	rate := BatteryDrainRate(reports)
+
+	if rate == nil || *rate <= 0 {
+		return nil
+	}
+
+	days := reports[len(reports)-1].Battery / *rate
+
+	return &days
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// series makes daily readings starting on the given day, one per level
+func series(day int, levels ...float64) []model.BatteryReport {
+
+	var reports []model.BatteryReport
+
+	for i, level := range levels {
+		reports = append(reports, model.BatteryReport{
+			DeviceId: "0x01",
+			Date:     time.Date(2026, time.January, day+i, 9, 0, 0, 0, time.UTC),
+			Battery:  level,
+		})
+	}
+
+	return reports
+}
+
+func TestIsBatteryReplacement(t *testing.T) {
+
+	tests := []struct {
+		previous float64
+		current  float64
+		expected bool
+	}{
+		{30, 100, true},
+		{75, 95, true},
+		{76, 95, false},
+		{50, 85, false},
+		{100, 100, false},
+		{90, 60, false},
+	}
+
+	for _, test := range tests {
+		if replaced := IsBatteryReplacement(test.previous, test.current); replaced != test.expected {
+			t.Errorf("IsBatteryReplacement(%v, %v) = %v, expected %v", test.previous, test.current, replaced, test.expected)
+		}
+	}
+}
+
+func TestBatteryProjection(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		reports []model.BatteryReport
+		rate    *float64
+		days    *float64
+	}{
+		{"no readings", nil, nil, nil},
+		{"one reading", series(1, 80), nil, nil},
+		{"less than a day", []model.BatteryReport{
+			{Date: time.Date(2026, time.January, 1, 9, 0, 0, 0, time.UTC), Battery: 80},
+			{Date: time.Date(2026, time.January, 1, 21, 0, 0, 0, time.UTC), Battery: 79},
+		}, nil, nil},
+		{"flat", series(1, 80, 80, 80, 80, 80), floatRef(0), nil},
+		{"draining", series(1, 100, 99, 98, 97, 96, 95), floatRef(1), floatRef(95)},
+		{"charging", series(1, 50, 60, 70), floatRef(-10), nil},
+		{"replaced", series(1, 40, 30, 20, 100, 98, 96), floatRef(2), floatRef(48)},
+		{"replaced with one reading since", series(1, 40, 30, 20, 100), nil, nil},
+	}
+
+	for _, test := range tests {
+
+		if rate := BatteryDrainRate(test.reports); !nearly(rate, test.rate) {
+			t.Errorf("%s: BatteryDrainRate = %s, expected %s", test.name, show(rate), show(test.rate))
+		}
+
+		if days := ProjectDaysToEmpty(test.reports); !nearly(days, test.days) {
+			t.Errorf("%s: ProjectDaysToEmpty = %s, expected %s", test.name, show(days), show(test.days))
+		}
+	}
+}
+
+func nearly(a *float64, b *float64) bool {
+
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return math.Abs(*a-*b) < 1e-9
+}
+
+func show(value *float64) string {
+
+	if value == nil {
+		return "none"
+	}
+
+	return strconv.FormatFloat(*value, 'g', -1, 64)
+}
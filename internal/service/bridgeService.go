@@ -0,0 +1,458 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TopicBridgeRequest = broker.TopicRoot + "/bridge/request/"
+	TopicBridgeResponse = broker.TopicRoot + "/bridge/response/"
+	TopicBridgeState = broker.TopicRoot + "/bridge/state"
+	TopicBridgeInfo = broker.TopicRoot + "/bridge/info"
+	TopicBridgeEvent = broker.TopicRoot + "/bridge/event"
+
+	BridgeRequestTimeout = 10 * time.Second
+	// Interviewing and configuring sleepy end devices can take a while
+	BridgeConfigureTimeout = 60 * time.Second
+	// zigbee2mqtt caps permit join at 254 seconds
+	MaxPermitJoinTime = 254
+
+	bridgeWriteQueueSize = 100
+	// A bridge message not recorded in this long is given up on so those behind it still go through
+	bridgeWriteTimeout = 10 * time.Second
+)
+
+var (
+	ErrBridgeTimeout = errors.New("timed out waiting for zigbee2mqtt")
+	ErrInvalidBridgeRequest = errors.New("invalid bridge request")
+)
+
+// BridgeError is an error reported by zigbee2mqtt in a bridge response
+type BridgeError struct {
+	Request string
+	Message string
+}
+
+func (e *BridgeError) Error() string {
+	return e.Request + ": " + e.Message
+}
+
+// NewBridgeService starts a worker recording the bridge messages, so the broker's message handlers never wait on the
+// database
+func NewBridgeService(bridgeRepository repository.IBridgeRepository, devicesService *DevicesService, auditService *AuditService, eventBus events.IEventBus) *BridgeService {
+
+	s := &BridgeService{
+		bridgeRepository: bridgeRepository,
+		auditService: auditService,
+		devicesService: devicesService,
+		eventBus: eventBus,
+		pending: make(map[string]chan model.BridgeResponse),
+		writes: make(chan func(ctx context.Context), bridgeWriteQueueSize),
+	}
+
+	go s.write()
+
+	return s
+}
+
+// BridgeService follows the state of the zigbee2mqtt bridge and wraps its request api, matching each response to its
+// request by transaction id
+type BridgeService struct {
+	bridgeRepository repository.IBridgeRepository
+	devicesService *DevicesService
+	auditService *AuditService
+	eventBus events.IEventBus
+	mqttClient *broker.MqttClient
+
+	mutex sync.Mutex
+	pending map[string]chan model.BridgeResponse
+	writes chan func(ctx context.Context)
+}
+
+func (s *BridgeService) ManageBridge(mqttClient *broker.MqttClient) {
+
+	s.mqttClient = mqttClient
+
+	if token := mqttClient.Conn.Subscribe(TopicBridgeResponse+"#", 0, func(client mqtt.Client, msg mqtt.Message) {
+		s.HandleBridgeResponseMessage(msg)
+	}); token.Wait() && token.Error() != nil {
+		log.Fatalf("ManageBridge: Subscribe error: %s", token.Error())
+		return
+	}
+}
+
+// ManageBridgeEvents records the bridge state, info and events, creating and removing devices as they join and leave
+func (s *BridgeService) ManageBridgeEvents(mqttClient *broker.MqttClient) {
+
+	handlers := map[string]func(ctx context.Context, client mqtt.Client, msg mqtt.Message){
+		TopicBridgeState: s.HandleBridgeStateMessage,
+		TopicBridgeInfo: s.HandleBridgeInfoMessage,
+		TopicBridgeEvent: s.HandleBridgeEventMessage,
+	}
+
+	for topic, handler := range handlers {
+		handler := handler
+		if token := mqttClient.Conn.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+			handler(mqttClient.Ctx, client, msg)
+		}); token.Wait() && token.Error() != nil {
+			log.Fatalf("ManageBridgeEvents: Subscribe error: %s", token.Error())
+			return
+		}
+	}
+}
+
+func (s *BridgeService) HandleBridgeStateMessage(ctx context.Context, client mqtt.Client, msg mqtt.Message) {
+
+	log.Printf("Received bridge state message: %s from topic: %s\n", msg.Payload(), msg.Topic())
+
+	// Older zigbee2mqtt versions publish the bare state rather than an object
+	var object struct {
+		State string `json:"state"`
+	}
+
+	state := string(msg.Payload())
+
+	if err := json.Unmarshal(msg.Payload(), &object); err == nil {
+		state = object.State
+	}
+
+	if state != model.BridgeOnline && state != model.BridgeOffline {
+		log.Println("HandleBridgeStateMessage: unknown state", state)
+		return
+	}
+
+	s.queueWrite(msg.Topic(), func(ctx context.Context) {
+
+		previous, _ := s.bridgeRepository.GetBridge(ctx)
+
+		bridge, err := s.bridgeRepository.UpdateBridgeState(ctx, state)
+
+		if err != nil {
+			return
+		}
+
+		if previous == nil || previous.State != bridge.State {
+			log.Println("Bridge is", bridge.State)
+			s.publishEvent(events.BridgeStateChanged, events.BridgeEvent{Bridge: *bridge})
+		}
+	})
+}
+
+func (s *BridgeService) HandleBridgeInfoMessage(ctx context.Context, client mqtt.Client, msg mqtt.Message) {
+
+	var info struct {
+		Version     *string `json:"version"`
+		Commit      *string `json:"commit"`
+		Coordinator struct {
+			IeeeAddress *string `json:"ieee_address"`
+			Type        *string `json:"type"`
+		} `json:"coordinator"`
+		Network struct {
+			Channel *int `json:"channel"`
+			PanId   *int `json:"pan_id"`
+		} `json:"network"`
+		PermitJoin bool `json:"permit_join"`
+	}
+
+	if err := json.Unmarshal(msg.Payload(), &info); err != nil {
+		log.Println("HandleBridgeInfoMessage:", err)
+		return
+	}
+
+	bridge := model.Bridge{
+		Version: info.Version,
+		Commit: info.Commit,
+		CoordinatorType: info.Coordinator.Type,
+		CoordinatorIeeeAddress: info.Coordinator.IeeeAddress,
+		Channel: info.Network.Channel,
+		PanId: info.Network.PanId,
+		PermitJoin: info.PermitJoin,
+	}
+
+	s.queueWrite(msg.Topic(), func(ctx context.Context) {
+		s.bridgeRepository.UpdateBridgeInfo(ctx, bridge)
+	})
+}
+
+func (s *BridgeService) HandleBridgeEventMessage(ctx context.Context, client mqtt.Client, msg mqtt.Message) {
+
+	log.Printf("Received bridge event message: %s from topic: %s\n", msg.Payload(), msg.Topic())
+
+	var object struct {
+		Type string                 `json:"type"`
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.Unmarshal(msg.Payload(), &object); err != nil {
+		log.Println("HandleBridgeEventMessage:", err)
+		return
+	}
+
+	event := model.BridgeEvent{
+		Date: time.Now().UTC(),
+		Type: object.Type,
+		IeeeAddress: optionalString(object.Data, "ieee_address"),
+		FriendlyName: optionalString(object.Data, "friendly_name"),
+		Data: object.Data,
+	}
+
+	if event.Data == nil {
+		event.Data = make(map[string]interface{})
+	}
+
+	s.queueWrite(msg.Topic(), func(ctx context.Context) {
+		s.recordBridgeEvent(ctx, client, event)
+	})
+}
+
+func (s *BridgeService) recordBridgeEvent(ctx context.Context, client mqtt.Client, event model.BridgeEvent) {
+
+	s.bridgeRepository.CreateBridgeEvent(ctx, event)
+
+	if event.IeeeAddress == nil {
+		return
+	}
+
+	switch event.Type {
+
+	case model.BridgeEventDeviceJoined:
+		friendlyName := *event.IeeeAddress
+		if event.FriendlyName != nil {
+			friendlyName = *event.FriendlyName
+		}
+		if _, err := s.devicesService.HandleDeviceJoined(ctx, client, *event.IeeeAddress, friendlyName); err != nil {
+			log.Println("HandleBridgeEventMessage: unable to create joined device", err)
+		}
+
+	case model.BridgeEventDeviceLeave:
+		if _, err := s.devicesService.HandleDeviceLeft(ctx, client, *event.IeeeAddress); err != nil {
+			log.Println("HandleBridgeEventMessage: unable to remove device", err)
+		}
+	}
+}
+
+func (s *BridgeService) queueWrite(topic string, write func(ctx context.Context)) {
+	select {
+	case s.writes <- write:
+	default:
+		log.Printf("BridgeService: write queue full, dropping the message from %s\n", topic)
+	}
+}
+
+// write records queued bridge messages one at a time, in the order they arrived
+func (s *BridgeService) write() {
+
+	for write := range s.writes {
+		ctx, cancel := context.WithTimeout(context.Background(), bridgeWriteTimeout)
+		write(ctx)
+		cancel()
+	}
+}
+
+func (s *BridgeService) GetBridge(ctx context.Context) (*model.Bridge, error) {
+	return s.bridgeRepository.GetBridge(ctx)
+}
+
+func (s *BridgeService) GetBridgeEvents(ctx context.Context, eventType *string, limit int) ([]model.BridgeEvent, error) {
+	return s.bridgeRepository.GetBridgeEvents(ctx, eventType, limit)
+}
+
+func (s *BridgeService) HandleBridgeResponseMessage(msg mqtt.Message) {
+
+	var response model.BridgeResponse
+
+	if err := json.Unmarshal(msg.Payload(), &response); err != nil {
+		log.Println("HandleBridgeResponseMessage:", err)
+		return
+	}
+
+	// Responses to requests made by other clients carry no transaction we know of
+	if response.Transaction == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	result, ok := s.pending[response.Transaction]
+	delete(s.pending, response.Transaction)
+	s.mutex.Unlock()
+
+	if ok {
+		result <- response
+	}
+}
+
+// Request publishes to bridge/request/<name> and waits for the matching bridge/response/<name>
+func (s *BridgeService) Request(ctx context.Context, name string, payload map[string]interface{}, timeout time.Duration) (response *model.BridgeResponse, err error) {
+
+	defer func() {
+		s.auditService.RecordCommand(ctx, model.AuditBridgeRequest, name, payload, err)
+	}()
+
+	if s.mqttClient == nil {
+		return nil, errors.New("bridge is not being managed")
+	}
+
+	id, err := uuid.NewV4()
+
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := id.String()
+	payload["transaction"] = transaction
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan model.BridgeResponse, 1)
+
+	s.mutex.Lock()
+	s.pending[transaction] = result
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pending, transaction)
+		s.mutex.Unlock()
+	}()
+
+	log.Printf("Bridge request %s: %s\n", name, data)
+
+	if token := s.mqttClient.Conn.Publish(TopicBridgeRequest+name, 0, false, data); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	select {
+	case received := <-result:
+		if received.Status != model.BridgeStatusOk {
+			return &received, &BridgeError{Request: name, Message: received.Error}
+		}
+		return &received, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%s: %w", name, ErrBridgeTimeout)
+	}
+}
+
+// PermitJoin opens the network for joining for the given number of seconds, through one router if a device is given.
+// A time of zero closes the network again.
+func (s *BridgeService) PermitJoin(ctx context.Context, seconds int, device *string) (*model.BridgeResponse, error) {
+
+	if seconds < 0 || seconds > MaxPermitJoinTime {
+		return nil, fmt.Errorf("%w: time must be between 0 and %d seconds", ErrInvalidBridgeRequest, MaxPermitJoinTime)
+	}
+
+	payload := map[string]interface{}{"value": seconds > 0, "time": seconds}
+
+	if device != nil && *device != "" {
+		payload["device"] = *device
+	}
+
+	return s.Request(ctx, "permit_join", payload, BridgeRequestTimeout)
+}
+
+func (s *BridgeService) RenameDevice(ctx context.Context, from string, to string, homeassistantRename bool) (*model.BridgeResponse, error) {
+
+	if strings.TrimSpace(to) == "" {
+		return nil, fmt.Errorf("%w: new name is required", ErrInvalidBridgeRequest)
+	}
+
+	return s.Request(ctx, "device/rename", map[string]interface{}{
+		"from": from,
+		"to": to,
+		"homeassistant_rename": homeassistantRename,
+	}, BridgeRequestTimeout)
+}
+
+// RemoveDevice asks the device to leave the network. Force only deletes it from the database, for devices that no longer respond.
+func (s *BridgeService) RemoveDevice(ctx context.Context, id string, force bool, block bool) (*model.BridgeResponse, error) {
+	return s.Request(ctx, "device/remove", map[string]interface{}{
+		"id": id,
+		"force": force,
+		"block": block,
+	}, BridgeRequestTimeout)
+}
+
+func (s *BridgeService) SetDeviceOptions(ctx context.Context, id string, options map[string]interface{}) (*model.BridgeResponse, error) {
+
+	if len(options) == 0 {
+		return nil, fmt.Errorf("%w: options are required", ErrInvalidBridgeRequest)
+	}
+
+	return s.Request(ctx, "device/options", map[string]interface{}{
+		"id": id,
+		"options": options,
+	}, BridgeRequestTimeout)
+}
+
+// ConfigureDevice re-runs the binding and reporting configuration of a device
+func (s *BridgeService) ConfigureDevice(ctx context.Context, id string) (*model.BridgeResponse, error) {
+	return s.Request(ctx, "device/configure", map[string]interface{}{"id": id}, BridgeConfigureTimeout)
+}
+
+func (s *BridgeService) AddGroup(ctx context.Context, friendlyName string, id *uint64) (*model.BridgeResponse, error) {
+
+	if strings.TrimSpace(friendlyName) == "" {
+		return nil, fmt.Errorf("%w: friendlyName is required", ErrInvalidBridgeRequest)
+	}
+
+	payload := map[string]interface{}{"friendly_name": friendlyName}
+
+	if id != nil {
+		payload["id"] = *id
+	}
+
+	return s.Request(ctx, "group/add", payload, BridgeRequestTimeout)
+}
+
+func (s *BridgeService) RemoveGroup(ctx context.Context, id string, force bool) (*model.BridgeResponse, error) {
+	return s.Request(ctx, "group/remove", map[string]interface{}{
+		"id": id,
+		"force": force,
+	}, BridgeRequestTimeout)
+}
+
+func (s *BridgeService) AddGroupMember(ctx context.Context, group string, device string, endpoint *int) (*model.BridgeResponse, error) {
+	return s.Request(ctx, "group/members/add", groupMemberPayload(group, device, endpoint), BridgeRequestTimeout)
+}
+
+func (s *BridgeService) RemoveGroupMember(ctx context.Context, group string, device string, endpoint *int) (*model.BridgeResponse, error) {
+	return s.Request(ctx, "group/members/remove", groupMemberPayload(group, device, endpoint), BridgeRequestTimeout)
+}
+
+func groupMemberPayload(group string, device string, endpoint *int) map[string]interface{} {
+
+	payload := map[string]interface{}{"group": group, "device": device}
+
+	if endpoint != nil {
+		payload["endpoint"] = *endpoint
+	}
+
+	return payload
+}
+
+func (s *BridgeService) publishEvent(eventType string, payload interface{}) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(eventType, payload); err != nil {
+		log.Println("BridgeService: unable to publish event", eventType, err)
+	}
+}
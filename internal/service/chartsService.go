@@ -0,0 +1,193 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/chart"
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Charts without a bucket are summarised to about this many points whatever their range
+	DefaultChartPoints = 288
+	// Keep a single chart from summarising more than this many buckets per series
+	MaxChartPoints = 10000
+
+	ChartFormatSvg = "svg"
+	ChartFormatPng = "png"
+)
+
+var ErrUnknownMeasurement = errors.New("unknown measurement")
+
+func NewChartsService(reportsService *ReportsService, devicesService *DevicesService, areasService *AreasService) *ChartsService {
+	return &ChartsService{reportsService: reportsService, devicesService: devicesService, areasService: areasService}
+}
+
+type ChartsService struct {
+	reportsService *ReportsService
+	devicesService *DevicesService
+	areasService *AreasService
+}
+
+// DefaultChartBucket is the whole number of minutes that summarises a range to about DefaultChartPoints points
+func DefaultChartBucket(start time.Time, end time.Time) time.Duration {
+
+	bucket := (end.Sub(start) / DefaultChartPoints).Truncate(time.Minute)
+
+	if bucket < time.Minute {
+		return time.Minute
+	}
+
+	return bucket
+}
+
+// GetReportChart summarises a measurement in the areas into a chart with a series for each area, or for each
+// device in them when query.ByDevice is set. The caller must be allowed to view every area.
+func (s *ChartsService) GetReportChart(ctx context.Context, query model.ReportChartQuery) (*chart.Chart, error) {
+
+	unit, ok := MeasurementUnits[query.Measurement]
+
+	if !ok {
+		return nil, ErrUnknownMeasurement
+	}
+
+	if len(query.AreaIds) == 0 {
+		return nil, errors.New("at least one area is required")
+	}
+
+	if !query.EndDate.After(query.StartDate) {
+		return nil, errors.New("the start must be before the end")
+	}
+
+	if query.Bucket == 0 {
+		query.Bucket = DefaultChartBucket(query.StartDate, query.EndDate)
+	}
+
+	if query.Bucket < 0 {
+		return nil, errors.New("the bucket must be positive")
+	}
+
+	if query.EndDate.Sub(query.StartDate)/query.Bucket > MaxChartPoints {
+		return nil, errors.New("the range covers more than " + strconv.Itoa(MaxChartPoints) + " buckets, use a larger bucket")
+	}
+
+	areas, err := s.areasService.GetAreasByIds(ctx, query.AreaIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	areaNames := make(map[uint64]string, len(areas))
+	for _, area := range areas {
+		areaNames[area.Id] = area.Name
+	}
+
+	names := make([]string, 0, len(query.AreaIds))
+	for _, id := range query.AreaIds {
+
+		name, ok := areaNames[id]
+
+		if !ok {
+			return nil, errors.New("area " + strconv.FormatUint(id, 10) + " not found")
+		}
+
+		if err := checkAreas(ctx, model.RoleView, name, &id); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	var buckets []model.ReportBucket
+
+	if query.ByDevice {
+		buckets, err = s.reportsService.GetDeviceReportBuckets(ctx, query.Measurement, query.AreaIds, query.StartDate, query.EndDate, query.Bucket)
+	} else {
+		buckets, err = s.reportsService.GetReportBuckets(ctx, query.Measurement, query.AreaIds, query.StartDate, query.EndDate, query.Bucket)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := s.chartSeries(ctx, query, buckets, areaNames)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &chart.Chart{
+		Title: strings.Join(names, ", ") + " " + query.Measurement,
+		Unit: unit,
+		Start: query.StartDate,
+		End: query.EndDate,
+		Bucket: query.Bucket,
+		Series: series,
+		Width: query.Width,
+		Height: query.Height,
+	}, nil
+}
+
+// chartSeries splits the buckets, which come ordered by area and device, into a series for each, named after the
+// area, the device or both when devices of several areas are drawn
+func (s *ChartsService) chartSeries(ctx context.Context, query model.ReportChartQuery, buckets []model.ReportBucket, areaNames map[uint64]string) ([]chart.Series, error) {
+
+	deviceNames := make(map[string]string)
+
+	if query.ByDevice {
+
+		ieeeAddresses := make([]string, 0)
+		for _, bucket := range buckets {
+			if _, ok := deviceNames[bucket.DeviceId]; !ok {
+				deviceNames[bucket.DeviceId] = bucket.DeviceId
+				ieeeAddresses = append(ieeeAddresses, bucket.DeviceId)
+			}
+		}
+
+		devices, err := s.devicesService.GetDevicesByIeeeAddresses(ctx, ieeeAddresses)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, device := range devices {
+			deviceNames[device.IeeeAddress] = device.FriendlyName
+		}
+	}
+
+	series := make([]chart.Series, 0)
+
+	for i, bucket := range buckets {
+
+		if i == 0 || bucket.AreaId != buckets[i-1].AreaId || bucket.DeviceId != buckets[i-1].DeviceId {
+
+			name := areaNames[bucket.AreaId]
+			if query.ByDevice && len(query.AreaIds) > 1 {
+				name += ": " + deviceNames[bucket.DeviceId]
+			} else if query.ByDevice {
+				name = deviceNames[bucket.DeviceId]
+			}
+
+			series = append(series, chart.Series{Name: name})
+		}
+
+		last := &series[len(series)-1]
+		last.Points = append(last.Points, chart.Point{Time: bucket.Start, Value: bucket.Average, Min: bucket.Min, Max: bucket.Max})
+	}
+
+	return series, nil
+}
+
+// RenderChart writes a chart as ChartFormatSvg or ChartFormatPng
+func (s *ChartsService) RenderChart(w io.Writer, c *chart.Chart, format string) error {
+
+	if format == ChartFormatPng {
+		return chart.RenderPNG(w, *c)
+	}
+
+	return chart.RenderSVG(w, *c)
+}
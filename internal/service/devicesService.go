@@ -2,30 +2,92 @@ package service
 
 import (
 	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/database"
+	"78concepts.com/domicile/internal/events"
 	"78concepts.com/domicile/internal/model"
 	"78concepts.com/domicile/internal/repository"
 	"context"
 	"encoding/json"
 	"errors"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v4"
+	"io/ioutil"
 	"log"
+	"os"
+	"sync"
+	"time"
 )
 
 const (
 	TopicGetDevices = broker.TopicRoot + "/bridge/config/devices/get"
 	TopicDevices = broker.TopicRoot + "/bridge/devices"
+
+	DeviceStateTimeout = 5 * time.Second
+
+	deviceUpdateQueueSize = 1000
+	// A device update not written in this long is given up on so those behind it still go through
+	deviceUpdateTimeout = 10 * time.Second
+	// Device updates are skipped, and a device list sync tried again, after this long once the database is found
+	// unavailable
+	deviceUpdatePause = 30 * time.Second
+	// Syncing the device list makes a few writes for each device that changed
+	deviceSyncTimeout = time.Minute
 )
 
-func NewDevicesService(reportsService *ReportsService, devicesRepository repository.IDevicesRepository) *DevicesService {
-	return &DevicesService{reportsService: reportsService, devicesRepository: devicesRepository}
+// NewDevicesService starts a worker syncing the device list and writing what device messages change about each device,
+// so the broker's message handlers never wait on the database
+func NewDevicesService(reportsService *ReportsService, auditService *AuditService, devicesRepository repository.IDevicesRepository, eventBus events.IEventBus) *DevicesService {
+
+	s := &DevicesService{
+		reportsService: reportsService,
+		auditService: auditService,
+		devicesRepository: devicesRepository,
+		eventBus: eventBus,
+		updates: make(chan deviceUpdate, deviceUpdateQueueSize),
+		syncs: make(chan devicesSync, 1),
+	}
+
+	go s.writeUpdates()
+
+	return s
 }
 
 type DevicesService struct {
 	reportsService *ReportsService
+	auditService *AuditService
 	devicesRepository repository.IDevicesRepository
+	eventBus events.IEventBus
+	stateMutex sync.Mutex
+	states map[string]model.DeviceState
+	availability map[string]bool
+	statesMutex sync.RWMutex
+	updates chan deviceUpdate
+	syncs chan devicesSync
+	// cacheFile keeps the devices subscribed to at the last sync, only read and written by the worker
+	cacheFile string
 }
 
-func (s *DevicesService) ManageDevices(mqttClient *broker.MqttClient) {
+// devicesSync is a device list broadcast by zigbee2mqtt, waiting to be synced with the stored devices
+type devicesSync struct {
+	client mqtt.Client
+	objects []map[string]interface{}
+}
+
+// deviceUpdate is what a device message changes about the device
+type deviceUpdate struct {
+	ieeeAddress string
+	date time.Time
+	linkQuality *int
+	battery *float64
+	voltage *float64
+	update map[string]interface{}
+}
+
+// ManageDevices subscribes to the device list and the devices in it. The devices are kept in cacheFile, when one is
+// given, so their readings are still recorded while the database is unavailable.
+func (s *DevicesService) ManageDevices(mqttClient *broker.MqttClient, cacheFile string) {
+
+	s.cacheFile = cacheFile
 
 	// Publish a message to trigger the broker to broadcast available devices
 	if token := mqttClient.Conn.Publish(TopicGetDevices, 0, false, "{}"); token.Wait() && token.Error() != nil {
@@ -35,7 +97,7 @@ func (s *DevicesService) ManageDevices(mqttClient *broker.MqttClient) {
 	if token := mqttClient.Conn.Subscribe(TopicDevices, 0, func(client mqtt.Client, msg mqtt.Message) {
 		s.HandleDevicesMessage(mqttClient.Ctx, client, msg);
 	}); token.Wait() && token.Error() != nil {
-		log.Fatal("HandleDevices: Subscribe error: %s", token.Error())
+		log.Fatalf("HandleDevices: Subscribe error: %s", token.Error())
 		return
 	}
 }
@@ -49,11 +111,45 @@ func (s *DevicesService) HandleDevicesMessage(ctx context.Context, client mqtt.C
 	err := json.Unmarshal(msg.Payload(), &objects)
 
 	if err != nil {
-		log.Fatal(err)
+		log.Println("HandleDevicesMessage:", err)
+		return
 	}
 
+	sync := devicesSync{client: client, objects: objects}
+
+	// Only the latest list matters, it replaces one still waiting to be synced
+	select {
+	case s.syncs <- sync:
+	default:
+		select {
+		case <-s.syncs:
+		default:
+		}
+		select {
+		case s.syncs <- sync:
+		default:
+		}
+	}
+}
+
+// syncDevices creates, updates and subscribes to the devices in the list, and marks stored devices missing from it
+// as inactive
+func (s *DevicesService) syncDevices(ctx context.Context, client mqtt.Client, objects []map[string]interface{}) error {
+
 	devices, err:= s.GetDevices(ctx)
 
+	// Without the stored devices every one would look new, so the list is synced again later. Until then the devices
+	// known at the last sync are subscribed to, their readings going through the ingest queue to be spooled.
+	if err != nil {
+		log.Println("syncDevices: unable to load devices", err)
+		if database.IsUnavailable(err) {
+			s.subscribeCachedDevices(client, objects)
+		}
+		return err
+	}
+
+	subscribed := make([]model.Device, 0, len(objects))
+
 	for _, object := range objects {
 
 		var found *model.Device
@@ -69,29 +165,49 @@ func (s *DevicesService) HandleDevicesMessage(ctx context.Context, client mqtt.C
 
 			object["active"] = true
 
+			// Devices created from a join event are filled in once zigbee2mqtt has interviewed them
+			if found.Type != nil && *found.Type == model.DeviceTypeUnknown && object["type"] != nil {
+				if device, err := s.UpdateDeviceDefinition(ctx, object); err == nil {
+					found = device
+				}
+			}
+
 			if !found.Active {
 				object["active"] = true
-				s.UpdateDevice(ctx, object)
+				if device, err := s.UpdateDevice(ctx, object); err == nil {
+					s.publishEvent(events.DeviceDiscovered, events.DeviceEvent{Device: *device})
+				}
 			}
 
 			if found.FriendlyName != object["friendly_name"] {
-				s.UpdateDevice(ctx, object)
+				previousFriendlyName := found.FriendlyName
+				if device, err := s.UpdateDevice(ctx, object); err == nil {
+					s.publishEvent(events.DeviceRenamed, events.DeviceEvent{Device: *device, PreviousFriendlyName: &previousFriendlyName})
+					s.auditService.RecordChange(ctx, model.AuditDeviceRenamed, device.IeeeAddress, map[string]string{
+						"from": previousFriendlyName,
+						"to": device.FriendlyName,
+					}, model.AuditOrigin{Type: model.OriginZigbee2mqtt})
+				}
 			}
 
 		} else if object["type"] != "Coordinator" {
 			found, _ = s.CreateDevice(ctx, object)
+
+			if found != nil {
+				s.publishEvent(events.DeviceDiscovered, events.DeviceEvent{Device: *found})
+			}
 		}
 
 		if found != nil {
-			if token := client.Subscribe(broker.TopicRoot+"/"+found.FriendlyName, 0, func(client mqtt.Client, msg mqtt.Message) {
-				s.HandleDeviceMessage(ctx, msg, found);
-			}); token.Wait() && token.Error() != nil {
-				panic(token.Error())
-			}
+			s.recordFirmware(ctx, found, object)
+			s.subscribeDevice(client, found)
+			subscribed = append(subscribed, *found)
 		}
 
 	}
 
+	s.writeDeviceCache(subscribed)
+
 	// If a device in the database is no longer being reported, mark it as inactive
 	for _, device := range devices {
 
@@ -112,9 +228,174 @@ func (s *DevicesService) HandleDevicesMessage(ctx context.Context, client mqtt.C
 				"active":  false,
 			}
 
-			s.UpdateDevice(ctx, object)
+			if updated, err := s.UpdateDevice(ctx, object); err == nil && device.Active {
+				s.publishEvent(events.DeviceRemoved, events.DeviceEvent{Device: *updated})
+			}
+		}
+	}
+
+	return nil
+}
+
+// subscribeCachedDevices subscribes to the devices in the list as they were at the last sync, under the names they
+// have now
+func (s *DevicesService) subscribeCachedDevices(client mqtt.Client, objects []map[string]interface{}) {
+
+	if s.cacheFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(s.cacheFile)
+
+	if os.IsNotExist(err) {
+		return
+	}
+
+	var cached []model.Device
+
+	if err == nil {
+		err = json.Unmarshal(data, &cached)
+	}
+
+	if err != nil {
+		log.Println("DevicesService: unable to read the device cache:", err)
+		return
+	}
+
+	count := 0
+
+	for _, object := range objects {
+		for _, device := range cached {
+
+			if device.IeeeAddress != object["ieee_address"] {
+				continue
+			}
+
+			if friendlyName, ok := object["friendly_name"].(string); ok {
+				device.FriendlyName = friendlyName
+			}
+
+			device := device
+			s.subscribeDevice(client, &device)
+			count++
+			break
 		}
 	}
+
+	log.Printf("DevicesService: subscribed to %d cached devices until the database is available\n", count)
+}
+
+// writeDeviceCache replaces the cache with the devices, through a temporary file so a crash cannot leave it partly
+// written
+func (s *DevicesService) writeDeviceCache(devices []model.Device) {
+
+	if s.cacheFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(devices)
+
+	if err == nil {
+		err = ioutil.WriteFile(s.cacheFile+".tmp", data, 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(s.cacheFile+".tmp", s.cacheFile)
+	}
+
+	if err != nil {
+		log.Println("DevicesService: unable to write the device cache:", err)
+	}
+}
+
+// HandleDeviceJoined creates or reactivates a device as soon as it joins, rather than waiting for the next devices message
+func (s *DevicesService) HandleDeviceJoined(ctx context.Context, client mqtt.Client, ieeeAddress string, friendlyName string) (*model.Device, error) {
+
+	found, err := s.devicesRepository.GetDevice(ctx, ieeeAddress)
+
+	var device *model.Device
+
+	switch {
+	case err == pgx.ErrNoRows:
+		device, err = s.CreateDevice(ctx, map[string]interface{}{
+			"ieee_address": ieeeAddress,
+			"friendly_name": friendlyName,
+			"type": model.DeviceTypeUnknown,
+		})
+	case err != nil:
+		return nil, err
+	case found.Active && found.FriendlyName == friendlyName:
+		return found, nil
+	default:
+		device, err = s.UpdateDevice(ctx, map[string]interface{}{
+			"ieee_address": ieeeAddress,
+			"friendly_name": friendlyName,
+			"active": true,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(events.DeviceDiscovered, events.DeviceEvent{Device: *device})
+	s.subscribeDevice(client, device)
+
+	return device, nil
+}
+
+// HandleDeviceLeft marks a device that left the network as removed
+func (s *DevicesService) HandleDeviceLeft(ctx context.Context, client mqtt.Client, ieeeAddress string) (*model.Device, error) {
+
+	found, err := s.devicesRepository.GetDevice(ctx, ieeeAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found.Active {
+		return found, nil
+	}
+
+	device, err := s.UpdateDevice(ctx, map[string]interface{}{
+		"ieee_address": ieeeAddress,
+		"friendly_name": found.FriendlyName,
+		"active": false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	client.Unsubscribe(broker.TopicRoot+"/"+device.FriendlyName, broker.TopicRoot+"/"+device.FriendlyName+"/availability")
+
+	s.publishEvent(events.DeviceRemoved, events.DeviceEvent{Device: *device})
+
+	return device, nil
+}
+
+// subscribeDevice is called from the devices and bridge event handlers, where waiting for the broker would hold up
+// paho's ordered router that delivers its acknowledgement, so the subscriptions are only checked in the background.
+// The subscriptions outlive whatever made them, so their handlers do not take its context.
+func (s *DevicesService) subscribeDevice(client mqtt.Client, device *model.Device) {
+
+	topic := broker.TopicRoot+"/"+device.FriendlyName
+
+	logSubscribeError(topic, client.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+		s.HandleDeviceMessage(context.Background(), msg, device);
+	}))
+
+	logSubscribeError(topic+"/availability", client.Subscribe(topic+"/availability", 0, func(client mqtt.Client, msg mqtt.Message) {
+		s.HandleDeviceAvailabilityMessage(context.Background(), msg, device);
+	}))
+}
+
+func logSubscribeError(topic string, token mqtt.Token) {
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Unable to subscribe to %s: %v\n", topic, token.Error())
+		}
+	}()
 }
 
 func (s *DevicesService) HandleDeviceMessage(ctx context.Context, msg mqtt.Message, device *model.Device) {
@@ -130,17 +411,37 @@ func (s *DevicesService) HandleDeviceMessage(ctx context.Context, msg mqtt.Messa
 	err := json.Unmarshal(msg.Payload(), &report)
 
 	if err != nil {
-		log.Fatal("DeviceHandler", err)
-		log.Fatal(err)
+		log.Println("DeviceHandler:", err)
+		return
 	}
 
-	if report["battery"] != nil {
-		s.UpdateDeviceBattery(ctx, map[string]interface{}{
-			"ieee_address": device.IeeeAddress,
-			"battery":      report["battery"],
-		})
+	s.publishEvent(events.DeviceStateChanged, events.DeviceStateEvent{
+		IeeeAddress:  device.IeeeAddress,
+		FriendlyName: device.FriendlyName,
+		AreaId:       device.AreaId,
+		State:        report,
+	})
+
+	update := deviceUpdate{ieeeAddress: device.IeeeAddress, date: time.Now().UTC()}
+
+	if value, ok := report["linkquality"].(float64); ok {
+		x := int(value)
+		update.linkQuality = &x
 	}
 
+	if value, ok := report["update"].(map[string]interface{}); ok {
+		update.update = value
+	}
+
+	if value, ok := report["battery"].(float64); ok {
+		update.battery = &value
+		if voltage, ok := report["voltage"].(float64); ok {
+			update.voltage = &voltage
+		}
+	}
+
+	s.queueUpdate(update)
+
 	if device.AreaId == nil {
 		log.Println("DeviceHandler: device does not belong to an area, will not save report")
 		return
@@ -160,53 +461,224 @@ func (s *DevicesService) HandleDeviceMessage(ctx context.Context, msg mqtt.Messa
 	}
 }
 
+// HandleDeviceAvailabilityMessage accepts both the legacy plain "online"/"offline" payload and the JSON {"state": ...} one
+func (s *DevicesService) HandleDeviceAvailabilityMessage(ctx context.Context, msg mqtt.Message, device *model.Device) {
+
+	log.Printf("Received availability message: %s from topic: %s\n", msg.Payload(), msg.Topic())
+
+	state := string(msg.Payload())
+
+	var object map[string]interface{}
+
+	if err := json.Unmarshal(msg.Payload(), &object); err == nil {
+		if value, ok := object["state"].(string); ok {
+			state = value
+		}
+	}
+
+	s.publishEvent(events.DeviceAvailabilityChanged, events.DeviceAvailabilityEvent{
+		IeeeAddress:  device.IeeeAddress,
+		FriendlyName: device.FriendlyName,
+		Available:    state == "online",
+	})
+}
+
+// SetDeviceState publishes a zigbee2mqtt set payload, e.g. {"state": "on", "brightness": 120}, to a device
+// in an area the caller may control
+func (s *DevicesService) SetDeviceState(ctx context.Context, mqttClient *broker.MqttClient, device *model.Device, payload map[string]interface{}) (err error) {
+
+	defer func() {
+		s.auditService.RecordCommand(ctx, model.AuditDeviceSet, device.FriendlyName, payload, err)
+	}()
+
+	if err = checkAreas(ctx, model.RoleControl, device.FriendlyName, device.AreaId); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	if token := mqttClient.Conn.Publish(broker.TopicRoot+"/"+device.FriendlyName+"/set", 0, false, data); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
+// UpdateDeviceArea moves a device to another area, or out of any area when areaId is nil. The caller must be
+// allowed to administer both the area the device is in and the one it moves to.
+func (s *DevicesService) UpdateDeviceArea(ctx context.Context, device *model.Device, areaId *uint64) (*model.Device, error) {
+
+	if err := checkAreas(ctx, model.RoleAdminister, device.FriendlyName, device.AreaId, areaId); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.devicesRepository.UpdateDeviceArea(ctx, device.IeeeAddress, areaId)
+
+	if err == nil {
+		s.auditService.RecordChange(ctx, model.AuditDeviceAreaChanged, device.IeeeAddress, map[string]*uint64{
+			"from": device.AreaId,
+			"to": areaId,
+		}, OriginFromContext(ctx))
+	}
+
+	return updated, err
+}
+
 func (s *DevicesService) RequestDeviceState(mqttClient *broker.MqttClient, friendlyName string) string {
 
-	result := make(chan string, 1)
+	state, err := s.RequestDeviceAttributes(mqttClient, friendlyName, []string{"state"}, DeviceStateTimeout)
 
-	go s.ListenForDeviceState(mqttClient, friendlyName, result)
+	if err != nil {
+		log.Println("RequestDeviceState:", err)
+		return "ERROR"
+	}
 
-	value := <-result
+	value, _ := state["state"].(string)
 
 	return value
 }
 
-func (s *DevicesService) ListenForDeviceState(mqttClient *broker.MqttClient, friendlyName string, result chan string) {
+// RequestDeviceAttributes asks a device to report the given attributes and returns its next state message
+func (s *DevicesService) RequestDeviceAttributes(mqttClient *broker.MqttClient, friendlyName string, attributes []string, timeout time.Duration) (map[string]interface{}, error) {
 
-	if token := mqttClient.Conn.Publish(broker.TopicRoot + "/" + friendlyName + "/get", 0, false, "{\"state\": \"\"}"); token.Wait() && token.Error() != nil {
-		panic(token.Error())
-	}
+	// Requests share the device topic subscription, so only one may wait on it at a time
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	topic := broker.TopicRoot + "/" + friendlyName
+	result := make(chan map[string]interface{}, 1)
 
-	if token := mqttClient.Conn.Subscribe(broker.TopicRoot + "/" + friendlyName, 0, func(client mqtt.Client, msg mqtt.Message) {
+	if token := mqttClient.Conn.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
 
 		var object map[string]interface{}
-		err := json.Unmarshal(msg.Payload(), &object)
-		if err == nil {
-			result <- object["state"].(string)
-		} else {
-			result <- "ERROR"
-		}
 
-		close(result)
+		if err := json.Unmarshal(msg.Payload(), &object); err != nil {
+			return
+		}
 
-		return
+		select {
+		case result <- object:
+		default:
+		}
 
 	}); token.Wait() && token.Error() != nil {
-		log.Println(token)
-		log.Fatal("HandleDevices: Subscribe error: %s", token.Error())
+		return nil, token.Error()
+	}
 
-		close(result)
+	defer mqttClient.Conn.Unsubscribe(topic)
 
-		return
+	request := make(map[string]string)
+	for _, attribute := range attributes {
+		request[attribute] = ""
+	}
+
+	payload, _ := json.Marshal(request)
+
+	if token := mqttClient.Conn.Publish(topic+"/get", 0, false, payload); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	select {
+	case object := <-result:
+		return object, nil
+	case <-time.After(timeout):
+		return nil, errors.New("timed out waiting for state of " + friendlyName)
+	}
+}
+
+// TrackDeviceStates keeps the last state and availability each device reported on the event bus, so processes
+// that do not handle device messages themselves can answer GetDeviceState and GetDeviceAvailability without
+// asking the devices
+func (s *DevicesService) TrackDeviceStates() {
+
+	s.statesMutex.Lock()
+	s.states = make(map[string]model.DeviceState)
+	s.availability = make(map[string]bool)
+	s.statesMutex.Unlock()
+
+	err := s.eventBus.Subscribe(func(ctx context.Context, event events.Event) {
+
+		if event.Type == events.DeviceAvailabilityChanged {
+
+			var payload events.DeviceAvailabilityEvent
+
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				log.Println("TrackDeviceStates: Unable to decode event", err)
+				return
+			}
+
+			s.statesMutex.Lock()
+			s.availability[payload.IeeeAddress] = payload.Available
+			s.statesMutex.Unlock()
+
+			return
+		}
+
+		var payload events.DeviceStateEvent
+
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			log.Println("TrackDeviceStates: Unable to decode event", err)
+			return
+		}
+
+		s.statesMutex.Lock()
+		s.states[payload.IeeeAddress] = model.DeviceState{IeeeAddress: payload.IeeeAddress, Date: event.Date, State: payload.State}
+		s.statesMutex.Unlock()
+
+	}, events.DeviceStateChanged, events.DeviceAvailabilityChanged)
+
+	if err != nil {
+		log.Fatalf("TrackDeviceStates: Subscribe error: %s", err)
+	}
+}
+
+// GetDeviceState returns the last state the device reported since TrackDeviceStates was called, or nil
+func (s *DevicesService) GetDeviceState(ieeeAddress string) *model.DeviceState {
+
+	s.statesMutex.RLock()
+	defer s.statesMutex.RUnlock()
+
+	if state, ok := s.states[ieeeAddress]; ok {
+		return &state
+	}
+
+	return nil
+}
+
+// GetDeviceAvailability returns whether the device was last reported online since TrackDeviceStates was called,
+// or nil if zigbee2mqtt has not reported its availability
+func (s *DevicesService) GetDeviceAvailability(ieeeAddress string) *bool {
+
+	s.statesMutex.RLock()
+	defer s.statesMutex.RUnlock()
+
+	if available, ok := s.availability[ieeeAddress]; ok {
+		return &available
 	}
 
-	return
+	return nil
 }
 
 func (s *DevicesService) GetDevices(ctx context.Context) ([]model.Device, error) {
 	return s.devicesRepository.GetDevices(ctx)
 }
 
+func (s *DevicesService) GetDevice(ctx context.Context, ieeeAddress string) (*model.Device, error) {
+	return s.devicesRepository.GetDevice(ctx, ieeeAddress)
+}
+
+func (s *DevicesService) GetDevicesByAreas(ctx context.Context, areaIds []uint64) ([]model.Device, error) {
+	return s.devicesRepository.GetDevicesByAreas(ctx, areaIds)
+}
+
+func (s *DevicesService) GetDevicesByIeeeAddresses(ctx context.Context, ieeeAddresses []string) ([]model.Device, error) {
+	return s.devicesRepository.GetDevicesByIeeeAddresses(ctx, ieeeAddresses)
+}
+
 func (s *DevicesService) CreateDevice(ctx context.Context, object map[string]interface{}) (*model.Device, error) {
 
 	if object == nil {
@@ -275,6 +747,188 @@ func (s *DevicesService) UpdateDevice(ctx context.Context, object map[string]int
 	)
 }
 
+func (s *DevicesService) UpdateDeviceDefinition(ctx context.Context, object map[string]interface{}) (*model.Device, error) {
+
+	if object == nil {
+		return nil, errors.New("UpdateDeviceDefinition: Object is null")
+	}
+
+	deviceType, _ := object["type"].(string)
+
+	return s.devicesRepository.UpdateDeviceDefinition(
+		ctx,
+		object["ieee_address"].(string),
+		optionalString(object, "date_code"),
+		optionalString(object, "manufacturer"),
+		optionalString(object, "model_id"),
+		deviceType,
+	)
+}
+
+// recordFirmware keeps the reported firmware of a device, adding to its firmware history when it changes
+func (s *DevicesService) recordFirmware(ctx context.Context, device *model.Device, object map[string]interface{}) {
+
+	softwareBuildId := optionalString(object, "software_build_id")
+	dateCode := optionalString(object, "date_code")
+
+	if softwareBuildId == nil && dateCode == nil {
+		return
+	}
+
+	if equalStrings(softwareBuildId, device.SoftwareBuildId) && equalStrings(dateCode, device.DateCode) {
+		return
+	}
+
+	// The first firmware seen for a device is not a change, it was only never stored
+	if device.SoftwareBuildId != nil {
+		log.Printf("Firmware of %s changed from %v to %v\n", device.FriendlyName, *device.SoftwareBuildId, softwareBuildId)
+
+		err := s.devicesRepository.CreateFirmwareChange(ctx, model.FirmwareChange{
+			DeviceId: device.IeeeAddress,
+			Date: time.Now().UTC(),
+			PreviousSoftwareBuildId: device.SoftwareBuildId,
+			PreviousDateCode: device.DateCode,
+			SoftwareBuildId: softwareBuildId,
+			DateCode: dateCode,
+		})
+
+		// Left as it was, so the change is recorded with the next device list
+		if err != nil {
+			log.Printf("DevicesService: unable to record the firmware change of %s: %v\n", device.FriendlyName, err)
+			return
+		}
+	}
+
+	updated, err := s.devicesRepository.UpdateDeviceFirmware(ctx, device.IeeeAddress, softwareBuildId, dateCode)
+
+	if err != nil {
+		log.Printf("DevicesService: unable to update the firmware of %s: %v\n", device.FriendlyName, err)
+		return
+	}
+
+	*device = *updated
+}
+
+func (s *DevicesService) queueUpdate(update deviceUpdate) {
+	select {
+	case s.updates <- update:
+	default:
+		log.Printf("DevicesService: update queue full, dropping the update of %s\n", update.ieeeAddress)
+	}
+}
+
+// writeUpdates syncs device lists and writes queued device updates, one at a time. While the database is unavailable
+// updates are skipped, as a device's next message brings it up to date again, but battery readings still go through
+// the ingest queue to be spooled.
+func (s *DevicesService) writeUpdates() {
+
+	var pausedUntil time.Time
+
+	// The last device list, synced again when retry fires
+	var pending devicesSync
+	var retry <-chan time.Time
+
+	for {
+		var update deviceUpdate
+
+		select {
+		case pending = <-s.syncs:
+			retry = s.runSync(pending)
+			continue
+		case <-retry:
+			retry = s.runSync(pending)
+			continue
+		case update = <-s.updates:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), deviceUpdateTimeout)
+
+		if update.battery != nil {
+			if err := s.reportsService.RecordBatteryReport(ctx, update.ieeeAddress, *update.battery, update.voltage); err != nil {
+				log.Printf("DevicesService: unable to record the battery of %s: %v\n", update.ieeeAddress, err)
+			}
+		}
+
+		if time.Now().After(pausedUntil) {
+			if err := s.writeUpdate(ctx, update); database.IsUnavailable(err) {
+				log.Printf("DevicesService: database unavailable, skipping device updates for %s: %v\n", deviceUpdatePause, err)
+				pausedUntil = time.Now().Add(deviceUpdatePause)
+			}
+		}
+
+		cancel()
+	}
+}
+
+// runSync syncs a device list, returning when to try again if the database is unavailable
+func (s *DevicesService) runSync(sync devicesSync) <-chan time.Time {
+
+	ctx, cancel := context.WithTimeout(context.Background(), deviceSyncTimeout)
+	defer cancel()
+
+	if err := s.syncDevices(ctx, sync.client, sync.objects); !database.IsUnavailable(err) {
+		return nil
+	}
+
+	log.Printf("DevicesService: database unavailable, syncing the device list again in %s\n", deviceUpdatePause)
+
+	return time.After(deviceUpdatePause)
+}
+
+func (s *DevicesService) writeUpdate(ctx context.Context, update deviceUpdate) error {
+
+	if err := s.devicesRepository.UpdateDeviceLastSeen(ctx, update.ieeeAddress, update.date, update.linkQuality); err != nil {
+		return err
+	}
+
+	if update.update != nil {
+		if err := s.updateDeviceUpdateState(ctx, update.ieeeAddress, update.update); err != nil {
+			return err
+		}
+	}
+
+	if update.battery != nil {
+		if _, err := s.devicesRepository.UpdateDeviceBattery(ctx, update.ieeeAddress, *update.battery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateDeviceUpdateState stores the progress reported in the update attribute of a device's state
+func (s *DevicesService) updateDeviceUpdateState(ctx context.Context, ieeeAddress string, update map[string]interface{}) error {
+
+	state, ok := update["state"].(string)
+
+	if !ok {
+		return nil
+	}
+
+	var progress *float64
+	var remaining *int
+
+	if state == model.UpdateStateUpdating {
+		if value, ok := update["progress"].(float64); ok {
+			progress = &value
+		}
+		if value, ok := update["remaining"].(float64); ok {
+			x := int(value)
+			remaining = &x
+		}
+	}
+
+	return s.devicesRepository.UpdateDeviceUpdateState(ctx, ieeeAddress, state, progress, remaining)
+}
+
+func (s *DevicesService) UpdateDeviceUpdateState(ctx context.Context, ieeeAddress string, state string) error {
+	return s.devicesRepository.UpdateDeviceUpdateState(ctx, ieeeAddress, state, nil, nil)
+}
+
+func (s *DevicesService) GetFirmwareHistory(ctx context.Context, ieeeAddress string) ([]model.FirmwareChange, error) {
+	return s.devicesRepository.GetFirmwareHistory(ctx, ieeeAddress)
+}
+
 func (s *DevicesService) UpdateDeviceBattery(ctx context.Context, object map[string]interface{}) (*model.Device, error) {
 
 	if object == nil {
@@ -295,3 +949,27 @@ func (s *DevicesService) UpdateDeviceBattery(ctx context.Context, object map[str
 		return nil, errors.New("Battery not found")
 	}
 }
+
+func (s *DevicesService) publishEvent(eventType string, payload interface{}) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(eventType, payload); err != nil {
+		log.Println("DevicesService: unable to publish event", eventType, err)
+	}
+}
+
+func optionalString(object map[string]interface{}, key string) *string {
+
+	if value, ok := object[key].(string); ok {
+		return &value
+	}
+
+	return nil
+}
+
+func equalStrings(a *string, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"encoding/json"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgconn"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storedDevices answers GetDevices, failing with err when it is set
+type storedDevices struct {
+	repository.IDevicesRepository
+	devices []model.Device
+	err     error
+}
+
+func (r *storedDevices) GetDevices(ctx context.Context) ([]model.Device, error) {
+	return r.devices, r.err
+}
+
+// subscribingClient keeps the handler of every topic subscribed to
+type subscribingClient struct {
+	mqtt.Client
+	handlers map[string]mqtt.MessageHandler
+}
+
+func (c *subscribingClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.handlers[topic] = callback
+	return doneToken{}
+}
+
+func (c *subscribingClient) topics() string {
+
+	topics := make([]string, 0, len(c.handlers))
+	for topic := range c.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	return strings.Join(topics, ", ")
+}
+
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Done() <-chan struct{}          { done := make(chan struct{}); close(done); return done }
+func (doneToken) Error() error                   { return nil }
+
+type deviceMessage struct {
+	mqtt.Message
+	payload string
+}
+
+func (m deviceMessage) Topic() string   { return "" }
+func (m deviceMessage) Payload() []byte { return []byte(m.payload) }
+
+// publishedEvents keeps the payloads published on the bus
+type publishedEvents struct {
+	payloads []interface{}
+}
+
+func (b *publishedEvents) Publish(eventType string, payload interface{}) error {
+	b.payloads = append(b.payloads, payload)
+	return nil
+}
+
+func (b *publishedEvents) Subscribe(handler events.Handler, eventTypes ...string) error {
+	return nil
+}
+
+func TestSyncDevicesFromCache(t *testing.T) {
+
+	cacheFile := filepath.Join(t.TempDir(), "devices.json")
+
+	kitchen := model.Device{IeeeAddress: "0x01", FriendlyName: "Kitchen sensor", AreaId: idRef(3), Active: true}
+	shed := model.Device{IeeeAddress: "0x02", FriendlyName: "Shed sensor", AreaId: idRef(5), Active: true}
+
+	stored := &storedDevices{devices: []model.Device{kitchen, shed}}
+	s := &DevicesService{devicesRepository: stored, cacheFile: cacheFile}
+
+	client := &subscribingClient{handlers: map[string]mqtt.MessageHandler{}}
+
+	err := s.syncDevices(context.Background(), client, []map[string]interface{}{
+		{"ieee_address": "0x01", "friendly_name": "Kitchen sensor"},
+		{"ieee_address": "0x02", "friendly_name": "Shed sensor"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(cacheFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cached []model.Device
+
+	if err := json.Unmarshal(data, &cached); err != nil || len(cached) != 2 || *cached[1].AreaId != 5 {
+		t.Fatalf("cached %s, %v", data, err)
+	}
+
+	// The database is down when the controller restarts, by which time the kitchen sensor has been renamed, the shed
+	// sensor has left and a new device joined
+	stored.err = &pgconn.PgError{Code: "57P03"}
+	client = &subscribingClient{handlers: map[string]mqtt.MessageHandler{}}
+
+	err = s.syncDevices(context.Background(), client, []map[string]interface{}{
+		{"ieee_address": "0x01", "friendly_name": "Kitchen"},
+		{"ieee_address": "0x03", "friendly_name": "Porch light"},
+	})
+
+	if err == nil {
+		t.Fatal("synced without the database")
+	}
+
+	if topics := client.topics(); topics != "zigbee2mqtt/Kitchen, zigbee2mqtt/Kitchen/availability" {
+		t.Fatalf("subscribed to %s", topics)
+	}
+
+	bus := &publishedEvents{}
+	s.eventBus = bus
+
+	client.handlers["zigbee2mqtt/Kitchen"](client, deviceMessage{payload: `{"linkquality": 80}`})
+
+	if len(bus.payloads) != 1 {
+		t.Fatalf("published %d events, expected 1", len(bus.payloads))
+	}
+
+	if event := bus.payloads[0].(events.DeviceStateEvent); event.FriendlyName != "Kitchen" || event.AreaId == nil || *event.AreaId != 3 {
+		t.Errorf("state of %s in area %v, expected Kitchen in area 3", event.FriendlyName, event.AreaId)
+	}
+
+	// Any other failure is not waited out with the cache
+	stored.err = &pgconn.PgError{Code: "42P01"}
+	client = &subscribingClient{handlers: map[string]mqtt.MessageHandler{}}
+
+	if err := s.syncDevices(context.Background(), client, []map[string]interface{}{{"ieee_address": "0x01", "friendly_name": "Kitchen"}}); err == nil || len(client.handlers) != 0 {
+		t.Errorf("subscribed to %s after %v", client.topics(), err)
+	}
+}
+
+func TestRunSyncRetries(t *testing.T) {
+
+	stored := &storedDevices{err: &pgconn.PgError{Code: "08006"}}
+	s := &DevicesService{devicesRepository: stored}
+
+	sync := devicesSync{client: &subscribingClient{handlers: map[string]mqtt.MessageHandler{}}}
+
+	if retry := s.runSync(sync); retry == nil {
+		t.Error("no retry while the database is unavailable")
+	}
+
+	stored.err = nil
+
+	if retry := s.runSync(sync); retry != nil {
+		t.Error("retrying a sync that succeeded")
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/events"
 	"78concepts.com/domicile/internal/model"
 	"78concepts.com/domicile/internal/repository"
 	"context"
@@ -15,12 +16,14 @@ const (
 	TopicGroups = broker.TopicRoot + "/bridge/groups"
 )
 
-func NewGroupsService(groupsRepository repository.IGroupsRepository) *GroupsService {
-	return &GroupsService{groupsRepository: groupsRepository}
+func NewGroupsService(auditService *AuditService, groupsRepository repository.IGroupsRepository, eventBus events.IEventBus) *GroupsService {
+	return &GroupsService{auditService: auditService, groupsRepository: groupsRepository, eventBus: eventBus}
 }
 
 type GroupsService struct {
+	auditService *AuditService
 	groupsRepository repository.IGroupsRepository
+	eventBus events.IEventBus
 }
 
 func (s *GroupsService) ManageGroups(mqttClient *broker.MqttClient) {
@@ -28,7 +31,7 @@ func (s *GroupsService) ManageGroups(mqttClient *broker.MqttClient) {
 	if token := mqttClient.Conn.Subscribe(TopicGroups, 0, func(client mqtt.Client, msg mqtt.Message) {
 		s.HandleGroupsMessage(mqttClient.Ctx, msg);
 	}); token.Wait() && token.Error() != nil {
-		log.Fatal("HandleGroups: Subscribe error: %s", token.Error())
+		log.Fatalf("HandleGroups: Subscribe error: %s", token.Error())
 		return
 	}
 }
@@ -42,11 +45,18 @@ func (s *GroupsService) HandleGroupsMessage(ctx context.Context, msg mqtt.Messag
 	err := json.Unmarshal(msg.Payload(), &objects)
 
 	if err != nil {
-		log.Fatal(err)
+		log.Println("HandleGroupsMessage:", err)
+		return
 	}
 
 	groups, err:= s.GetGroups(ctx)
 
+	// Without the stored groups every reported one would look new and every stored one gone
+	if err != nil {
+		log.Println("HandleGroupsMessage: unable to get groups, skipping the message:", err)
+		return
+	}
+
 	for _, object := range objects {
 
 		var found *model.Group
@@ -58,6 +68,8 @@ func (s *GroupsService) HandleGroupsMessage(ctx context.Context, msg mqtt.Messag
 			}
 		}
 
+		changed := false
+
 		if found != nil {
 
 			object["active"] = true
@@ -65,17 +77,28 @@ func (s *GroupsService) HandleGroupsMessage(ctx context.Context, msg mqtt.Messag
 			if !found.Active {
 				object["active"] = true
 				s.UpdateGroup(ctx, object)
+				changed = true
 			}
 
 			if found.FriendlyName != object["friendly_name"] {
 				s.UpdateGroup(ctx, object)
+				changed = true
 			}
 
 		} else {
 			found, _ = s.CreateGroup(ctx, object)
+			changed = true
+		}
+
+		if s.HandleGroupsMembersMessage(ctx, found, object["members"].([]interface{})) {
+			changed = true
 		}
 
-		s.HandleGroupsMembersMessage(ctx, found, object["members"].([]interface{}))
+		if found != nil && changed {
+			if group, err := s.GetGroup(ctx, found.Id); err == nil {
+				s.publishEvent(events.GroupChanged, events.GroupEvent{Group: *group})
+			}
+		}
 	}
 
 	// If a group in the database is no longer being reported, mark it as inactive
@@ -93,23 +116,34 @@ func (s *GroupsService) HandleGroupsMessage(ctx context.Context, msg mqtt.Messag
 		if found == nil {
 
 			object := map[string]interface{} {
-				"id":  group.Id,
+				"id":  float64(group.Id),
 				"friendly_name":  group.FriendlyName,
 				"active":  false,
 			}
 
-			s.UpdateGroup(ctx, object)
+			if updated, err := s.UpdateGroup(ctx, object); err == nil && group.Active {
+				s.publishEvent(events.GroupChanged, events.GroupEvent{Group: *updated})
+			}
 		}
 	}
 }
 
-func (s *GroupsService) HandleGroupsMembersMessage(ctx context.Context, group *model.Group, objects []interface{}) {
+// HandleGroupsMembersMessage reconciles the stored members of a group, returning whether they changed
+func (s *GroupsService) HandleGroupsMembersMessage(ctx context.Context, group *model.Group, objects []interface{}) bool {
 
 	if group == nil {
-		return
+		return false
+	}
+
+	changed := false
+
+	groupMembers, err := s.GetGroupMembers(ctx, group.Id)
+
+	if err != nil {
+		log.Printf("HandleGroupsMembersMessage: unable to get the members of group %d, skipping them: %v\n", group.Id, err)
+		return false
 	}
 
-	groupMembers, _ := s.GetGroupMembers(ctx, group.Id)
 	for _, object := range objects {
 
 		var found *model.GroupMember
@@ -123,6 +157,7 @@ func (s *GroupsService) HandleGroupsMembersMessage(ctx context.Context, group *m
 
 		if found == nil {
 			found, _ = s.CreateGroupMember(ctx, group.Id, object.(map[string]interface{})["ieee_address"].(string))
+			changed = true
 		}
 	}
 
@@ -141,40 +176,88 @@ func (s *GroupsService) HandleGroupsMembersMessage(ctx context.Context, group *m
 
 		if found == nil {
 			s.DeleteGroupMember(ctx, groupMember.GroupId, groupMember.IeeeAddress)
+			changed = true
 		}
 	}
+
+	return changed
 }
 
-func (s *GroupsService) TurnGroupOn(mqttClient *broker.MqttClient, group *model.Group) {
-	payload := "{\"state\": \"on\"}"
+func (s *GroupsService) TurnGroupOn(ctx context.Context, mqttClient *broker.MqttClient, group *model.Group) error {
+	return s.SetGroupState(ctx, mqttClient, group, map[string]interface{}{"state": "on"})
+}
 
-	if token := mqttClient.Conn.Publish(broker.TopicRoot + "/" + group.FriendlyName + "/set", 0, false, payload); token.Wait() && token.Error() != nil {
-		panic(token.Error())
-	}
+func (s *GroupsService) TurnGroupOff(ctx context.Context, mqttClient *broker.MqttClient, group *model.Group) error {
+	return s.SetGroupState(ctx, mqttClient, group, map[string]interface{}{"state": "off"})
 }
 
-func (s *GroupsService) TurnGroupOff(mqttClient *broker.MqttClient, group *model.Group) {
+// SetGroupState publishes a zigbee2mqtt set payload to a group, which zigbee2mqtt broadcasts to its members.
+// The caller must be allowed to control every member's area.
+func (s *GroupsService) SetGroupState(ctx context.Context, mqttClient *broker.MqttClient, group *model.Group, payload map[string]interface{}) (err error) {
+
+	defer func() {
+		s.auditService.RecordCommand(ctx, model.AuditGroupSet, group.FriendlyName, payload, err)
+	}()
+
+	if err = s.CheckGroupAccess(ctx, group, model.RoleControl); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	if token := mqttClient.Conn.Publish(broker.TopicRoot+"/"+group.FriendlyName+"/set", 0, false, data); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
 
-	payload := "{\"state\": \"off\"}"
+// CheckGroupAccess returns ErrForbidden unless the access in the context grants role in the areas of all the group's members
+func (s *GroupsService) CheckGroupAccess(ctx context.Context, group *model.Group, role string) error {
 
-	if token := mqttClient.Conn.Publish(broker.TopicRoot + "/" + group.FriendlyName + "/set", 0, false, payload); token.Wait() && token.Error() != nil {
-		panic(token.Error())
+	areaIds := make([]*uint64, 0, len(group.Members))
+	for _, member := range group.Members {
+		areaIds = append(areaIds, member.AreaId)
 	}
+
+	return checkAreas(ctx, role, group.FriendlyName, areaIds...)
 }
 
 func (s *GroupsService) GetGroups(ctx context.Context) ([]model.Group, error) {
 	groups, err := s.groupsRepository.GetGroups(ctx)
 
-	if err == nil {
-		for i, group := range groups {
-			members, err := s.groupsRepository.GetGroupMembers(ctx, group.Id)
-			if err == nil {
-				groups[i].Members = members
-			}
+	if err != nil || len(groups) == 0 {
+		return groups, err
+	}
+
+	ids := make([]uint64, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.Id)
+	}
+
+	members, err := s.groupsRepository.GetGroupsMembers(ctx, ids)
+
+	if err != nil {
+		return groups, nil
+	}
+
+	byGroup := make(map[uint64][]model.GroupMember, len(groups))
+	for _, member := range members {
+		byGroup[member.GroupId] = append(byGroup[member.GroupId], member)
+	}
+
+	for i, group := range groups {
+		groups[i].Members = byGroup[group.Id]
+		if groups[i].Members == nil {
+			groups[i].Members = make([]model.GroupMember, 0)
 		}
 	}
 
-	return groups, err
+	return groups, nil
 }
 
 func (s *GroupsService) GetGroup(ctx context.Context, id uint64) (*model.Group, error) {
@@ -222,6 +305,11 @@ func (s *GroupsService) GetGroupMembers(ctx context.Context, id uint64) ([]model
 	return s.groupsRepository.GetGroupMembers(ctx, id)
 }
 
+// GetGroupsMembers returns the members of all the groups at once
+func (s *GroupsService) GetGroupsMembers(ctx context.Context, ids []uint64) ([]model.GroupMember, error) {
+	return s.groupsRepository.GetGroupsMembers(ctx, ids)
+}
+
 func (s *GroupsService) CreateGroupMember(ctx context.Context, id uint64, ieeeAddress string) (*model.GroupMember, error) {
 	return s.groupsRepository.CreateGroupMember(ctx, id, ieeeAddress)
 }
@@ -229,3 +317,14 @@ func (s *GroupsService) CreateGroupMember(ctx context.Context, id uint64, ieeeAd
 func (s *GroupsService) DeleteGroupMember(ctx context.Context, id uint64, ieeeAddress string) (error) {
 	return s.groupsRepository.DeleteGroupMember(ctx, id, ieeeAddress)
 }
+
+func (s *GroupsService) publishEvent(eventType string, payload interface{}) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(eventType, payload); err != nil {
+		log.Println("GroupsService: unable to publish event", eventType, err)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/importer"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultImportBatchSize is how many readings of a measurement are checked for duplicates and copied at once
+const DefaultImportBatchSize = 5000
+
+type ImportOptions struct {
+	BatchSize int
+	// DryRun validates and checks for duplicates without loading anything
+	DryRun bool
+	// Progress is called with the totals after each batch
+	Progress func(progress model.ImportProgress)
+	// Rejected is called with each reading that is skipped as invalid
+	Rejected func(line int, err error)
+}
+
+func NewImportService(reportsRepository repository.IReportsRepository, devicesRepository repository.IDevicesRepository, areasRepository repository.IAreasRepository) *ImportService {
+	return &ImportService{reportsRepository: reportsRepository, devicesRepository: devicesRepository, areasRepository: areasRepository}
+}
+
+type ImportService struct {
+	reportsRepository repository.IReportsRepository
+	devicesRepository repository.IDevicesRepository
+	areasRepository repository.IAreasRepository
+}
+
+// ImportReports loads the readings of the reader in batches, skipping invalid readings and those already reported
+// by the same device at the same time. A dry run can only spot duplicates of readings in the database or in the
+// same batch, as the batches before are never loaded.
+func (s *ImportService) ImportReports(ctx context.Context, reader importer.Reader, options ImportOptions) (model.ImportProgress, error) {
+
+	var progress model.ImportProgress
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultImportBatchSize
+	}
+
+	devices, err := s.devicesRepository.GetDevices(ctx)
+
+	if err != nil {
+		return progress, err
+	}
+
+	devicesByAddress := make(map[string]model.Device, len(devices))
+	for _, device := range devices {
+		devicesByAddress[device.IeeeAddress] = device
+	}
+
+	areas, err := s.areasRepository.GetAreas(ctx)
+
+	if err != nil {
+		return progress, err
+	}
+
+	areaIds := make(map[uint64]bool, len(areas))
+	for _, area := range areas {
+		areaIds[area.Id] = true
+	}
+
+	batches := make(map[string][]model.Report)
+
+	for {
+
+		row, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		var rowError *importer.RowError
+
+		if errors.As(err, &rowError) {
+			progress.Invalid++
+			if options.Rejected != nil {
+				options.Rejected(rowError.Line, rowError.Err)
+			}
+			continue
+		}
+
+		if err != nil {
+			return progress, err
+		}
+
+		progress.Read++
+
+		report, err := validateImport(row.Report, devicesByAddress, areaIds)
+
+		if err != nil {
+			progress.Invalid++
+			if options.Rejected != nil {
+				options.Rejected(row.Line, err)
+			}
+			continue
+		}
+
+		batches[report.Measurement] = append(batches[report.Measurement], report)
+
+		if len(batches[report.Measurement]) >= options.BatchSize {
+
+			if err := s.importBatch(ctx, report.Measurement, batches[report.Measurement], options, &progress); err != nil {
+				return progress, err
+			}
+
+			batches[report.Measurement] = batches[report.Measurement][:0]
+		}
+	}
+
+	measurements := make([]string, 0, len(batches))
+	for measurement := range batches {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+
+	for _, measurement := range measurements {
+		if len(batches[measurement]) > 0 {
+			if err := s.importBatch(ctx, measurement, batches[measurement], options, &progress); err != nil {
+				return progress, err
+			}
+		}
+	}
+
+	return progress, nil
+}
+
+// validateImport checks the reading can be stored, filing it under its device's area when the source has none
+func validateImport(report model.Report, devices map[string]model.Device, areaIds map[uint64]bool) (model.Report, error) {
+
+	if _, ok := MeasurementUnits[report.Measurement]; !ok {
+		return report, fmt.Errorf("unknown measurement %q", report.Measurement)
+	}
+
+	device, ok := devices[report.DeviceId]
+
+	if !ok {
+		return report, fmt.Errorf("unknown device %q", report.DeviceId)
+	}
+
+	if report.AreaId == 0 {
+		if device.AreaId == nil {
+			return report, fmt.Errorf("device %s is in no area", report.DeviceId)
+		}
+		report.AreaId = *device.AreaId
+	}
+
+	if !areaIds[report.AreaId] {
+		return report, fmt.Errorf("unknown area %d", report.AreaId)
+	}
+
+	if report.Date.After(time.Now().Add(24 * time.Hour)) {
+		return report, fmt.Errorf("%s is in the future", report.Date.Format(time.RFC3339))
+	}
+
+	// Postgres keeps microseconds, so compare and store at that precision
+	report.Date = report.Date.Truncate(time.Microsecond)
+
+	return report, nil
+}
+
+// importBatch drops the readings already in the batch or the database and copies the rest
+func (s *ImportService) importBatch(ctx context.Context, measurement string, batch []model.Report, options ImportOptions, progress *model.ImportProgress) error {
+
+	key := func(report model.Report) string {
+		return report.DeviceId + " " + strconv.FormatInt(report.Date.UnixNano(), 10)
+	}
+
+	filter := model.ReportFilter{Measurements: []string{measurement}}
+	start, end := batch[0].Date, batch[0].Date
+	seen := make(map[string]bool, len(batch))
+
+	for _, report := range batch {
+
+		if !seen[report.DeviceId] {
+			seen[report.DeviceId] = true
+			filter.DeviceIds = append(filter.DeviceIds, report.DeviceId)
+		}
+
+		if report.Date.Before(start) {
+			start = report.Date
+		}
+
+		if report.Date.After(end) {
+			end = report.Date
+		}
+	}
+
+	// The filter's end is exclusive
+	end = end.Add(time.Microsecond)
+	filter.StartDate, filter.EndDate = &start, &end
+
+	existing := make(map[string]bool)
+
+	err := s.reportsRepository.StreamReports(ctx, filter, func(report model.Report) error {
+		existing[key(report)] = true
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fresh := make([]model.Report, 0, len(batch))
+
+	for _, report := range batch {
+
+		k := key(report)
+
+		if existing[k] {
+			progress.Duplicates++
+			continue
+		}
+
+		existing[k] = true
+		fresh = append(fresh, report)
+	}
+
+	if !options.DryRun && len(fresh) > 0 {
+		if _, err := s.reportsRepository.CopyReports(ctx, measurement, fresh); err != nil {
+			return fmt.Errorf("unable to copy %s reports: %w", measurement, err)
+		}
+	}
+
+	progress.Imported += int64(len(fresh))
+
+	if options.Progress != nil {
+		options.Progress(*progress)
+	}
+
+	return nil
+}
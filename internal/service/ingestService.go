@@ -0,0 +1,526 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"78concepts.com/domicile/internal/database"
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"78concepts.com/domicile/internal/spool"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultIngestQueueSize = 10000
+	DefaultIngestBatchSize = 500
+	DefaultIngestFlushInterval = time.Second
+	DefaultIngestEnqueueTimeout = 100 * time.Millisecond
+	DefaultIngestStatsInterval = 5 * time.Minute
+
+	// A batch that takes longer than this to copy is given up on so the queue keeps moving
+	ingestWriteTimeout = 30 * time.Second
+
+	minReplayBackoff = time.Second
+	maxReplayBackoff = time.Minute
+)
+
+var (
+	ErrIngestQueueFull = errors.New("the report queue is full")
+	ErrIngestClosed = errors.New("the report queue is closed")
+)
+
+// NewIngestService writes reports through a queue, keeping them in reportSpool while the database is unavailable
+// when one is given. Its counters are published on eventBus, when one is given, as they are logged.
+func NewIngestService(reportsRepository repository.IReportsRepository, reportSpool *spool.Spool, eventBus events.IEventBus, configuration config.IngestConfiguration) *IngestService {
+
+	s := &IngestService{
+		reportsRepository: reportsRepository,
+		spool: reportSpool,
+		eventBus: eventBus,
+		replaySignal: make(chan struct{}, 1),
+		stopping: make(chan struct{}),
+		replayDone: make(chan struct{}),
+		batchSize: DefaultIngestBatchSize,
+		flushInterval: DefaultIngestFlushInterval,
+		enqueueTimeout: DefaultIngestEnqueueTimeout,
+		statsInterval: DefaultIngestStatsInterval,
+		done: make(chan struct{}),
+	}
+
+	queueSize := DefaultIngestQueueSize
+	if configuration.QueueSize > 0 {
+		queueSize = configuration.QueueSize
+	}
+	s.queue = make(chan model.Report, queueSize)
+
+	if configuration.BatchSize > 0 {
+		s.batchSize = configuration.BatchSize
+	}
+
+	if configuration.FlushInterval > 0 {
+		s.flushInterval = time.Duration(configuration.FlushInterval) * time.Millisecond
+	}
+
+	if configuration.EnqueueTimeout > 0 {
+		s.enqueueTimeout = time.Duration(configuration.EnqueueTimeout) * time.Millisecond
+	}
+
+	if configuration.StatsInterval > 0 {
+		s.statsInterval = time.Duration(configuration.StatsInterval) * time.Minute
+	}
+
+	return s
+}
+
+// IngestService writes reports in batches from a bounded queue, so a slow database holds up neither the broker's
+// message handlers nor the readings behind them. While the database is unavailable batches go to the spool, and
+// keep going there behind those waiting until the spool has been replayed.
+type IngestService struct {
+	// The counters come first, 64 bit atomics must be 8 byte aligned on 32 bit platforms
+	enqueued int64
+	written int64
+	dropped int64
+	failed int64
+	batches int64
+	spooled int64
+	replayed int64
+	reportsRepository repository.IReportsRepository
+	spool *spool.Spool
+	eventBus events.IEventBus
+	replaySignal chan struct{}
+	stopping chan struct{}
+	replayDone chan struct{}
+	batchSize int
+	flushInterval time.Duration
+	enqueueTimeout time.Duration
+	statsInterval time.Duration
+	queue chan model.Report
+	done chan struct{}
+	// mutex keeps readings from being queued while the queue is closed
+	mutex sync.RWMutex
+	closed bool
+	dropping int32
+}
+
+// ManageIngest starts writing queued reports, Close must be called on shutdown to write those still queued
+func (s *IngestService) ManageIngest(ctx context.Context) {
+
+	go s.write()
+
+	if s.spool != nil {
+
+		go s.replay()
+
+		// Reports left in the spool by the last run are written first
+		if !s.spool.Empty() {
+			log.Printf("IngestService: replaying %d reports left in the spool\n", s.spool.Stats().Reports)
+			s.signalReplay()
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.statsInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.logStats()
+				s.publishStats()
+			}
+		}
+	}()
+}
+
+// Enqueue queues a report to be written. When the queue is full the caller is held back for the enqueue timeout,
+// after which the report is dropped and ErrIngestQueueFull returned.
+func (s *IngestService) Enqueue(report model.Report) error {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		atomic.AddInt64(&s.dropped, 1)
+		return ErrIngestClosed
+	}
+
+	select {
+	case s.queue <- report:
+		s.countEnqueued()
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(s.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.queue <- report:
+		s.countEnqueued()
+		return nil
+	case <-timer.C:
+		atomic.AddInt64(&s.dropped, 1)
+		// Log when dropping starts rather than for every reading
+		if atomic.CompareAndSwapInt32(&s.dropping, 0, 1) {
+			log.Printf("IngestService: queue of %d reports is full, dropping readings\n", cap(s.queue))
+		}
+		return ErrIngestQueueFull
+	}
+}
+
+func (s *IngestService) countEnqueued() {
+
+	atomic.AddInt64(&s.enqueued, 1)
+
+	if atomic.CompareAndSwapInt32(&s.dropping, 1, 0) {
+		log.Println("IngestService: queue has room again")
+	}
+}
+
+// Close stops taking reports and waits until those queued are written or spooled, or until ctx is done. Reports
+// still in the spool are replayed when the controller next starts.
+func (s *IngestService) Close(ctx context.Context) error {
+
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return fmt.Errorf("%d reports were not written: %w", len(s.queue), ctx.Err())
+	}
+
+	if s.spool != nil {
+
+		close(s.stopping)
+
+		select {
+		case <-s.replayDone:
+		case <-ctx.Done():
+			return fmt.Errorf("the spool replay did not stop: %w", ctx.Err())
+		}
+	}
+
+	s.logStats()
+
+	return nil
+}
+
+func (s *IngestService) Stats() model.IngestStats {
+
+	stats := model.IngestStats{
+		Queued: len(s.queue),
+		Capacity: cap(s.queue),
+		Enqueued: atomic.LoadInt64(&s.enqueued),
+		Written: atomic.LoadInt64(&s.written),
+		Dropped: atomic.LoadInt64(&s.dropped),
+		Failed: atomic.LoadInt64(&s.failed),
+		Batches: atomic.LoadInt64(&s.batches),
+		Spooled: atomic.LoadInt64(&s.spooled),
+		Replayed: atomic.LoadInt64(&s.replayed),
+	}
+
+	if s.spool != nil {
+		spoolStats := s.spool.Stats()
+		stats.SpoolSegments = spoolStats.Segments
+		stats.SpoolReports = spoolStats.Reports
+		stats.SpoolBytes = spoolStats.Bytes
+	}
+
+	return stats
+}
+
+// write collects queued reports into batches, written when full or when the flush interval passes
+func (s *IngestService) write() {
+
+	defer close(s.done)
+
+	batch := make([]model.Report, 0, s.batchSize)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case report, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+
+			batch = append(batch, report)
+
+			if len(batch) >= s.batchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush copies the batch into each measurement's table in the order the readings came, or spools what cannot be
+// written while the database is unavailable
+func (s *IngestService) flush(batch []model.Report) {
+
+	if len(batch) == 0 {
+		return
+	}
+
+	defer atomic.AddInt64(&s.batches, 1)
+
+	// Readings wait behind those already spooled so they reach the database in order
+	if s.spool != nil && !s.spool.Empty() {
+		s.spoolReports(batch)
+		return
+	}
+
+	measurements, reports := groupReports(batch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ingestWriteTimeout)
+	defer cancel()
+
+	for i, measurement := range measurements {
+
+		count, remaining, err := s.copyReports(ctx, measurement, reports[measurement])
+
+		atomic.AddInt64(&s.written, count)
+
+		if err == nil {
+			continue
+		}
+
+		if s.spool != nil {
+			log.Printf("IngestService: database unavailable, spooling reports: %v\n", err)
+			s.spoolReports(append(remaining, joinReports(measurements[i+1:], reports)...))
+			return
+		}
+
+		atomic.AddInt64(&s.failed, int64(len(remaining)))
+		log.Printf("IngestService: unable to write %d %s reports: %v\n", len(remaining), measurement, err)
+	}
+}
+
+// copyReports copies the reports of a measurement. A batch the database refuses is split in halves down to the
+// reports it refuses, so one bad reading costs only itself. When the database is unavailable the error is returned
+// with the reports not yet written.
+func (s *IngestService) copyReports(ctx context.Context, measurement string, reports []model.Report) (int64, []model.Report, error) {
+
+	refused := 0
+	var refusal error
+
+	var copyPart func(part []model.Report) (int64, []model.Report, error)
+
+	copyPart = func(part []model.Report) (int64, []model.Report, error) {
+
+		count, err := s.reportsRepository.CopyReports(ctx, measurement, part)
+
+		if err == nil {
+			return count, nil, nil
+		}
+
+		if database.IsUnavailable(err) {
+			return 0, part, err
+		}
+
+		if len(part) == 1 {
+			refused++
+			refusal = err
+			return 0, nil, nil
+		}
+
+		half := len(part) / 2
+
+		count, remaining, err := copyPart(part[:half])
+
+		// What is left of the first half runs on into the second
+		if err != nil {
+			return count, part[half-len(remaining):], err
+		}
+
+		more, remaining, err := copyPart(part[half:])
+
+		return count + more, remaining, err
+	}
+
+	count, remaining, err := copyPart(reports)
+
+	if refused > 0 {
+		atomic.AddInt64(&s.failed, int64(refused))
+		log.Printf("IngestService: dropping %d of %d %s reports the database refused: %v\n", refused, len(reports), measurement, refusal)
+	}
+
+	return count, remaining, err
+}
+
+func (s *IngestService) spoolReports(reports []model.Report) {
+
+	if err := s.spool.Append(reports); err != nil {
+		atomic.AddInt64(&s.failed, int64(len(reports)))
+		log.Printf("IngestService: unable to spool %d reports: %v\n", len(reports), err)
+	} else {
+		atomic.AddInt64(&s.spooled, int64(len(reports)))
+	}
+
+	s.signalReplay()
+}
+
+func (s *IngestService) signalReplay() {
+	select {
+	case s.replaySignal <- struct{}{}:
+	default:
+	}
+}
+
+// replay writes the spool oldest segment first whenever reports are spooled, backing off while the database is
+// still unavailable
+func (s *IngestService) replay() {
+
+	defer close(s.replayDone)
+
+	backoff := database.NewBackoff(minReplayBackoff, maxReplayBackoff)
+
+	for {
+		select {
+		case <-s.stopping:
+			return
+		case <-s.replaySignal:
+		}
+
+		for !s.spool.Empty() {
+
+			select {
+			case <-s.stopping:
+				return
+			default:
+			}
+
+			if err := s.replayOldest(); err != nil {
+
+				delay := backoff.Next()
+				log.Printf("IngestService: unable to replay the spool, retrying in %s: %v\n", delay, err)
+
+				select {
+				case <-s.stopping:
+					return
+				case <-time.After(delay):
+				}
+
+				continue
+			}
+
+			if backoff.Reset(); s.spool.Empty() {
+				log.Println("IngestService: spool replayed")
+			}
+		}
+	}
+}
+
+// replayOldest writes the oldest segment of the spool and removes it. When the database becomes unavailable part
+// way the segment is cut down to the reports still to be written.
+func (s *IngestService) replayOldest() error {
+
+	id, batch, ok, err := s.spool.Oldest()
+
+	if !ok {
+		return nil
+	}
+
+	// A segment that cannot be read would hold up the rest of the spool for good
+	if err != nil {
+		return s.spool.Quarantine(id, err)
+	}
+
+	measurements, reports := groupReports(batch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ingestWriteTimeout)
+	defer cancel()
+
+	for i, measurement := range measurements {
+
+		// Reports the database refuses are dropped, retrying them would hold up the rest of the spool for good
+		count, remaining, err := s.copyReports(ctx, measurement, reports[measurement])
+
+		atomic.AddInt64(&s.replayed, count)
+		atomic.AddInt64(&s.written, count)
+
+		if err != nil {
+			if rest := append(remaining, joinReports(measurements[i+1:], reports)...); len(rest) < len(batch) {
+				if replaceErr := s.spool.Replace(id, rest); replaceErr != nil {
+					log.Println("IngestService: unable to trim a replayed spool segment", replaceErr)
+				}
+			}
+			return err
+		}
+	}
+
+	return s.spool.Remove(id)
+}
+
+// groupReports splits reports by measurement, in the order each measurement first comes
+func groupReports(batch []model.Report) ([]string, map[string][]model.Report) {
+
+	measurements := make([]string, 0, 4)
+	reports := make(map[string][]model.Report, 4)
+
+	for _, report := range batch {
+		if _, ok := reports[report.Measurement]; !ok {
+			measurements = append(measurements, report.Measurement)
+		}
+		reports[report.Measurement] = append(reports[report.Measurement], report)
+	}
+
+	return measurements, reports
+}
+
+func joinReports(measurements []string, reports map[string][]model.Report) []model.Report {
+
+	joined := make([]model.Report, 0)
+
+	for _, measurement := range measurements {
+		joined = append(joined, reports[measurement]...)
+	}
+
+	return joined
+}
+
+// publishStats lets other processes, and anything else on the broker, watch the queue and the spool
+func (s *IngestService) publishStats() {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(events.IngestStatsReported, events.IngestStatsEvent{Stats: s.Stats()}); err != nil {
+		log.Println("IngestService: unable to publish stats:", err)
+	}
+}
+
+func (s *IngestService) logStats() {
+
+	stats := s.Stats()
+
+	log.Printf("IngestService: %d of %d queued, %d enqueued, %d written in %d batches, %d dropped, %d failed\n",
+		stats.Queued, stats.Capacity, stats.Enqueued, stats.Written, stats.Batches, stats.Dropped, stats.Failed)
+
+	if s.spool != nil {
+		log.Printf("IngestService: spool holds %d reports in %d segments of %d bytes, %d spooled and %d replayed\n",
+			stats.SpoolReports, stats.SpoolSegments, stats.SpoolBytes, stats.Spooled, stats.Replayed)
+	}
+}
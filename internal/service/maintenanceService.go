@@ -0,0 +1,246 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"78concepts.com/domicile/internal/cron"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/notify"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBatteryReportingInterval = 25 * 60
+	defaultMainsReportingInterval = 10
+	defaultWeakLinkQuality = 30
+	defaultDigestSchedule = "0 9 * * sun"
+)
+
+func NewMaintenanceService(devicesService *DevicesService, reportsService *ReportsService, notificationsService *NotificationsService) *MaintenanceService {
+
+	configuration := config.GetConfig()
+
+	return &MaintenanceService{
+		devicesService: devicesService,
+		reportsService: reportsService,
+		notificationsService: notificationsService,
+		configuration: configuration.Maintenance,
+		location: configuration.Location.GetTimezone(),
+	}
+}
+
+type MaintenanceService struct {
+	devicesService *DevicesService
+	reportsService *ReportsService
+	notificationsService *NotificationsService
+	configuration config.MaintenanceConfiguration
+	location *time.Location
+}
+
+// GetMaintenanceReport lists battery levels lowest first, devices overdue for a report and devices with weak links
+func (s *MaintenanceService) GetMaintenanceReport(ctx context.Context, now time.Time) (*model.MaintenanceReport, error) {
+
+	devices, err := s.devicesService.GetDevices(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := model.MaintenanceReport{
+		Date: now,
+		Batteries: make([]model.BatteryStatus, 0),
+		Stale: make([]model.StaleDevice, 0),
+		WeakLinks: make([]model.LinkQualityStatus, 0),
+	}
+
+	weakLinkQuality := s.configuration.WeakLinkQuality
+	if weakLinkQuality == 0 {
+		weakLinkQuality = defaultWeakLinkQuality
+	}
+
+	var batteryDevices []string
+
+	for _, device := range devices {
+		if device.Active && device.Battery != nil {
+			batteryDevices = append(batteryDevices, device.IeeeAddress)
+		}
+	}
+
+	// One query for every battery history rather than one per device, the projection is left out if it fails
+	batteryReports, err := s.reportsService.GetDevicesBatteryReports(ctx, batteryDevices, now.Add(-batteryProjectionWindow), now)
+
+	if err != nil {
+		log.Println("GetMaintenanceReport:", err)
+	}
+
+	for _, device := range devices {
+
+		if !device.Active {
+			continue
+		}
+
+		if device.Battery != nil {
+			report.Batteries = append(report.Batteries, model.BatteryStatus{
+				IeeeAddress: device.IeeeAddress,
+				FriendlyName: device.FriendlyName,
+				AreaId: device.AreaId,
+				Battery: *device.Battery,
+				LastSeen: device.LastSeen,
+				DaysToEmpty: ProjectDaysToEmpty(batteryReports[device.IeeeAddress]),
+			})
+		}
+
+		interval := s.reportingInterval(device)
+
+		if device.LastSeen == nil || now.Sub(*device.LastSeen) > time.Duration(interval)*time.Minute {
+			report.Stale = append(report.Stale, model.StaleDevice{
+				IeeeAddress: device.IeeeAddress,
+				FriendlyName: device.FriendlyName,
+				AreaId: device.AreaId,
+				LastSeen: device.LastSeen,
+				ExpectedInterval: interval,
+			})
+		}
+
+		if device.LinkQuality != nil && *device.LinkQuality < weakLinkQuality {
+			report.WeakLinks = append(report.WeakLinks, model.LinkQualityStatus{
+				IeeeAddress: device.IeeeAddress,
+				FriendlyName: device.FriendlyName,
+				AreaId: device.AreaId,
+				LinkQuality: *device.LinkQuality,
+			})
+		}
+	}
+
+	sort.Slice(report.Batteries, func(i, j int) bool {
+		return report.Batteries[i].Battery < report.Batteries[j].Battery
+	})
+
+	sort.Slice(report.WeakLinks, func(i, j int) bool {
+		return report.WeakLinks[i].LinkQuality < report.WeakLinks[j].LinkQuality
+	})
+
+	return &report, nil
+}
+
+// ManageDigest sends the maintenance report through the configured notifier on the digest schedule
+func (s *MaintenanceService) ManageDigest(ctx context.Context) {
+
+	if s.configuration.DigestNotifier == "" {
+		return
+	}
+
+	expression := s.configuration.DigestSchedule
+	if expression == "" {
+		expression = defaultDigestSchedule
+	}
+
+	schedule, err := cron.Parse(expression)
+
+	if err != nil {
+		log.Println("ManageDigest:", err)
+		return
+	}
+
+	go func() {
+		for {
+			next := schedule.Next(time.Now().In(s.location))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+				if err := s.SendDigest(ctx); err != nil {
+					log.Println("SendDigest:", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *MaintenanceService) SendDigest(ctx context.Context) error {
+
+	report, err := s.GetMaintenanceReport(ctx, time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	return s.notificationsService.Notify(ctx, []string{s.configuration.DigestNotifier}, notify.Notification{
+		Title:    "domicile weekly maintenance",
+		Message:  FormatMaintenanceDigest(report, s.location),
+		Priority: notify.PriorityDefault,
+		Origin:   "maintenance",
+	})
+}
+
+func (s *MaintenanceService) reportingInterval(device model.Device) int {
+
+	if device.ModelId != nil {
+		if interval, ok := s.configuration.ReportingIntervals[*device.ModelId]; ok {
+			return interval
+		}
+	}
+
+	if device.Battery != nil {
+		if s.configuration.BatteryReportingInterval > 0 {
+			return s.configuration.BatteryReportingInterval
+		}
+		return defaultBatteryReportingInterval
+	}
+
+	if s.configuration.MainsReportingInterval > 0 {
+		return s.configuration.MainsReportingInterval
+	}
+
+	return defaultMainsReportingInterval
+}
+
+func FormatMaintenanceDigest(report *model.MaintenanceReport, location *time.Location) string {
+
+	var digest strings.Builder
+
+	digest.WriteString("Batteries\n")
+
+	if len(report.Batteries) == 0 {
+		digest.WriteString("  none\n")
+	}
+
+	for _, battery := range report.Batteries {
+		fmt.Fprintf(&digest, "  %s: %.0f%%", battery.FriendlyName, battery.Battery)
+		if battery.DaysToEmpty != nil {
+			fmt.Fprintf(&digest, ", about %.0f days left", *battery.DaysToEmpty)
+		}
+		digest.WriteString("\n")
+	}
+
+	digest.WriteString("\nNot reporting\n")
+
+	if len(report.Stale) == 0 {
+		digest.WriteString("  none\n")
+	}
+
+	for _, stale := range report.Stale {
+		if stale.LastSeen == nil {
+			fmt.Fprintf(&digest, "  %s: never seen\n", stale.FriendlyName)
+		} else {
+			fmt.Fprintf(&digest, "  %s: last seen %s\n", stale.FriendlyName, stale.LastSeen.In(location).Format("Mon Jan 2 15:04"))
+		}
+	}
+
+	digest.WriteString("\nWeak links\n")
+
+	if len(report.WeakLinks) == 0 {
+		digest.WriteString("  none\n")
+	}
+
+	for _, link := range report.WeakLinks {
+		fmt.Fprintf(&digest, "  %s: linkquality %d\n", link.FriendlyName, link.LinkQuality)
+	}
+
+	return digest.String()
+}
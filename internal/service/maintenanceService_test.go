@@ -0,0 +1,60 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"testing"
+	"time"
+)
+
+func TestFormatMaintenanceDigest(t *testing.T) {
+
+	melbourne, err := time.LoadLocation("Australia/Melbourne")
+
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	lastSeen := time.Date(2026, time.January, 14, 22, 5, 0, 0, time.UTC)
+	days := 41.6
+
+	tests := []struct {
+		name     string
+		report   model.MaintenanceReport
+		expected string
+	}{
+		{
+			name:     "nothing to report",
+			report:   model.MaintenanceReport{},
+			expected: "Batteries\n  none\n\nNot reporting\n  none\n\nWeak links\n  none\n",
+		},
+		{
+			name: "everything",
+			report: model.MaintenanceReport{
+				Batteries: []model.BatteryStatus{
+					{FriendlyName: "Hall sensor", Battery: 12.4, DaysToEmpty: &days},
+					{FriendlyName: "Back door", Battery: 87},
+				},
+				Stale: []model.StaleDevice{
+					{FriendlyName: "Garage", LastSeen: &lastSeen},
+					{FriendlyName: "Shed"},
+				},
+				WeakLinks: []model.LinkQualityStatus{{FriendlyName: "Letterbox", LinkQuality: 9}},
+			},
+			// Last seen in Melbourne time, the next morning
+			expected: "Batteries\n" +
+				"  Hall sensor: 12%, about 42 days left\n" +
+				"  Back door: 87%\n" +
+				"\nNot reporting\n" +
+				"  Garage: last seen Thu Jan 15 09:05\n" +
+				"  Shed: never seen\n" +
+				"\nWeak links\n" +
+				"  Letterbox: linkquality 9\n",
+		},
+	}
+
+	for _, test := range tests {
+		if digest := FormatMaintenanceDigest(&test.report, melbourne); digest != test.expected {
+			t.Errorf("%s: FormatMaintenanceDigest =\n%s\nexpected\n%s", test.name, digest, test.expected)
+		}
+	}
+}
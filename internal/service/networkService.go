@@ -0,0 +1,149 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/networkmap"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// Scanning the mesh makes every router report its neighbours, which takes a while on larger networks
+	NetworkMapTimeout = 3 * time.Minute
+	// A map younger than this is returned from memory rather than scanning the network again
+	NetworkMapCacheAge = 15 * time.Minute
+)
+
+func NewNetworkService(networkRepository repository.INetworkRepository, bridgeService *BridgeService, devicesService *DevicesService, areasService *AreasService) *NetworkService {
+	weakLinkQuality := config.GetConfig().Maintenance.WeakLinkQuality
+	if weakLinkQuality == 0 {
+		weakLinkQuality = defaultWeakLinkQuality
+	}
+
+	return &NetworkService{
+		weakLinkQuality: weakLinkQuality,
+		networkRepository: networkRepository,
+		bridgeService: bridgeService,
+		devicesService: devicesService,
+		areasService: areasService,
+	}
+}
+
+type NetworkService struct {
+	networkRepository repository.INetworkRepository
+	bridgeService *BridgeService
+	devicesService *DevicesService
+	areasService *AreasService
+	weakLinkQuality int
+
+	// Held for the whole scan so concurrent requests wait for one scan rather than starting their own
+	mutex sync.Mutex
+	cached *model.NetworkMap
+}
+
+// GetNetworkMap returns the cached map while it is fresh, the latest stored snapshot otherwise, scanning only when none exists
+// or a refresh is asked for
+func (s *NetworkService) GetNetworkMap(ctx context.Context, refresh bool) (*model.NetworkMap, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !refresh && s.cached != nil && time.Since(s.cached.Date) < NetworkMapCacheAge {
+		return s.cached, nil
+	}
+
+	if !refresh {
+		latest, err := s.networkRepository.GetLatestNetworkMap(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if latest != nil && time.Since(latest.Date) < NetworkMapCacheAge {
+			s.cached = latest
+			return latest, nil
+		}
+	}
+
+	networkMap, err := s.scanNetwork(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.cached = networkMap
+
+	return networkMap, nil
+}
+
+// RenderNetworkMap draws the map as SVG, highlighting links weaker than the configured weak link quality
+func (s *NetworkService) RenderNetworkMap(w io.Writer, networkMap *model.NetworkMap) error {
+	return networkmap.Render(w, *networkMap, s.weakLinkQuality)
+}
+
+func (s *NetworkService) GetNetworkMapSnapshots(ctx context.Context, limit int) ([]model.NetworkMapSummary, error) {
+	return s.networkRepository.GetNetworkMaps(ctx, limit)
+}
+
+func (s *NetworkService) GetNetworkMapSnapshot(ctx context.Context, id uint64) (*model.NetworkMap, error) {
+	return s.networkRepository.GetNetworkMap(ctx, id)
+}
+
+// scanNetwork requests the raw map from zigbee2mqtt, annotates it with our devices and areas and stores it as a snapshot
+func (s *NetworkService) scanNetwork(ctx context.Context) (*model.NetworkMap, error) {
+
+	response, err := s.bridgeService.Request(ctx, "networkmap", map[string]interface{}{"type": "raw", "routes": false}, NetworkMapTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	networkMap, err := networkmap.Parse(response.Data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.devicesService.GetDevices(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	areas, err := s.areasService.GetAreas(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	areaNames := make(map[uint64]string)
+	for _, area := range areas {
+		areaNames[area.Id] = area.Name
+	}
+
+	networkMap.Date = time.Now().UTC()
+
+	for i := range networkMap.Nodes {
+
+		node := &networkMap.Nodes[i]
+
+		for _, device := range devices {
+			if device.IeeeAddress == node.IeeeAddress {
+				node.FriendlyName = device.FriendlyName
+				node.AreaId = device.AreaId
+				if device.AreaId != nil {
+					if name, ok := areaNames[*device.AreaId]; ok {
+						node.AreaName = &name
+					}
+				}
+				break
+			}
+		}
+	}
+
+	return s.networkRepository.CreateNetworkMap(ctx, *networkMap)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/config"
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/notify"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	notificationQueueSize = 100
+	// A notification not delivered in this long is given up on so those behind it still go out
+	notificationTimeout = time.Minute
+)
+
+// NewNotificationsService starts a worker delivering dispatched notifications, so the message handlers that raise
+// them never wait on a slow notifier
+func NewNotificationsService(eventBus events.IEventBus) *NotificationsService {
+
+	notifiers := make(map[string]notify.INotifier)
+
+	for _, configuration := range config.GetConfig().Notifiers {
+
+		notifier, err := notify.NewNotifier(configuration)
+
+		if err != nil {
+			log.Printf("Notifier %s: %v\n", configuration.Name, err)
+			continue
+		}
+
+		notifiers[notifier.Name()] = notifier
+	}
+
+	s := &NotificationsService{notifiers: notifiers, eventBus: eventBus, queue: make(chan dispatch, notificationQueueSize)}
+
+	go s.deliver()
+
+	return s
+}
+
+type NotificationsService struct {
+	notifiers map[string]notify.INotifier
+	eventBus events.IEventBus
+	queue chan dispatch
+}
+
+type dispatch struct {
+	channels []string
+	notification notify.Notification
+}
+
+// ManageNotifications delivers notifications requested by other processes, e.g. automation notify actions
+func (s *NotificationsService) ManageNotifications() {
+
+	err := s.eventBus.Subscribe(func(ctx context.Context, event events.Event) {
+
+		var payload events.NotificationEvent
+
+		if err := event.Decode(&payload); err != nil {
+			log.Println("ManageNotifications:", err)
+			return
+		}
+
+		s.Dispatch(nil, notify.Notification{
+			Title:    payload.Title,
+			Message:  payload.Message,
+			Priority: notify.PriorityDefault,
+			Origin:   payload.Origin,
+			Date:     event.Date,
+		})
+
+	}, events.NotificationRequested)
+
+	if err != nil {
+		log.Fatalf("ManageNotifications: Subscribe error: %s", err)
+	}
+}
+
+func (s *NotificationsService) GetNotifierNames() []string {
+
+	names := make([]string, 0, len(s.notifiers))
+
+	for name := range s.notifiers {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func (s *NotificationsService) HasNotifier(name string) bool {
+	return s.notifiers[name] != nil
+}
+
+// Dispatch queues a notification for the named notifiers, or all of them when none are named, dropping it when the
+// queue is full rather than holding up the caller
+func (s *NotificationsService) Dispatch(channels []string, notification notify.Notification) {
+
+	if notification.Date.IsZero() {
+		notification.Date = time.Now().UTC()
+	}
+
+	select {
+	case s.queue <- dispatch{channels: channels, notification: notification}:
+	default:
+		log.Printf("Notification queue full, dropping %q\n", notification.Title)
+	}
+}
+
+func (s *NotificationsService) deliver() {
+
+	for next := range s.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		s.Notify(ctx, next.channels, next.notification)
+		cancel()
+	}
+}
+
+// Notify sends a notification through the named notifiers, or all of them when none are named, and waits for them
+func (s *NotificationsService) Notify(ctx context.Context, channels []string, notification notify.Notification) error {
+
+	if notification.Date.IsZero() {
+		notification.Date = time.Now().UTC()
+	}
+
+	if len(channels) == 0 {
+		channels = s.GetNotifierNames()
+	}
+
+	var failures []string
+
+	for _, channel := range channels {
+
+		notifier := s.notifiers[channel]
+
+		if notifier == nil {
+			failures = append(failures, channel+": not configured")
+			continue
+		}
+
+		if err := notifier.Notify(ctx, notification); err != nil {
+			log.Printf("Notifier %s: %v\n", channel, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", channel, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+
+	return nil
+}
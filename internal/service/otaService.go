@@ -0,0 +1,181 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Sleepy end devices only answer the query when they next wake up
+	OtaCheckTimeout = 2 * time.Minute
+	// zigbee2mqtt only responds to an update request once the new image has been transferred and installed
+	OtaUpdateTimeout = 2 * time.Hour
+)
+
+var ErrUpdateInProgress = errors.New("an update is already in progress")
+
+func NewOtaService(bridgeService *BridgeService, devicesService *DevicesService) *OtaService {
+	return &OtaService{bridgeService: bridgeService, devicesService: devicesService, jobs: make(map[uint64]*model.OtaCheckJob)}
+}
+
+// OtaService checks for and runs over-the-air firmware updates. Progress is reported by the devices themselves and stored
+// by the controller.
+type OtaService struct {
+	bridgeService *BridgeService
+	devicesService *DevicesService
+
+	mutex sync.Mutex
+	jobs map[uint64]*model.OtaCheckJob
+	lastJobId uint64
+}
+
+// CheckDevice asks zigbee2mqtt whether an update is available for a device
+func (s *OtaService) CheckDevice(ctx context.Context, device *model.Device) (bool, error) {
+
+	response, err := s.bridgeService.Request(ctx, "device/ota_update/check", map[string]interface{}{"id": device.IeeeAddress}, OtaCheckTimeout)
+
+	if err != nil {
+		return false, err
+	}
+
+	var data struct {
+		UpdateAvailable bool `json:"update_available"`
+	}
+
+	if err := json.Unmarshal(response.Data, &data); err != nil {
+		return false, err
+	}
+
+	state := model.UpdateStateIdle
+	if data.UpdateAvailable {
+		state = model.UpdateStateAvailable
+	}
+
+	s.devicesService.UpdateDeviceUpdateState(ctx, device.IeeeAddress, state)
+
+	return data.UpdateAvailable, nil
+}
+
+// StartCheckAll checks every active device for updates in the background, returning the job tracking the check
+func (s *OtaService) StartCheckAll(ctx context.Context) (*model.OtaCheckJob, error) {
+
+	devices, err := s.devicesService.GetDevices(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]model.Device, 0)
+	for _, device := range devices {
+		if device.Active {
+			candidates = append(candidates, device)
+		}
+	}
+
+	s.mutex.Lock()
+	s.lastJobId++
+	job := &model.OtaCheckJob{
+		Id: s.lastJobId,
+		DateStarted: time.Now().UTC(),
+		Total: len(candidates),
+		Available: make([]string, 0),
+		Unsupported: make([]string, 0),
+		Failed: make(map[string]string),
+	}
+	s.jobs[job.Id] = job
+	snapshot := copyOtaCheckJob(job)
+	s.mutex.Unlock()
+
+	go func() {
+		for i := range candidates {
+
+			device := &candidates[i]
+			available, err := s.CheckDevice(ctx, device)
+
+			var bridgeError *BridgeError
+
+			s.mutex.Lock()
+			job.Checked++
+			switch {
+			case err == nil && available:
+				job.Available = append(job.Available, device.IeeeAddress)
+			case errors.As(err, &bridgeError) && strings.Contains(strings.ToLower(bridgeError.Message), "support"):
+				job.Unsupported = append(job.Unsupported, device.IeeeAddress)
+			case err != nil:
+				job.Failed[device.IeeeAddress] = err.Error()
+			}
+			s.mutex.Unlock()
+		}
+
+		s.mutex.Lock()
+		finished := time.Now().UTC()
+		job.DateFinished = &finished
+		s.mutex.Unlock()
+
+		log.Printf("OTA check %d finished, %d of %d devices have updates\n", job.Id, len(job.Available), job.Total)
+	}()
+
+	return snapshot, nil
+}
+
+// GetCheckJob returns a copy of a check job, so it can be read while the check carries on
+func (s *OtaService) GetCheckJob(id uint64) *model.OtaCheckJob {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[id]
+
+	if !ok {
+		return nil
+	}
+
+	return copyOtaCheckJob(job)
+}
+
+// StartUpdate begins updating a device's firmware, which continues in the background and can take the best part of an hour
+func (s *OtaService) StartUpdate(ctx context.Context, device *model.Device) error {
+
+	if device.UpdateState != nil && *device.UpdateState == model.UpdateStateUpdating {
+		return ErrUpdateInProgress
+	}
+
+	if err := s.devicesService.UpdateDeviceUpdateState(ctx, device.IeeeAddress, model.UpdateStateUpdating); err != nil {
+		return err
+	}
+
+	go func() {
+		_, err := s.bridgeService.Request(ctx, "device/ota_update/update", map[string]interface{}{"id": device.IeeeAddress}, OtaUpdateTimeout)
+
+		if err != nil {
+			log.Printf("OTA update of %s failed: %v\n", device.FriendlyName, err)
+			// Let the update be retried, the device reports its real state again the next time it is checked
+			s.devicesService.UpdateDeviceUpdateState(ctx, device.IeeeAddress, model.UpdateStateAvailable)
+			return
+		}
+
+		log.Printf("OTA update of %s finished\n", device.FriendlyName)
+	}()
+
+	return nil
+}
+
+func copyOtaCheckJob(job *model.OtaCheckJob) *model.OtaCheckJob {
+
+	copied := *job
+	copied.Available = append([]string{}, job.Available...)
+	copied.Unsupported = append([]string{}, job.Unsupported...)
+	copied.Failed = make(map[string]string, len(job.Failed))
+
+	for key, value := range job.Failed {
+		copied.Failed[key] = value
+	}
+
+	return &copied
+}
@@ -1,56 +1,124 @@
 package service
 
 import (
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/export"
 	"78concepts.com/domicile/internal/model"
 	"78concepts.com/domicile/internal/repository"
 	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
 	"time"
 )
 
-func NewReportsService(reportsRepository repository.IReportsRepository) *ReportsService {
-	return &ReportsService{reportsRepository: reportsRepository}
+const (
+	TemperatureMeasurement = "temperature"
+	HumidityMeasurement = "humidity"
+	PressureMeasurement = "pressure"
+	IlluminanceMeasurement = "illuminance"
+	// BatteryMeasurement readings go through the ingest queue to the battery history, with the voltage as the raw
+	// value, and are not published as measurements
+	BatteryMeasurement = "battery"
+)
+
+// MeasurementUnits are the units each measurement's readings are stored in, illuminance in lux
+var MeasurementUnits = map[string]string{
+	TemperatureMeasurement: "°C",
+	HumidityMeasurement: "%",
+	PressureMeasurement: "hPa",
+	IlluminanceMeasurement: "lx",
+}
+
+// NewReportsService writes reports through the ingest queue when one is given, otherwise one at a time as they come
+func NewReportsService(reportsRepository repository.IReportsRepository, eventBus events.IEventBus, ingestService *IngestService) *ReportsService {
+	return &ReportsService{reportsRepository: reportsRepository, eventBus: eventBus, ingestService: ingestService, batteries: make(map[string]float64)}
 }
 
 type ReportsService struct {
 	reportsRepository repository.IReportsRepository
+	eventBus events.IEventBus
+	ingestService *IngestService
+	// batteries is the last battery reading of each device, as the last one may still be queued
+	batteries map[string]float64
+	batteriesMutex sync.Mutex
 }
 
 func (s *ReportsService) CreateTemperatureReport(ctx context.Context, deviceId string, areaId uint64, value float64) (*model.TemperatureReport, error) {
 
-	return s.reportsRepository.CreateTemperatureReport(
+	if s.ingestService != nil {
+		report, err := s.queueReport(TemperatureMeasurement, deviceId, areaId, value, nil)
+		return &model.TemperatureReport{DeviceId: report.DeviceId, AreaId: report.AreaId, Date: report.Date, Value: report.Value}, err
+	}
+
+	report, err := s.reportsRepository.CreateTemperatureReport(
 		ctx,
 		deviceId,
 		areaId,
 		time.Now().UTC(),
 		value,
 	)
+
+	if err == nil {
+		s.publishMeasurement(TemperatureMeasurement, report.DeviceId, report.AreaId, report.Date, report.Value)
+	}
+
+	return report, err
 }
 
 func (s *ReportsService) CreateHumidityReport(ctx context.Context, deviceId string, areaId uint64, value float64) (*model.HumidityReport, error) {
 
-	return s.reportsRepository.CreateHumidityReport(
+	if s.ingestService != nil {
+		report, err := s.queueReport(HumidityMeasurement, deviceId, areaId, value, nil)
+		return &model.HumidityReport{DeviceId: report.DeviceId, AreaId: report.AreaId, Date: report.Date, Value: report.Value}, err
+	}
+
+	report, err := s.reportsRepository.CreateHumidityReport(
 		ctx,
 		deviceId,
 		areaId,
 		time.Now().UTC(),
 		value,
 	)
+
+	if err == nil {
+		s.publishMeasurement(HumidityMeasurement, report.DeviceId, report.AreaId, report.Date, report.Value)
+	}
+
+	return report, err
 }
 
 func (s *ReportsService) CreatePressureReport(ctx context.Context, deviceId string, areaId uint64, value float64) (*model.PressureReport, error) {
 
-	return s.reportsRepository.CreatePressureReport(
+	if s.ingestService != nil {
+		report, err := s.queueReport(PressureMeasurement, deviceId, areaId, value, nil)
+		return &model.PressureReport{DeviceId: report.DeviceId, AreaId: report.AreaId, Date: report.Date, Value: report.Value}, err
+	}
+
+	report, err := s.reportsRepository.CreatePressureReport(
 		ctx,
 		deviceId,
 		areaId,
 		time.Now().UTC(),
 		value,
 	)
+
+	if err == nil {
+		s.publishMeasurement(PressureMeasurement, report.DeviceId, report.AreaId, report.Date, report.Value)
+	}
+
+	return report, err
 }
 
 func (s *ReportsService) CreateIlluminanceReport(ctx context.Context, deviceId string, areaId uint64, value float64, valueLux float64) (*model.IlluminanceReport, error) {
 
-	return s.reportsRepository.CreateIlluminanceReport(
+	if s.ingestService != nil {
+		report, err := s.queueReport(IlluminanceMeasurement, deviceId, areaId, valueLux, &value)
+		return &model.IlluminanceReport{DeviceId: report.DeviceId, AreaId: report.AreaId, Date: report.Date, Value: value, ValueLux: report.Value}, err
+	}
+
+	report, err := s.reportsRepository.CreateIlluminanceReport(
 		ctx,
 		deviceId,
 		areaId,
@@ -58,6 +126,12 @@ func (s *ReportsService) CreateIlluminanceReport(ctx context.Context, deviceId s
 		value,
 		valueLux,
 	)
+
+	if err == nil {
+		s.publishMeasurement(IlluminanceMeasurement, report.DeviceId, report.AreaId, report.Date, report.ValueLux)
+	}
+
+	return report, err
 }
 
 func (s *ReportsService) GetTemperatureReports(ctx context.Context, areaId uint64, startDate time.Time, endDate time.Time) ([]model.TemperatureReport, error) {
@@ -76,3 +150,187 @@ func (s *ReportsService) GetIlluminanceReports(ctx context.Context, areaId uint6
 	return s.reportsRepository.GetIlluminanceReports(ctx, areaId)
 }
 
+func (s *ReportsService) GetReports(ctx context.Context, measurement string, areaId uint64, startDate time.Time, endDate time.Time, limit int, offset int) ([]model.Report, error) {
+	return s.reportsRepository.GetReports(ctx, measurement, areaId, startDate, endDate, limit, offset)
+}
+
+func (s *ReportsService) GetReportBuckets(ctx context.Context, measurement string, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error) {
+	return s.reportsRepository.GetReportBuckets(ctx, measurement, areaIds, startDate, endDate, bucket)
+}
+
+func (s *ReportsService) GetDeviceReportBuckets(ctx context.Context, measurement string, areaIds []uint64, startDate time.Time, endDate time.Time, bucket time.Duration) ([]model.ReportBucket, error) {
+	return s.reportsRepository.GetDeviceReportBuckets(ctx, measurement, areaIds, startDate, endDate, bucket)
+}
+
+func (s *ReportsService) GetLatestDeviceReports(ctx context.Context, measurement string, deviceIds []string) ([]model.Report, error) {
+	return s.reportsRepository.GetLatestDeviceReports(ctx, measurement, deviceIds)
+}
+
+func (s *ReportsService) GetLatestAreaReports(ctx context.Context, measurement string, areaIds []uint64) ([]model.Report, error) {
+	return s.reportsRepository.GetLatestAreaReports(ctx, measurement, areaIds)
+}
+
+// ExportReports streams the reports matching the filter to w and closes it, every measurement when none is given.
+// Users limited to some areas export only those they may view, all of them when the filter names no areas.
+func (s *ReportsService) ExportReports(ctx context.Context, filter model.ReportFilter, w export.ReportWriter) error {
+
+	if len(filter.Measurements) == 0 {
+		for measurement := range MeasurementUnits {
+			filter.Measurements = append(filter.Measurements, measurement)
+		}
+		sort.Strings(filter.Measurements)
+	}
+
+	for _, measurement := range filter.Measurements {
+		if _, ok := MeasurementUnits[measurement]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownMeasurement, measurement)
+		}
+	}
+
+	access := AccessFromContext(ctx)
+
+	if access.Restricted() && len(filter.AreaIds) == 0 {
+
+		for areaId, role := range access.Roles {
+			if model.RoleAllows(role, model.RoleView) {
+				filter.AreaIds = append(filter.AreaIds, areaId)
+			}
+		}
+
+		if len(filter.AreaIds) == 0 {
+			return fmt.Errorf("%w: %s", ErrForbidden, "reports")
+		}
+	}
+
+	for i := range filter.AreaIds {
+		if err := checkAreas(ctx, model.RoleView, "reports", &filter.AreaIds[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := s.reportsRepository.StreamReports(ctx, filter, w.Write); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func (s *ReportsService) GetLatestAreaValue(ctx context.Context, measurement string, areaId uint64) (*float64, error) {
+	return s.reportsRepository.GetLatestAreaValue(ctx, measurement, areaId)
+}
+
+// RecordBatteryReport adds a reading to the device's battery history, noting a replacement when it jumps back up to
+// full. The reading is written through the ingest queue when there is one, so it is spooled while the database is
+// unavailable.
+func (s *ReportsService) RecordBatteryReport(ctx context.Context, deviceId string, battery float64, voltage *float64) error {
+
+	date := time.Now().UTC()
+
+	if previous, ok := s.swapBattery(ctx, deviceId, battery); ok && IsBatteryReplacement(previous, battery) {
+		log.Printf("Battery of %s replaced, %v%% to %v%%\n", deviceId, previous, battery)
+		s.reportsRepository.CreateBatteryReplacement(ctx, deviceId, date, previous, battery)
+	}
+
+	if s.ingestService != nil {
+		return s.ingestService.Enqueue(model.Report{DeviceId: deviceId, Measurement: BatteryMeasurement, Date: date, Value: battery, RawValue: voltage})
+	}
+
+	_, err := s.reportsRepository.CreateBatteryReport(ctx, deviceId, date, battery, voltage)
+
+	return err
+}
+
+// swapBattery stores a device's battery reading, returning the one before it. The first time a device is seen that
+// is its latest in the history, if the database can be reached.
+func (s *ReportsService) swapBattery(ctx context.Context, deviceId string, battery float64) (float64, bool) {
+
+	s.batteriesMutex.Lock()
+	previous, ok := s.batteries[deviceId]
+	s.batteries[deviceId] = battery
+	s.batteriesMutex.Unlock()
+
+	if ok {
+		return previous, true
+	}
+
+	if report, err := s.reportsRepository.GetLatestBatteryReport(ctx, deviceId); err == nil && report != nil {
+		return report.Battery, true
+	}
+
+	return 0, false
+}
+
+func (s *ReportsService) GetBatteryReplacements(ctx context.Context, deviceId string) ([]model.BatteryReplacement, error) {
+	return s.reportsRepository.GetBatteryReplacements(ctx, deviceId)
+}
+
+func (s *ReportsService) GetBatteryReports(ctx context.Context, deviceId string, startDate time.Time, endDate time.Time) ([]model.BatteryReport, error) {
+	return s.reportsRepository.GetBatteryReports(ctx, deviceId, startDate, endDate)
+}
+
+// GetDevicesBatteryReports reads the battery history of several devices in one query, keyed by device and oldest first
+func (s *ReportsService) GetDevicesBatteryReports(ctx context.Context, deviceIds []string, startDate time.Time, endDate time.Time) (map[string][]model.BatteryReport, error) {
+
+	reports := make(map[string][]model.BatteryReport)
+
+	if len(deviceIds) == 0 {
+		return reports, nil
+	}
+
+	filter := model.ReportFilter{
+		Measurements: []string{BatteryMeasurement},
+		DeviceIds: deviceIds,
+		StartDate: &startDate,
+		EndDate: &endDate,
+	}
+
+	err := s.reportsRepository.StreamReports(ctx, filter, func(report model.Report) error {
+		reports[report.DeviceId] = append(reports[report.DeviceId], model.BatteryReport{DeviceId: report.DeviceId, Date: report.Date, Battery: report.Value})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// queueReport hands the reading to the ingest queue, publishing it straight away so automations and alerts do not
+// wait on the database. The reading is published even when the queue is full and it is dropped.
+func (s *ReportsService) queueReport(measurement string, deviceId string, areaId uint64, value float64, rawValue *float64) (model.Report, error) {
+
+	report := model.Report{
+		DeviceId: deviceId,
+		AreaId: areaId,
+		Measurement: measurement,
+		Date: time.Now().UTC(),
+		Value: value,
+		RawValue: rawValue,
+	}
+
+	err := s.ingestService.Enqueue(report)
+
+	s.publishMeasurement(measurement, report.DeviceId, report.AreaId, report.Date, report.Value)
+
+	return report, err
+}
+
+func (s *ReportsService) publishMeasurement(measurement string, deviceId string, areaId uint64, date time.Time, value float64) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	err := s.eventBus.Publish(events.MeasurementRecorded, events.MeasurementEvent{
+		DeviceId:    deviceId,
+		AreaId:      areaId,
+		Measurement: measurement,
+		Date:        date,
+		Value:       value,
+	})
+
+	if err != nil {
+		log.Println("ReportsService: unable to publish measurement", measurement, err)
+	}
+}
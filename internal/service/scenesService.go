@@ -0,0 +1,286 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"context"
+	"errors"
+	"log"
+	"strings"
+)
+
+// Attributes captured from each device, zigbee2mqtt accepts them back unchanged in a /set payload
+var sceneAttributes = []string{"state", "brightness", "color", "color_temp"}
+
+func NewScenesService(scenesRepository repository.IScenesRepository, devicesService *DevicesService, groupsService *GroupsService) *ScenesService {
+	return &ScenesService{scenesRepository: scenesRepository, devicesService: devicesService, groupsService: groupsService}
+}
+
+type ScenesService struct {
+	scenesRepository repository.IScenesRepository
+	devicesService *DevicesService
+	groupsService *GroupsService
+}
+
+func (s *ScenesService) GetScenes(ctx context.Context) ([]model.Scene, error) {
+	return s.scenesRepository.GetScenes(ctx)
+}
+
+func (s *ScenesService) GetScene(ctx context.Context, id uint64) (*model.Scene, error) {
+
+	scene, err := s.scenesRepository.GetScene(ctx, id)
+
+	if err == nil {
+		members, err := s.scenesRepository.GetSceneMembers(ctx, scene.Id)
+		if err == nil {
+			scene.Members = members
+		}
+	}
+
+	return scene, err
+}
+
+func (s *ScenesService) DeleteScene(ctx context.Context, id uint64) error {
+	return s.scenesRepository.DeleteScene(ctx, id)
+}
+
+// CaptureScene snapshots the current state of the requested devices into a new scene
+func (s *ScenesService) CaptureScene(ctx context.Context, mqttClient *broker.MqttClient, capture model.SceneCapture) (*model.Scene, error) {
+
+	if strings.TrimSpace(capture.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if capture.NativeSceneId != nil && capture.GroupId == nil {
+		return nil, errors.New("a native scene requires a group")
+	}
+
+	var group *model.Group
+
+	if capture.GroupId != nil {
+		var err error
+		if group, err = s.groupsService.GetGroup(ctx, *capture.GroupId); err != nil {
+			return nil, errors.New("group not found")
+		}
+	}
+
+	devices, err := s.sceneDevices(ctx, capture, group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Capturing a scene makes it recallable, so it is limited to devices the caller could set directly
+	for _, device := range devices {
+		if err := checkAreas(ctx, model.RoleControl, device.FriendlyName, device.AreaId); err != nil {
+			return nil, err
+		}
+	}
+
+	scene := model.Scene{
+		Name:          capture.Name,
+		AreaId:        capture.AreaId,
+		GroupId:       capture.GroupId,
+		NativeSceneId: capture.NativeSceneId,
+	}
+
+	for _, device := range devices {
+
+		state, err := s.devicesService.RequestDeviceAttributes(mqttClient, device.FriendlyName, sceneAttributes, DeviceStateTimeout)
+
+		if err != nil {
+			log.Printf("CaptureScene: skipping %s: %v\n", device.FriendlyName, err)
+			continue
+		}
+
+		captured := captureState(state)
+
+		if captured == nil {
+			log.Printf("CaptureScene: skipping %s, it does not report a state\n", device.FriendlyName)
+			continue
+		}
+
+		scene.Members = append(scene.Members, model.SceneMember{
+			IeeeAddress:  device.IeeeAddress,
+			FriendlyName: device.FriendlyName,
+			State:        captured,
+		})
+	}
+
+	if len(scene.Members) == 0 {
+		return nil, errors.New("none of the devices reported a state to capture")
+	}
+
+	created, err := s.scenesRepository.CreateScene(ctx, scene)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The members are in the captured state right now, so zigbee2mqtt can store it on the devices directly
+	if group != nil && capture.NativeSceneId != nil {
+		err = s.groupsService.SetGroupState(ctx, mqttClient, group, map[string]interface{}{
+			"scene_store": map[string]interface{}{"ID": *capture.NativeSceneId, "name": capture.Name},
+		})
+
+		if err != nil {
+			log.Println("CaptureScene: unable to store native scene", err)
+		}
+	}
+
+	return created, nil
+}
+
+// RecallScene restores a scene, as a single zigbee2mqtt scene_recall when stored natively otherwise device by device
+func (s *ScenesService) RecallScene(ctx context.Context, mqttClient *broker.MqttClient, scene *model.Scene, transition *float64) error {
+
+	if scene.GroupId != nil && scene.NativeSceneId != nil {
+
+		group, err := s.groupsService.GetGroup(ctx, *scene.GroupId)
+
+		if err != nil {
+			return err
+		}
+
+		return s.groupsService.SetGroupState(ctx, mqttClient, group, map[string]interface{}{"scene_recall": *scene.NativeSceneId})
+	}
+
+	devices, err := s.recallDevices(ctx, scene)
+
+	if err != nil {
+		return err
+	}
+
+	for i, member := range scene.Members {
+
+		payload := make(map[string]interface{}, len(member.State)+1)
+
+		for key, value := range member.State {
+			payload[key] = value
+		}
+
+		if transition != nil {
+			payload["transition"] = *transition
+		}
+
+		if err := s.devicesService.SetDeviceState(ctx, mqttClient, &devices[i], payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckSceneAccess returns ErrForbidden unless the access in the context may recall the scene
+func (s *ScenesService) CheckSceneAccess(ctx context.Context, scene *model.Scene) error {
+
+	if scene.GroupId != nil && scene.NativeSceneId != nil {
+
+		group, err := s.groupsService.GetGroup(ctx, *scene.GroupId)
+
+		if err != nil {
+			return err
+		}
+
+		return s.groupsService.CheckGroupAccess(ctx, group, model.RoleControl)
+	}
+
+	_, err := s.recallDevices(ctx, scene)
+
+	return err
+}
+
+// recallDevices looks up the devices of the scene's members, so that a recall which is not allowed for
+// all of them fails before any is sent
+func (s *ScenesService) recallDevices(ctx context.Context, scene *model.Scene) ([]model.Device, error) {
+
+	devices := make([]model.Device, 0, len(scene.Members))
+
+	for _, member := range scene.Members {
+
+		device, err := s.devicesService.GetDevice(ctx, member.IeeeAddress)
+
+		if err != nil {
+			return nil, errors.New("device not found: " + member.IeeeAddress)
+		}
+
+		if err := checkAreas(ctx, model.RoleControl, device.FriendlyName, device.AreaId); err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, *device)
+	}
+
+	return devices, nil
+}
+
+func (s *ScenesService) sceneDevices(ctx context.Context, capture model.SceneCapture, group *model.Group) ([]model.Device, error) {
+
+	var devices []model.Device
+	seen := make(map[string]bool)
+
+	add := func(device model.Device) {
+		if !seen[device.IeeeAddress] {
+			seen[device.IeeeAddress] = true
+			devices = append(devices, device)
+		}
+	}
+
+	for _, ieeeAddress := range capture.Devices {
+		device, err := s.devicesService.GetDevice(ctx, ieeeAddress)
+		if err != nil {
+			return nil, errors.New("device not found: " + ieeeAddress)
+		}
+		add(*device)
+	}
+
+	if capture.AreaId != nil {
+		all, err := s.devicesService.GetDevices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range all {
+			if device.Active && device.AreaId != nil && *device.AreaId == *capture.AreaId {
+				add(device)
+			}
+		}
+	}
+
+	if group != nil && len(capture.Devices) == 0 && capture.AreaId == nil {
+		for _, member := range group.Members {
+			add(model.Device{IeeeAddress: member.IeeeAddress, FriendlyName: member.FriendlyName, AreaId: member.AreaId})
+		}
+	}
+
+	if len(devices) == 0 {
+		return nil, errors.New("no devices to capture")
+	}
+
+	return devices, nil
+}
+
+// captureState keeps the restorable attributes of a state message, and only the colour matching the active color_mode
+func captureState(state map[string]interface{}) map[string]interface{} {
+
+	if state["state"] == nil {
+		return nil
+	}
+
+	captured := make(map[string]interface{})
+
+	for _, attribute := range sceneAttributes {
+		if state[attribute] != nil {
+			captured[attribute] = state[attribute]
+		}
+	}
+
+	switch state["color_mode"] {
+	case "color_temp":
+		delete(captured, "color")
+	case "xy", "hs":
+		delete(captured, "color_temp")
+	}
+
+	return captured
+}
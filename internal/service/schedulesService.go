@@ -0,0 +1,441 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/config"
+	"78concepts.com/domicile/internal/cron"
+	"78concepts.com/domicile/internal/events"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/repository"
+	"78concepts.com/domicile/internal/sun"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// A run this late is treated as missed, e.g. because the controller was not running
+	scheduleMissedAfter = time.Minute
+	// Re-evaluate at least this often so clock and timezone changes are picked up
+	scheduleMaxSleep = time.Minute
+	// A reload after a change gives up after this long, the next change or restart loads them again
+	scheduleLoadTimeout = 10 * time.Second
+)
+
+func NewSchedulesService(
+	schedulesRepository repository.ISchedulesRepository,
+	devicesService *DevicesService,
+	groupsService *GroupsService,
+	accessService *AccessService,
+	eventBus events.IEventBus,
+) *SchedulesService {
+
+	location := config.GetConfig().Location
+
+	return &SchedulesService{
+		schedulesRepository: schedulesRepository,
+		devicesService: devicesService,
+		groupsService: groupsService,
+		accessService: accessService,
+		eventBus: eventBus,
+		location: location.GetTimezone(),
+		latitude: location.Latitude,
+		longitude: location.Longitude,
+		wake: make(chan struct{}, 1),
+		reloads: make(chan struct{}, 1),
+	}
+}
+
+type SchedulesService struct {
+	schedulesRepository repository.ISchedulesRepository
+	devicesService *DevicesService
+	groupsService *GroupsService
+	accessService *AccessService
+	eventBus events.IEventBus
+	location *time.Location
+	latitude float64
+	longitude float64
+
+	mutex sync.Mutex
+	mqttClient *broker.MqttClient
+	schedules []model.Schedule
+	wake chan struct{}
+	reloads chan struct{}
+}
+
+// ManageSchedules runs the persisted schedules, reloading them whenever they are changed through the api
+func (s *SchedulesService) ManageSchedules(mqttClient *broker.MqttClient) {
+
+	s.mqttClient = mqttClient
+
+	s.LoadSchedules(mqttClient.Ctx)
+
+	// The reload reads and writes the database, so it is left to the run loop rather than done on the event handler
+	err := s.eventBus.Subscribe(func(ctx context.Context, event events.Event) {
+		select {
+		case s.reloads <- struct{}{}:
+		default:
+		}
+	}, events.ScheduleChanged)
+
+	if err != nil {
+		log.Fatalf("ManageSchedules: Subscribe error: %s", err)
+	}
+
+	go s.run(mqttClient.Ctx)
+}
+
+func (s *SchedulesService) LoadSchedules(ctx context.Context) {
+
+	schedules, err := s.schedulesRepository.GetSchedules(ctx)
+
+	if err != nil {
+		log.Println("LoadSchedules:", err)
+		return
+	}
+
+	now := time.Now()
+
+	for i := range schedules {
+		if schedules[i].Enabled && schedules[i].NextRun == nil {
+			schedules[i].NextRun = s.NextRun(schedules[i], now)
+			if err := s.schedulesRepository.UpdateScheduleRuns(ctx, schedules[i].Id, schedules[i].LastRun, schedules[i].NextRun); err != nil {
+				log.Printf("Schedule %d (%s): %v\n", schedules[i].Id, schedules[i].Name, err)
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	s.schedules = schedules
+	s.mutex.Unlock()
+
+	log.Printf("Loaded %d schedules\n", len(schedules))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *SchedulesService) run(ctx context.Context) {
+
+	for {
+		sleep := scheduleMaxSleep
+
+		s.mutex.Lock()
+		for _, schedule := range s.schedules {
+			if schedule.Enabled && schedule.NextRun != nil {
+				if until := time.Until(*schedule.NextRun); until < sleep {
+					sleep = until
+				}
+			}
+		}
+		s.mutex.Unlock()
+
+		if sleep < 0 {
+			sleep = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.reloads:
+			loadCtx, cancel := context.WithTimeout(ctx, scheduleLoadTimeout)
+			s.LoadSchedules(loadCtx)
+			cancel()
+		case <-s.wake:
+		case <-time.After(sleep):
+		}
+
+		s.runDue(ctx, time.Now())
+	}
+}
+
+// runDue runs the schedules whose time has come. They are copied out under the lock and run without it, since sending
+// commands and writing to the database can take a while
+func (s *SchedulesService) runDue(ctx context.Context, now time.Time) {
+
+	var due []model.Schedule
+
+	s.mutex.Lock()
+	for _, schedule := range s.schedules {
+		if schedule.Enabled && schedule.NextRun != nil && !schedule.NextRun.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, schedule := range due {
+
+		missed := now.Sub(*schedule.NextRun) > scheduleMissedAfter
+
+		if !missed || schedule.MissedRun == model.MissedRunCatchUp {
+			if err := s.Execute(ctx, schedule); err != nil {
+				log.Printf("Schedule %d (%s): %v\n", schedule.Id, schedule.Name, err)
+			}
+			lastRun := now.UTC()
+			schedule.LastRun = &lastRun
+		} else {
+			log.Printf("Schedule %d (%s): skipping run missed at %s\n", schedule.Id, schedule.Name, schedule.NextRun)
+		}
+
+		schedule.NextRun = s.NextRun(schedule, now)
+
+		s.setRuns(schedule)
+
+		if err := s.schedulesRepository.UpdateScheduleRuns(ctx, schedule.Id, schedule.LastRun, schedule.NextRun); err != nil {
+			log.Printf("Schedule %d (%s): %v\n", schedule.Id, schedule.Name, err)
+		}
+	}
+}
+
+func (s *SchedulesService) setRuns(schedule model.Schedule) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.schedules {
+		if s.schedules[i].Id == schedule.Id {
+			s.schedules[i].LastRun = schedule.LastRun
+			s.schedules[i].NextRun = schedule.NextRun
+		}
+	}
+}
+
+// Execute publishes the schedule's payload on the set topic of its device or group
+func (s *SchedulesService) Execute(ctx context.Context, schedule model.Schedule) error {
+
+	log.Printf("Schedule %d (%s): running\n", schedule.Id, schedule.Name)
+
+	ctx, err := s.accessService.OwnerContext(WithOrigin(ctx, scheduleOrigin(schedule.Id)), schedule.OwnerId)
+
+	if err != nil {
+		return err
+	}
+
+	switch schedule.TargetType {
+
+	case model.ScheduleTargetDevice:
+		device, err := s.devicesService.GetDevice(ctx, *schedule.IeeeAddress)
+		if err != nil {
+			return err
+		}
+		return s.devicesService.SetDeviceState(ctx, s.mqttClient, device, schedule.Payload)
+
+	case model.ScheduleTargetGroup:
+		group, err := s.groupsService.GetGroup(ctx, *schedule.GroupId)
+		if err != nil {
+			return err
+		}
+		return s.groupsService.SetGroupState(ctx, s.mqttClient, group, schedule.Payload)
+	}
+
+	return errors.New("unknown target type " + schedule.TargetType)
+}
+
+// NextRun returns the first time after the given one at which the schedule should run, or nil if it never will
+func (s *SchedulesService) NextRun(schedule model.Schedule, after time.Time) *time.Time {
+
+	after = after.In(s.location)
+
+	switch schedule.Type {
+
+	case model.ScheduleCron:
+		expression, err := cron.Parse(*schedule.Cron)
+		if err != nil {
+			return nil
+		}
+		next := expression.Next(after)
+		if next.IsZero() {
+			return nil
+		}
+		next = next.UTC()
+		return &next
+
+	case model.ScheduleSunrise, model.ScheduleSunset:
+		offset := time.Duration(schedule.OffsetMinutes) * time.Minute
+
+		// Start a day early, a large negative offset can move the run onto the previous day
+		for i := -1; i <= 366; i++ {
+			day := time.Date(after.Year(), after.Month(), after.Day()+i, 12, 0, 0, 0, s.location)
+
+			var event time.Time
+			var ok bool
+
+			if schedule.Type == model.ScheduleSunrise {
+				event, ok = sun.Sunrise(day, s.latitude, s.longitude)
+			} else {
+				event, ok = sun.Sunset(day, s.latitude, s.longitude)
+			}
+
+			if !ok {
+				continue
+			}
+
+			next := event.Add(offset).Truncate(time.Second)
+
+			if next.After(after) && matchesWeekday(schedule.Weekdays, next) {
+				next = next.UTC()
+				return &next
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SchedulesService) GetSchedules(ctx context.Context) ([]model.Schedule, error) {
+	return s.schedulesRepository.GetSchedules(ctx)
+}
+
+func (s *SchedulesService) GetSchedule(ctx context.Context, id uint64) (*model.Schedule, error) {
+	return s.schedulesRepository.GetSchedule(ctx, id)
+}
+
+func (s *SchedulesService) CreateSchedule(ctx context.Context, schedule model.Schedule) (*model.Schedule, error) {
+
+	if err := ValidateSchedule(&schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTarget(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	schedule.NextRun = s.NextRun(schedule, time.Now())
+
+	created, err := s.schedulesRepository.CreateSchedule(ctx, schedule)
+
+	if err == nil {
+		s.publishChanged(created.Id)
+	}
+
+	return created, err
+}
+
+func (s *SchedulesService) UpdateSchedule(ctx context.Context, schedule model.Schedule) (*model.Schedule, error) {
+
+	if err := ValidateSchedule(&schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTarget(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	schedule.NextRun = s.NextRun(schedule, time.Now())
+
+	updated, err := s.schedulesRepository.UpdateSchedule(ctx, schedule)
+
+	if err == nil {
+		s.publishChanged(updated.Id)
+	}
+
+	return updated, err
+}
+
+// checkTarget refuses to save a schedule for a device or group the caller could not control directly
+func (s *SchedulesService) checkTarget(ctx context.Context, schedule model.Schedule) error {
+
+	switch schedule.TargetType {
+
+	case model.ScheduleTargetDevice:
+		device, err := s.devicesService.GetDevice(ctx, *schedule.IeeeAddress)
+		if err != nil {
+			return errors.New("device not found")
+		}
+		return checkAreas(ctx, model.RoleControl, device.FriendlyName, device.AreaId)
+
+	case model.ScheduleTargetGroup:
+		group, err := s.groupsService.GetGroup(ctx, *schedule.GroupId)
+		if err != nil {
+			return errors.New("group not found")
+		}
+		return s.groupsService.CheckGroupAccess(ctx, group, model.RoleControl)
+	}
+
+	return nil
+}
+
+func (s *SchedulesService) DeleteSchedule(ctx context.Context, id uint64) error {
+
+	err := s.schedulesRepository.DeleteSchedule(ctx, id)
+
+	if err == nil {
+		s.publishChanged(id)
+	}
+
+	return err
+}
+
+func (s *SchedulesService) publishChanged(id uint64) {
+
+	if s.eventBus == nil {
+		return
+	}
+
+	if err := s.eventBus.Publish(events.ScheduleChanged, events.ScheduleEvent{ScheduleId: id}); err != nil {
+		log.Println("SchedulesService: unable to publish event", err)
+	}
+}
+
+// ValidateSchedule checks a schedule and fills in the default missed run policy
+func ValidateSchedule(schedule *model.Schedule) error {
+
+	if strings.TrimSpace(schedule.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	switch schedule.Type {
+	case model.ScheduleCron:
+		if schedule.Cron == nil {
+			return errors.New("cron is required")
+		}
+		if _, err := cron.Parse(*schedule.Cron); err != nil {
+			return err
+		}
+	case model.ScheduleSunrise, model.ScheduleSunset:
+		if schedule.OffsetMinutes <= -720 || schedule.OffsetMinutes >= 720 {
+			return errors.New("offsetMinutes must be within 12 hours")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", schedule.Type)
+	}
+
+	for _, weekday := range schedule.Weekdays {
+		if weekday < 0 || weekday > 7 {
+			return fmt.Errorf("invalid weekday %d", weekday)
+		}
+	}
+
+	switch schedule.TargetType {
+	case model.ScheduleTargetDevice:
+		if schedule.IeeeAddress == nil {
+			return errors.New("ieeeAddress is required")
+		}
+	case model.ScheduleTargetGroup:
+		if schedule.GroupId == nil {
+			return errors.New("groupId is required")
+		}
+	default:
+		return fmt.Errorf("unknown target type %q", schedule.TargetType)
+	}
+
+	if len(schedule.Payload) == 0 {
+		return errors.New("payload is required")
+	}
+
+	switch schedule.MissedRun {
+	case "":
+		schedule.MissedRun = model.MissedRunSkip
+	case model.MissedRunSkip, model.MissedRunCatchUp:
+	default:
+		return fmt.Errorf("unknown missed run policy %q", schedule.MissedRun)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/sun"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	melbourneLatitude  = -37.8136
+	melbourneLongitude = 144.9631
+)
+
+func TestNextRun(t *testing.T) {
+
+	melbourne, err := time.LoadLocation("Australia/Melbourne")
+
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	s := &SchedulesService{location: melbourne, latitude: melbourneLatitude, longitude: melbourneLongitude}
+
+	// Days are in 2026, with January 0 the last day of 2025
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 12, 0, 0, 0, melbourne)
+	}
+
+	sunrise := func(month time.Month, date int) time.Time {
+		event, _ := sun.Sunrise(day(month, date), melbourneLatitude, melbourneLongitude)
+		return event.Truncate(time.Second)
+	}
+
+	sunset := func(month time.Month, date int) time.Time {
+		event, _ := sun.Sunset(day(month, date), melbourneLatitude, melbourneLongitude)
+		return event.Truncate(time.Second)
+	}
+
+	// 1 January 2026 is a Thursday
+	midnight := time.Date(2026, time.January, 1, 0, 0, 0, 0, melbourne)
+
+	tests := []struct {
+		name     string
+		schedule model.Schedule
+		after    time.Time
+		expected *time.Time
+	}{
+		{
+			name:     "cron",
+			schedule: model.Schedule{Type: model.ScheduleCron, Cron: stringRef("30 7 * * *")},
+			after:    midnight.Add(8 * time.Hour),
+			expected: timeRef(time.Date(2026, time.January, 2, 7, 30, 0, 0, melbourne)),
+		},
+		{
+			name:     "invalid cron",
+			schedule: model.Schedule{Type: model.ScheduleCron, Cron: stringRef("every morning")},
+			after:    midnight,
+		},
+		{
+			name:     "sunrise",
+			schedule: model.Schedule{Type: model.ScheduleSunrise},
+			after:    midnight,
+			expected: timeRef(sunrise(time.January, 1)),
+		},
+		{
+			name:     "sunrise already passed",
+			schedule: model.Schedule{Type: model.ScheduleSunrise},
+			after:    midnight.Add(10 * time.Hour),
+			expected: timeRef(sunrise(time.January, 2)),
+		},
+		{
+			name:     "before sunset",
+			schedule: model.Schedule{Type: model.ScheduleSunset, OffsetMinutes: -30},
+			after:    midnight,
+			expected: timeRef(sunset(time.January, 1).Add(-30 * time.Minute)),
+		},
+		{
+			name:     "offset past midnight",
+			schedule: model.Schedule{Type: model.ScheduleSunset, OffsetMinutes: 600},
+			after:    midnight,
+			expected: timeRef(sunset(time.January, 0).Add(600 * time.Minute)),
+		},
+		{
+			name:     "offset before midnight",
+			schedule: model.Schedule{Type: model.ScheduleSunrise, OffsetMinutes: -420},
+			after:    midnight.Add(-2 * time.Hour),
+			expected: timeRef(sunrise(time.January, 1).Add(-420 * time.Minute)),
+		},
+		{
+			name:     "next weekday",
+			schedule: model.Schedule{Type: model.ScheduleSunrise, Weekdays: []int{1}},
+			after:    midnight,
+			expected: timeRef(sunrise(time.January, 5)),
+		},
+		{
+			name:     "sunday as 7",
+			schedule: model.Schedule{Type: model.ScheduleSunset, Weekdays: []int{7}},
+			after:    midnight,
+			expected: timeRef(sunset(time.January, 4)),
+		},
+	}
+
+	for _, test := range tests {
+
+		next := s.NextRun(test.schedule, test.after)
+
+		switch {
+		case test.expected == nil && next != nil:
+			t.Errorf("%s: NextRun = %s, expected none", test.name, next)
+		case test.expected == nil:
+		case next == nil:
+			t.Errorf("%s: NextRun = none, expected %s", test.name, test.expected.In(melbourne))
+		case !next.Equal(*test.expected) || next.Location() != time.UTC:
+			t.Errorf("%s: NextRun = %s, expected %s in UTC", test.name, next, test.expected.In(melbourne))
+		}
+	}
+}
+
+func timeRef(value time.Time) *time.Time {
+	return &value
+}
+
+func TestValidateSchedule(t *testing.T) {
+
+	valid := func() model.Schedule {
+		return model.Schedule{
+			Name:        "Porch light",
+			Type:        model.ScheduleCron,
+			Cron:        stringRef("0 18 * * *"),
+			TargetType:  model.ScheduleTargetDevice,
+			IeeeAddress: stringRef("0x01"),
+			Payload:     map[string]interface{}{"state": "ON"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(schedule *model.Schedule)
+		err    string
+	}{
+		{"valid", func(schedule *model.Schedule) {}, ""},
+		{"blank name", func(schedule *model.Schedule) { schedule.Name = "" }, "name is required"},
+		{"no cron", func(schedule *model.Schedule) { schedule.Cron = nil }, "cron is required"},
+		{"bad cron", func(schedule *model.Schedule) { schedule.Cron = stringRef("0 25 * * *") }, "cron"},
+		{"unknown type", func(schedule *model.Schedule) { schedule.Type = "noon" }, "unknown type"},
+		{"sunset within 12 hours", func(schedule *model.Schedule) {
+			schedule.Type = model.ScheduleSunset
+			schedule.OffsetMinutes = -719
+		}, ""},
+		{"sunset 12 hours late", func(schedule *model.Schedule) {
+			schedule.Type = model.ScheduleSunset
+			schedule.OffsetMinutes = 720
+		}, "offsetMinutes must be within 12 hours"},
+		{"sunday as 7", func(schedule *model.Schedule) { schedule.Weekdays = []int{0, 7} }, ""},
+		{"bad weekday", func(schedule *model.Schedule) { schedule.Weekdays = []int{1, 8} }, "invalid weekday 8"},
+		{"device without address", func(schedule *model.Schedule) { schedule.IeeeAddress = nil }, "ieeeAddress is required"},
+		{"group without id", func(schedule *model.Schedule) { schedule.TargetType = model.ScheduleTargetGroup }, "groupId is required"},
+		{"unknown target", func(schedule *model.Schedule) { schedule.TargetType = "scene" }, "unknown target type"},
+		{"no payload", func(schedule *model.Schedule) { schedule.Payload = nil }, "payload is required"},
+		{"catch up", func(schedule *model.Schedule) { schedule.MissedRun = model.MissedRunCatchUp }, ""},
+		{"unknown missed run", func(schedule *model.Schedule) { schedule.MissedRun = "retry" }, "unknown missed run policy"},
+	}
+
+	for _, test := range tests {
+
+		schedule := valid()
+		test.change(&schedule)
+
+		err := ValidateSchedule(&schedule)
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: ValidateSchedule = %v", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: ValidateSchedule = %v, expected %q", test.name, err, test.err)
+		}
+	}
+
+	schedule := valid()
+
+	if err := ValidateSchedule(&schedule); err != nil || schedule.MissedRun != model.MissedRunSkip {
+		t.Errorf("missed run policy defaulted to %q, expected %q", schedule.MissedRun, model.MissedRunSkip)
+	}
+}
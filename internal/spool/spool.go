@@ -0,0 +1,365 @@
+package spool
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentExtension = ".jsonl"
+	// Segments that cannot be read are renamed with this added, out of the way of replay but kept to be looked at
+	quarantineExtension = ".quarantined"
+	// A segment takes appends until it holds this many reports, or until it is taken for replay
+	segmentReports = 10000
+)
+
+// Spool keeps reports on disk, in the order they were added, while they cannot be written to the database. Reports
+// are appended as JSON lines to numbered segment files that are taken oldest first, so a spool left behind by a
+// stopped controller is carried on with when it starts again.
+type Spool struct {
+	directory string
+	mutex sync.Mutex
+	segments []segment
+	// sealed is set once the newest segment is taken, so it takes no more appends
+	sealed bool
+}
+
+type segment struct {
+	id uint64
+	reports int64
+	bytes int64
+}
+
+// Stats are the reports waiting in the spool and the size of its files
+type Stats struct {
+	Segments int
+	Reports int64
+	Bytes int64
+}
+
+func Open(directory string) (*Spool, error) {
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{directory: directory}
+
+	for _, file := range files {
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), segmentExtension), 10, 64)
+
+		if err != nil || !strings.HasSuffix(file.Name(), segmentExtension) {
+			continue
+		}
+
+		reports, err := s.read(id)
+
+		if err != nil {
+			if err := s.quarantine(id, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		s.segments = append(s.segments, segment{id: id, reports: int64(len(reports)), bytes: file.Size()})
+	}
+
+	sort.Slice(s.segments, func(i int, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+
+	// Appending to a segment that was cut short could join a torn line to the next report
+	s.sealed = true
+
+	return s, nil
+}
+
+// Append adds the reports to the newest segment, synced to disk before returning
+func (s *Spool) Append(reports []model.Report) error {
+
+	if len(reports) == 0 {
+		return nil
+	}
+
+	var data []byte
+
+	for _, report := range reports {
+		line, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.segments) == 0 || s.sealed || s.segments[len(s.segments)-1].reports >= segmentReports {
+
+		id := uint64(1)
+		if len(s.segments) > 0 {
+			id = s.segments[len(s.segments)-1].id + 1
+		}
+
+		s.segments = append(s.segments, segment{id: id})
+		s.sealed = false
+	}
+
+	last := &s.segments[len(s.segments)-1]
+
+	file, err := os.OpenFile(s.path(last.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		if last.reports == 0 {
+			os.Remove(s.path(last.id))
+			s.segments = s.segments[:len(s.segments)-1]
+		}
+		// Whatever part was written may be torn, so leave the segment for replay as it is
+		s.sealed = true
+		return err
+	}
+
+	last.reports += int64(len(reports))
+	last.bytes += int64(len(data))
+
+	return nil
+}
+
+// Oldest returns the oldest segment's id and reports, which stay in the spool until removed. ok is false when the
+// spool is empty.
+func (s *Spool) Oldest() (id uint64, reports []model.Report, ok bool, err error) {
+
+	s.mutex.Lock()
+
+	if len(s.segments) == 0 {
+		s.mutex.Unlock()
+		return 0, nil, false, nil
+	}
+
+	id = s.segments[0].id
+
+	if len(s.segments) == 1 {
+		s.sealed = true
+	}
+
+	s.mutex.Unlock()
+
+	reports, err = s.read(id)
+
+	return id, reports, true, err
+}
+
+// Replace rewrites a segment taken with Oldest to hold only the reports still to be written
+func (s *Spool) Replace(id uint64, reports []model.Report) error {
+
+	if len(reports) == 0 {
+		return s.Remove(id)
+	}
+
+	temporary := s.path(id) + ".tmp"
+
+	file, err := os.OpenFile(temporary, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, report := range reports {
+		if err = encoder.Encode(report); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temporary, s.path(id))
+	}
+
+	if err != nil {
+		os.Remove(temporary)
+		return err
+	}
+
+	info, err := os.Stat(s.path(id))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.segments {
+		if s.segments[i].id == id {
+			s.segments[i].reports = int64(len(reports))
+			if err == nil {
+				s.segments[i].bytes = info.Size()
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove deletes a segment once its reports are written
+func (s *Spool) Remove(id uint64) error {
+
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.segments {
+		if s.segments[i].id == id {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Quarantine moves a segment taken with Oldest out of the spool when it cannot be replayed, so it no longer holds up
+// the segments behind it
+func (s *Spool) Quarantine(id uint64, reason error) error {
+
+	if err := s.quarantine(id, reason); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.segments {
+		if s.segments[i].id == id {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *Spool) quarantine(id uint64, reason error) error {
+
+	// Ids start again from 1 once the spool empties, so the time keeps a later segment from taking the same name
+	quarantined := s.path(id) + "." + time.Now().UTC().Format("20060102T150405.000000000") + quarantineExtension
+
+	log.Printf("Spool: quarantining segment %d as %s: %v\n", id, quarantined, reason)
+
+	if err := os.Rename(s.path(id), quarantined); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Spool) Empty() bool {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.segments) == 0
+}
+
+func (s *Spool) Stats() Stats {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := Stats{Segments: len(s.segments)}
+
+	for _, segment := range s.segments {
+		stats.Reports += segment.reports
+		stats.Bytes += segment.bytes
+	}
+
+	return stats
+}
+
+// read loads a segment, skipping a last line cut short when the controller stopped part way through an append
+func (s *Spool) read(id uint64) ([]model.Report, error) {
+
+	file, err := os.Open(s.path(id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	reports := make([]model.Report, 0)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+
+	for scanner.Scan() {
+
+		line++
+
+		var report model.Report
+
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			log.Printf("Spool: skipping unreadable line %d of segment %d: %v\n", line, id, err)
+			continue
+		}
+
+		reports = append(reports, report)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read spool segment %d: %w", id, err)
+	}
+
+	return reports, nil
+}
+
+func (s *Spool) path(id uint64) string {
+	return filepath.Join(s.directory, fmt.Sprintf("%020d%s", id, segmentExtension))
+}
@@ -0,0 +1,294 @@
+package spool
+
+import (
+	"78concepts.com/domicile/internal/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reports(values ...float64) []model.Report {
+
+	var reports []model.Report
+
+	for _, value := range values {
+		reports = append(reports, model.Report{
+			DeviceId:    "0x01",
+			AreaId:      3,
+			Measurement: "temperature",
+			Date:        time.Date(2026, time.January, 14, 9, 30, int(value), 0, time.UTC),
+			Value:       value,
+		})
+	}
+
+	return reports
+}
+
+func values(reports []model.Report) []float64 {
+
+	var values []float64
+
+	for _, report := range reports {
+		values = append(values, report.Value)
+	}
+
+	return values
+}
+
+func equal(a []float64, b []float64) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func openSpool(t *testing.T, directory string) *Spool {
+
+	t.Helper()
+
+	s, err := Open(directory)
+
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	return s
+}
+
+func appendReports(t *testing.T, s *Spool, values ...float64) {
+
+	t.Helper()
+
+	if err := s.Append(reports(values...)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+}
+
+// drain takes every segment oldest first, removing each, and returns the values of each segment
+func drain(t *testing.T, s *Spool) [][]float64 {
+
+	t.Helper()
+
+	var segments [][]float64
+
+	for {
+		id, batch, ok, err := s.Oldest()
+
+		if err != nil {
+			t.Fatalf("Oldest: %v", err)
+		}
+
+		if !ok {
+			return segments
+		}
+
+		segments = append(segments, values(batch))
+
+		if err := s.Remove(id); err != nil {
+			t.Fatalf("Remove: %v", err)
+		}
+	}
+}
+
+func checkSegments(t *testing.T, actual [][]float64, expected ...[]float64) {
+
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("segments %v, expected %v", actual, expected)
+	}
+
+	for i := range actual {
+		if !equal(actual[i], expected[i]) {
+			t.Fatalf("segments %v, expected %v", actual, expected)
+		}
+	}
+}
+
+func TestSpoolKeepsOrder(t *testing.T) {
+
+	s := openSpool(t, t.TempDir())
+
+	if !s.Empty() {
+		t.Fatal("a new spool is not empty")
+	}
+
+	appendReports(t, s, 1, 2)
+	appendReports(t, s, 3)
+
+	id, batch, ok, err := s.Oldest()
+
+	if err != nil || !ok || !equal(values(batch), []float64{1, 2, 3}) {
+		t.Fatalf("Oldest = %v, %v, %v", values(batch), ok, err)
+	}
+
+	// Taking the newest segment seals it, so what comes in during the replay goes to the next one
+	appendReports(t, s, 4)
+
+	if stats := s.Stats(); stats.Segments != 2 || stats.Reports != 4 || stats.Bytes == 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+
+	if err := s.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+
+	appendReports(t, s, 5)
+
+	checkSegments(t, drain(t, s), []float64{4, 5})
+
+	if stats := s.Stats(); !s.Empty() || stats != (Stats{}) {
+		t.Errorf("drained spool Stats = %+v", stats)
+	}
+}
+
+func TestSpoolReplace(t *testing.T) {
+
+	directory := t.TempDir()
+	s := openSpool(t, directory)
+
+	appendReports(t, s, 1, 2, 3)
+
+	id, _, _, err := s.Oldest()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendReports(t, s, 4)
+
+	// Part of the segment was written before the database went away again
+	if err := s.Replace(id, reports(2, 3)); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+
+	if stats := s.Stats(); stats.Segments != 2 || stats.Reports != 3 {
+		t.Errorf("Stats after Replace = %+v", stats)
+	}
+
+	// The trimmed segment is still the oldest, and stays so when the spool is opened again
+	checkSegments(t, drain(t, openSpool(t, directory)), []float64{2, 3}, []float64{4})
+
+	// The temporary file is gone
+	if files, _ := ioutil.ReadDir(directory); len(files) != 0 {
+		t.Errorf("files left behind: %v", files[0].Name())
+	}
+
+	s = openSpool(t, directory)
+	appendReports(t, s, 5)
+
+	id, _, _, _ = s.Oldest()
+
+	// Nothing left to write removes the segment
+	if err := s.Replace(id, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Empty() {
+		t.Error("Replace with nothing left kept the segment")
+	}
+}
+
+func TestSpoolCarriesOnAfterRestart(t *testing.T) {
+
+	directory := t.TempDir()
+	s := openSpool(t, directory)
+
+	appendReports(t, s, 1, 2)
+
+	s = openSpool(t, directory)
+
+	if stats := s.Stats(); stats.Segments != 1 || stats.Reports != 2 {
+		t.Errorf("Stats after Open = %+v", stats)
+	}
+
+	// A reopened spool starts a new segment rather than appending to one that may have been cut short
+	appendReports(t, s, 3)
+
+	checkSegments(t, drain(t, s), []float64{1, 2}, []float64{3})
+}
+
+func TestSpoolSkipsATornLastLine(t *testing.T) {
+
+	directory := t.TempDir()
+	s := openSpool(t, directory)
+
+	appendReports(t, s, 1, 2)
+
+	// The controller stopped part way through writing the third report
+	file, err := os.OpenFile(s.path(1), os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.WriteString(`{"ieeeAddr":"0x01","areaId":3,"measur`)
+	file.Close()
+
+	s = openSpool(t, directory)
+
+	if stats := s.Stats(); stats.Reports != 2 {
+		t.Errorf("Stats = %+v, expected the 2 whole reports", stats)
+	}
+
+	appendReports(t, s, 3)
+
+	checkSegments(t, drain(t, s), []float64{1, 2}, []float64{3})
+}
+
+func TestSpoolQuarantinesUnreadableSegments(t *testing.T) {
+
+	directory := t.TempDir()
+	s := openSpool(t, directory)
+
+	appendReports(t, s, 1)
+	s.Oldest()
+	appendReports(t, s, 2)
+
+	// A line longer than the reader takes can never be read
+	if err := ioutil.WriteFile(s.path(1), []byte(strings.Repeat("x", 2*1024*1024)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	id, _, ok, err := s.Oldest()
+
+	if !ok || err == nil {
+		t.Fatalf("Oldest read an unreadable segment: %v, %v", ok, err)
+	}
+
+	if err := s.Quarantine(id, err); err != nil {
+		t.Fatalf("Quarantine: %v", err)
+	}
+
+	checkSegments(t, drain(t, s), []float64{2})
+
+	quarantined, _ := filepath.Glob(filepath.Join(directory, "*"+quarantineExtension))
+
+	if len(quarantined) != 1 {
+		t.Fatalf("quarantined files %v", quarantined)
+	}
+
+	// Another unreadable segment of the same id found when opening is put aside under its own name
+	if err := ioutil.WriteFile(s.path(1), []byte(strings.Repeat("x", 2*1024*1024)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if s = openSpool(t, directory); !s.Empty() {
+		t.Errorf("Open kept an unreadable segment: %+v", s.Stats())
+	}
+
+	if quarantined, _ = filepath.Glob(filepath.Join(directory, "*"+quarantineExtension)); len(quarantined) != 2 {
+		t.Errorf("quarantined files %v", quarantined)
+	}
+}
@@ -0,0 +1,69 @@
+package sun
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+	secondsPerDay   = 86400.0
+	// Sun's apparent radius plus atmospheric refraction at the horizon
+	horizonAltitude = -0.833
+	obliquity       = 23.4397
+)
+
+// Sunrise returns the time of sunrise on the calendar date of day, as observed at latitude and longitude
+// (degrees, east positive). ok is false when the sun does not rise or set that day, e.g. polar day or night.
+func Sunrise(day time.Time, latitude float64, longitude float64) (time.Time, bool) {
+	rise, _, ok := calculate(day, latitude, longitude)
+	return rise.In(day.Location()), ok
+}
+
+// Sunset returns the time of sunset on the calendar date of day, see Sunrise
+func Sunset(day time.Time, latitude float64, longitude float64) (time.Time, bool) {
+	_, set, ok := calculate(day, latitude, longitude)
+	return set.In(day.Location()), ok
+}
+
+// calculate implements the sunrise equation, accurate to about a minute away from the poles
+func calculate(day time.Time, latitude float64, longitude float64) (time.Time, time.Time, bool) {
+
+	date := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, time.UTC)
+	julianDate := float64(date.Unix())/secondsPerDay + julianUnixEpoch
+
+	n := math.Round(julianDate - julian2000 + 0.0008)
+	meanSolarNoon := n - longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarNoon, 360)
+	center := 1.9148*sin(anomaly) + 0.02*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+
+	transit := julian2000 + meanSolarNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*eclipticLongitude)
+
+	declination := math.Asin(sin(eclipticLongitude) * sin(obliquity))
+
+	cosHourAngle := (sin(horizonAltitude) - sin(latitude)*math.Sin(declination)) / (cos(latitude) * math.Cos(declination))
+
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), true
+}
+
+func fromJulian(julianDate float64) time.Time {
+	seconds := (julianDate - julianUnixEpoch) * secondsPerDay
+	return time.Unix(int64(math.Round(seconds)), 0).UTC()
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cos(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
@@ -0,0 +1,107 @@
+package sun
+
+import (
+	"testing"
+	"time"
+)
+
+// Published times are rounded to the minute and the equation is accurate to about a minute
+const tolerance = 3 * time.Minute
+
+func TestSunriseAndSunset(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		location  string
+		latitude  float64
+		longitude float64
+		date      [3]int
+		sunrise   string
+		sunset    string
+	}{
+		{"Melbourne summer", "Australia/Melbourne", -37.8136, 144.9631, [3]int{2026, 1, 1}, "06:00", "20:44"},
+		{"Melbourne winter", "Australia/Melbourne", -37.8136, 144.9631, [3]int{2026, 6, 21}, "07:35", "17:08"},
+		{"London summer", "Europe/London", 51.5074, -0.1278, [3]int{2026, 6, 21}, "04:43", "21:21"},
+		{"London winter", "Europe/London", 51.5074, -0.1278, [3]int{2026, 12, 21}, "08:03", "15:53"},
+		// Local noon falls on the previous and next day in UTC
+		{"Auckland", "Pacific/Auckland", -36.8485, 174.7633, [3]int{2026, 1, 1}, "06:04", "20:43"},
+		{"Honolulu", "Pacific/Honolulu", 21.3069, -157.8583, [3]int{2026, 1, 1}, "07:09", "18:00"},
+		{"Equinox on the equator", "UTC", 0, 0, [3]int{2026, 3, 20}, "06:04", "18:10"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			location, err := time.LoadLocation(test.location)
+
+			if err != nil {
+				t.Skip("no time zone database:", err)
+			}
+
+			// Any time of the day gives that day's times
+			for _, hour := range []int{0, 12, 23} {
+
+				day := time.Date(test.date[0], time.Month(test.date[1]), test.date[2], hour, 30, 0, 0, location)
+
+				sunrise, ok := Sunrise(day, test.latitude, test.longitude)
+
+				if !ok {
+					t.Fatalf("Sunrise(%s) found no sunrise", day)
+				}
+
+				checkTime(t, "sunrise", sunrise, day, test.sunrise)
+
+				sunset, ok := Sunset(day, test.latitude, test.longitude)
+
+				if !ok {
+					t.Fatalf("Sunset(%s) found no sunset", day)
+				}
+
+				checkTime(t, "sunset", sunset, day, test.sunset)
+			}
+		})
+	}
+}
+
+func TestPolarDayAndNight(t *testing.T) {
+
+	// Tromsø has midnight sun in June and polar night in December
+	for _, day := range []time.Time{
+		time.Date(2026, time.June, 21, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, time.December, 21, 12, 0, 0, 0, time.UTC),
+	} {
+		if _, ok := Sunrise(day, 69.6492, 18.9553); ok {
+			t.Errorf("Sunrise(%s) in Tromsø found a sunrise", day.Format("2006-01-02"))
+		}
+
+		if _, ok := Sunset(day, 69.6492, 18.9553); ok {
+			t.Errorf("Sunset(%s) in Tromsø found a sunset", day.Format("2006-01-02"))
+		}
+	}
+
+	// The sun still rises there at the equinox
+	if _, ok := Sunrise(time.Date(2026, time.March, 20, 12, 0, 0, 0, time.UTC), 69.6492, 18.9553); !ok {
+		t.Error("Sunrise at the equinox in Tromsø found no sunrise")
+	}
+}
+
+func checkTime(t *testing.T, name string, actual time.Time, day time.Time, expected string) {
+
+	t.Helper()
+
+	clock, err := time.Parse("15:04", expected)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location())
+
+	if actual.Location() != day.Location() {
+		t.Errorf("%s is in %s, expected %s", name, actual.Location(), day.Location())
+	}
+
+	if difference := actual.Sub(want); difference > tolerance || difference < -tolerance {
+		t.Errorf("%s on %s = %s, expected about %s", name, day.Format("2006-01-02"), actual.Format("15:04 MST"), expected)
+	}
+}
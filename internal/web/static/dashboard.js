@@ -0,0 +1,44 @@
+// Refreshes the readings on the area cards without reloading the page
+(function () {
+
+	var interval = 30000;
+
+	function refresh() {
+
+		fetch('/readings', {credentials: 'same-origin', headers: {'Accept': 'application/json'}})
+			.then(function (response) {
+				if (!response.ok) {
+					throw new Error(response.statusText);
+				}
+				return response.json();
+			})
+			.then(function (areas) {
+				Object.keys(areas).forEach(function (id) {
+
+					var card = document.querySelector('.card[data-area="' + id + '"]');
+
+					if (!card) {
+						return;
+					}
+
+					areas[id].forEach(function (reading) {
+
+						var value = card.querySelector('[data-measurement="' + reading.measurement + '"]');
+
+						if (!value || value.textContent === reading.text) {
+							return;
+						}
+
+						value.textContent = reading.text;
+						value.title = reading.date ? new Date(reading.date).toLocaleString() : '';
+						value.classList.add('updated');
+					});
+				});
+			})
+			.catch(function (error) {
+				console.warn('Unable to refresh readings', error);
+			});
+	}
+
+	setInterval(refresh, interval);
+})();
@@ -0,0 +1,570 @@
+// Package web serves the dashboard for browsers: area cards with their current readings, group and device
+// controls and a graph of every measurement. Pages are rendered with html/template and the templates, styles
+// and scripts are embedded in the binary, so the dashboard works without an internet connection.
+package web
+
+import (
+	"78concepts.com/domicile/internal/api"
+	"78concepts.com/domicile/internal/broker"
+	"78concepts.com/domicile/internal/model"
+	"78concepts.com/domicile/internal/service"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+//go:embed static
+var staticFiles embed.FS
+
+const (
+	defaultGraphHours = 24
+	lowBattery = 20
+	timeFormat = "2 Jan 15:04"
+)
+
+// Measurement is a kind of reading the dashboard shows, with the unit and precision it is displayed in
+type Measurement struct {
+	Name     string
+	Label    string
+	Unit     string
+	Decimals int
+}
+
+var measurements = []Measurement{
+	{Name: service.TemperatureMeasurement, Label: "Temperature", Unit: service.MeasurementUnits[service.TemperatureMeasurement], Decimals: 1},
+	{Name: service.HumidityMeasurement, Label: "Humidity", Unit: service.MeasurementUnits[service.HumidityMeasurement], Decimals: 0},
+	{Name: service.PressureMeasurement, Label: "Pressure", Unit: service.MeasurementUnits[service.PressureMeasurement], Decimals: 0},
+	{Name: service.IlluminanceMeasurement, Label: "Illuminance", Unit: service.MeasurementUnits[service.IlluminanceMeasurement], Decimals: 0},
+}
+
+type graphRange struct {
+	Hours int
+	Label string
+}
+
+// Ranges offered on graph pages, the longest is the most that can be asked for
+var graphRanges = []graphRange{{6, "6 hours"}, {24, "24 hours"}, {24 * 7, "7 days"}, {24 * 30, "30 days"}}
+
+// Values accepted by the state field of the control forms
+var controlStates = map[string]bool{"on": true, "off": true, "toggle": true}
+
+func NewWeb(
+	ctx context.Context,
+	client *broker.MqttClient,
+	devicesService *service.DevicesService,
+	groupsService *service.GroupsService,
+	areasService *service.AreasService,
+	reportsService *service.ReportsService,
+) *Web {
+	return &Web{
+		ctx: ctx,
+		client: client,
+		devicesService: devicesService,
+		groupsService: groupsService,
+		areasService: areasService,
+		reportsService: reportsService,
+		pages: map[string]*template.Template{
+			"dashboard": parsePage("dashboard"),
+			"devices": parsePage("devices"),
+			"graph": parsePage("graph"),
+			"error": parsePage("error"),
+		}}
+}
+
+type Web struct {
+	ctx context.Context
+	client *broker.MqttClient
+	devicesService *service.DevicesService
+	groupsService *service.GroupsService
+	areasService *service.AreasService
+	reportsService *service.ReportsService
+	pages map[string]*template.Template
+}
+
+// parsePage parses a page's template together with the layout it fills in
+func parsePage(name string) *template.Template {
+	return template.Must(template.New("layout.html").ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html"))
+}
+
+// Static serves the embedded styles and scripts, which hold no data and so need no authentication
+var Static = http.StripPrefix("/static/", http.FileServer(http.FS(mustSub(staticFiles, "static")))).ServeHTTP
+
+func mustSub(files fs.FS, dir string) fs.FS {
+
+	sub, err := fs.Sub(files, dir)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+// Reading is the latest value of a measurement in an area, formatted for display
+type Reading struct {
+	Measurement string `json:"measurement"`
+	Value       *float64 `json:"value"`
+	Text        string `json:"text"`
+	Date        *time.Time `json:"date"`
+}
+
+type areaCard struct {
+	Area     model.Area
+	Readings []Reading
+}
+
+type groupCard struct {
+	Group      model.Group
+	CanControl bool
+	Members    []memberRow
+}
+
+type memberRow struct {
+	Name  string
+	State string
+}
+
+type deviceRow struct {
+	Device       model.Device
+	Area         string
+	Battery      string
+	LowBattery   bool
+	LastSeen     string
+	Availability string
+	State        string
+	CanControl   bool
+}
+
+// Dashboard shows a card with the current readings of every area the caller may view and the groups they may
+// view, with on and off buttons for those they may control
+func (a *Web) Dashboard(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /")
+
+	areas, err := a.visibleAreas(r)
+
+	if err != nil {
+		a.renderError(w, http.StatusInternalServerError, "Unable to list areas")
+		return
+	}
+
+	readings, err := a.readings(areas)
+
+	if err != nil {
+		a.renderError(w, http.StatusInternalServerError, "Unable to load the current readings")
+		return
+	}
+
+	cards := make([]areaCard, 0, len(areas))
+	for _, area := range areas {
+		cards = append(cards, areaCard{Area: area, Readings: readings[area.Id]})
+	}
+
+	groups, err := a.groupsService.GetGroups(a.ctx)
+
+	if err != nil {
+		a.renderError(w, http.StatusInternalServerError, "Unable to list groups")
+		return
+	}
+
+	ctx := api.CommandContext(a.ctx, r)
+	control := model.ScopeAllows(api.PrincipalFromRequest(r).Scope, model.ScopeControl)
+
+	groupCards := make([]groupCard, 0, len(groups))
+	for i := range groups {
+
+		if a.groupsService.CheckGroupAccess(ctx, &groups[i], model.RoleView) != nil {
+			continue
+		}
+
+		card := groupCard{
+			Group: groups[i],
+			CanControl: control && len(groups[i].Members) > 0 && a.groupsService.CheckGroupAccess(ctx, &groups[i], model.RoleControl) == nil}
+
+		for _, member := range groups[i].Members {
+			card.Members = append(card.Members, memberRow{Name: member.FriendlyName, State: a.stateText(member.IeeeAddress)})
+		}
+
+		groupCards = append(groupCards, card)
+	}
+
+	a.render(w, "dashboard", map[string]interface{}{
+		"Title": "Dashboard",
+		"Areas": cards,
+		"Groups": groupCards,
+		"Measurements": measurements,
+	})
+}
+
+// Readings returns the current readings of the areas the caller may view, keyed by area id, for the dashboard
+// to refresh its cards with
+func (a *Web) Readings(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /readings")
+
+	areas, err := a.visibleAreas(r)
+
+	if err != nil {
+		http.Error(w, "Unable to list areas", http.StatusInternalServerError)
+		return
+	}
+
+	readings, err := a.readings(areas)
+
+	if err != nil {
+		http.Error(w, "Unable to load the current readings", http.StatusInternalServerError)
+		return
+	}
+
+	byArea := make(map[string][]Reading, len(readings))
+	for id, areaReadings := range readings {
+		byArea[strconv.FormatUint(id, 10)] = areaReadings
+	}
+
+	data, _ := json.Marshal(byArea)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// Devices lists the devices the caller may view with their battery, last seen time and availability
+func (a *Web) Devices(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /devices")
+
+	devices, err := a.devicesService.GetDevices(a.ctx)
+
+	if err != nil {
+		a.renderError(w, http.StatusInternalServerError, "Unable to list devices")
+		return
+	}
+
+	areas, err := a.areasService.GetAreas(a.ctx)
+
+	if err != nil {
+		a.renderError(w, http.StatusInternalServerError, "Unable to list areas")
+		return
+	}
+
+	areaNames := make(map[uint64]string, len(areas))
+	for _, area := range areas {
+		areaNames[area.Id] = area.Name
+	}
+
+	access := api.AccessFromRequest(r)
+	control := model.ScopeAllows(api.PrincipalFromRequest(r).Scope, model.ScopeControl)
+
+	rows := make([]deviceRow, 0, len(devices))
+	for _, device := range devices {
+
+		if !access.Allows(device.AreaId, model.RoleView) {
+			continue
+		}
+
+		row := deviceRow{Device: device, Battery: "-", LastSeen: "-", Availability: "Unknown", State: a.stateText(device.IeeeAddress)}
+
+		if device.AreaId != nil {
+			row.Area = areaNames[*device.AreaId]
+		}
+
+		if device.Battery != nil {
+			row.Battery = strconv.Itoa(int(*device.Battery)) + "%"
+			row.LowBattery = *device.Battery < lowBattery
+		}
+
+		if device.LastSeen != nil {
+			row.LastSeen = device.LastSeen.Local().Format(timeFormat)
+		}
+
+		if available := a.devicesService.GetDeviceAvailability(device.IeeeAddress); !device.Active {
+			row.Availability = "Removed"
+		} else if available != nil && *available {
+			row.Availability = "Online"
+		} else if available != nil {
+			row.Availability = "Offline"
+		}
+
+		// Only devices that have reported an on/off state can be switched from the list
+		row.CanControl = control && device.Active && row.State != "" && access.Allows(device.AreaId, model.RoleControl)
+
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Area != rows[j].Area {
+			return rows[i].Area < rows[j].Area
+		}
+		return strings.ToLower(rows[i].Device.FriendlyName) < strings.ToLower(rows[j].Device.FriendlyName)
+	})
+
+	a.render(w, "devices", map[string]interface{}{
+		"Title": "Devices",
+		"Devices": rows,
+	})
+}
+
+// Graph shows an area's readings of a measurement over the last ?hours=, as a whole or by ?series=device, with
+// the chart drawn by the graphs api
+func (a *Web) Graph(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET " + r.URL.Path + "?" + r.URL.RawQuery)
+
+	measurement, ok := findMeasurement(mux.Vars(r)["measurement"])
+
+	if !ok {
+		a.renderError(w, http.StatusNotFound, "Unknown measurement")
+		return
+	}
+
+	id, _ := strconv.ParseUint(mux.Vars(r)["area"], 10, 64)
+	area, err := a.areasService.GetAreaById(a.ctx, id)
+
+	if area == nil || err != nil || !api.AccessFromRequest(r).Allows(&area.Id, model.RoleView) {
+		a.renderError(w, http.StatusNotFound, "Area not found")
+		return
+	}
+
+	hours := defaultGraphHours
+	if value := r.URL.Query().Get("hours"); value != "" {
+		if hours, err = strconv.Atoi(value); err != nil || hours <= 0 || hours > graphRanges[len(graphRanges)-1].Hours {
+			a.renderError(w, http.StatusBadRequest, "hours must be between 1 and "+strconv.Itoa(graphRanges[len(graphRanges)-1].Hours))
+			return
+		}
+	}
+
+	series := "area"
+	if r.URL.Query().Get("series") == "device" {
+		series = "device"
+	}
+
+	a.render(w, "graph", map[string]interface{}{
+		"Title": area.Name + " " + strings.ToLower(measurement.Label),
+		"Area": area,
+		"Measurement": measurement,
+		"Measurements": measurements,
+		"Hours": hours,
+		"Ranges": graphRanges,
+		"Series": series,
+	})
+}
+
+// LegacyGraph sends links to the old /graphs?area=<uuid>&type=<measurement> page to the new graph page
+func (a *Web) LegacyGraph(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: GET /graphs?" + r.URL.RawQuery)
+
+	id, _ := uuid.FromString(r.URL.Query().Get("area"))
+	area, err := a.areasService.GetArea(a.ctx, id)
+
+	if area == nil || err != nil || !api.AccessFromRequest(r).Allows(&area.Id, model.RoleView) {
+		a.renderError(w, http.StatusNotFound, "Area not found")
+		return
+	}
+
+	measurement := r.URL.Query().Get("type")
+	if measurement == "" {
+		measurement = service.TemperatureMeasurement
+	}
+
+	http.Redirect(w, r, "/graphs/"+strconv.FormatUint(area.Id, 10)+"/"+url.PathEscape(measurement), http.StatusMovedPermanently)
+}
+
+// SetGroupState switches a group on, off or over from the dashboard's form. Forms rely on the session cookie
+// being SameSite=Lax, which browsers leave off POSTs from other sites.
+func (a *Web) SetGroupState(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST " + r.URL.Path)
+
+	state := r.PostFormValue("state")
+
+	if !controlStates[state] {
+		a.renderError(w, http.StatusBadRequest, "state must be on, off or toggle")
+		return
+	}
+
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	group, err := a.groupsService.GetGroup(a.ctx, id)
+
+	ctx := api.CommandContext(a.ctx, r)
+
+	if group == nil || err != nil || a.groupsService.CheckGroupAccess(ctx, group, model.RoleView) != nil {
+		a.renderError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
+	if err := a.groupsService.SetGroupState(ctx, a.client, group, map[string]interface{}{"state": state}); err != nil {
+		a.renderCommandError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// SetDeviceState switches a device on, off or over from the device list's form, see SetGroupState
+func (a *Web) SetDeviceState(w http.ResponseWriter, r *http.Request) {
+
+	log.Println("Endpoint hit: POST " + r.URL.Path)
+
+	state := r.PostFormValue("state")
+
+	if !controlStates[state] {
+		a.renderError(w, http.StatusBadRequest, "state must be on, off or toggle")
+		return
+	}
+
+	device, err := a.devicesService.GetDevice(a.ctx, mux.Vars(r)["ieee"])
+
+	if device == nil || err != nil || !api.AccessFromRequest(r).Allows(device.AreaId, model.RoleView) {
+		a.renderError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	if err := a.devicesService.SetDeviceState(api.CommandContext(a.ctx, r), a.client, device, map[string]interface{}{"state": state}); err != nil {
+		a.renderCommandError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/devices", http.StatusSeeOther)
+}
+
+// visibleAreas returns the areas the caller may view, by name
+func (a *Web) visibleAreas(r *http.Request) ([]model.Area, error) {
+
+	areas, err := a.areasService.GetAreas(a.ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	access := api.AccessFromRequest(r)
+
+	visible := make([]model.Area, 0, len(areas))
+	for _, area := range areas {
+		if access.Allows(&area.Id, model.RoleView) {
+			visible = append(visible, area)
+		}
+	}
+
+	sort.SliceStable(visible, func(i, j int) bool {
+		return visible[i].Name < visible[j].Name
+	})
+
+	return visible, nil
+}
+
+// readings loads the latest value of every measurement in the areas with one query per measurement
+func (a *Web) readings(areas []model.Area) (map[uint64][]Reading, error) {
+
+	readings := make(map[uint64][]Reading, len(areas))
+
+	if len(areas) == 0 {
+		return readings, nil
+	}
+
+	ids := make([]uint64, 0, len(areas))
+	for _, area := range areas {
+		ids = append(ids, area.Id)
+	}
+
+	for _, measurement := range measurements {
+
+		reports, err := a.reportsService.GetLatestAreaReports(a.ctx, measurement.Name, ids)
+
+		if err != nil {
+			return nil, err
+		}
+
+		latest := make(map[uint64]model.Report, len(reports))
+		for _, report := range reports {
+			latest[report.AreaId] = report
+		}
+
+		for _, id := range ids {
+
+			reading := Reading{Measurement: measurement.Name, Text: "-"}
+
+			if report, ok := latest[id]; ok {
+				value, date := report.Value, report.Date
+				reading.Value = &value
+				reading.Date = &date
+				reading.Text = strconv.FormatFloat(value, 'f', measurement.Decimals, 64) + " " + measurement.Unit
+			}
+
+			readings[id] = append(readings[id], reading)
+		}
+	}
+
+	return readings, nil
+}
+
+// stateText is the on/off state a device last reported, empty if it has not reported one
+func (a *Web) stateText(ieeeAddress string) string {
+
+	state := a.devicesService.GetDeviceState(ieeeAddress)
+
+	if state == nil {
+		return ""
+	}
+
+	value, _ := state.State["state"].(string)
+
+	return strings.ToUpper(value)
+}
+
+func findMeasurement(name string) (Measurement, bool) {
+
+	for _, measurement := range measurements {
+		if measurement.Name == name {
+			return measurement, true
+		}
+	}
+
+	return Measurement{}, false
+}
+
+func (a *Web) render(w http.ResponseWriter, page string, data map[string]interface{}) {
+	a.renderStatus(w, http.StatusOK, page, data)
+}
+
+func (a *Web) renderStatus(w http.ResponseWriter, status int, page string, data map[string]interface{}) {
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := a.pages[page].Execute(w, data); err != nil {
+		log.Println("Unable to render", page, err)
+	}
+}
+
+func (a *Web) renderError(w http.ResponseWriter, status int, message string) {
+	a.renderStatus(w, status, "error", map[string]interface{}{"Title": http.StatusText(status), "Status": status, "Message": message})
+}
+
+// renderCommandError answers a command the caller may not send with a 403 and one the broker failed to send
+// with a 502
+func (a *Web) renderCommandError(w http.ResponseWriter, err error) {
+
+	if errors.Is(err, service.ErrForbidden) {
+		a.renderError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	a.renderError(w, http.StatusBadGateway, err.Error())
+}
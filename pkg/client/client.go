@@ -0,0 +1,220 @@
+// Package client calls domicile's versioned api, /api/v1, for the devices, groups, areas, reports and commands
+// described in its OpenAPI document.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1"
+
+// Error is the error envelope the api answers failed requests with
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("domicile: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// NewClient returns a client for the domicile at baseUrl, e.g. https://domicile.local:8443, authenticating with an api key
+func NewClient(baseUrl string, apiKey string) *Client {
+	return &Client{baseUrl: strings.TrimSuffix(baseUrl, "/"), apiKey: apiKey, HttpClient: http.DefaultClient}
+}
+
+type Client struct {
+	baseUrl string
+	apiKey string
+	// HttpClient sends the requests, replace it to set timeouts or trust a self-signed CA
+	HttpClient *http.Client
+}
+
+func (c *Client) ListDevices(ctx context.Context, areaId *uint64, options PageOptions) (*DevicePage, error) {
+
+	query := pageQuery(options)
+
+	if areaId != nil {
+		query.Set("area", strconv.FormatUint(*areaId, 10))
+	}
+
+	var page DevicePage
+	err := c.do(ctx, http.MethodGet, "/devices", query, nil, &page)
+
+	return &page, err
+}
+
+func (c *Client) GetDevice(ctx context.Context, ieeeAddress string) (*Device, error) {
+
+	var device Device
+	err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(ieeeAddress), nil, nil, &device)
+
+	return &device, err
+}
+
+// SetDeviceArea moves a device into an area, or out of any area when areaId is nil
+func (c *Client) SetDeviceArea(ctx context.Context, ieeeAddress string, areaId *uint64) (*Device, error) {
+
+	body := map[string]*uint64{"areaId": areaId}
+
+	var device Device
+	err := c.do(ctx, http.MethodPut, "/devices/"+url.PathEscape(ieeeAddress)+"/area", nil, body, &device)
+
+	return &device, err
+}
+
+// SendDeviceCommand publishes a set payload to a device, the device reports its new state asynchronously
+func (c *Client) SendDeviceCommand(ctx context.Context, ieeeAddress string, command Command) error {
+	return c.do(ctx, http.MethodPost, "/devices/"+url.PathEscape(ieeeAddress)+"/commands", nil, command, nil)
+}
+
+func (c *Client) ListGroups(ctx context.Context, options PageOptions) (*GroupPage, error) {
+
+	var page GroupPage
+	err := c.do(ctx, http.MethodGet, "/groups", pageQuery(options), nil, &page)
+
+	return &page, err
+}
+
+func (c *Client) GetGroup(ctx context.Context, id uint64) (*Group, error) {
+
+	var group Group
+	err := c.do(ctx, http.MethodGet, "/groups/"+strconv.FormatUint(id, 10), nil, nil, &group)
+
+	return &group, err
+}
+
+// SendGroupCommand publishes a set payload to every device in a group
+func (c *Client) SendGroupCommand(ctx context.Context, id uint64, command Command) error {
+	return c.do(ctx, http.MethodPost, "/groups/"+strconv.FormatUint(id, 10)+"/commands", nil, command, nil)
+}
+
+func (c *Client) ListAreas(ctx context.Context, options PageOptions) (*AreaPage, error) {
+
+	var page AreaPage
+	err := c.do(ctx, http.MethodGet, "/areas", pageQuery(options), nil, &page)
+
+	return &page, err
+}
+
+func (c *Client) GetArea(ctx context.Context, id uint64) (*Area, error) {
+
+	var area Area
+	err := c.do(ctx, http.MethodGet, "/areas/"+strconv.FormatUint(id, 10), nil, nil, &area)
+
+	return &area, err
+}
+
+// ListAreaReports returns an area's readings of temperature, humidity, pressure or illuminance, oldest first
+func (c *Client) ListAreaReports(ctx context.Context, areaId uint64, measurement string, options ReportOptions) (*ReportPage, error) {
+
+	query := pageQuery(options.PageOptions)
+
+	if !options.Start.IsZero() {
+		query.Set("start", options.Start.Format(time.RFC3339))
+	}
+
+	if !options.End.IsZero() {
+		query.Set("end", options.End.Format(time.RFC3339))
+	}
+
+	var page ReportPage
+	err := c.do(ctx, http.MethodGet, "/areas/"+strconv.FormatUint(areaId, 10)+"/reports/"+url.PathEscape(measurement), query, nil, &page)
+
+	return &page, err
+}
+
+// ListCommands returns the commands sent to devices and groups, newest first. It needs an admin api key.
+func (c *Client) ListCommands(ctx context.Context, options PageOptions) (*CommandPage, error) {
+
+	var page CommandPage
+	err := c.do(ctx, http.MethodGet, "/commands", pageQuery(options), nil, &page)
+
+	return &page, err
+}
+
+func pageQuery(options PageOptions) url.Values {
+
+	query := url.Values{}
+
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+
+	if options.Offset > 0 {
+		query.Set("offset", strconv.Itoa(options.Offset))
+	}
+
+	return query
+}
+
+// do sends a request to the api, encoding body and decoding the response into out when they are not nil.
+// Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+
+	target := c.baseUrl + apiPrefix + path
+
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.HttpClient.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+
+		var envelope struct {
+			Error *Error `json:"error"`
+		}
+
+		if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil || envelope.Error == nil {
+			return &Error{Status: response.StatusCode, Code: "unexpected_response", Message: response.Status}
+		}
+
+		return envelope.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(out)
+}
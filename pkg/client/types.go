@@ -0,0 +1,134 @@
+package client
+
+import "time"
+
+// The types mirror the schemas of the OpenAPI document served at /api/v1/openapi.json
+
+type Device struct {
+	IeeeAddress     string     `json:"ieeeAddr"`
+	DateCreated     time.Time  `json:"dateCreated"`
+	DateModified    time.Time  `json:"dateModified"`
+	DateCode        *string    `json:"dateCode"`
+	FriendlyName    string     `json:"friendlyName"`
+	AreaId          *uint64    `json:"areaId"`
+	Description     *string    `json:"description"`
+	Manufacturer    *string    `json:"manufacturerName"`
+	Model           *string    `json:"model"`
+	ModelId         *string    `json:"modelID"`
+	LastSeen        *time.Time `json:"lastSeen"`
+	Vendor          *string    `json:"vendor"`
+	Type            *string    `json:"type"`
+	Battery         *float32   `json:"battery"`
+	Active          bool       `json:"active"`
+	LinkQuality     *int       `json:"linkQuality"`
+	SoftwareBuildId *string    `json:"softwareBuildId"`
+	UpdateState     *string    `json:"updateState"`
+	UpdateProgress  *float64   `json:"updateProgress"`
+	UpdateRemaining *int       `json:"updateRemaining"`
+}
+
+type Group struct {
+	Id           uint64        `json:"id"`
+	DateCreated  time.Time     `json:"dateCreated"`
+	DateModified time.Time     `json:"dateModified"`
+	FriendlyName string        `json:"friendlyName"`
+	Active       bool          `json:"active"`
+	Members      []GroupMember `json:"members"`
+}
+
+type GroupMember struct {
+	GroupId      uint64  `json:"groupId"`
+	IeeeAddress  string  `json:"ieeeAddress"`
+	FriendlyName string  `json:"friendlyName"`
+	AreaId       *uint64 `json:"areaId"`
+}
+
+type Area struct {
+	Id          uint64    `json:"id"`
+	Uuid        string    `json:"uuid"`
+	DateCreated time.Time `json:"dateCreated"`
+	Name        string    `json:"name"`
+	ParentId    *uint64   `json:"parentId"`
+}
+
+// Report is a reading of a measurement, illuminance is in lux
+type Report struct {
+	DeviceId    string    `json:"ieeeAddr"`
+	AreaId      uint64    `json:"areaId"`
+	Measurement string    `json:"measurement"`
+	Date        time.Time `json:"date"`
+	Value       float64   `json:"value"`
+}
+
+// Command is a zigbee2mqtt set payload, e.g. {"state": "on", "brightness": 120}
+type Command map[string]interface{}
+
+// CommandEntry is a command sent to a device or group, as recorded in the audit log
+type CommandEntry struct {
+	Id        uint64      `json:"id"`
+	Date      time.Time   `json:"date"`
+	Direction string      `json:"direction"`
+	Action    string      `json:"action"`
+	Target    string      `json:"target"`
+	Payload   interface{} `json:"payload"`
+	Origin    Origin      `json:"origin"`
+	Outcome   string      `json:"outcome"`
+	Error     *string     `json:"error"`
+}
+
+// Origin says who or what sent a command
+type Origin struct {
+	Type   string  `json:"type"`
+	Id     *string `json:"id"`
+	Client *string `json:"client"`
+}
+
+// PageOptions selects a page of a list, zero values use the server's defaults
+type PageOptions struct {
+	Limit  int
+	Offset int
+}
+
+// ReportOptions selects the readings between Start and End, zero values are the last 24 hours
+type ReportOptions struct {
+	PageOptions
+	Start time.Time
+	End   time.Time
+}
+
+// Each page carries the url of the next one in Next, nil on the last page
+
+type DevicePage struct {
+	Items  []Device `json:"items"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+	Next   *string  `json:"next"`
+}
+
+type GroupPage struct {
+	Items  []Group `json:"items"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+	Next   *string `json:"next"`
+}
+
+type AreaPage struct {
+	Items  []Area  `json:"items"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+	Next   *string `json:"next"`
+}
+
+type ReportPage struct {
+	Items  []Report `json:"items"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+	Next   *string  `json:"next"`
+}
+
+type CommandPage struct {
+	Items  []CommandEntry `json:"items"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+	Next   *string        `json:"next"`
+}
@@ -10,7 +10,12 @@ CREATE TABLE devices (
      last_seen timestamp with time zone null,
      type varchar(64) not null,
      battery numeric null,
-     active bool not null
+     active bool not null,
+     link_quality integer null,
+     software_build_id varchar(64) null,
+     update_state varchar(24) null,
+     update_progress numeric null,
+     update_remaining integer null
 );
 
 ALTER TABLE devices ADD PRIMARY KEY (ieee_address);
@@ -19,7 +24,8 @@ CREATE TABLE areas (
    id serial not null,
    uuid uuid not null,
    date_created timestamp with time zone not null,
-   name varchar(255) not null
+   name varchar(255) not null,
+   parent_id bigint null references areas(id)
 );
 
 
@@ -72,4 +78,235 @@ CREATE TABLE groups_devices (
     ieee_address varchar(24) not null
 );
 
-ALTER TABLE groups_devices ADD PRIMARY KEY (group_id, ieee_address);
\ No newline at end of file
+ALTER TABLE groups_devices ADD PRIMARY KEY (group_id, ieee_address);
+
+CREATE TABLE automations (
+    id serial not null,
+    date_created timestamp with time zone not null,
+    date_modified timestamp with time zone not null,
+    name varchar(255) not null,
+    enabled bool not null,
+    triggers jsonb not null,
+    conditions jsonb not null,
+    actions jsonb not null,
+    owner_id bigint null
+);
+
+ALTER TABLE automations ADD PRIMARY KEY (id);
+
+CREATE TABLE automation_logs (
+    id serial not null,
+    automation_id bigint not null references automations(id) on delete cascade,
+    date timestamp with time zone not null,
+    trigger text not null,
+    status varchar(24) not null,
+    message text null
+);
+
+ALTER TABLE automation_logs ADD PRIMARY KEY (id);
+CREATE INDEX automation_logs_automation_id_date ON automation_logs (automation_id, date);
+
+CREATE TABLE schedules (
+    id serial not null,
+    date_created timestamp with time zone not null,
+    date_modified timestamp with time zone not null,
+    name varchar(255) not null,
+    enabled bool not null,
+    type varchar(24) not null,
+    cron varchar(255) null,
+    offset_minutes integer not null default 0,
+    weekdays integer[] not null default '{}',
+    target_type varchar(24) not null,
+    ieee_address varchar(24) null references devices(ieee_address),
+    group_id numeric null references groups(id),
+    payload jsonb not null,
+    missed_run varchar(24) not null,
+    last_run timestamp with time zone null,
+    next_run timestamp with time zone null,
+    owner_id bigint null
+);
+
+ALTER TABLE schedules ADD PRIMARY KEY (id);
+
+CREATE TABLE scenes (
+    id serial not null,
+    date_created timestamp with time zone not null,
+    date_modified timestamp with time zone not null,
+    name varchar(255) not null,
+    area_id bigint null references areas(id),
+    group_id numeric null references groups(id),
+    native_scene_id integer null
+);
+
+ALTER TABLE scenes ADD PRIMARY KEY (id);
+
+CREATE TABLE scenes_devices (
+    scene_id bigint not null references scenes(id) on delete cascade,
+    ieee_address varchar(24) not null references devices(ieee_address),
+    state jsonb not null
+);
+
+ALTER TABLE scenes_devices ADD PRIMARY KEY (scene_id, ieee_address);
+
+CREATE TABLE alert_rules (
+    id serial not null,
+    date_created timestamp with time zone not null,
+    date_modified timestamp with time zone not null,
+    name varchar(255) not null,
+    enabled bool not null,
+    type varchar(24) not null,
+    measurement varchar(24) null,
+    area_id bigint null references areas(id),
+    ieee_address varchar(24) null references devices(ieee_address),
+    operator varchar(8) not null,
+    threshold numeric not null,
+    hysteresis numeric not null default 0,
+    for_minutes integer not null default 0,
+    channels text[] not null default '{}'
+);
+
+ALTER TABLE alert_rules ADD PRIMARY KEY (id);
+
+CREATE TABLE alerts (
+    id serial not null,
+    rule_id bigint not null references alert_rules(id) on delete cascade,
+    ieee_address varchar(24) not null references devices(ieee_address),
+    state varchar(24) not null,
+    value numeric not null,
+    date_fired timestamp with time zone not null,
+    date_resolved timestamp with time zone null
+);
+
+ALTER TABLE alerts ADD PRIMARY KEY (id);
+CREATE UNIQUE INDEX alerts_firing ON alerts (rule_id, ieee_address) WHERE state = 'firing';
+
+CREATE TABLE battery_reports (
+     device_id varchar(24) not null references devices(ieee_address),
+     date timestamp with time zone not null,
+     battery numeric not null,
+     voltage numeric null
+);
+
+CREATE INDEX battery_reports_device_id_date ON battery_reports (device_id, date);
+
+CREATE TABLE battery_replacements (
+     device_id varchar(24) not null references devices(ieee_address),
+     date timestamp with time zone not null,
+     previous_battery numeric not null,
+     battery numeric not null
+);
+
+CREATE INDEX battery_replacements_device_id_date ON battery_replacements (device_id, date);
+
+CREATE TABLE bridge (
+    id integer not null,
+    date_modified timestamp with time zone not null,
+    state varchar(24) not null,
+    version varchar(64) null,
+    commit varchar(64) null,
+    coordinator_type varchar(64) null,
+    coordinator_ieee_address varchar(24) null,
+    channel integer null,
+    pan_id integer null,
+    permit_join bool not null default false
+);
+
+ALTER TABLE bridge ADD PRIMARY KEY (id);
+
+CREATE TABLE bridge_events (
+    id serial not null,
+    date timestamp with time zone not null,
+    type varchar(64) not null,
+    ieee_address varchar(24) null,
+    friendly_name varchar(255) null,
+    data jsonb not null
+);
+
+ALTER TABLE bridge_events ADD PRIMARY KEY (id);
+CREATE INDEX bridge_events_date ON bridge_events (date);
+
+CREATE TABLE network_maps (
+    id serial not null,
+    date timestamp with time zone not null,
+    nodes jsonb not null,
+    links jsonb not null
+);
+
+ALTER TABLE network_maps ADD PRIMARY KEY (id);
+CREATE INDEX network_maps_date ON network_maps (date);
+
+CREATE TABLE firmware_history (
+    device_id varchar(24) not null references devices(ieee_address),
+    date timestamp with time zone not null,
+    previous_software_build_id varchar(64) null,
+    previous_date_code varchar(24) null,
+    software_build_id varchar(64) null,
+    date_code varchar(24) null
+);
+
+CREATE INDEX firmware_history_device_id_date ON firmware_history (device_id, date);
+
+CREATE TABLE audit_log (
+    id serial not null,
+    date timestamp with time zone not null,
+    direction varchar(24) not null,
+    action varchar(64) not null,
+    target varchar(255) not null,
+    payload jsonb null,
+    origin_type varchar(24) not null,
+    origin_id varchar(255) null,
+    origin_client varchar(255) null,
+    outcome varchar(24) not null,
+    error text null
+);
+
+ALTER TABLE audit_log ADD PRIMARY KEY (id);
+CREATE INDEX audit_log_date ON audit_log (date);
+CREATE INDEX audit_log_target_date ON audit_log (target, date);
+
+CREATE TABLE users (
+    id serial not null,
+    date_created timestamp with time zone not null,
+    username varchar(255) not null,
+    password_hash varchar(255) not null,
+    scope varchar(24) not null,
+    date_last_seen timestamp with time zone null
+);
+
+ALTER TABLE users ADD PRIMARY KEY (id);
+ALTER TABLE users ADD UNIQUE (username);
+
+CREATE TABLE sessions (
+    token_hash varchar(64) not null,
+    user_id bigint not null references users(id) on delete cascade,
+    date_created timestamp with time zone not null,
+    date_expires timestamp with time zone not null
+);
+
+ALTER TABLE sessions ADD PRIMARY KEY (token_hash);
+
+CREATE TABLE api_keys (
+    id serial not null,
+    date_created timestamp with time zone not null,
+    name varchar(255) not null,
+    prefix varchar(24) not null,
+    key_hash varchar(64) not null,
+    scope varchar(24) not null,
+    date_last_used timestamp with time zone null
+);
+
+ALTER TABLE api_keys ADD PRIMARY KEY (id);
+ALTER TABLE api_keys ADD UNIQUE (key_hash);
+
+CREATE TABLE area_roles (
+    user_id bigint not null references users(id) on delete cascade,
+    area_id bigint not null references areas(id) on delete cascade,
+    date_created timestamp with time zone not null,
+    role varchar(24) not null
+);
+
+ALTER TABLE area_roles ADD PRIMARY KEY (user_id, area_id);
+
+-- Automations and schedules run with the area access of the user who last saved them; deleting the user disables them
+ALTER TABLE automations ADD FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE schedules ADD FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL;